@@ -13,11 +13,11 @@ echo ""
 
 # macOS - Intel (amd64)
 echo "Building for macOS (Intel/amd64)..."
-GOOS=darwin GOARCH=amd64 go build -ldflags="-s -w" -o "$DIST_DIR/xentz-agent-darwin-amd64" ./cmd/xentz-agent
+GOOS=darwin GOARCH=amd64 go build -ldflags="-s -w -X xentz-agent/internal/version.Version=$VERSION" -o "$DIST_DIR/xentz-agent-darwin-amd64" ./cmd/xentz-agent
 
 # macOS - Apple Silicon (arm64)
 echo "Building for macOS (Apple Silicon/arm64)..."
-GOOS=darwin GOARCH=arm64 go build -ldflags="-s -w" -o "$DIST_DIR/xentz-agent-darwin-arm64" ./cmd/xentz-agent
+GOOS=darwin GOARCH=arm64 go build -ldflags="-s -w -X xentz-agent/internal/version.Version=$VERSION" -o "$DIST_DIR/xentz-agent-darwin-arm64" ./cmd/xentz-agent
 
 # macOS - Universal binary (works on both Intel and Apple Silicon)
 echo "Building for macOS (Universal binary)..."
@@ -32,28 +32,50 @@ fi
 
 # Windows - amd64
 echo "Building for Windows (amd64)..."
-GOOS=windows GOARCH=amd64 go build -ldflags="-s -w" -o "$DIST_DIR/xentz-agent-windows-amd64.exe" ./cmd/xentz-agent
+GOOS=windows GOARCH=amd64 go build -ldflags="-s -w -X xentz-agent/internal/version.Version=$VERSION" -o "$DIST_DIR/xentz-agent-windows-amd64.exe" ./cmd/xentz-agent
 
 # Windows - arm64 (Windows on ARM)
 echo "Building for Windows (arm64)..."
-GOOS=windows GOARCH=arm64 go build -ldflags="-s -w" -o "$DIST_DIR/xentz-agent-windows-arm64.exe" ./cmd/xentz-agent
+GOOS=windows GOARCH=arm64 go build -ldflags="-s -w -X xentz-agent/internal/version.Version=$VERSION" -o "$DIST_DIR/xentz-agent-windows-arm64.exe" ./cmd/xentz-agent
 
 # Linux - amd64
 echo "Building for Linux (amd64)..."
-GOOS=linux GOARCH=amd64 go build -ldflags="-s -w" -o "$DIST_DIR/xentz-agent-linux-amd64" ./cmd/xentz-agent
+GOOS=linux GOARCH=amd64 go build -ldflags="-s -w -X xentz-agent/internal/version.Version=$VERSION" -o "$DIST_DIR/xentz-agent-linux-amd64" ./cmd/xentz-agent
 
 # Linux - arm64
 echo "Building for Linux (arm64)..."
-GOOS=linux GOARCH=arm64 go build -ldflags="-s -w" -o "$DIST_DIR/xentz-agent-linux-arm64" ./cmd/xentz-agent
+GOOS=linux GOARCH=arm64 go build -ldflags="-s -w -X xentz-agent/internal/version.Version=$VERSION" -o "$DIST_DIR/xentz-agent-linux-arm64" ./cmd/xentz-agent
 
 # Linux - ARMv7 (32-bit, for Raspberry Pi and older ARM devices)
 echo "Building for Linux (ARMv7)..."
-GOOS=linux GOARCH=arm GOARM=7 go build -ldflags="-s -w" -o "$DIST_DIR/xentz-agent-linux-armv7" ./cmd/xentz-agent
+GOOS=linux GOARCH=arm GOARM=7 go build -ldflags="-s -w -X xentz-agent/internal/version.Version=$VERSION" -o "$DIST_DIR/xentz-agent-linux-armv7" ./cmd/xentz-agent
 
-# FreeBSD - amd64 (optional, for completeness)
-if command -v go &> /dev/null && go env GOOS | grep -q darwin; then
-    echo "Building for FreeBSD (amd64)..."
-    GOOS=freebsd GOARCH=amd64 go build -ldflags="-s -w" -o "$DIST_DIR/xentz-agent-freebsd-amd64" ./cmd/xentz-agent || echo "  ⚠ FreeBSD build skipped (may require cross-compilation tools)"
+# FreeBSD - amd64
+echo "Building for FreeBSD (amd64)..."
+GOOS=freebsd GOARCH=amd64 go build -ldflags="-s -w -X xentz-agent/internal/version.Version=$VERSION" -o "$DIST_DIR/xentz-agent-freebsd-amd64" ./cmd/xentz-agent
+
+# FreeBSD - arm64
+echo "Building for FreeBSD (arm64)..."
+GOOS=freebsd GOARCH=arm64 go build -ldflags="-s -w -X xentz-agent/internal/version.Version=$VERSION" -o "$DIST_DIR/xentz-agent-freebsd-arm64" ./cmd/xentz-agent
+
+# OpenBSD - amd64
+echo "Building for OpenBSD (amd64)..."
+GOOS=openbsd GOARCH=amd64 go build -ldflags="-s -w -X xentz-agent/internal/version.Version=$VERSION" -o "$DIST_DIR/xentz-agent-openbsd-amd64" ./cmd/xentz-agent
+
+# Checksums, verified by the installers before a binary is run
+echo "Writing SHA256SUMS..."
+if command -v sha256sum &> /dev/null; then
+    (cd "$DIST_DIR" && sha256sum xentz-agent-* > SHA256SUMS)
+else
+    (cd "$DIST_DIR" && shasum -a 256 xentz-agent-* > SHA256SUMS)
+fi
+
+# Sign the checksums (legacy, non-prehashed format, as the Go installer expects)
+if [ -n "$MINISIGN_KEY" ] && command -v minisign &> /dev/null; then
+    echo "Signing SHA256SUMS..."
+    minisign -S -l -s "$MINISIGN_KEY" -m "$DIST_DIR/SHA256SUMS"
+else
+    echo "  ⚠ MINISIGN_KEY not set or minisign not found, SHA256SUMS is unsigned"
 fi
 
 echo ""
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"xentz-agent/internal/backup"
+	"xentz-agent/internal/config"
+	"xentz-agent/internal/httpx"
+	"xentz-agent/internal/humanize"
+	"xentz-agent/internal/report"
+	"xentz-agent/internal/secret"
+)
+
+// doctorCheck is one line of the doctor checklist
+type doctorCheck struct {
+	name     string
+	ok       bool
+	critical bool
+	detail   string
+}
+
+// runDoctor performs read-only pre-flight checks and prints a checklist.
+// It returns false if any critical check failed.
+func runDoctor(cfgFile string) bool {
+	var checks []doctorCheck
+	add := func(name string, ok, critical bool, detail string) {
+		checks = append(checks, doctorCheck{name: name, ok: ok, critical: critical, detail: detail})
+	}
+
+	// restic binary
+	resticPath, err := exec.LookPath("restic")
+	if err != nil {
+		add("restic installed", false, true, "restic not found in PATH (install restic first)")
+	} else {
+		v, semver, err := backup.ResticVersion(context.Background())
+		switch {
+		case err != nil:
+			add("restic installed", false, true, fmt.Sprintf("%s: %v", resticPath, err))
+		case !semver.AtLeast(backup.MinResticVersion):
+			add("restic installed", false, true, fmt.Sprintf("restic %s is too old (need %s or newer)", v, backup.MinResticVersion))
+		default:
+			add("restic installed", true, true, fmt.Sprintf("restic %s (%s)", v, resticPath))
+		}
+	}
+
+	// Config file
+	cfg, err := config.Read(cfgFile)
+	if err != nil {
+		add("config file", false, true, fmt.Sprintf("%s: %v", cfgFile, err))
+		return printDoctorChecks(checks)
+	}
+	add("config file", true, true, cfgFile)
+	configureSpool(cfg)
+
+	// TLS and proxy settings for control plane requests
+	if opts := httpOptions(cfg); opts != (httpx.Options{}) {
+		if err := httpx.Configure(opts); err != nil {
+			add("TLS/proxy settings", false, true, err.Error())
+		} else {
+			add("TLS/proxy settings", true, true, "CA bundle/client certificate/proxy loaded")
+		}
+	}
+
+	// Server URL and effective config (enrolled devices only)
+	if cfg.ServerURL != "" {
+		if err := httpx.ValidateServerURL(cfg.ServerURL); err != nil {
+			add("server URL", false, true, fmt.Sprintf("%s: %v", cfg.ServerURL, err))
+		} else {
+			add("server URL", true, true, cfg.ServerURL)
+		}
+	}
+	if cfg.DeviceAPIKey != "" && cfg.ServerURL != "" {
+		// FetchFromServer does not write the cache, so this stays read-only
+		fetched, err := config.FetchFromServer(cfg.ServerURL, cfg.DeviceAPIKey)
+		if err != nil {
+			add("server config", false, false, err.Error())
+			if cached, fetchedAt, cacheErr := config.ReadCachedAt(cfg.DeviceAPIKey); cacheErr == nil {
+				fetched = cached
+				err = nil
+				age, maxAge := time.Since(fetchedAt).Round(time.Minute), cmp.Or(cfg.CachePolicy().MaxAge, config.DefaultMaxCacheAge)
+				add("cached config", age <= maxAge, cfg.StrictCache, fmt.Sprintf("fetched %s ago (max %s)", age, maxAge))
+			}
+		} else {
+			add("server config", true, false, "fetched from control plane")
+		}
+		if err == nil {
+			restic := cfg.Restic
+			cfg = fetched
+			cfg.Restic.PasswordFile = restic.PasswordFile
+			cfg.Restic.PasswordSource = restic.PasswordSource
+			cfg.Restic.PasswordCommand = restic.PasswordCommand
+		}
+	}
+
+	// Reports waiting to be sent (they pile up while the control plane is unreachable)
+	if count, size, oldest, err := report.SpoolStats(); err != nil {
+		add("report spool", false, false, err.Error())
+	} else if count > 0 {
+		detail := fmt.Sprintf("%d pending report(s), %s, oldest from %s", count, humanize.Bytes(size), oldest.UTC().Format(time.RFC3339))
+		if report.SpoolNearFull(size) {
+			detail += fmt.Sprintf(" (nearly full, max %s)", humanize.Bytes(report.SpoolMaxBytes()))
+		}
+		add("report spool", !report.SpoolNearFull(size), false, detail)
+	}
+
+	// Include paths
+	if len(cfg.Include) == 0 {
+		add("include paths", false, true, "no include paths configured")
+	}
+	for _, path := range cfg.Include {
+		path = backup.ExpandPath(path)
+		f, err := os.Open(path)
+		if err != nil {
+			add("include path", false, true, fmt.Sprintf("%s: %v", path, err))
+			continue
+		}
+		f.Close()
+		add("include path", true, true, path)
+	}
+
+	// Password (keychain or file); the file is checked where restic will look for it
+	passwordOK := false
+	passwordFile := backup.PasswordFile(cfg)
+	if os.Getenv("RESTIC_PASSWORD") != "" {
+		passwordOK = true
+		add("password (env)", true, true, "RESTIC_PASSWORD is set")
+	} else if len(cfg.Restic.PasswordCommand) > 0 {
+		if _, err := exec.LookPath(cfg.Restic.PasswordCommand[0]); err != nil {
+			add("password (command)", false, true, fmt.Sprintf("%s: %v", cfg.Restic.PasswordCommand[0], err))
+		} else {
+			passwordOK = true
+			add("password (command)", true, true, cfg.Restic.PasswordCommand[0])
+		}
+	} else if cfg.Restic.PasswordSource == config.PasswordSourceKeychain {
+		store, err := secret.Keychain()
+		if err == nil {
+			_, err = store.Get(secret.ResticPasswordAccount)
+		}
+		if err != nil {
+			add("password (keychain)", false, true, err.Error())
+		} else {
+			passwordOK = true
+			add("password (keychain)", true, true, "found in OS keychain")
+		}
+	} else if passwordFile == "" {
+		add("password file", false, true, "restic.password_file is not configured")
+	} else if info, err := os.Stat(passwordFile); err != nil {
+		add("password file", false, true, fmt.Sprintf("%s: %v", passwordFile, err))
+	} else {
+		passwordOK = true
+		if runtime.GOOS != "windows" && info.Mode().Perm() != 0o600 {
+			add("password file", false, false, fmt.Sprintf("%s: permissions are %04o, expected 0600", passwordFile, info.Mode().Perm()))
+		} else {
+			add("password file", true, true, passwordFile)
+		}
+	}
+
+	// Repository connectivity
+	if cfg.Restic.Repository == "" {
+		add("repository reachable", false, true, "restic.repository is not configured")
+	} else if resticPath != "" && passwordOK {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := backup.CheckConnectivity(ctx, cfg); err != nil {
+			add("repository reachable", false, true, err.Error())
+		} else {
+			add("repository reachable", true, true, cfg.Restic.Repository)
+		}
+	} else {
+		add("repository reachable", false, true, "skipped (restic or password missing)")
+	}
+
+	return printDoctorChecks(checks)
+}
+
+// printDoctorChecks prints the checklist and reports whether all critical checks passed
+func printDoctorChecks(checks []doctorCheck) bool {
+	healthy := true
+	for _, c := range checks {
+		mark := "PASS"
+		if !c.ok {
+			if c.critical {
+				mark = "FAIL"
+				healthy = false
+			} else {
+				mark = "WARN"
+			}
+		}
+		fmt.Printf("[%s] %s: %s\n", mark, c.name, c.detail)
+	}
+	return healthy
+}
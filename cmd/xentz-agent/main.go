@@ -1,20 +1,35 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"math/rand/v2"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"text/tabwriter"
 	"time"
 
 	"xentz-agent/internal/backup"
 	"xentz-agent/internal/config"
 	"xentz-agent/internal/enroll"
+	"xentz-agent/internal/httpx"
+	"xentz-agent/internal/humanize"
+	"xentz-agent/internal/idle"
 	"xentz-agent/internal/install"
+	"xentz-agent/internal/logx"
+	"xentz-agent/internal/notify"
 	"xentz-agent/internal/report"
+	"xentz-agent/internal/secret"
 	"xentz-agent/internal/state"
+	"xentz-agent/internal/update"
+	"xentz-agent/internal/version"
 )
 
 func usage() {
@@ -22,9 +37,31 @@ func usage() {
 
 Commands:
   install    Install config + scheduled task (macOS: launchd, Windows: Task Scheduler, Linux: systemd/cron)
+  reconfigure Change the schedule or include/exclude paths of an installed agent (no re-enrollment)
+  uninstall  Remove the scheduled task (--purge also removes config, state, spool, and logs)
+  deregister Revoke this device on the control plane and clear its enrollment (--uninstall also removes the scheduled task)
   backup     Run one backup now (used by scheduler)
   retention  Run retention/prune policy (forget old snapshots)
+  run        Backup, then retention and a repository check when due, as one scheduled job (see run_* config)
+  snapshots  List snapshots in the repository
+  unlock     Remove stale repository locks left by interrupted runs
+  stats      Show repository size, unique (deduplicated) size and snapshot count
+  diff       Summarize changes between two snapshots: diff [--json] <snapshotA> [snapshotB (default: latest)]
+  mount      Browse snapshots as files: mount [--config path] <dir> (macOS/Linux, needs FUSE; blocks until Ctrl-C)
   status     Show last run status
+  checkin    Send a heartbeat (version, last backup status) to the control plane
+  flush-reports Send spooled reports now: flush-reports [--max N] [--max-age 720h (default spool_max_age_hours)]
+  rotate-key Replace the device API key with a new one from the control plane
+  fingerprint Print the SHA-256 fingerprint of the control plane's TLS certificate: fingerprint [server-url]
+  doctor     Run pre-flight checks (restic, config, paths, password file, server, repository)
+  scheduler-status Show whether the scheduled jobs are registered and enabled, and their next run [--json]
+  test-connection Check the control plane round trip with the stored device API key (read-only)
+  self-update Update the agent binary to the latest (or a given) release
+
+Global flags:
+  --log-format   Log format: text (default) or json (also XENTZ_LOG_FORMAT)
+  --verbose, -v  Debug logging; backup and retention also pass -v to restic and stream its output
+                 (repeat or use -vv for more detail)
 
 Examples:
   # Token-based enrollment (recommended):
@@ -33,26 +70,143 @@ Examples:
   # Legacy mode (direct repository):
   xentz-agent install --repo rest:https://... --password "..." --daily-at 02:00 --include "/Users/me/Documents"
   
+  xentz-agent reconfigure --daily-at 03:30 --add-include "/Users/me/Music" --remove-include "/Users/me/Downloads"
+  xentz-agent uninstall
+  xentz-agent uninstall --purge
+  xentz-agent deregister --uninstall
+  
   xentz-agent backup
   xentz-agent backup --auto-init  # Auto-initialize repository if missing (use with caution)
+  xentz-agent backup --dry-run    # Preview what would be backed up
   xentz-agent retention
+  xentz-agent retention --dry-run # Preview which snapshots would be removed
+  xentz-agent run --quiet
+  xentz-agent snapshots
+  xentz-agent snapshots --json
+  xentz-agent unlock
+  xentz-agent stats
+  xentz-agent diff 1a2b3c4d
+  xentz-agent mount ~/xentz-snapshots
   xentz-agent status
+  xentz-agent checkin
+  xentz-agent flush-reports --max 5
+  xentz-agent rotate-key
+  xentz-agent fingerprint https://control-plane.example.com
+  xentz-agent doctor
+  xentz-agent test-connection
+  xentz-agent self-update --check-only
+
+Flags (backup, retention):
+  --profile      Run for a named profile from config "profiles" (default: top-level settings)
+  --timeout-hours
+                 Give up after this many hours (default: config "timeouts", else 6 for backup, 2 for retention)
+
+Flags (backup, retention, run):
+  --quiet        Don't stream restic output; backups still log progress every 10s (used by scheduled runs)
 
 Flags (backup):
+  --dry-run      Show what would be backed up (files/bytes) without writing data or saving status
   --auto-init    Automatically initialize repository if it doesn't exist (default: false)
                  WARNING: Only use if you're certain the repository URL is correct.
                  Without this flag, backup will fail if repository doesn't exist.
 
+Flags (run):
+  --backup-timeout-hours, --retention-timeout-hours, --check-timeout-hours
+                 Per-job time limits (default: config "timeouts", else 6, 2 and 6)
+
+Flags (reconfigure):
+  --daily-at, --interval, --frequency, --day-of-week, --day-of-month, --retention-at, --retention-day, --jitter
+                 Same as for install; only the flags given are changed
+  --include, --exclude                Replace the include paths / exclude globs (repeatable)
+  --add-include, --add-exclude        Add an include path / exclude glob (repeatable)
+  --remove-include, --remove-exclude  Remove an include path / exclude glob (repeatable)
+  --run-now      Also run a backup right after reinstalling the schedule (default: false)
+  --run-password Windows: password of the system_user account (prompted for if not set)
+
+Flags (uninstall):
+  --purge        Also remove ~/.xentz-agent (config, state, spool, and logs)
+
+Flags (retention):
+  --dry-run      List snapshots that would be forgotten without deleting anything or saving status
+
+Flags (unlock):
+  --remove-all   Remove all locks, including those of operations still running (use with caution)
+
+Flags (snapshots):
+  --json         Print snapshots as JSON instead of a table
+
+Flags (stats):
+  --mode         Only run one restic stats mode: restore-size, files-by-contents, blobs-per-file, raw-data
+  --timeout      Give up after this long (default 1h; stats on large repositories are slow)
+  --json         Print the stats as JSON
+
+Flags (diff):
+  --json         Print the summary as JSON
+
+Flags (status):
+  --json         Print the last backup and retention runs as JSON
+
+Flags (self-update):
+  --check-only   Only report whether an update is available
+  --version      Release tag to install, e.g. v1.4.0 (default: latest)
+  --skip-verify  Skip the release signature check (checksums are still verified)
+  --force        Allow downgrades and replacing development builds
+
 Flags (install):
   --token         Install token for enrollment (recommended, provided by control plane)
   --server        Control plane base URL (required with --token)
+  --enroll-file   Enroll from a provisioning file (tenant_id, device_id, device_api_key, repo_path,
+                  password) for machines that can't reach the control plane; --server is optional
+  --ca-cert       PEM CA bundle to trust for the control plane (internal/private CAs)
+  --client-cert   PEM client certificate for mutual TLS (with --client-key)
+  --client-key    PEM private key for --client-cert
+  --server-fingerprint  Accept only the control plane certificate with this SHA-256 fingerprint
+                  (instead of its CA chain); get it with the fingerprint command
+  --strict-url    Reject control plane URLs and redirects to private/link-local IP addresses
+  --http-timeout  Timeout for control plane requests, e.g. 2m (default 30s, clamped to 5s-5m)
+  --resolve-url   Also resolve the control plane hostname and reject loopback/link-local/metadata addresses
+  --proxy         Proxy URL for control plane requests (http, https or socks5; default: HTTP(S)_PROXY)
+  --enroll-attempts  Enrollment attempts on network errors/5xx (default 3; bad tokens fail at once)
   --daily-at      Time in HH:MM (24h), default 02:00
+  --interval      Back up every interval instead of daily, e.g. 4h (15m minimum, under 24h)
+  --frequency     daily (default), weekly or monthly; the backup runs at --daily-at on the chosen day
+  --day-of-week   Day for weekly backups, sun..sat (implies --frequency weekly)
+  --day-of-month  Day for monthly backups, 1-28 (implies --frequency monthly)
+  --retention-at  Weekly retention time in HH:MM (24h). Also scheduled (at 03:00) when config.json has a
+                  retention policy; enrolled devices get their policy from the server at run time.
+  --retention-day Weekly retention day, sun..sat (default: sun)
+  --jitter        Random delay before each scheduled run, e.g. 30m (spreads load across a fleet)
+  --catch-up      When the last successful backup is over a day old (machine was off or asleep),
+                  retention and checkin runs first run a catch-up backup
+  --run-now       Run the backup once right after installing (default true); --run-now=false only
+                  registers the schedule, e.g. to avoid every machine backing up at once in a rollout
+  --system        Install system-wide jobs (/etc/systemd/system, /Library/LaunchDaemons, or Windows tasks
+                  that run whether the user is logged on or not) that run with nobody logged in; run
+                  install with sudo or from an elevated prompt. Uninstall also needs it then.
+  --run-as        User the --system jobs run as (default: root, SYSTEM on Windows); it must be able to
+                  read the config
+  --run-password  Windows: password of the --run-as account, stored by Task Scheduler (prompted for if
+                  not set)
   --repo          Restic repository URL (legacy mode, use --token instead)
   --password      Restic repository password (optional if server provides via enrollment)
   --password-file Path to restic password file (optional, default: ~/.xentz-agent/restic.pw)
+  --password-source Where to store the password: file (default) or keychain (macOS Keychain,
+                  Windows Credential Manager, libsecret on Linux; falls back to file if unavailable)
   --include       Repeatable. Add include paths. Example: --include "/Users/me/Documents" --include "/Users/me/Pictures"
   --exclude       Repeatable. Add exclude globs.
-  --config        Config path override (default: ~/.xentz-agent/config.json)
+  --exclude-file  Repeatable. File of exclude patterns (passed to restic --exclude-file).
+  --tag           Repeatable. Snapshot tag. Enrolled devices are also tagged device:<device-id>.
+  --upload-limit   Upload bandwidth limit per second, e.g. 500K, 1.5M or 2M (0 = unlimited)
+  --download-limit Download bandwidth limit per second, e.g. 500K, 1.5M or 2M (0 = unlimited)
+  --auto-init     Persist auto-init in config so scheduled backups initialize a missing repository (default: false)
+  --one-file-system Don't cross filesystem boundaries (skips mounted network shares etc.)
+  --exclude-caches  Skip directories containing a CACHEDIR.TAG file
+  --config        Config path override (default: $XENTZ_CONFIG, then ~/.xentz-agent/config.json)
+
+Exit codes (backup, retention, run):
+  0 success, 1 other failure (including degraded backups), 2 usage error, 3 config or password error,
+  4 restic missing or too old, 5 repository unreachable, 6 run or repository locked, 7 backup skipped
+  (run exits with the code of the first job that did not succeed)
 
 Note: With token-based enrollment, configuration (including retention policy) is fetched from the server on each run.
       In legacy mode, retention policy must be configured in config.json before running 'retention' command.
@@ -67,14 +221,667 @@ func (m *multiFlag) Set(v string) error {
 	return nil
 }
 
+// editList applies reconfigure edits to list: set replaces it (when non-empty), then add
+// appends entries not already present and remove drops matching entries
+func editList(list, set, add, remove []string) []string {
+	if len(set) > 0 {
+		list = slices.Clone(set)
+	}
+	for _, v := range add {
+		if !slices.Contains(list, v) {
+			list = append(list, v)
+		}
+	}
+	return slices.DeleteFunc(list, func(v string) bool { return slices.Contains(remove, v) })
+}
+
+// frequencyFlag returns the schedule frequency for the --frequency, --day-of-week and
+// --day-of-month flags: the one given, or inferred from a day flag ("" if none is set)
+func frequencyFlag(frequency, dayOfWeek string, dayOfMonth int) (string, error) {
+	switch {
+	case frequency != "":
+		return frequency, nil
+	case dayOfWeek != "" && dayOfMonth != 0:
+		return "", fmt.Errorf("--day-of-week and --day-of-month can't be combined")
+	case dayOfWeek != "":
+		return config.FrequencyWeekly, nil
+	case dayOfMonth != 0:
+		return config.FrequencyMonthly, nil
+	}
+	return "", nil
+}
+
+// loadRunConfig reads the local config and, for enrolled devices, fetches the
+// effective config from the server (falling back to the cached copy).
+// It returns the local config (enrollment data) and the effective config.
+// Exits the process on failure or if the device is disabled by the server.
+func loadRunConfig(cfgFile string) (config.Config, config.Config) {
+	// Read local config to get enrollment data (device_id, device_api_key, server_url)
+	localCfg, err := config.Read(cfgFile)
+	if err != nil {
+		logx.Exitf(exitConfig, "read config: %v", err)
+	}
+	logx.Debugf("using config %s", cfgFile)
+	logx.SetDeviceID(localCfg.DeviceID)
+	logx.AddSecret(localCfg.DeviceAPIKey, localCfg.InstallToken)
+	configureHTTP(localCfg)
+	configureSpool(localCfg)
+
+	// Keep the scheduler's log files bounded (scheduled runs all come through here)
+	if home, err := os.UserHomeDir(); err == nil {
+		maxBytes := int64(localCfg.LogMaxSizeMB) << 20
+		if err := logx.RotateFiles(logx.AgentLogFiles(home), maxBytes, localCfg.LogKeep); err != nil {
+			logx.Printf("warning: log rotation: %v", err)
+		}
+	}
+
+	// Fetch config from server (with fallback to cached config)
+	var cfg config.Config
+	if localCfg.DeviceAPIKey != "" && localCfg.ServerURL != "" {
+		// Device is enrolled, fetch config from server
+		fetchedCfg, fetchErr := config.LoadWithFallback(localCfg.ServerURL, localCfg.DeviceAPIKey, localCfg.CachePolicy())
+		if errors.Is(fetchErr, config.ErrKeyExpiring) {
+			// The server asks for a new key: rotate it, then fetch again with the new one
+			logx.Println("device API key is expiring, rotating it")
+			localCfg, err = rotateDeviceKey(cfgFile, localCfg)
+			if err != nil {
+				logx.Fatalf("rotate device key: %v", err)
+			}
+			fetchedCfg, fetchErr = config.LoadWithFallback(localCfg.ServerURL, localCfg.DeviceAPIKey, localCfg.CachePolicy())
+		}
+		if fetchErr != nil {
+			logx.Fatalf("failed to load config: %v", fetchErr)
+		}
+		cfg = fetchedCfg
+		// Preserve enrollment data from local config
+		cfg.TenantID = localCfg.TenantID
+		cfg.DeviceID = localCfg.DeviceID
+		cfg.DeviceAPIKey = localCfg.DeviceAPIKey
+		cfg.ServerURL = localCfg.ServerURL
+		cfg.UserID = localCfg.UserID
+		cfg.CACertFile = localCfg.CACertFile
+		cfg.ClientCertFile = localCfg.ClientCertFile
+		cfg.ClientKeyFile = localCfg.ClientKeyFile
+		cfg.ServerCertFingerprint = localCfg.ServerCertFingerprint
+		cfg.ProxyURL = localCfg.ProxyURL
+		cfg.StrictServerValidation = localCfg.StrictServerValidation
+		cfg.ResolveServerHost = localCfg.ResolveServerHost
+		cfg.HTTPTimeoutSeconds = localCfg.HTTPTimeoutSeconds
+		// Always preserve password settings from local config (they refer to local files/keychain)
+		cfg.Restic.PasswordFile = localCfg.Restic.PasswordFile
+		cfg.Restic.PasswordSource = localCfg.Restic.PasswordSource
+		// Never execute a password command supplied by the server
+		cfg.Restic.PasswordCommand = localCfg.Restic.PasswordCommand
+		// Same for backup hooks
+		cfg.PreBackup = localCfg.PreBackup
+		cfg.PostBackup = localCfg.PostBackup
+		// A local opt-in to failing on missing include paths wins over the server
+		cfg.FailOnMissingInclude = cfg.FailOnMissingInclude || localCfg.FailOnMissingInclude
+		// Keep locally configured tags (e.g. the device tag added at enrollment)
+		for _, tag := range localCfg.Tags {
+			if !slices.Contains(cfg.Tags, tag) {
+				cfg.Tags = append(cfg.Tags, tag)
+			}
+		}
+	} else {
+		// Legacy mode: use local config directly
+		logx.Println("Using local config (device not enrolled or legacy mode)")
+		cfg = localCfg
+	}
+
+	// KILL-SWITCH: Final safety check - if device is disabled, exit immediately
+	if cfg.Enabled != nil && !*cfg.Enabled {
+		logx.Fatalf("device is disabled by server (kill-switch activated). All operations stopped.")
+	}
+
+	checkAgentVersion(cfg)
+
+	return localCfg, cfg
+}
+
+// rotateDeviceKey replaces the device API key with a new one from the server and saves it to
+// cfgFile. The config file is replaced atomically, so it holds either the old or the new key.
+func rotateDeviceKey(cfgFile string, localCfg config.Config) (config.Config, error) {
+	newKey, err := enroll.RotateKey(localCfg.ServerURL, localCfg.DeviceAPIKey)
+	if err != nil {
+		return localCfg, err
+	}
+	logx.AddSecret(newKey)
+
+	updated := localCfg
+	updated.DeviceAPIKey = newKey
+	if err := config.Write(cfgFile, updated); err != nil {
+		return localCfg, fmt.Errorf("new key could not be saved, the current key was kept: %w", err)
+	}
+	// The cached server config is signed with the device key
+	if err := config.ResignCached(localCfg.DeviceAPIKey, newKey); err != nil {
+		logx.Printf("warning: cached config could not be re-signed with the new key: %v", err)
+	}
+	return updated, nil
+}
+
+// configureHTTP applies the config's CA bundle, client certificate, proxy and URL policy to control plane requests
+func configureHTTP(cfg config.Config) {
+	if err := httpx.Configure(httpOptions(cfg)); err != nil {
+		logx.Fatalf("HTTP client configuration: %v", err)
+	}
+}
+
+// httpOptions returns the httpx options for cfg's TLS, proxy and URL policy settings
+// (zero when none are set)
+func httpOptions(cfg config.Config) httpx.Options {
+	return httpx.Options{
+		CACertFile:            cfg.CACertFile,
+		ClientCertFile:        cfg.ClientCertFile,
+		ClientKeyFile:         cfg.ClientKeyFile,
+		ServerCertFingerprint: cfg.ServerCertFingerprint,
+		ProxyURL:              cfg.ProxyURL,
+
+		StrictServerValidation: cfg.StrictServerValidation,
+		ResolveServerHost:      cfg.ResolveServerHost,
+		Timeout:                time.Duration(cfg.HTTPTimeoutSeconds) * time.Second,
+	}
+}
+
+// canReport reports whether the local config has the enrollment data needed to send reports
+func canReport(localCfg config.Config) bool {
+	return localCfg.DeviceID != "" && localCfg.DeviceAPIKey != "" && localCfg.ServerURL != ""
+}
+
+// flushPendingReports sends reports spooled by earlier runs (max 20, oldest first)
+// and removes spool files older than spool_max_age_hours (default 30 days)
+func flushPendingReports(localCfg config.Config) {
+	if !canReport(localCfg) {
+		return
+	}
+	_, _, _ = report.SendPendingReports(localCfg.ServerURL, localCfg.DeviceAPIKey, 20, localCfg.ReportWorkers)
+
+	// Cleanup old reports periodically (every run for simplicity in MVP)
+	_ = report.CleanupOldReports(0)
+}
+
+// configureSpool applies the config's spool size cap and report age limit
+func configureSpool(cfg config.Config) {
+	report.ConfigureSpool(cfg.SpoolMaxBytes, time.Duration(cfg.SpoolMaxAgeHours)*time.Hour)
+}
+
+// sendRunReport reports the outcome of a backup or retention run to the control plane.
+// Reports that cannot be delivered are spooled for the next run.
+func sendRunReport(localCfg config.Config, job string, res state.LastRun) {
+	if !canReport(localCfg) {
+		return
+	}
+
+	runReport := report.FromLastRun(job, localCfg.DeviceID, res)
+	// Repository size from the last `stats` run, if any
+	if st, err := state.New(); err == nil {
+		if stats, ok, _ := st.LoadRepoStats(backup.StatsModeRawData); ok {
+			runReport.RepoSizeBytes = stats.TotalSize
+		}
+	}
+	// Cached from the run itself, so this does not exec restic again
+	if v, _, err := backup.ResticVersion(context.Background()); err == nil {
+		runReport.ResticVersion = v
+	}
+
+	// Send current report (spools if it fails)
+	_ = report.SendReportWithSpool(localCfg.ServerURL, localCfg.DeviceAPIKey, runReport)
+}
+
+// notifyTimeout bounds a failure notification, so a hung webhook or notifier can't hold up the run
+const notifyTimeout = 15 * time.Second
+
+// notifyFailure announces a failed run through the configured notifier (best-effort)
+func notifyFailure(localCfg config.Config, job string, res state.LastRun) {
+	if !localCfg.Notify.Enabled || res.Status != "error" {
+		return
+	}
+	n, err := notify.New(localCfg.Notify.Type, localCfg.Notify.WebhookURL, localCfg.Notify.Format)
+	if err != nil {
+		logx.Printf("warning: notify: %v", err)
+		return
+	}
+	hostname, _ := os.Hostname()
+	ev := notify.Event{
+		Job:        job,
+		Status:     res.Status,
+		Error:      logx.Redact(res.Error),
+		ErrorKind:  res.ErrorKind,
+		Duration:   res.Duration,
+		BytesAdded: res.DataAddedBytes,
+		DeviceID:   localCfg.DeviceID,
+		Hostname:   hostname,
+		Time:       res.TimeUTC,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	if err := n.Notify(ctx, ev); err != nil {
+		logx.Printf("warning: failure notification not delivered: %v", err)
+	}
+}
+
+// runLockWait is how long a backup or retention run waits for another run to finish
+const runLockWait = 2 * time.Hour
+
+// overrideTimeouts applies --*timeout-hours flags (0 = keep the configured value)
+func overrideTimeouts(t *config.Timeouts, backupHours, retentionHours, checkHours int) {
+	if backupHours < 0 || retentionHours < 0 || checkHours < 0 {
+		logx.Exitf(exitUsage, "timeouts must be positive")
+	}
+	t.BackupHours = cmp.Or(backupHours, t.BackupHours)
+	t.RetentionHours = cmp.Or(retentionHours, t.RetentionHours)
+	t.CheckHours = cmp.Or(checkHours, t.CheckHours)
+}
+
+// runBackupJob flushes spooled reports, runs one backup under the agent run lock, and
+// records the result (state, metrics, control plane report). Dry runs skip the lock,
+// flush, and recording. If another run still holds the lock after lockWait, the backup is
+// skipped without recording anything (that run records its own result).
+func runBackupJob(st *state.Store, localCfg, cfg config.Config, opts backup.Options, lockWait time.Duration) (state.LastRun, error) {
+	if !opts.DryRun {
+		if cfg.DeferWhileActive {
+			waitForIdle(cfg)
+		}
+
+		start := time.Now()
+		unlock, err := st.WaitLock(lockWait)
+		if errors.Is(err, state.ErrLocked) {
+			return state.NewLastRunSkipped(start, err.Error()), nil
+		}
+		if err != nil {
+			return state.LastRun{}, err
+		}
+		defer unlock()
+
+		// Flush reports spooled by earlier runs before starting
+		flushPendingReports(localCfg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeouts.Backup())
+	defer cancel()
+
+	res := backup.Run(ctx, cfg, opts)
+	if opts.DryRun {
+		return res, nil
+	}
+	recordRun(st, localCfg, "backup", res)
+	return res, nil
+}
+
+// recordRun saves the result of a finished job ("backup", "retention" or "check") to state,
+// updates the metrics file, reports the run to the control plane and announces failures
+func recordRun(st *state.Store, localCfg config.Config, job string, res state.LastRun) {
+	var err error
+	switch job {
+	case "backup":
+		err = st.SaveLastRun(res)
+	case "retention":
+		err = st.SaveLastRetentionRun(res)
+	case "check":
+		err = st.SaveLastCheckRun(res)
+	}
+	if err != nil {
+		logx.Printf("save last %s run: %v", job, err)
+	}
+	if err := st.WriteMetrics(st.MetricsPath()); err != nil {
+		logx.Printf("write metrics: %v", err)
+	}
+
+	// Send report for this run (non-blocking, spools on failure)
+	sendRunReport(localCfg, job, res)
+	notifyFailure(localCfg, job, res)
+}
+
+// Idle wait for defer_while_active: the user must have been idle this long, checked this often
+const (
+	idleThreshold   = 5 * time.Minute
+	idlePoll        = time.Minute
+	defaultMaxDefer = 60 * time.Minute
+)
+
+// waitForIdle holds the backup until the user is idle, for at most cfg.MaxDeferMinutes
+func waitForIdle(cfg config.Config) {
+	maxDefer := defaultMaxDefer
+	if cfg.MaxDeferMinutes > 0 {
+		maxDefer = time.Duration(cfg.MaxDeferMinutes) * time.Minute
+	}
+	start := time.Now()
+	idleNow, err := idle.WaitUntil(context.Background(), idle.Default, idleThreshold, maxDefer, idlePoll)
+	switch {
+	case err != nil:
+		logx.Printf("warning: defer_while_active: %v (backing up now)", err)
+	case !idleNow:
+		logx.Printf("user still active after %s, backing up anyway", maxDefer)
+	case time.Since(start) > time.Second:
+		logx.Printf("user idle, starting backup after waiting %s", time.Since(start).Round(time.Second))
+	}
+}
+
+// Catch-up backups run when the last success is older than the schedule interval
+// (daily unless schedule.interval_minutes or frequency say otherwise) plus catchUpGrace
+const (
+	backupInterval = 24 * time.Hour
+	catchUpGrace   = 2 * time.Hour
+)
+
+// catchUpBackup runs a backup now if catch-up is enabled and the last successful backup is
+// overdue (e.g. the machine was asleep at the scheduled time). It does nothing if the last
+// attempt was recent, so a failing backup isn't retried on every invocation; a skipped
+// attempt (metered, on battery) is retried as soon as conditions allow.
+func catchUpBackup(st *state.Store, localCfg, cfg config.Config, verbose int) {
+	if !cfg.Schedule.CatchUp && !localCfg.Schedule.CatchUp {
+		return
+	}
+	last, ok, err := st.LoadLastRun()
+	if err != nil || (ok && last.Status != "skipped" && !olderThan(last.TimeUTC, catchUpGrace)) {
+		return
+	}
+	interval := backupInterval
+	switch {
+	case cfg.Schedule.IntervalMinutes > 0:
+		interval = time.Duration(cfg.Schedule.IntervalMinutes) * time.Minute
+	case cfg.Schedule.Frequency == config.FrequencyWeekly:
+		interval = 7 * backupInterval
+	case cfg.Schedule.Frequency == config.FrequencyMonthly:
+		interval = 31 * backupInterval
+	}
+	success, ok, err := st.LoadLastSuccess()
+	if err != nil || (ok && !olderThan(success.TimeUTC, interval+catchUpGrace)) {
+		return
+	}
+
+	logx.Println("last successful backup is overdue, running a catch-up backup")
+	res, err := runBackupJob(st, localCfg, cfg, backup.Options{
+		AutoInit: cfg.AutoInit || localCfg.AutoInit,
+		Quiet:    true,
+		Verbose:  verbose,
+	}, 0)
+	switch {
+	case err != nil:
+		logx.Printf("catch-up backup skipped: %v", err)
+	case res.Status == "error":
+		logx.Printf("catch-up backup failed ❌: %s", res.Error)
+	case res.Status == "skipped":
+		logx.Printf("catch-up backup skipped: %s", res.SkipReason)
+	default:
+		logx.Printf("catch-up backup ok ✅: duration=%s bytes_sent=%d (%s)", res.Duration, res.BytesSent, humanize.Bytes(res.BytesSent))
+	}
+}
+
+// How often `run` applies the retention policy, and checks the repository unless
+// check_interval_hours says otherwise. A failed attempt is retried after catchUpGrace.
+const (
+	retentionInterval    = 7 * 24 * time.Hour
+	defaultCheckInterval = 7 * 24 * time.Hour
+)
+
+// jobDue reports whether a job last run as last (ok = false if never) is due again
+func jobDue(last state.LastRun, ok bool, err error, interval time.Duration) bool {
+	if err != nil {
+		return false
+	}
+	if !ok {
+		return true
+	}
+	if last.Status == "error" {
+		return olderThan(last.TimeUTC, catchUpGrace)
+	}
+	// Scheduled runs drift by the jitter; don't wait a whole extra run for a job that's nearly due
+	return olderThan(last.TimeUTC, interval-catchUpGrace)
+}
+
+// runJobs does the jobs selected by run_backup, run_retention and run_check under a single
+// hold of the run lock: a backup, then retention and a repository check when they are due.
+// Each job's result is recorded separately. It returns the exit code of the first job that
+// did not succeed (exitOK if all did).
+func runJobs(st *state.Store, localCfg, cfg config.Config, quiet bool, verbose int) int {
+	doBackup, doRetention, doCheck := cfg.RunBackup, cfg.RunRetention, cfg.RunCheck
+	if !doBackup && !doRetention && !doCheck {
+		doBackup, doRetention = true, cfg.Retention.Configured()
+	}
+	if doRetention && !cfg.Retention.Configured() {
+		logx.Printf("warning: run_retention is set but no retention policy is configured")
+		doRetention = false
+	}
+	if doBackup && cfg.DeferWhileActive {
+		waitForIdle(cfg)
+	}
+
+	unlock, err := st.WaitLock(runLockWait)
+	if errors.Is(err, state.ErrLocked) {
+		logx.Printf("run skipped ⏭️: %v", err)
+		return exitLocked
+	}
+	if err != nil {
+		logx.Printf("run: %v", err)
+		return exitError
+	}
+	defer unlock()
+
+	// Flush reports spooled by earlier runs before starting
+	flushPendingReports(localCfg)
+
+	code := exitOK
+	finish := func(job string, res state.LastRun) {
+		recordRun(st, localCfg, job, res)
+		switch res.Status {
+		case "success":
+			logx.Printf("%s ok ✅: duration=%s", job, res.Duration)
+		case "skipped":
+			logx.Printf("%s skipped ⏭️: %s", job, res.SkipReason)
+		case "degraded":
+			logx.Printf("%s ok but degraded ⚠️: %s", job, res.Error)
+		default:
+			logx.Printf("%s failed ❌: %s", job, res.Error)
+		}
+		if code == exitOK {
+			code = exitCode(res)
+		}
+	}
+	opts := backup.Options{Quiet: quiet, Verbose: verbose}
+
+	if doBackup {
+		backupOpts := opts
+		backupOpts.AutoInit = cfg.AutoInit || localCfg.AutoInit
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeouts.Backup())
+		res := backup.Run(ctx, cfg, backupOpts)
+		cancel()
+		finish("backup", res)
+		// Whatever made the backup skip (metered connection, battery) applies to the others too
+		if res.Status == "skipped" {
+			return code
+		}
+	}
+	if doRetention {
+		last, ok, err := st.LoadLastRetentionRun()
+		if jobDue(last, ok, err, retentionInterval) {
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeouts.Retention())
+			res := backup.RunRetention(ctx, cfg, opts)
+			cancel()
+			finish("retention", res)
+		}
+	}
+	if doCheck {
+		interval := defaultCheckInterval
+		if cfg.CheckIntervalHours > 0 {
+			interval = time.Duration(cfg.CheckIntervalHours) * time.Hour
+		}
+		last, ok, err := st.LoadLastCheckRun()
+		if jobDue(last, ok, err, interval) {
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeouts.Check())
+			res := backup.RunCheck(ctx, cfg, opts)
+			cancel()
+			finish("check", res)
+		}
+	}
+	return code
+}
+
+// olderThan reports whether the RFC3339 time ts is more than d ago (true if unparseable)
+func olderThan(ts string, d time.Duration) bool {
+	t, err := time.Parse(time.RFC3339, ts)
+	return err != nil || time.Since(t) > d
+}
+
+// Exit codes for backup and retention, so scripts and monitoring can tell failures apart.
+// These are part of the CLI contract: don't renumber them.
+const (
+	exitOK              = 0
+	exitError           = 1 // Any other failure, including degraded backups
+	exitUsage           = 2 // Unknown command or bad flags
+	exitConfig          = 3 // Config missing or invalid, or wrong repository password
+	exitResticMissing   = 4 // restic not installed, too old, or not runnable
+	exitRepoUnreachable = 5 // Repository unreachable, failing, or not initialized
+	exitLocked          = 6 // Another agent run holds the run lock, or the repository is locked
+	exitSkipped         = 7 // Backup skipped (metered connection, on battery)
+)
+
+// exitCode maps the outcome of a backup or retention run to the process exit code
+func exitCode(res state.LastRun) int {
+	switch res.Status {
+	case "success":
+		return exitOK
+	case "skipped":
+		if res.SkipReason == state.ErrLocked.Error() {
+			return exitLocked
+		}
+		return exitSkipped
+	case "error":
+		return errorExitCode(backup.ErrorKind(res.ErrorKind))
+	}
+	return exitError
+}
+
+// errorExitCode maps the kind of a failed run to its exit code
+func errorExitCode(kind backup.ErrorKind) int {
+	switch kind {
+	case backup.KindConfigInvalid, backup.KindAuthFailed:
+		return exitConfig
+	case backup.KindResticMissing:
+		return exitResticMissing
+	case backup.KindRepoUnreachable, backup.KindTransient:
+		return exitRepoUnreachable
+	case backup.KindRepoLocked:
+		return exitLocked
+	}
+	return exitError
+}
+
+// statusCount formats a count for the status output, "n/a" when not recorded
+func statusCount(n int64) string {
+	if n <= 0 {
+		return "n/a"
+	}
+	return fmt.Sprint(n)
+}
+
+// statusSize formats a byte count for the status output with binary units, "n/a" when not recorded
+func statusSize(n int64) string {
+	if n <= 0 {
+		return "n/a"
+	}
+	return humanize.Bytes(n)
+}
+
+// sleepJitter waits a random time in [0, max) so scheduled runs across a fleet don't all start at once
+func sleepJitter(max time.Duration) {
+	if max <= 0 {
+		return
+	}
+	d := rand.N(max).Round(time.Second)
+	logx.Printf("waiting %s (jitter) before starting", d)
+	time.Sleep(d)
+}
+
+// storePassword saves the restic password in the OS keychain (source "keychain") or in
+// passwordFile (default ~/.xentz-agent/restic.pw) and records the choice in cfg.
+// If the keychain is unavailable it falls back to the password file. Exits on failure.
+func storePassword(cfg *config.Config, password, passwordFile, source, home string) {
+	if source == config.PasswordSourceKeychain {
+		store, err := secret.Keychain()
+		if err == nil {
+			err = store.Set(secret.ResticPasswordAccount, password)
+		}
+		if err == nil {
+			cfg.Restic.PasswordSource = config.PasswordSourceKeychain
+			cfg.Restic.PasswordFile = ""
+			logx.Println("Restic password stored in OS keychain")
+			return
+		}
+		logx.Printf("warning: cannot use keychain, falling back to password file: %v", err)
+	}
+
+	if passwordFile == "" {
+		passwordFile = filepath.Join(home, ".xentz-agent", "restic.pw")
+	}
+	if err := os.MkdirAll(filepath.Dir(passwordFile), 0o700); err != nil {
+		logx.Fatalf("password dir: %v", err)
+	}
+	if err := os.WriteFile(passwordFile, []byte(password+"\n"), 0o600); err != nil {
+		logx.Fatalf("write password file: %v", err)
+	}
+	cfg.Restic.PasswordSource = config.PasswordSourceFile
+	cfg.Restic.PasswordFile = passwordFile
+}
+
+// extractLogFormat removes the global --log-format flag from args and returns its value,
+// falling back to XENTZ_LOG_FORMAT. It may appear anywhere on the command line.
+func extractLogFormat(args []string) (string, []string) {
+	format := os.Getenv("XENTZ_LOG_FORMAT")
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--log-format" || arg == "-log-format":
+			if i+1 < len(args) {
+				format = args[i+1]
+				i++
+			}
+		case strings.HasPrefix(arg, "--log-format="):
+			format = strings.TrimPrefix(arg, "--log-format=")
+		case strings.HasPrefix(arg, "-log-format="):
+			format = strings.TrimPrefix(arg, "-log-format=")
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return format, rest
+}
+
+// extractVerbose removes the global --verbose/-v flags from args and returns the level:
+// each --verbose or -v adds one, and -vv counts as two. They may appear anywhere.
+func extractVerbose(args []string) (int, []string) {
+	level := 0
+	rest := make([]string, 0, len(args))
+	for _, arg := range args {
+		switch {
+		case arg == "--verbose" || arg == "-verbose":
+			level++
+		case len(arg) > 1 && arg[0] == '-' && strings.Trim(arg[1:], "v") == "":
+			level += len(arg) - 1
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return level, rest
+}
+
 func main() {
-	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
+	logFormat, args := extractLogFormat(os.Args)
+	verbose, args := extractVerbose(args)
+	os.Args = args
+	if err := logx.Setup(logFormat); err != nil {
+		logx.Fatalf("--log-format: %v", err)
+	}
+	logx.SetVerbosity(verbose)
 
 	if len(os.Args) < 2 {
 		usage()
-		os.Exit(2)
+		os.Exit(exitUsage)
 	}
 	cmd := os.Args[1]
+	logx.SetJob(cmd)
 
 	var cfgFile string
 	var err error
@@ -84,24 +891,77 @@ func main() {
 		fs := flag.NewFlagSet(cmd, flag.ExitOnError)
 		server := fs.String("server", "", "Control plane base URL (required for token-based enrollment)")
 		dailyAt := fs.String("daily-at", "02:00", "Daily time HH:MM (24h)")
+		interval := fs.Duration("interval", 0, "Back up every interval instead of daily, e.g. 4h (overrides --daily-at)")
+		frequency := fs.String("frequency", "", "Backup frequency: daily (default), weekly or monthly")
+		dayOfWeek := fs.String("day-of-week", "", "Day for weekly backups, sun..sat (implies --frequency weekly)")
+		dayOfMonth := fs.Int("day-of-month", 0, "Day for monthly backups, 1-28 (implies --frequency monthly)")
+		retentionAt := fs.String("retention-at", "", "Weekly retention time HH:MM (24h); schedules the retention job")
+		retentionDay := fs.String("retention-day", "", "Weekly retention day, sun..sat (default: sun)")
+		jitter := fs.Duration("jitter", 0, "Random delay of up to this duration before each scheduled run, e.g. 30m")
+		catchUp := fs.Bool("catch-up", false, "Run an overdue backup from other scheduled commands (retention, checkin)")
+		runNow := fs.Bool("run-now", true, "Run the backup once right after installing (false: wait for the schedule)")
+		system := fs.Bool("system", false, "Install system-wide jobs that run with nobody logged in (needs root or an elevated prompt)")
+		runAs := fs.String("run-as", "", "User the --system jobs run as (default: root, or SYSTEM on Windows)")
+		runPassword := fs.String("run-password", "", "Windows: password of the --run-as account (prompted for if not set)")
 		configPath := fs.String("config", "", "Config path override")
 		token := fs.String("token", "", "Install token for enrollment (primary method)")
+		enrollFile := fs.String("enroll-file", "", "Enroll from a provisioning file instead of the control plane (offline installs)")
+		caCert := fs.String("ca-cert", "", "PEM CA bundle to trust for the control plane (private CAs)")
+		clientCert := fs.String("client-cert", "", "PEM client certificate for mutual TLS with the control plane")
+		clientKey := fs.String("client-key", "", "PEM private key for --client-cert")
+		serverFingerprint := fs.String("server-fingerprint", "", "Pin the control plane's certificate by its SHA-256 fingerprint (see the fingerprint command)")
+		strictURL := fs.Bool("strict-url", false, "Reject control plane URLs and redirects to private IP addresses")
+		httpTimeout := fs.Duration("http-timeout", 0, "Timeout for control plane requests (default 30s, clamped to 5s-5m)")
+		resolveURL := fs.Bool("resolve-url", false, "Resolve the control plane hostname and reject blocked addresses it points at")
+		proxy := fs.String("proxy", "", "Proxy URL for control plane requests (default: HTTP_PROXY/HTTPS_PROXY)")
+		enrollAttempts := fs.Int("enroll-attempts", enroll.DefaultAttempts, "Enrollment attempts when the control plane is unreachable or returns 5xx")
 		repo := fs.String("repo", "", "Restic repository URL (legacy mode, use --token instead)")
 		password := fs.String("password", "", "Restic repository password (optional if server provides)")
 		passwordFile := fs.String("password-file", "", "Path to restic password file (optional, default: ~/.xentz-agent/restic.pw)")
+		passwordSource := fs.String("password-source", config.PasswordSourceFile, "Where to store the restic password: file or keychain")
+		autoInit := fs.Bool("auto-init", false, "Automatically initialize repository on backup if it doesn't exist (use with caution)")
+		uploadLimit := fs.String("upload-limit", "", "Upload bandwidth limit, e.g. 500K or 2M (per second, default: unlimited)")
+		downloadLimit := fs.String("download-limit", "", "Download bandwidth limit, e.g. 500K or 2M (per second, default: unlimited)")
+		oneFileSystem := fs.Bool("one-file-system", false, "Don't cross filesystem boundaries during backup")
+		excludeCaches := fs.Bool("exclude-caches", false, "Skip directories containing a CACHEDIR.TAG file")
 
 		var includes multiFlag
 		var excludes multiFlag
 		fs.Var(&includes, "include", "Include path (repeatable)")
+		var excludeFiles multiFlag
+		var tags multiFlag
+		fs.Var(&tags, "tag", "Snapshot tag (repeatable)")
 		fs.Var(&excludes, "exclude", "Exclude glob (repeatable)")
+		fs.Var(&excludeFiles, "exclude-file", "File with exclude patterns (repeatable)")
 
 		if err := fs.Parse(os.Args[2:]); err != nil {
-			log.Fatalf("parse flags: %v", err)
+			logx.Fatalf("parse flags: %v", err)
+		}
+		logx.AddSecret(*token, *password, *runPassword)
+		if *passwordSource != config.PasswordSourceFile && *passwordSource != config.PasswordSourceKeychain {
+			logx.Fatalf("--password-source must be %q or %q", config.PasswordSourceFile, config.PasswordSourceKeychain)
+		}
+
+		// Fail before enrolling rather than after
+		if (*runAs != "" || *runPassword != "") && !*system {
+			logx.Exitf(exitUsage, "--run-as and --run-password need --system")
+		}
+		freq, err := frequencyFlag(*frequency, *dayOfWeek, *dayOfMonth)
+		if err != nil {
+			logx.Exitf(exitUsage, "%v", err)
+		}
+		if *system {
+			if runtime.GOOS != "linux" && runtime.GOOS != "darwin" && runtime.GOOS != "windows" {
+				logx.Exitf(exitUsage, "--system is only supported on Linux, macOS and Windows")
+			}
+			if err := install.RequireAdmin(); err != nil {
+				logx.Fatalf("install --system: %v", err)
+			}
 		}
 
 		cfgFile, err = config.ResolvePath(*configPath)
 		if err != nil {
-			log.Fatalf("resolve config path: %v", err)
+			logx.Fatalf("resolve config path: %v", err)
 		}
 
 		// Try to load existing config to check if already enrolled
@@ -113,42 +973,87 @@ func main() {
 		// Determine user ID
 		home, err := os.UserHomeDir()
 		if err != nil {
-			log.Fatalf("get home directory: %v", err)
+			logx.Fatalf("get home directory: %v", err)
 		}
 		configDir := filepath.Join(home, ".xentz-agent")
 		userID, err := enroll.GetOrCreateUserID(configDir)
 		if err != nil {
-			log.Fatalf("get user ID: %v", err)
+			logx.Fatalf("get user ID: %v", err)
 		}
 		cfg.UserID = userID
 
-		// Handle enrollment flow (token-based) or legacy flow (direct repo)
-		if *token != "" {
-			// Token-based enrollment
-			if *server == "" {
-				log.Fatal("--server is required when using --token")
+		// TLS and proxy settings are needed before enrollment talks to the control plane
+		if *caCert != "" {
+			cfg.CACertFile = *caCert
+		}
+		if *clientCert != "" {
+			cfg.ClientCertFile = *clientCert
+		}
+		if *clientKey != "" {
+			cfg.ClientKeyFile = *clientKey
+		}
+		if *serverFingerprint != "" {
+			cfg.ServerCertFingerprint = *serverFingerprint
+		}
+		if *proxy != "" {
+			cfg.ProxyURL = *proxy
+		}
+		if *strictURL {
+			cfg.StrictServerValidation = true
+		}
+		if *resolveURL {
+			cfg.ResolveServerHost = true
+		}
+		if *httpTimeout < 0 {
+			logx.Fatal("--http-timeout must not be negative")
+		}
+		if *httpTimeout > 0 {
+			clamped := httpx.ClampTimeout(*httpTimeout)
+			if clamped != *httpTimeout {
+				logx.Printf("warning: --http-timeout %s out of range, using %s", *httpTimeout, clamped)
+			}
+			cfg.HTTPTimeoutSeconds = int(clamped.Seconds())
+		}
+		configureHTTP(cfg)
+
+		// Handle enrollment flow (token-based or provisioning file) or legacy flow (direct repo)
+		if *token != "" || *enrollFile != "" {
+			if *token != "" && *enrollFile != "" {
+				logx.Fatal("use either --token or --enroll-file, not both")
+			}
+			// Token-based enrollment needs the control plane; a provisioning file doesn't
+			if *token != "" && *server == "" {
+				logx.Fatal("--server is required when using --token")
 			}
 
 			// Check if already enrolled
 			if enroll.IsEnrolled(cfg.TenantID, cfg.DeviceID) {
-				log.Println("Device is already enrolled. Using existing configuration.")
-				log.Printf("  Tenant ID: %s", cfg.TenantID)
-				log.Printf("  Device ID: %s", cfg.DeviceID)
+				logx.Println("Device is already enrolled. Using existing configuration.")
+				logx.Printf("  Tenant ID: %s", cfg.TenantID)
+				logx.Printf("  Device ID: %s", cfg.DeviceID)
 
 				// Update server URL if a new one is provided (allows switching servers)
 				if *server != "" && cfg.ServerURL != *server {
-					log.Printf("  Updating server URL: %s -> %s", cfg.ServerURL, *server)
+					logx.Printf("  Updating server URL: %s -> %s", cfg.ServerURL, *server)
 					cfg.ServerURL = *server
 				}
 			} else {
 				// Perform enrollment
-				log.Println("Enrolling device with control plane...")
-				// Pass include paths to enrollment so control plane can store them
-				enrollmentResult, err := enroll.Enroll(*token, *server, includes)
+				var enrollmentResult *enroll.EnrollmentResult
+				if *enrollFile != "" {
+					logx.Printf("Enrolling device from %s...", *enrollFile)
+					enrollmentResult, err = enroll.FromFile(*enrollFile)
+				} else {
+					logx.Println("Enrolling device with control plane...")
+					// Pass include paths to enrollment so control plane can store them
+					enrollmentResult, err = enroll.Enroll(*token, *server, includes, *enrollAttempts)
+				}
 				if err != nil {
-					log.Fatalf("enrollment failed: %v", err)
+					logx.Fatalf("enrollment failed: %v", err)
 				}
 
+				logx.AddSecret(enrollmentResult.DeviceAPIKey, enrollmentResult.Password)
+
 				// Store enrollment data (do not store InstallToken after enrollment)
 				cfg.TenantID = enrollmentResult.TenantID
 				cfg.DeviceID = enrollmentResult.DeviceID
@@ -156,349 +1061,1128 @@ func main() {
 				cfg.ServerURL = *server
 				cfg.Restic.Repository = enrollmentResult.RepoPath
 
-				log.Printf("Enrollment successful:")
-				log.Printf("  Tenant ID: %s", cfg.TenantID)
-				log.Printf("  Device ID: %s", cfg.DeviceID)
-				log.Printf("  Repository: %s", cfg.Restic.Repository)
+				logx.Printf("Enrollment successful:")
+				logx.Printf("  Tenant ID: %s", cfg.TenantID)
+				logx.Printf("  Device ID: %s", cfg.DeviceID)
+				logx.Printf("  Repository: %s", cfg.Restic.Repository)
 
 				// Handle password from server or user input
 				if enrollmentResult.Password != "" {
 					// Server provided password
-					if *passwordFile == "" {
-						pwFile := filepath.Join(home, ".xentz-agent", "restic.pw")
-						passwordFile = &pwFile
-					}
-					if err := os.MkdirAll(filepath.Dir(*passwordFile), 0o700); err != nil {
-						log.Fatalf("password dir: %v", err)
-					}
-					if err := os.WriteFile(*passwordFile, []byte(enrollmentResult.Password+"\n"), 0o600); err != nil {
-						log.Fatalf("write password file: %v", err)
-					}
-					cfg.Restic.PasswordFile = *passwordFile
+					storePassword(&cfg, enrollmentResult.Password, *passwordFile, *passwordSource, home)
 				} else if *password != "" {
 					// User provided password
-					if *passwordFile == "" {
-						pwFile := filepath.Join(home, ".xentz-agent", "restic.pw")
-						passwordFile = &pwFile
-					}
-					if err := os.MkdirAll(filepath.Dir(*passwordFile), 0o700); err != nil {
-						log.Fatalf("password dir: %v", err)
-					}
-					if err := os.WriteFile(*passwordFile, []byte(*password+"\n"), 0o600); err != nil {
-						log.Fatalf("write password file: %v", err)
-					}
-					cfg.Restic.PasswordFile = *passwordFile
+					storePassword(&cfg, *password, *passwordFile, *passwordSource, home)
 				} else {
-					log.Fatal("Password required: either server must provide it or use --password flag")
+					logx.Fatal("Password required: either server must provide it or use --password flag")
 				}
 			}
 		} else if *repo != "" {
 			// Legacy mode: direct repository URL
-			log.Println("Using legacy mode with direct repository URL")
+			logx.Println("Using legacy mode with direct repository URL")
 			if *password == "" {
-				log.Fatal("--password is required when using --repo (legacy mode)")
+				logx.Fatal("--password is required when using --repo (legacy mode)")
 			}
 
-			pwFile := *passwordFile
-			if pwFile == "" {
-				pwFile = filepath.Join(home, ".xentz-agent", "restic.pw")
-			}
-
-			if err := os.MkdirAll(filepath.Dir(pwFile), 0o700); err != nil {
-				log.Fatalf("password dir: %v", err)
-			}
-			if err := os.WriteFile(pwFile, []byte(*password+"\n"), 0o600); err != nil {
-				log.Fatalf("write password file: %v", err)
-			}
+			storePassword(&cfg, *password, *passwordFile, *passwordSource, home)
 
 			cfg.Restic.Repository = *repo
-			cfg.Restic.PasswordFile = pwFile
 			if *server != "" {
 				cfg.ServerURL = *server
 			}
 		} else {
-			log.Fatal("Either --token (recommended) or --repo (legacy) is required")
+			logx.Fatal("Either --token (recommended), --enroll-file or --repo (legacy) is required")
 		}
 
 		// Update schedule and paths
 		if *dailyAt != "" {
 			cfg.Schedule.DailyAt = *dailyAt
 		}
+		if *interval != 0 {
+			cfg.Schedule.IntervalMinutes = int(interval.Minutes())
+		}
+		if freq != "" {
+			cfg.Schedule.Frequency = freq
+			cfg.Schedule.DayOfWeek = *dayOfWeek
+			cfg.Schedule.DayOfMonth = *dayOfMonth
+		}
+		if *retentionAt != "" {
+			cfg.Schedule.RetentionWeeklyAt = *retentionAt
+		}
+		if *retentionDay != "" {
+			cfg.Schedule.RetentionDay = *retentionDay
+		}
+		if *jitter < 0 {
+			logx.Fatal("--jitter must not be negative")
+		}
+		if *jitter > 0 {
+			cfg.Schedule.JitterSeconds = int(jitter.Seconds())
+		}
+		if *catchUp {
+			cfg.Schedule.CatchUp = true
+		}
+		if *system {
+			cfg.SystemService = true
+			cfg.SystemUser = *runAs
+		}
 		if len(includes) > 0 {
 			cfg.Include = []string(includes)
 		}
 		if len(excludes) > 0 {
 			cfg.Exclude = []string(excludes)
 		}
+		if len(excludeFiles) > 0 {
+			cfg.ExcludeFiles = []string(excludeFiles)
+		}
+		if len(tags) > 0 {
+			cfg.Tags = []string(tags)
+		}
+		// Tag snapshots with the enrolled device so shared repositories can tell devices apart
+		if cfg.DeviceID != "" && !slices.Contains(cfg.Tags, config.DeviceTag(cfg.DeviceID)) {
+			cfg.Tags = append(cfg.Tags, config.DeviceTag(cfg.DeviceID))
+		}
+		if *autoInit {
+			cfg.AutoInit = true
+		}
+		if *oneFileSystem {
+			cfg.Restic.OneFileSystem = true
+		}
+		if *excludeCaches {
+			cfg.Restic.ExcludeCaches = true
+		}
+		if *uploadLimit != "" {
+			kib, err := config.ParseSizeKiB(*uploadLimit)
+			if err != nil {
+				logx.Fatalf("--upload-limit: %v", err)
+			}
+			cfg.Restic.UploadLimitKiB = kib
+		}
+		if *downloadLimit != "" {
+			kib, err := config.ParseSizeKiB(*downloadLimit)
+			if err != nil {
+				logx.Fatalf("--download-limit: %v", err)
+			}
+			cfg.Restic.DownloadLimitKiB = kib
+		}
 
 		// Validate repository is set
 		if cfg.Restic.Repository == "" {
-			log.Fatal("Repository URL is required")
+			logx.Fatal("Repository URL is required")
 		}
-		if cfg.Restic.PasswordFile == "" {
-			log.Fatal("Password file is required")
+		if cfg.Restic.PasswordFile == "" && cfg.Restic.PasswordSource != config.PasswordSourceKeychain &&
+			len(cfg.Restic.PasswordCommand) == 0 && os.Getenv("RESTIC_PASSWORD") == "" {
+			logx.Fatal("Password file is required")
 		}
 
 		if len(cfg.Include) == 0 {
-			log.Println("note: no --include provided; backups will likely do nothing until you add include paths")
+			logx.Println("note: no --include provided; backups will likely do nothing until you add include paths")
+		}
+
+		if err := config.Validate(cfg); err != nil {
+			logx.Fatalf("invalid config:\n%v", err)
 		}
 
 		// Write config
 		if err := config.Write(cfgFile, cfg); err != nil {
-			log.Fatalf("write config: %v", err)
+			logx.Fatalf("write config: %v", err)
 		}
 
 		// Install scheduler
-		if err := install.Install(cfgFile); err != nil {
-			log.Fatalf("install scheduler: %v", err)
+		if err := install.Install(cfgFile, install.Options{RunNow: *runNow, RunPassword: *runPassword}); err != nil {
+			logx.Fatalf("install scheduler: %v", err)
 		}
 
-		log.Println("install complete ✅")
+		logx.Println("install complete ✅")
 		return
 
-	case "backup":
+	case "reconfigure":
 		fs := flag.NewFlagSet(cmd, flag.ExitOnError)
 		configPath := fs.String("config", "", "Config path override")
-		autoInit := fs.Bool("auto-init", false, "Automatically initialize repository if it doesn't exist (use with caution)")
+		dailyAt := fs.String("daily-at", "", "Daily time HH:MM (24h); switches an --interval schedule back to daily")
+		interval := fs.Duration("interval", 0, "Back up every interval instead of daily, e.g. 4h")
+		frequency := fs.String("frequency", "", "Backup frequency: daily, weekly or monthly")
+		dayOfWeek := fs.String("day-of-week", "", "Day for weekly backups, sun..sat (implies --frequency weekly)")
+		dayOfMonth := fs.Int("day-of-month", 0, "Day for monthly backups, 1-28 (implies --frequency monthly)")
+		retentionAt := fs.String("retention-at", "", "Weekly retention time HH:MM (24h)")
+		retentionDay := fs.String("retention-day", "", "Weekly retention day, sun..sat")
+		jitter := fs.Duration("jitter", 0, "Random delay of up to this duration before each scheduled run (0 to turn off)")
+		runNow := fs.Bool("run-now", false, "Also run the backup once right after reinstalling the schedule")
+		runPassword := fs.String("run-password", "", "Windows: password of the system_user account (prompted for if not set)")
+
+		var includes, addIncludes, removeIncludes multiFlag
+		var excludes, addExcludes, removeExcludes multiFlag
+		fs.Var(&includes, "include", "Replace the include paths (repeatable)")
+		fs.Var(&addIncludes, "add-include", "Add an include path (repeatable)")
+		fs.Var(&removeIncludes, "remove-include", "Remove an include path (repeatable)")
+		fs.Var(&excludes, "exclude", "Replace the exclude globs (repeatable)")
+		fs.Var(&addExcludes, "add-exclude", "Add an exclude glob (repeatable)")
+		fs.Var(&removeExcludes, "remove-exclude", "Remove an exclude glob (repeatable)")
+
 		if err := fs.Parse(os.Args[2:]); err != nil {
-			log.Fatalf("parse flags: %v", err)
+			logx.Fatalf("parse flags: %v", err)
+		}
+		set := map[string]bool{}
+		fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		delete(set, "config")
+		delete(set, "run-now")
+		delete(set, "run-password")
+		if len(set) == 0 {
+			logx.Exitf(exitUsage, "reconfigure: nothing to change (see xentz-agent reconfigure -h)")
 		}
 
+		logx.AddSecret(*runPassword)
+
 		cfgFile, err = config.ResolvePath(*configPath)
 		if err != nil {
-			log.Fatalf("resolve config path: %v", err)
+			logx.Fatalf("resolve config path: %v", err)
 		}
 
-		// Read local config to get enrollment data (device_id, device_api_key, server_url)
-		localCfg, err := config.Read(cfgFile)
+		// Only schedule and path settings change; enrollment and repository settings are kept as-is
+		cfg, err := config.Read(cfgFile)
 		if err != nil {
-			log.Fatalf("read config: %v", err)
+			logx.Exitf(exitConfig, "read config: %v (run install first)", err)
 		}
 
-		// Fetch config from server (with fallback to cached config)
-		var cfg config.Config
-		if localCfg.DeviceAPIKey != "" && localCfg.ServerURL != "" {
-			// Device is enrolled, fetch config from server
-			fetchedCfg, fetchErr := config.LoadWithFallback(localCfg.ServerURL, localCfg.DeviceAPIKey)
-			if fetchErr != nil {
-				log.Fatalf("failed to load config: %v", fetchErr)
-			}
-			cfg = fetchedCfg
-			// Preserve enrollment data from local config
-			cfg.TenantID = localCfg.TenantID
-			cfg.DeviceID = localCfg.DeviceID
-			cfg.DeviceAPIKey = localCfg.DeviceAPIKey
-			cfg.ServerURL = localCfg.ServerURL
-			cfg.UserID = localCfg.UserID
-			// Always preserve password file path from local config (it's a local file path)
-			cfg.Restic.PasswordFile = localCfg.Restic.PasswordFile
-		} else {
-			// Legacy mode: use local config directly
-			log.Println("Using local config (device not enrolled or legacy mode)")
-			cfg = localCfg
+		if *dailyAt != "" {
+			cfg.Schedule.DailyAt = *dailyAt
+			cfg.Schedule.IntervalMinutes = 0
 		}
-
-		// KILL-SWITCH: Final safety check - if device is disabled, exit immediately
-		if cfg.Enabled != nil && !*cfg.Enabled {
-			log.Fatalf("device is disabled by server (kill-switch activated). All operations stopped.")
+		if *interval != 0 {
+			cfg.Schedule.IntervalMinutes = int(interval.Minutes())
 		}
-
-		st, err := state.New()
+		freq, err := frequencyFlag(*frequency, *dayOfWeek, *dayOfMonth)
 		if err != nil {
-			log.Fatalf("state init: %v", err)
+			logx.Exitf(exitUsage, "%v", err)
 		}
+		if freq != "" {
+			cfg.Schedule.Frequency = freq
+			cfg.Schedule.DayOfWeek = *dayOfWeek
+			cfg.Schedule.DayOfMonth = *dayOfMonth
+		}
+		if *retentionAt != "" {
+			cfg.Schedule.RetentionWeeklyAt = *retentionAt
+		}
+		if *retentionDay != "" {
+			cfg.Schedule.RetentionDay = *retentionDay
+		}
+		if set["jitter"] {
+			if *jitter < 0 {
+				logx.Exitf(exitUsage, "--jitter must not be negative")
+			}
+			cfg.Schedule.JitterSeconds = int(jitter.Seconds())
+		}
+		cfg.Include = editList(cfg.Include, includes, addIncludes, removeIncludes)
+		cfg.Exclude = editList(cfg.Exclude, excludes, addExcludes, removeExcludes)
 
-		// Track start time for reporting
-		startTime := time.Now()
-
-		ctx, cancel := context.WithTimeout(context.Background(), 6*time.Hour)
-		defer cancel()
-
-		res := backup.Run(ctx, cfg, *autoInit)
-		if err := st.SaveLastRun(res); err != nil {
-			log.Printf("save last run: %v", err)
+		if err := config.Validate(cfg); err != nil {
+			logx.Exitf(exitConfig, "invalid config:\n%v", err)
+		}
+		if len(cfg.Include) == 0 && len(cfg.Profiles) == 0 {
+			logx.Println("note: no include paths left; backups will likely do nothing until you add some")
+		}
+		pathsChanged := set["include"] || set["add-include"] || set["remove-include"] ||
+			set["exclude"] || set["add-exclude"] || set["remove-exclude"]
+		if pathsChanged && enroll.IsEnrolled(cfg.TenantID, cfg.DeviceID) {
+			logx.Println("note: this device is enrolled; include/exclude paths set by the control plane take precedence at run time")
 		}
 
-		// Send reports (non-blocking)
-		if localCfg.DeviceID != "" && localCfg.DeviceAPIKey != "" && localCfg.ServerURL != "" {
-			// Send pending reports first (max 20, oldest first)
-			_ = report.SendPendingReports(localCfg.ServerURL, localCfg.DeviceAPIKey, 20)
+		if err := config.Write(cfgFile, cfg); err != nil {
+			logx.Fatalf("write config: %v", err)
+		}
+		if err := install.Install(cfgFile, install.Options{RunNow: *runNow, RunPassword: *runPassword}); err != nil {
+			logx.Fatalf("install scheduler: %v", err)
+		}
+
+		logx.Println("reconfigure complete ✅")
+		return
+
+	case "uninstall":
+		fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+		configPath := fs.String("config", "", "Config path override")
+		purge := fs.Bool("purge", false, "Also remove ~/.xentz-agent (config, state, spool, logs)")
+		if err := fs.Parse(os.Args[2:]); err != nil {
+			logx.Fatalf("parse flags: %v", err)
+		}
 
-			// Create report for current run
-			finishedTime := time.Now()
-			reportStatus := "success"
-			if res.Status == "error" {
-				reportStatus = "failure"
+		cfgFile, err = config.ResolvePath(*configPath)
+		if err != nil {
+			logx.Fatalf("resolve config path: %v", err)
+		}
+
+		if err := install.Uninstall(cfgFile); err != nil {
+			logx.Fatalf("uninstall scheduler: %v", err)
+		}
+
+		if *purge {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				logx.Fatalf("get home directory: %v", err)
 			}
-			backupReport := report.Report{
-				DeviceID:       localCfg.DeviceID,
-				Job:            "backup",
-				StartedAt:      startTime.UTC().Format(time.RFC3339),
-				FinishedAt:     finishedTime.UTC().Format(time.RFC3339),
-				Status:         reportStatus,
-				DurationMS:     res.DurationMS,
-				FilesTotal:     res.FilesTotal,
-				BytesTotal:     res.BytesTotal,
-				DataAddedBytes: res.DataAddedBytes,
-				SnapshotID:     res.SnapshotID,
+			agentDir := filepath.Join(home, ".xentz-agent")
+			// A config outside the agent directory (--config override) is removed explicitly
+			if rel, err := filepath.Rel(agentDir, cfgFile); err != nil || strings.HasPrefix(rel, "..") {
+				if err := os.Remove(cfgFile); err == nil {
+					logx.Printf("removed %s", cfgFile)
+				} else if !os.IsNotExist(err) {
+					logx.Fatalf("remove config: %v", err)
+				}
 			}
-			if res.Error != "" {
-				backupReport.Error = res.Error
+			if _, err := os.Stat(agentDir); err == nil {
+				if err := os.RemoveAll(agentDir); err != nil {
+					logx.Fatalf("remove %s: %v", agentDir, err)
+				}
+				logx.Printf("removed %s", agentDir)
 			}
+		}
 
-			// Send current report (spools if it fails)
-			_ = report.SendReportWithSpool(localCfg.ServerURL, localCfg.DeviceAPIKey, backupReport)
+		logx.Println("uninstall complete ✅")
+		return
 
-			// Cleanup old reports periodically (every run for simplicity in MVP)
-			_ = report.CleanupOldReports(30 * 24 * time.Hour)
+	case "deregister":
+		fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+		configPath := fs.String("config", "", "Config path override")
+		uninstall := fs.Bool("uninstall", false, "Also remove the scheduled tasks")
+		if err := fs.Parse(os.Args[2:]); err != nil {
+			logx.Fatalf("parse flags: %v", err)
 		}
 
+		cfgFile, err = config.ResolvePath(*configPath)
+		if err != nil {
+			logx.Fatalf("resolve config path: %v", err)
+		}
+
+		localCfg, err := config.Read(cfgFile)
+		if err != nil {
+			logx.Fatalf("read config: %v", err)
+		}
+		logx.SetDeviceID(localCfg.DeviceID)
+		logx.AddSecret(localCfg.DeviceAPIKey)
+		configureHTTP(localCfg)
+
+		// Already deregistered (or never enrolled): only the local cleanup is left to do
+		if localCfg.DeviceAPIKey != "" && localCfg.ServerURL != "" {
+			if err := enroll.Deregister(localCfg.ServerURL, localCfg.DeviceAPIKey); err != nil {
+				logx.Fatalf("deregister failed ❌: %v", err)
+			}
+			logx.Printf("device %s revoked by the control plane", localCfg.DeviceID)
+		}
+
+		// Clear the server-issued identifiers; server_url and user_id are kept for re-enrollment
+		localCfg.TenantID = ""
+		localCfg.DeviceID = ""
+		localCfg.DeviceAPIKey = ""
+		localCfg.InstallToken = ""
+		if err := config.Write(cfgFile, localCfg); err != nil {
+			logx.Fatalf("write config: %v", err)
+		}
+		// The cached server config belongs to the revoked device
+		if cachePath, err := config.GetCachedConfigPath(); err == nil {
+			if err := os.Remove(cachePath); err != nil && !os.IsNotExist(err) {
+				logx.Printf("warning: remove cached config: %v", err)
+			}
+		}
+
+		if *uninstall {
+			if err := install.Uninstall(cfgFile); err != nil {
+				logx.Fatalf("uninstall scheduler: %v", err)
+			}
+		}
+
+		logx.Println("deregister complete ✅")
+		return
+
+	case "backup":
+		fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+		configPath := fs.String("config", "", "Config path override")
+		autoInit := fs.Bool("auto-init", false, "Automatically initialize repository if it doesn't exist (use with caution)")
+		profile := fs.String("profile", "", "Backup profile name (default: top-level include/exclude)")
+		dryRun := fs.Bool("dry-run", false, "Show what would be backed up without writing to the repository")
+		quiet := fs.Bool("quiet", false, "Don't stream restic output; only log throttled progress (used by scheduled runs)")
+		jitter := fs.Duration("jitter", 0, "Sleep a random time up to this duration before starting (used by scheduled runs)")
+		timeoutHours := fs.Int("timeout-hours", 0, "Give up after this many hours (default: config timeouts.backup_hours, else 6)")
+		if err := fs.Parse(os.Args[2:]); err != nil {
+			logx.Fatalf("parse flags: %v", err)
+		}
+
+		cfgFile, err = config.ResolvePath(*configPath)
+		if err != nil {
+			logx.Fatalf("resolve config path: %v", err)
+		}
+
+		sleepJitter(*jitter)
+
+		localCfg, cfg := loadRunConfig(cfgFile)
+		cfg, err = cfg.ForProfile(*profile)
+		if err != nil {
+			logx.Exitf(exitConfig, "%v", err)
+		}
+		overrideTimeouts(&cfg.Timeouts, *timeoutHours, 0, 0)
+
+		st, err := state.New()
+		if err != nil {
+			logx.Fatalf("state init: %v", err)
+		}
+
+		// Auto-init can be requested by flag, by the server config, or persisted locally at install time
+		res, err := runBackupJob(st, localCfg, cfg, backup.Options{
+			AutoInit: *autoInit || cfg.AutoInit || localCfg.AutoInit,
+			DryRun:   *dryRun,
+			Quiet:    *quiet,
+			Verbose:  verbose,
+		}, runLockWait)
+		if err != nil {
+			logx.Fatalf("backup: %v", err)
+		}
+
+		// Dry runs are previews only: no state is saved and nothing is reported
+		if *dryRun {
+			if res.Status != "success" && res.Status != "degraded" {
+				logx.Printf("[dry run] backup failed ❌: %s", res.Error)
+				os.Exit(exitCode(res))
+			}
+			logx.Printf("[dry run] no data was written. Would back up: files=%d bytes=%d (%s) data_added=%d (%s)",
+				res.FilesTotal, res.BytesTotal, humanize.Bytes(res.BytesTotal), res.DataAddedBytes, humanize.Bytes(res.DataAddedBytes))
+			if res.ErrorsCount > 0 {
+				logx.Printf("[dry run] warning: %s", res.Error)
+			}
+			return
+		}
+
+		if res.Status == "skipped" {
+			logx.Printf("backup skipped ⏭️: %s", res.SkipReason)
+			os.Exit(exitCode(res))
+		}
+		if res.Status == "degraded" {
+			logx.Printf("backup ok but degraded ⚠️: snapshot=%s: %s", res.SnapshotID, res.Error)
+			os.Exit(exitCode(res))
+		}
 		if res.Status != "success" {
-			log.Printf("backup failed ❌: %s", res.Error)
-			os.Exit(1)
+			logx.Printf("backup failed ❌: %s", res.Error)
+			os.Exit(exitCode(res))
 		}
-		log.Printf("backup ok ✅: duration=%s bytes_sent=%d", res.Duration, res.BytesSent)
+		logx.Printf("backup ok ✅: duration=%s bytes_sent=%d (%s)", res.Duration, res.BytesSent, humanize.Bytes(res.BytesSent))
 		return
 
 	case "retention":
 		fs := flag.NewFlagSet(cmd, flag.ExitOnError)
 		configPath := fs.String("config", "", "Config path override")
+		profile := fs.String("profile", "", "Backup profile name (default: top-level retention policy)")
+		dryRun := fs.Bool("dry-run", false, "Show which snapshots would be removed without deleting anything")
+		quiet := fs.Bool("quiet", false, "Don't stream restic output")
+		jitter := fs.Duration("jitter", 0, "Sleep a random time up to this duration before starting (used by scheduled runs)")
+		timeoutHours := fs.Int("timeout-hours", 0, "Give up after this many hours (default: config timeouts.retention_hours, else 2)")
+		if err := fs.Parse(os.Args[2:]); err != nil {
+			logx.Fatalf("parse flags: %v", err)
+		}
+
+		cfgFile, err = config.ResolvePath(*configPath)
+		if err != nil {
+			logx.Fatalf("resolve config path: %v", err)
+		}
+
+		sleepJitter(*jitter)
+
+		localCfg, cfg := loadRunConfig(cfgFile)
+		cfg, err = cfg.ForProfile(*profile)
+		if err != nil {
+			logx.Exitf(exitConfig, "%v", err)
+		}
+		overrideTimeouts(&cfg.Timeouts, 0, *timeoutHours, 0)
+
+		st, err := state.New()
+		if err != nil {
+			logx.Fatalf("state init: %v", err)
+		}
+
+		// Released right after restic finishes; the os.Exit paths below would skip a defer
+		unlock := func() {}
+		if !*dryRun {
+			// Laptops often miss the nightly backup; a scheduled retention run is a chance to catch up
+			catchUpBackup(st, localCfg, cfg, verbose)
+
+			unlock, err = st.WaitLock(runLockWait)
+			if errors.Is(err, state.ErrLocked) {
+				logx.Exitf(exitLocked, "retention: %v", err)
+			}
+			if err != nil {
+				logx.Fatalf("retention: %v", err)
+			}
+
+			// Flush reports spooled by earlier runs before starting
+			flushPendingReports(localCfg)
+		}
+
+		// Retention gets a shorter timeout than backups (default 2 hours): a prune that runs
+		// longer is usually stuck. The connectivity check fails faster if the repository is unreachable
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeouts.Retention())
+		defer cancel()
+
+		res := backup.RunRetention(ctx, cfg, backup.Options{DryRun: *dryRun, Quiet: *quiet, Verbose: verbose})
+		unlock()
+
+		// Dry runs are previews only: no state is saved and nothing is reported
+		if *dryRun {
+			if res.Status != "success" {
+				logx.Printf("[dry run] retention failed ❌: %s", res.Error)
+				os.Exit(exitCode(res))
+			}
+			logx.Printf("[dry run] no snapshots were removed: duration=%s", res.Duration)
+			return
+		}
+
+		recordRun(st, localCfg, "retention", res)
+
+		if res.Status != "success" {
+			logx.Printf("retention failed ❌: %s", res.Error)
+			os.Exit(exitCode(res))
+		}
+		logx.Printf("retention ok ✅: duration=%s", res.Duration)
+		return
+
+	case "run":
+		fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+		configPath := fs.String("config", "", "Config path override")
+		quiet := fs.Bool("quiet", false, "Don't stream restic output; only log throttled progress (used by scheduled runs)")
+		jitter := fs.Duration("jitter", 0, "Sleep a random time up to this duration before starting (used by scheduled runs)")
+		backupTimeout := fs.Int("backup-timeout-hours", 0, "Backup time limit in hours (default: config timeouts.backup_hours, else 6)")
+		retentionTimeout := fs.Int("retention-timeout-hours", 0, "Retention time limit in hours (default: config timeouts.retention_hours, else 2)")
+		checkTimeout := fs.Int("check-timeout-hours", 0, "Check time limit in hours (default: config timeouts.check_hours, else 6)")
+		if err := fs.Parse(os.Args[2:]); err != nil {
+			logx.Fatalf("parse flags: %v", err)
+		}
+
+		cfgFile, err = config.ResolvePath(*configPath)
+		if err != nil {
+			logx.Fatalf("resolve config path: %v", err)
+		}
+
+		sleepJitter(*jitter)
+
+		localCfg, cfg := loadRunConfig(cfgFile)
+		overrideTimeouts(&cfg.Timeouts, *backupTimeout, *retentionTimeout, *checkTimeout)
+		st, err := state.New()
+		if err != nil {
+			logx.Fatalf("state init: %v", err)
+		}
+		os.Exit(runJobs(st, localCfg, cfg, *quiet, verbose))
+
+	case "snapshots":
+		fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+		configPath := fs.String("config", "", "Config path override")
+		jsonOut := fs.Bool("json", false, "Print snapshots as JSON")
+		if err := fs.Parse(os.Args[2:]); err != nil {
+			logx.Fatalf("parse flags: %v", err)
+		}
+
+		cfgFile, err = config.ResolvePath(*configPath)
+		if err != nil {
+			logx.Fatalf("resolve config path: %v", err)
+		}
+
+		_, cfg := loadRunConfig(cfgFile)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+
+		snapshots, err := backup.ListSnapshots(ctx, cfg)
+		if err != nil {
+			logx.Fatalf("list snapshots: %v", err)
+		}
+
+		if *jsonOut {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(snapshots); err != nil {
+				logx.Fatalf("encode snapshots: %v", err)
+			}
+			return
+		}
+
+		if len(snapshots) == 0 {
+			fmt.Println("no snapshots")
+			return
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tTIME\tHOST\tPATHS\tTAGS")
+		for _, snap := range snapshots {
+			id := snap.ShortID
+			if id == "" {
+				id = snap.ID
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+				id,
+				snap.Time.Local().Format("2006-01-02 15:04:05"),
+				snap.Hostname,
+				strings.Join(snap.Paths, ", "),
+				strings.Join(snap.Tags, ", "))
+		}
+		tw.Flush()
+		return
+
+	case "unlock":
+		fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+		configPath := fs.String("config", "", "Config path override")
+		removeAll := fs.Bool("remove-all", false, "Remove all locks, even those of running operations (use with caution)")
+		if err := fs.Parse(os.Args[2:]); err != nil {
+			logx.Fatalf("parse flags: %v", err)
+		}
+
+		cfgFile, err = config.ResolvePath(*configPath)
+		if err != nil {
+			logx.Fatalf("resolve config path: %v", err)
+		}
+
+		_, cfg := loadRunConfig(cfgFile)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+
+		if err := backup.Unlock(ctx, cfg, *removeAll); err != nil {
+			logx.Fatalf("unlock: %v", err)
+		}
+		logx.Println("unlock ok ✅")
+		return
+
+	case "stats":
+		fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+		configPath := fs.String("config", "", "Config path override")
+		mode := fs.String("mode", "", "Only run this restic stats mode (default: restore-size and raw-data)")
+		timeout := fs.Duration("timeout", time.Hour, "Give up after this long")
+		jsonOut := fs.Bool("json", false, "Print the stats as JSON")
+		if err := fs.Parse(os.Args[2:]); err != nil {
+			logx.Fatalf("parse flags: %v", err)
+		}
+
+		cfgFile, err = config.ResolvePath(*configPath)
+		if err != nil {
+			logx.Fatalf("resolve config path: %v", err)
+		}
+
+		_, cfg := loadRunConfig(cfgFile)
+
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+
+		modes := []string{backup.StatsModeRestoreSize, backup.StatsModeRawData}
+		if *mode != "" {
+			modes = []string{*mode}
+		}
+		st, err := state.New()
+		if err != nil {
+			logx.Fatalf("state init: %v", err)
+		}
+		var results []state.RepoStats
+		for _, m := range modes {
+			stats, err := backup.RepoStats(ctx, cfg, m)
+			if err != nil {
+				logx.Fatalf("stats: %v", err)
+			}
+			// Cached so run reports can include the repository size
+			if err := st.SaveRepoStats(stats); err != nil {
+				logx.Printf("warning: save stats: %v", err)
+			}
+			results = append(results, stats)
+		}
+
+		if *jsonOut {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(results); err != nil {
+				logx.Fatalf("encode stats: %v", err)
+			}
+			return
+		}
+
+		if *mode != "" {
+			s := results[0]
+			fmt.Printf("Repository stats (%s):\n  size:      %s\n  files:     %d\n  snapshots: %d\n",
+				s.Mode, humanize.Bytes(s.TotalSize), s.TotalFileCount, s.SnapshotsCount)
+			return
+		}
+		restore, raw := results[0], results[1]
+		fmt.Printf("Repository stats:\n  total size:  %s (all snapshots restored)\n  unique size: %s (stored in the repository)\n  snapshots:   %d\n",
+			humanize.Bytes(restore.TotalSize), humanize.Bytes(raw.TotalSize), raw.SnapshotsCount)
+		if raw.TotalSize > 0 {
+			fmt.Printf("  dedup ratio: %.2fx\n", float64(restore.TotalSize)/float64(raw.TotalSize))
+		}
+		if raw.CompressionRatio > 0 {
+			fmt.Printf("  compression: %.2fx\n", raw.CompressionRatio)
+		}
+		return
+
+	case "diff":
+		fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+		configPath := fs.String("config", "", "Config path override")
+		jsonOut := fs.Bool("json", false, "Print the summary as JSON")
 		if err := fs.Parse(os.Args[2:]); err != nil {
-			log.Fatalf("parse flags: %v", err)
+			logx.Fatalf("parse flags: %v", err)
+		}
+		if fs.NArg() < 1 || fs.NArg() > 2 {
+			logx.Fatal("usage: xentz-agent diff [--json] <snapshotA> [snapshotB]")
 		}
 
 		cfgFile, err = config.ResolvePath(*configPath)
 		if err != nil {
-			log.Fatalf("resolve config path: %v", err)
+			logx.Fatalf("resolve config path: %v", err)
+		}
+
+		_, cfg := loadRunConfig(cfgFile)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+		defer cancel()
+
+		summary, err := backup.Diff(ctx, cfg, fs.Arg(0), fs.Arg(1))
+		if err != nil {
+			logx.Fatalf("diff: %v", err)
+		}
+
+		if *jsonOut {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(summary); err != nil {
+				logx.Fatalf("encode diff: %v", err)
+			}
+			return
+		}
+
+		fmt.Printf("Changes from %s to %s:\n", summary.SourceSnapshot, summary.TargetSnapshot)
+		fmt.Printf("  added:   %d files, %d dirs, %s\n", summary.Added.Files, summary.Added.Dirs, humanize.Bytes(summary.Added.Bytes))
+		fmt.Printf("  removed: %d files, %d dirs, %s\n", summary.Removed.Files, summary.Removed.Dirs, humanize.Bytes(summary.Removed.Bytes))
+		fmt.Printf("  changed: %d files\n", summary.ChangedFiles)
+		return
+
+	case "mount":
+		fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+		configPath := fs.String("config", "", "Config path override")
+		if err := fs.Parse(os.Args[2:]); err != nil {
+			logx.Fatalf("parse flags: %v", err)
+		}
+		if fs.NArg() != 1 {
+			logx.Fatal("usage: xentz-agent mount [--config path] <dir>")
+		}
+
+		cfgFile, err = config.ResolvePath(*configPath)
+		if err != nil {
+			logx.Fatalf("resolve config path: %v", err)
+		}
+
+		_, cfg := loadRunConfig(cfgFile)
+
+		// No timeout: the mount stays up until restic is interrupted
+		logx.Printf("mounting repository at %s (press Ctrl-C to unmount)", fs.Arg(0))
+		if err := backup.Mount(context.Background(), cfg, fs.Arg(0)); err != nil {
+			logx.Fatalf("mount: %v", err)
+		}
+		return
+
+	case "rotate-key":
+		fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+		configPath := fs.String("config", "", "Config path override")
+		if err := fs.Parse(os.Args[2:]); err != nil {
+			logx.Fatalf("parse flags: %v", err)
+		}
+
+		cfgFile, err = config.ResolvePath(*configPath)
+		if err != nil {
+			logx.Fatalf("resolve config path: %v", err)
 		}
 
-		// Read local config to get enrollment data (device_id, device_api_key, server_url)
 		localCfg, err := config.Read(cfgFile)
 		if err != nil {
-			log.Fatalf("read config: %v", err)
+			logx.Fatalf("read config: %v", err)
+		}
+		logx.SetDeviceID(localCfg.DeviceID)
+		logx.AddSecret(localCfg.DeviceAPIKey)
+		configureHTTP(localCfg)
+		if localCfg.DeviceAPIKey == "" || localCfg.ServerURL == "" {
+			logx.Fatal("device is not enrolled (rotate-key requires device_api_key and server_url)")
 		}
 
-		// Fetch config from server (with fallback to cached config)
-		var cfg config.Config
-		if localCfg.DeviceAPIKey != "" && localCfg.ServerURL != "" {
-			// Device is enrolled, fetch config from server
-			fetchedCfg, fetchErr := config.LoadWithFallback(localCfg.ServerURL, localCfg.DeviceAPIKey)
-			if fetchErr != nil {
-				log.Fatalf("failed to load config: %v", fetchErr)
-			}
-			cfg = fetchedCfg
-			// Preserve enrollment data from local config
-			cfg.TenantID = localCfg.TenantID
-			cfg.DeviceID = localCfg.DeviceID
-			cfg.DeviceAPIKey = localCfg.DeviceAPIKey
-			cfg.ServerURL = localCfg.ServerURL
-			cfg.UserID = localCfg.UserID
-			// Always preserve password file path from local config (it's a local file path)
-			cfg.Restic.PasswordFile = localCfg.Restic.PasswordFile
-		} else {
-			// Legacy mode: use local config directly
-			log.Println("Using local config (device not enrolled or legacy mode)")
-			cfg = localCfg
+		if _, err := rotateDeviceKey(cfgFile, localCfg); err != nil {
+			logx.Fatalf("rotate-key failed ❌: %v", err)
+		}
+		logx.Println("rotate-key ok ✅ (new device API key saved)")
+		return
+
+	case "checkin":
+		fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+		configPath := fs.String("config", "", "Config path override")
+		if err := fs.Parse(os.Args[2:]); err != nil {
+			logx.Fatalf("parse flags: %v", err)
 		}
 
-		// KILL-SWITCH: Final safety check - if device is disabled, exit immediately
-		if cfg.Enabled != nil && !*cfg.Enabled {
-			log.Fatalf("device is disabled by server (kill-switch activated). All operations stopped.")
+		cfgFile, err = config.ResolvePath(*configPath)
+		if err != nil {
+			logx.Fatalf("resolve config path: %v", err)
+		}
+
+		localCfg, err := config.Read(cfgFile)
+		if err != nil {
+			logx.Fatalf("read config: %v", err)
+		}
+		logx.SetDeviceID(localCfg.DeviceID)
+		logx.AddSecret(localCfg.DeviceAPIKey)
+		configureHTTP(localCfg)
+		if !canReport(localCfg) {
+			logx.Fatal("device is not enrolled (checkin requires device_id, device_api_key and server_url)")
 		}
 
 		st, err := state.New()
 		if err != nil {
-			log.Fatalf("state init: %v", err)
+			logx.Fatalf("state init: %v", err)
+		}
+
+		// Check-ins can run when the nightly backup was missed, so they may catch up too
+		if localCfg.Schedule.CatchUp {
+			_, cfg := loadRunConfig(cfgFile)
+			catchUpBackup(st, localCfg, cfg, verbose)
+		}
+
+		checkin := report.Checkin{
+			DeviceID:     localCfg.DeviceID,
+			AgentVersion: version.Version,
+			OS:           runtime.GOOS,
+			Arch:         runtime.GOARCH,
+			SentAt:       time.Now().UTC().Format(time.RFC3339),
+		}
+		if last, ok, err := st.LoadLastRun(); err != nil {
+			logx.Printf("warning: load last run: %v", err)
+		} else if ok {
+			checkin.LastBackupStatus = last.Status
+			checkin.LastBackupAt = last.TimeUTC
+		}
+
+		// Deliver a previously spooled heartbeat first, then the current one
+		if err := report.SendPendingCheckin(localCfg.ServerURL, localCfg.DeviceAPIKey); err != nil {
+			logx.Printf("warning: failed to send spooled checkin: %v", err)
+		}
+		if err := report.SendCheckinWithSpool(localCfg.ServerURL, localCfg.DeviceAPIKey, checkin); err != nil {
+			logx.Printf("checkin failed ❌: %v", err)
+			os.Exit(1)
+		}
+		logx.Println("checkin ok ✅")
+		return
+
+	case "flush-reports":
+		fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+		configPath := fs.String("config", "", "Config path override")
+		maxCount := fs.Int("max", 20, "Maximum number of reports to send (oldest first, at most 20)")
+		maxAge := fs.Duration("max-age", 0, "Delete spooled reports older than this without sending them (default spool_max_age_hours, 30 days)")
+		if err := fs.Parse(os.Args[2:]); err != nil {
+			logx.Fatalf("parse flags: %v", err)
+		}
+		if *maxCount < 1 || *maxAge < 0 {
+			logx.Exitf(exitUsage, "--max must be at least 1 and --max-age positive")
 		}
 
-		// Track start time for reporting
-		startTime := time.Now()
+		cfgFile, err = config.ResolvePath(*configPath)
+		if err != nil {
+			logx.Fatalf("resolve config path: %v", err)
+		}
+		localCfg, err := config.Read(cfgFile)
+		if err != nil {
+			logx.Exitf(exitConfig, "read config: %v", err)
+		}
+		logx.SetDeviceID(localCfg.DeviceID)
+		logx.AddSecret(localCfg.DeviceAPIKey)
+		configureHTTP(localCfg)
+		configureSpool(localCfg)
+		if !canReport(localCfg) {
+			logx.Exitf(exitConfig, "device is not enrolled (flush-reports requires device_id, device_api_key and server_url)")
+		}
 
-		// Use a shorter timeout for retention - if it takes longer than 2 hours, something is wrong
-		// The connectivity check will fail faster if the repository is unreachable
-		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Hour)
+		if err := report.CleanupOldReports(*maxAge); err != nil {
+			logx.Printf("warning: cleanup old reports: %v", err)
+		}
+		sent, failed, err := report.SendPendingReports(localCfg.ServerURL, localCfg.DeviceAPIKey, *maxCount, localCfg.ReportWorkers)
+		if err != nil {
+			logx.Fatalf("flush reports: %v", err)
+		}
+		remaining, _, _, err := report.SpoolStats()
+		if err != nil {
+			logx.Printf("warning: report spool: %v", err)
+		}
+		fmt.Printf("sent: %d, failed: %d, remaining: %d\n", sent, failed, remaining)
+		if failed > 0 {
+			os.Exit(exitError)
+		}
+		return
+
+	case "fingerprint":
+		fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+		configPath := fs.String("config", "", "Config path override (server URL when none is given)")
+		if err := fs.Parse(os.Args[2:]); err != nil {
+			logx.Fatalf("parse flags: %v", err)
+		}
+
+		serverURL := fs.Arg(0)
+		if serverURL == "" {
+			cfgFile, err = config.ResolvePath(*configPath)
+			if err != nil {
+				logx.Fatalf("resolve config path: %v", err)
+			}
+			cfg, err := config.Read(cfgFile)
+			if err != nil || cfg.ServerURL == "" {
+				logx.Exitf(exitUsage, "usage: xentz-agent fingerprint <server-url> (no server_url in %s)", cfgFile)
+			}
+			serverURL = cfg.ServerURL
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), httpx.DefaultTimeout)
 		defer cancel()
+		cert, err := httpx.ServerCertificate(ctx, serverURL)
+		if err != nil {
+			logx.Fatalf("fingerprint: %v", err)
+		}
+		fmt.Printf("SHA-256 fingerprint: %s\n", httpx.Fingerprint(cert))
+		fmt.Printf("  subject: %s\n  issuer:  %s\n  expires: %s\n",
+			cert.Subject, cert.Issuer, cert.NotAfter.UTC().Format(time.RFC3339))
+		fmt.Println("Check it out-of-band before pinning it with install --server-fingerprint.")
+		return
 
-		res := backup.RunRetention(ctx, cfg)
-		if err := st.SaveLastRetentionRun(res); err != nil {
-			log.Printf("save last retention run: %v", err)
+	case "scheduler-status":
+		fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+		jsonOut := fs.Bool("json", false, "Print the scheduler status as JSON")
+		if err := fs.Parse(os.Args[2:]); err != nil {
+			logx.Fatalf("parse flags: %v", err)
 		}
 
-		// Send reports (non-blocking)
-		if localCfg.DeviceID != "" && localCfg.DeviceAPIKey != "" && localCfg.ServerURL != "" {
-			// Send pending reports first (max 20, oldest first)
-			_ = report.SendPendingReports(localCfg.ServerURL, localCfg.DeviceAPIKey, 20)
+		info, err := install.SchedulerStatus()
+		if err != nil {
+			logx.Fatalf("scheduler status: %v", err)
+		}
 
-			// Create report for current run (simpler payload, no file/byte stats)
-			finishedTime := time.Now()
-			reportStatus := "success"
-			if res.Status == "error" {
-				reportStatus = "failure"
+		if *jsonOut {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(info); err != nil {
+				logx.Fatalf("encode scheduler status: %v", err)
 			}
-			retentionReport := report.Report{
-				DeviceID:   localCfg.DeviceID,
-				Job:        "retention",
-				StartedAt:  startTime.UTC().Format(time.RFC3339),
-				FinishedAt: finishedTime.UTC().Format(time.RFC3339),
-				Status:     reportStatus,
-				DurationMS: res.DurationMS,
+		} else if len(info.Jobs) > 0 {
+			fmt.Printf("Scheduler: %s\n", info.Scheduler)
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "JOB\tENABLED\tNEXT RUN")
+			for _, job := range info.Jobs {
+				next := "unknown"
+				if !job.NextRun.IsZero() {
+					next = job.NextRun.Local().Format("2006-01-02 15:04")
+				}
+				fmt.Fprintf(tw, "%s\t%t\t%s\n", job.Name, job.Enabled, next)
 			}
-			if res.Error != "" {
-				retentionReport.Error = res.Error
+			_ = tw.Flush()
+		}
+
+		// Scripts can check the exit code: nothing registered, or a disabled job, is an error
+		if len(info.Jobs) == 0 {
+			logx.Exitf(exitError, "no scheduled jobs registered with %s (run install)", info.Scheduler)
+		}
+		for _, job := range info.Jobs {
+			if !job.Enabled {
+				os.Exit(exitError)
 			}
+		}
+		return
 
-			// Send current report (spools if it fails)
-			_ = report.SendReportWithSpool(localCfg.ServerURL, localCfg.DeviceAPIKey, retentionReport)
+	case "doctor":
+		fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+		configPath := fs.String("config", "", "Config path override")
+		if err := fs.Parse(os.Args[2:]); err != nil {
+			logx.Fatalf("parse flags: %v", err)
+		}
 
-			// Cleanup old reports periodically
-			_ = report.CleanupOldReports(30 * 24 * time.Hour)
+		cfgFile, err = config.ResolvePath(*configPath)
+		if err != nil {
+			logx.Fatalf("resolve config path: %v", err)
 		}
 
-		if res.Status != "success" {
-			log.Printf("retention failed ❌: %s", res.Error)
+		if !runDoctor(cfgFile) {
+			fmt.Println("")
+			fmt.Println("doctor found problems ❌")
+			os.Exit(1)
+		}
+		fmt.Println("")
+		fmt.Println("all checks passed ✅")
+		return
+
+	case "test-connection":
+		fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+		configPath := fs.String("config", "", "Config path override")
+		if err := fs.Parse(os.Args[2:]); err != nil {
+			logx.Fatalf("parse flags: %v", err)
+		}
+
+		cfgFile, err = config.ResolvePath(*configPath)
+		if err != nil {
+			logx.Fatalf("resolve config path: %v", err)
+		}
+
+		if !runTestConnection(cfgFile) {
+			fmt.Println("")
+			fmt.Println("connection test failed ❌")
 			os.Exit(1)
 		}
-		log.Printf("retention ok ✅: duration=%s", res.Duration)
+		fmt.Println("")
+		fmt.Println("connection OK ✅")
+		return
+
+	case "self-update":
+		fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+		checkOnly := fs.Bool("check-only", false, "Only report whether an update is available")
+		tag := fs.String("version", "", "Release tag to install, e.g. v1.4.0 (default: latest)")
+		skipVerify := fs.Bool("skip-verify", false, "Skip the release signature check (checksums are still verified)")
+		force := fs.Bool("force", false, "Allow downgrades and replacing development builds")
+		if err := fs.Parse(os.Args[2:]); err != nil {
+			logx.Fatalf("parse flags: %v", err)
+		}
+
+		if err := runSelfUpdate(*tag, *checkOnly, *force, update.Options{SkipSignature: *skipVerify}); err != nil {
+			logx.Fatalf("self-update failed ❌: %v", err)
+		}
 		return
 
 	case "status":
 		fs := flag.NewFlagSet(cmd, flag.ExitOnError)
-		_ = fs.String("config", "", "Config path override (unused, kept for compatibility)")
+		configPath := fs.String("config", "", "Config path override (device API key for reading the cached server config)")
+		jsonOut := fs.Bool("json", false, "Print the last backup, retention and check runs as JSON")
 		if err := fs.Parse(os.Args[2:]); err != nil {
-			log.Fatalf("parse flags: %v", err)
+			logx.Fatalf("parse flags: %v", err)
 		}
 
 		st, err := state.New()
 		if err != nil {
-			log.Fatalf("state init: %v", err)
+			logx.Fatalf("state init: %v", err)
 		}
 
 		// Show backup status
 		last, ok, err := st.LoadLastRun()
 		if err != nil {
-			log.Fatalf("load last run: %v", err)
+			logx.Fatalf("load last run: %v", err)
 		}
+
+		if *jsonOut {
+			lastRetention, retentionOK, err := st.LoadLastRetentionRun()
+			if err != nil {
+				logx.Fatalf("load last retention run: %v", err)
+			}
+			lastCheck, checkOK, err := st.LoadLastCheckRun()
+			if err != nil {
+				logx.Fatalf("load last check run: %v", err)
+			}
+			out := struct {
+				Backup    *state.LastRun `json:"backup"`
+				Retention *state.LastRun `json:"retention"`
+				Check     *state.LastRun `json:"check,omitempty"`
+			}{}
+			if ok {
+				out.Backup = &last
+			}
+			if retentionOK {
+				out.Retention = &lastRetention
+			}
+			if checkOK {
+				out.Check = &lastCheck
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(out); err != nil {
+				logx.Fatalf("encode status: %v", err)
+			}
+			return
+		}
+
 		if !ok {
 			fmt.Println("No backups have run yet.")
+		} else if last.Status == "skipped" {
+			fmt.Printf("Last backup:\n  status: skipped (not a failure)\n  time:   %s\n  reason: %s\n", last.TimeUTC, last.SkipReason)
+			if success, ok, _ := st.LoadLastSuccess(); ok {
+				fmt.Printf("  last success: %s\n", success.TimeUTC)
+			}
 		} else {
-			fmt.Printf("Last backup:\n  status: %s\n  time:   %s\n  dur:    %s\n  bytes:  %d\n  error:  %s\n",
-				last.Status, last.TimeUTC, last.Duration, last.BytesSent, last.Error)
+			fmt.Printf("Last backup:\n  status: %s\n  time:   %s\n  dur:    %s\n  bytes:  %s\n  error:  %s\n",
+				last.Status, last.TimeUTC, last.Duration, humanize.Bytes(last.BytesSent), last.Error)
+			snapshotID := last.SnapshotID
+			if snapshotID == "" {
+				snapshotID = "n/a"
+			}
+			fmt.Printf("  files:  %s\n  size:   %s\n  added:  %s\n  snapshot: %s\n",
+				statusCount(last.FilesTotal), statusSize(last.BytesTotal), statusSize(last.DataAddedBytes), snapshotID)
+			if last.ErrorKind != "" {
+				fmt.Printf("  kind:   %s\n", last.ErrorKind)
+			}
+			if last.Attempts > 1 {
+				fmt.Printf("  attempts: %d\n", last.Attempts)
+			}
+			if len(last.SkippedPaths) > 0 {
+				fmt.Printf("  skipped (missing): %s\n", strings.Join(last.SkippedPaths, ", "))
+			}
+			if last.ErrorsCount > 0 {
+				fmt.Printf("  read errors: %d\n", last.ErrorsCount)
+				for _, e := range last.ErrorSample {
+					fmt.Printf("    %s\n", e)
+				}
+			}
+		}
+
+		// Show the agent version and the control plane's version policy (from the cached server config)
+		fmt.Println("")
+		fmt.Printf("Agent:\n  version: %s\n", version.Version)
+		var deviceAPIKey string
+		if cfgFile, err = config.ResolvePath(*configPath); err == nil {
+			if localCfg, err := config.Read(cfgFile); err == nil {
+				deviceAPIKey = localCfg.DeviceAPIKey
+				configureSpool(localCfg)
+			}
+		}
+		if cached, err := config.ReadCached(deviceAPIKey); err == nil {
+			if cached.TargetAgentVersion != "" {
+				fmt.Printf("  pinned:  %s\n", cached.TargetAgentVersion)
+			}
+			if cached.MinAgentVersion != "" {
+				fmt.Printf("  minimum: %s\n", cached.MinAgentVersion)
+			}
+			if cached.AutoUpdate {
+				fmt.Println("  auto-update: on")
+			}
+		}
+
+		// Show reports waiting to be sent to the control plane
+		if count, size, oldest, err := report.SpoolStats(); err != nil {
+			logx.Printf("warning: report spool: %v", err)
+		} else if count > 0 {
+			fmt.Println("")
+			fmt.Printf("Report spool:\n  pending: %d report(s), %s\n  oldest:  %s\n",
+				count, humanize.Bytes(size), oldest.UTC().Format(time.RFC3339))
+			if report.SpoolNearFull(size) {
+				fmt.Printf("  warning: nearly full (max %s); new reports are dropped beyond it\n", humanize.Bytes(report.SpoolMaxBytes()))
+			}
 		}
 
 		// Show retention status
 		lastRetention, ok, err := st.LoadLastRetentionRun()
 		if err != nil {
-			log.Fatalf("load last retention run: %v", err)
+			logx.Fatalf("load last retention run: %v", err)
 		}
 		if ok {
 			fmt.Println("")
 			fmt.Printf("Last retention:\n  status: %s\n  time:   %s\n  dur:    %s\n  error:  %s\n",
 				lastRetention.Status, lastRetention.TimeUTC, lastRetention.Duration, lastRetention.Error)
 		}
+
+		// Show the last repository check (done by `run` with run_check)
+		lastCheck, ok, err := st.LoadLastCheckRun()
+		if err != nil {
+			logx.Fatalf("load last check run: %v", err)
+		}
+		if ok {
+			fmt.Println("")
+			fmt.Printf("Last check:\n  status: %s\n  time:   %s\n  dur:    %s\n  error:  %s\n",
+				lastCheck.Status, lastCheck.TimeUTC, lastCheck.Duration, lastCheck.Error)
+		}
 		return
 
 	default:
 		usage()
-		os.Exit(2)
+		os.Exit(exitUsage)
 	}
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+
+	"xentz-agent/internal/backup"
+	"xentz-agent/internal/state"
+)
+
+func TestFrequencyFlag(t *testing.T) {
+	tests := []struct {
+		frequency, dayOfWeek string
+		dayOfMonth           int
+		want                 string
+		wantErr              bool
+	}{
+		{"", "", 0, "", false},
+		{"daily", "", 0, "daily", false},
+		{"weekly", "mon", 0, "weekly", false},
+		{"", "mon", 0, "weekly", false},
+		{"", "", 15, "monthly", false},
+		{"monthly", "", 15, "monthly", false},
+		{"", "mon", 15, "", true},
+		// A mismatch with an explicit --frequency is left to config validation
+		{"daily", "mon", 0, "daily", false},
+	}
+	for _, tt := range tests {
+		got, err := frequencyFlag(tt.frequency, tt.dayOfWeek, tt.dayOfMonth)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("frequencyFlag(%q, %q, %d) = %q, %v; want %q (error: %v)",
+				tt.frequency, tt.dayOfWeek, tt.dayOfMonth, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// TestExitCode pins the documented exit codes (README "Exit codes"); scripts and the
+// systemd units depend on them
+func TestExitCode(t *testing.T) {
+	failed := func(kind backup.ErrorKind) state.LastRun {
+		return state.LastRun{Status: "error", ErrorKind: string(kind)}
+	}
+	tests := []struct {
+		name string
+		res  state.LastRun
+		want int
+	}{
+		{"success", state.LastRun{Status: "success"}, 0},
+		{"degraded", state.LastRun{Status: "degraded", ErrorsCount: 3}, 1},
+		{"skipped", state.LastRun{Status: "skipped", SkipReason: "metered connection"}, 7},
+		{"skipped locked", state.LastRun{Status: "skipped", SkipReason: state.ErrLocked.Error()}, 6},
+		{"config_invalid", failed(backup.KindConfigInvalid), 3},
+		{"auth_failed", failed(backup.KindAuthFailed), 3},
+		{"restic_missing", failed(backup.KindResticMissing), 4},
+		{"repo_unreachable", failed(backup.KindRepoUnreachable), 5},
+		{"transient", failed(backup.KindTransient), 5},
+		{"repo_locked", failed(backup.KindRepoLocked), 6},
+		{"timeout", failed(backup.KindTimeout), 1},
+		{"unknown", failed(backup.KindUnknown), 1},
+		{"unclassified", failed(""), 1},
+		{"unknown status", state.LastRun{Status: "bogus"}, 1},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.res); got != tt.want {
+			t.Errorf("%s: exitCode = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	codes := []int{exitOK, exitError, exitUsage, exitConfig, exitResticMissing, exitRepoUnreachable, exitLocked, exitSkipped}
+	for want, code := range codes {
+		if code != want {
+			t.Errorf("exit code constant #%d = %d, want %d", want, code, want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"xentz-agent/internal/config"
+	"xentz-agent/internal/logx"
+	"xentz-agent/internal/update"
+	"xentz-agent/internal/version"
+)
+
+// checkAgentVersion enforces the control plane's agent version policy: when the running release is
+// below min_agent_version or differs from target_agent_version it warns, or self-updates if
+// auto_update is set. The update takes effect from the next run. Development builds are left alone.
+func checkAgentVersion(cfg config.Config) {
+	if !version.IsRelease(version.Version) {
+		return
+	}
+
+	var tag, reason string
+	if cfg.TargetAgentVersion != "" {
+		if cmp, err := version.Compare(version.Version, cfg.TargetAgentVersion); err == nil && cmp != 0 {
+			tag = cfg.TargetAgentVersion
+			reason = fmt.Sprintf("the control plane pins version %s", cfg.TargetAgentVersion)
+		}
+	}
+	if reason == "" && cfg.MinAgentVersion != "" {
+		if cmp, err := version.Compare(version.Version, cfg.MinAgentVersion); err == nil && cmp < 0 {
+			reason = fmt.Sprintf("the control plane requires at least %s", cfg.MinAgentVersion)
+		}
+	}
+	if reason == "" {
+		return
+	}
+
+	if !cfg.AutoUpdate {
+		logx.Printf("warning: ⚠ agent version %s is out of policy: %s. Run `xentz-agent self-update` to update.", version.Version, reason)
+		return
+	}
+	logx.Printf("agent version %s is out of policy (%s), updating", version.Version, reason)
+	// A pinned version may be older than the running one, so allow downgrades
+	if err := runSelfUpdate(tag, false, tag != "", update.Options{}); err != nil {
+		logx.Printf("warning: automatic update failed: %v", err)
+	}
+}
+
+// runSelfUpdate replaces the running binary with the release tagged tag (latest if empty).
+// Without force it refuses to downgrade or to overwrite a development build.
+func runSelfUpdate(tag string, checkOnly, force bool, opts update.Options) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Minute)
+	defer cancel()
+
+	exePath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if resolved, err := filepath.EvalSymlinks(exePath); err == nil {
+		exePath = resolved
+	}
+	update.CleanupOld(exePath)
+
+	if tag == "" {
+		tag, err = update.LatestVersion(ctx)
+		if err != nil {
+			return err
+		}
+	} else if !strings.HasPrefix(tag, "v") {
+		// Release tags are "v"-prefixed; the control plane and users may omit it
+		tag = "v" + tag
+	}
+	fmt.Printf("current version: %s\n", version.Version)
+	fmt.Printf("target version:  %s\n", tag)
+
+	if version.IsRelease(version.Version) {
+		cmp, err := version.Compare(version.Version, tag)
+		if err != nil {
+			return err
+		}
+		switch {
+		case cmp == 0:
+			fmt.Println("already up to date ✅")
+			return nil
+		case cmp > 0 && !force:
+			return fmt.Errorf("%s is older than the running version (use --force to downgrade)", tag)
+		}
+	} else if !checkOnly && !force {
+		return fmt.Errorf("running a development build (%s); use --force to replace it", version.Version)
+	}
+	if checkOnly {
+		fmt.Println("update available")
+		return nil
+	}
+
+	logx.Printf("downloading %s for %s", tag, update.AssetName())
+	if err := update.Apply(ctx, tag, exePath, opts); err != nil {
+		if errors.Is(err, update.ErrSignatureMissing) {
+			return fmt.Errorf("%w (use --skip-verify to update without a signature check)", err)
+		}
+		return err
+	}
+	logx.Printf("updated %s: %s -> %s ✅", exePath, version.Version, tag)
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"xentz-agent/internal/config"
+	"xentz-agent/internal/httpx"
+)
+
+// runTestConnection checks the control plane round trip with the stored device API key and
+// prints a checklist like doctor. Nothing is written: FetchFromServer doesn't touch the cache.
+// It returns false if any check failed.
+func runTestConnection(cfgFile string) bool {
+	var checks []doctorCheck
+	add := func(name string, ok bool, detail string) {
+		checks = append(checks, doctorCheck{name: name, ok: ok, critical: true, detail: detail})
+	}
+
+	cfg, err := config.Read(cfgFile)
+	if err != nil {
+		add("config file", false, fmt.Sprintf("%s: %v", cfgFile, err))
+		return printDoctorChecks(checks)
+	}
+	if cfg.ServerURL == "" || cfg.DeviceAPIKey == "" {
+		add("config file", false, fmt.Sprintf("%s: device is not enrolled (no server_url or device_api_key)", cfgFile))
+		return printDoctorChecks(checks)
+	}
+	add("config file", true, cfgFile)
+	configureHTTP(cfg)
+
+	if err := httpx.ValidateServerURL(cfg.ServerURL); err != nil {
+		add("server URL", false, fmt.Sprintf("%s rejected by SSRF validation: %v", cfg.ServerURL, err))
+		return printDoctorChecks(checks)
+	}
+	add("server URL", true, cfg.ServerURL)
+
+	start := time.Now()
+	_, err = config.FetchFromServer(cfg.ServerURL, cfg.DeviceAPIKey)
+	latency := time.Since(start).Round(time.Millisecond)
+	switch {
+	case err == nil:
+		add("round trip", true, fmt.Sprintf("GET /control/v1/config: HTTP 200 in %s", latency))
+		add("device API key", true, "accepted")
+	case errors.Is(err, config.ErrKeyRevoked), errors.Is(err, config.ErrKeyExpiring):
+		add("round trip", true, fmt.Sprintf("server answered in %s", latency))
+		add("device API key", false, err.Error())
+	case errors.Is(err, httpx.ErrRedirectRefused):
+		add("round trip", false, fmt.Sprintf("redirect rejected by SSRF validation: %v", err))
+	case httpx.IsTLSError(err):
+		add("TLS", false, err.Error())
+	case errors.Is(err, httpx.ErrProxy):
+		add("proxy", false, err.Error())
+	default:
+		add("round trip", false, fmt.Sprintf("after %s: %v", latency, err))
+	}
+
+	return printDoctorChecks(checks)
+}
@@ -1,9 +1,17 @@
 // install.go - Universal Go-based installer (works on all platforms)
 // Build: go build -o install-xentz-agent install.go
-// Usage: ./install-xentz-agent
+// Usage: ./install-xentz-agent [--skip-verify]
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,13 +20,30 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 )
 
 const (
 	baseURL = "https://github.com/arope28/xentz-agent/releases/latest/download"
+	// Published with each release by build.sh, in sha256sum format
+	checksumsFile = "SHA256SUMS"
+	// minisign signature of checksumsFile (legacy, non-prehashed: minisign -S -l -m SHA256SUMS)
+	signatureFile = checksumsFile + ".minisig"
+)
+
+// minisign public key (base64, as in the second line of minisign.pub) that release checksums
+// must be signed with. Set at build time: -ldflags "-X main.minisignPublicKey=RWQ..."
+var minisignPublicKey = ""
+
+var (
+	errSignatureMissing = errors.New("signature file missing")
+	errSignatureInvalid = errors.New("signature invalid")
 )
 
 func main() {
+	skipVerify := flag.Bool("skip-verify", false, "Skip release signature verification (checksums are still checked)")
+	flag.Parse()
+
 	fmt.Println("xentz-agent Installer")
 	fmt.Println("======================")
 	fmt.Println("")
@@ -59,6 +84,10 @@ func main() {
 				fmt.Println("  winget install restic.restic")
 			} else if osName == "darwin" {
 				fmt.Println("  brew install restic")
+			} else if osName == "freebsd" {
+				fmt.Println("  sudo pkg install restic")
+			} else if osName == "openbsd" {
+				fmt.Println("  doas pkg_add restic")
 			} else {
 				fmt.Println("  sudo apt install restic (or your package manager)")
 			}
@@ -92,6 +121,8 @@ func main() {
 			} else {
 				binaryFile = fmt.Sprintf("xentz-agent-darwin-%s", arch)
 			}
+		} else if osName == "freebsd" || osName == "openbsd" {
+			binaryFile = fmt.Sprintf("xentz-agent-%s-%s", osName, arch)
 		} else {
 			// Linux
 			if arch == "arm" {
@@ -121,7 +152,7 @@ func main() {
 		// macOS: use /usr/local/bin (system-wide, requires sudo)
 		installDir = "/usr/local/bin"
 	} else {
-		// Linux: use ~/.local/bin (XDG standard)
+		// Linux and BSD: use ~/.local/bin (XDG standard)
 		installDir = filepath.Join(home, ".local", "bin")
 	}
 
@@ -145,6 +176,30 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Verify the download against the signed release checksums before it is ever executed
+	fmt.Println("Verifying download...")
+	if *skipVerify {
+		fmt.Println("⚠ --skip-verify: release signature not checked")
+	}
+	if err := verifyDownload(tempPath, binaryFile, !*skipVerify); err != nil {
+		os.Remove(tempPath)
+		fmt.Printf("Error: %v\n", err)
+		switch {
+		case errors.Is(err, errSignatureMissing):
+			fmt.Printf("The release has no %s; rerun with --skip-verify to install without a signature check.\n", signatureFile)
+		case errors.Is(err, errSignatureInvalid):
+			fmt.Println("The release was not signed with the expected key; do not install it.")
+		default:
+			fmt.Println("The download may be corrupted or tampered with; nothing was installed.")
+		}
+		os.Exit(1)
+	}
+	if *skipVerify {
+		fmt.Println("✓ Checksum verified")
+	} else {
+		fmt.Println("✓ Signature and checksum verified")
+	}
+
 	// Make executable (Unix-like systems)
 	if osName != "windows" {
 		if err := os.Chmod(tempPath, 0o755); err != nil {
@@ -184,7 +239,7 @@ func main() {
 			os.Exit(1)
 		}
 	} else {
-		// Linux: create directory if needed and copy
+		// Linux and BSD: create directory if needed and copy
 		if err := os.MkdirAll(installDir, 0o755); err != nil {
 			fmt.Printf("Error creating install directory: %v\n", err)
 			os.Exit(1)
@@ -272,6 +327,12 @@ func installRestic(osName string) bool {
 			fmt.Println("  winget install restic.restic")
 			return false
 		}
+	case "freebsd":
+		fmt.Println("Installing restic via pkg...")
+		cmd = exec.Command("sudo", "pkg", "install", "-y", "restic")
+	case "openbsd":
+		fmt.Println("Installing restic via pkg_add...")
+		cmd = exec.Command("doas", "pkg_add", "restic")
 	default:
 		// Linux - try different package managers
 		if _, err := exec.LookPath("apt-get"); err == nil {
@@ -307,25 +368,262 @@ func installRestic(osName string) bool {
 	return false
 }
 
-func downloadFile(url, filepath string) error {
-	resp, err := http.Get(url)
+// Download retry policy: attempts in total, with the delay doubling after each failure
+const (
+	downloadAttempts = 4
+	downloadDelay    = 2 * time.Second
+)
+
+// downloadFile downloads url to dest, showing progress. Data goes to dest+".part" and is renamed
+// into place only when complete; network errors are retried, resuming with a Range request
+// when the server supports it.
+func downloadFile(url, dest string) error {
+	partPath := dest + ".part"
+	delay := downloadDelay
+	var err error
+	for attempt := 1; attempt <= downloadAttempts; attempt++ {
+		var retry bool
+		retry, err = downloadAttempt(url, partPath)
+		if err == nil {
+			return os.Rename(partPath, dest)
+		}
+		if !retry || attempt == downloadAttempts {
+			break
+		}
+		fmt.Printf("Download interrupted (%v), retrying in %s...\n", err, delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+	os.Remove(partPath)
+	return err
+}
+
+// downloadAttempt continues downloading url into partPath from its current size.
+// It reports whether a failure is worth retrying.
+func downloadAttempt(url, partPath string) (retry bool, err error) {
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
-		return err
+		return false, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return true, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("bad status: %s", resp.Status)
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		flags |= os.O_APPEND
+	case resp.StatusCode == http.StatusOK:
+		// Range not supported (or first attempt): start over
+		flags |= os.O_TRUNC
+		offset = 0
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// The partial file is unusable; drop it and start over on the next attempt
+		os.Remove(partPath)
+		return true, fmt.Errorf("bad status: %s", resp.Status)
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return true, fmt.Errorf("bad status: %s", resp.Status)
+	default:
+		return false, fmt.Errorf("bad status: %s", resp.Status)
 	}
 
-	out, err := os.Create(filepath)
+	out, err := os.OpenFile(partPath, flags, 0o644)
 	if err != nil {
-		return err
+		return false, err
 	}
 	defer out.Close()
 
-	_, err = io.Copy(out, resp.Body)
-	return err
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
+	}
+	progress := &downloadProgress{done: offset, total: total}
+	_, err = io.Copy(out, io.TeeReader(resp.Body, progress))
+	progress.finish()
+	if err != nil {
+		return true, err
+	}
+	if total >= 0 && progress.done != total {
+		return true, fmt.Errorf("incomplete download: got %d of %d bytes", progress.done, total)
+	}
+	return false, out.Close()
+}
+
+// downloadProgress prints a single updating progress line as bytes are written through it
+type downloadProgress struct {
+	done, total int64
+	last        time.Time
+}
+
+func (p *downloadProgress) Write(b []byte) (int, error) {
+	p.done += int64(len(b))
+	if time.Since(p.last) >= 100*time.Millisecond {
+		p.print()
+		p.last = time.Now()
+	}
+	return len(b), nil
+}
+
+func (p *downloadProgress) print() {
+	if p.total > 0 {
+		fmt.Printf("\r  %.1f / %.1f MB (%d%%)", float64(p.done)/(1<<20), float64(p.total)/(1<<20), p.done*100/p.total)
+	} else {
+		fmt.Printf("\r  %.1f MB", float64(p.done)/(1<<20))
+	}
+}
+
+func (p *downloadProgress) finish() {
+	p.print()
+	fmt.Println()
+}
+
+// verifyDownload checks the sha256 of path against the entry for fileName in the release's SHA256SUMS.
+// With checkSignature, SHA256SUMS itself must carry a valid minisign signature from minisignPublicKey.
+func verifyDownload(path, fileName string, checkSignature bool) error {
+	sums, err := fetchReleaseFile(checksumsFile)
+	if err != nil {
+		return err
+	}
+
+	if checkSignature {
+		sig, err := fetchReleaseFile(signatureFile)
+		if errors.Is(err, errNotFound) {
+			return fmt.Errorf("%s: %w", signatureFile, errSignatureMissing)
+		}
+		if err != nil {
+			return err
+		}
+		if err := verifyMinisign(minisignPublicKey, sums, sig); err != nil {
+			return fmt.Errorf("%s: %w", signatureFile, err)
+		}
+	}
+
+	expected, ok := lookupChecksum(string(sums), fileName)
+	if !ok {
+		return fmt.Errorf("%s has no entry for %s", checksumsFile, fileName)
+	}
+	actual, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+	if !checksumMatches(expected, actual) {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", fileName, expected, actual)
+	}
+	return nil
+}
+
+var errNotFound = errors.New("not found")
+
+// fetchReleaseFile downloads a small file from the latest release (errNotFound on 404)
+func fetchReleaseFile(name string) ([]byte, error) {
+	resp, err := http.Get(fmt.Sprintf("%s/%s", baseURL, name))
+	if err != nil {
+		return nil, fmt.Errorf("download %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("download %s: %w", name, errNotFound)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download %s: bad status: %s", name, resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("download %s: %w", name, err)
+	}
+	return b, nil
+}
+
+// verifyMinisign checks a minisign signature of data. Only legacy (non-prehashed, "Ed")
+// signatures are supported, since prehashed ones need BLAKE2b from outside the standard library.
+// Problems with the signature itself wrap errSignatureInvalid.
+func verifyMinisign(publicKey string, data, sigFile []byte) error {
+	if publicKey == "" {
+		return fmt.Errorf("%w: this installer was built without a release public key", errSignatureInvalid)
+	}
+	pk, err := base64.StdEncoding.DecodeString(strings.TrimSpace(publicKey))
+	if err != nil || len(pk) != 2+8+ed25519.PublicKeySize || string(pk[:2]) != "Ed" {
+		return fmt.Errorf("malformed release public key")
+	}
+	keyID, key := pk[2:10], ed25519.PublicKey(pk[10:])
+
+	// untrusted comment, signature, trusted comment, global signature
+	lines := strings.Split(strings.ReplaceAll(string(sigFile), "\r\n", "\n"), "\n")
+	if len(lines) < 4 {
+		return fmt.Errorf("%w: malformed signature file", errSignatureInvalid)
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(sig) != 2+8+ed25519.SignatureSize {
+		return fmt.Errorf("%w: malformed signature", errSignatureInvalid)
+	}
+	switch string(sig[:2]) {
+	case "Ed":
+	case "ED":
+		return fmt.Errorf("%w: prehashed signatures are not supported (sign with minisign -l)", errSignatureInvalid)
+	default:
+		return fmt.Errorf("%w: unknown signature algorithm", errSignatureInvalid)
+	}
+	if !bytes.Equal(sig[2:10], keyID) {
+		return fmt.Errorf("%w: signed with a different key", errSignatureInvalid)
+	}
+	if !ed25519.Verify(key, data, sig[10:]) {
+		return errSignatureInvalid
+	}
+
+	trusted, ok := strings.CutPrefix(strings.TrimRight(lines[2], "\r"), "trusted comment: ")
+	if !ok {
+		return fmt.Errorf("%w: missing trusted comment", errSignatureInvalid)
+	}
+	globalSig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil || !ed25519.Verify(key, append(append([]byte{}, sig[10:]...), trusted...), globalSig) {
+		return fmt.Errorf("%w: trusted comment signature", errSignatureInvalid)
+	}
+	return nil
+}
+
+// lookupChecksum returns the hex digest for fileName from sha256sum output
+// ("<hex>  <name>", or "<hex> *<name>" for binary mode)
+func lookupChecksum(sums, fileName string) (string, bool) {
+	scanner := bufio.NewScanner(strings.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if strings.TrimPrefix(fields[1], "*") == fileName {
+			return fields[0], true
+		}
+	}
+	return "", false
+}
+
+// fileSHA256 returns the hex-encoded sha256 of the file at path
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checksumMatches compares two hex digests, ignoring case
+func checksumMatches(expected, actual string) bool {
+	return len(expected) == sha256.Size*2 && strings.EqualFold(expected, actual)
 }
 
 func checkURLExists(url string) bool {
@@ -32,6 +32,12 @@ detect_platform() {
         Darwin*)
             os="darwin"
             ;;
+        FreeBSD*)
+            os="freebsd"
+            ;;
+        OpenBSD*)
+            os="openbsd"
+            ;;
         *)
             echo -e "${RED}Error: Unsupported operating system: $(uname -s)${NC}"
             exit 1
@@ -74,7 +80,7 @@ ARCH=$(echo $PLATFORM | cut -d'-' -f2)
 if [ "$OS" = "darwin" ]; then
     INSTALL_DIR="/usr/local/bin"
 else
-    # Linux - use XDG standard
+    # Linux and BSD - use XDG standard
     INSTALL_DIR="${HOME}/.local/bin"
 fi
 
@@ -116,7 +122,7 @@ install_restic() {
             return 1
         fi
     else
-        # Linux - try different package managers
+        # Linux/BSD - try different package managers
         if command -v apt-get &> /dev/null; then
             echo "Installing restic via apt..."
             if sudo apt-get update && sudo apt-get install -y restic; then
@@ -144,6 +150,24 @@ install_restic() {
                 echo -e "${RED}✗ Failed to install restic via dnf${NC}"
                 return 1
             fi
+        elif command -v pkg_add &> /dev/null; then
+            echo "Installing restic via pkg_add..."
+            if doas pkg_add restic; then
+                echo -e "${GREEN}✓ restic installed successfully${NC}"
+                return 0
+            else
+                echo -e "${RED}✗ Failed to install restic via pkg_add${NC}"
+                return 1
+            fi
+        elif [ "$OS" = "freebsd" ] && command -v pkg &> /dev/null; then
+            echo "Installing restic via pkg..."
+            if sudo pkg install -y restic; then
+                echo -e "${GREEN}✓ restic installed successfully${NC}"
+                return 0
+            else
+                echo -e "${RED}✗ Failed to install restic via pkg${NC}"
+                return 1
+            fi
         elif command -v pacman &> /dev/null; then
             echo "Installing restic via pacman..."
             if sudo pacman -S --noconfirm restic; then
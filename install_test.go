@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyChecksum(t *testing.T) {
+	binary := []byte("xentz-agent release binary")
+	sum := sha256.Sum256(binary)
+	digest := hex.EncodeToString(sum[:])
+	other := sha256.Sum256([]byte("tampered binary"))
+	otherDigest := hex.EncodeToString(other[:])
+
+	path := filepath.Join(t.TempDir(), "xentz-agent-linux-amd64")
+	if err := os.WriteFile(path, binary, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	actual, err := fileSHA256(path)
+	if err != nil || actual != digest {
+		t.Fatalf("fileSHA256 = %s, %v; want %s", actual, err, digest)
+	}
+
+	sums := strings.Join([]string{
+		otherDigest + "  xentz-agent-darwin-arm64",
+		"not a checksum line at all",
+		"",
+		digest + " *xentz-agent-linux-amd64", // Binary mode
+		otherDigest + "  xentz-agent-windows-amd64.exe",
+	}, "\n")
+	tests := []struct {
+		fileName string
+		want     bool
+	}{
+		{"xentz-agent-linux-amd64", true},
+		{"xentz-agent-darwin-arm64", false},
+		{"xentz-agent-windows-amd64.exe", false},
+	}
+	for _, tt := range tests {
+		expected, ok := lookupChecksum(sums, tt.fileName)
+		if !ok {
+			t.Errorf("lookupChecksum(%s): no entry", tt.fileName)
+			continue
+		}
+		if got := checksumMatches(expected, actual); got != tt.want {
+			t.Errorf("%s: checksumMatches = %v, want %v", tt.fileName, got, tt.want)
+		}
+	}
+
+	if _, ok := lookupChecksum(sums, "xentz-agent-freebsd-amd64"); ok {
+		t.Error("lookupChecksum found an entry for a file that is not listed")
+	}
+	// Uppercase digests are accepted
+	if !checksumMatches(strings.ToUpper(digest), actual) {
+		t.Error("checksumMatches is case-sensitive")
+	}
+}
+
+func TestChecksumMalformed(t *testing.T) {
+	digest := strings.Repeat("ab", sha256.Size)
+
+	// Lines without exactly a digest and a name are skipped
+	for _, sums := range []string{
+		"",
+		"xentz-agent-linux-amd64",
+		digest,
+		digest + "  xentz-agent-linux-amd64  extra",
+		digest + "xentz-agent-linux-amd64",
+	} {
+		if expected, ok := lookupChecksum(sums, "xentz-agent-linux-amd64"); ok {
+			t.Errorf("lookupChecksum(%q) = %q, want no entry", sums, expected)
+		}
+	}
+
+	// A digest of the wrong length never matches, even against itself
+	for _, expected := range []string{"", "abcd", digest[:len(digest)-2], digest + "00"} {
+		if checksumMatches(expected, expected) {
+			t.Errorf("checksumMatches(%q) = true for a malformed digest", expected)
+		}
+	}
+}
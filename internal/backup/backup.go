@@ -5,96 +5,364 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"xentz-agent/internal/config"
+	"xentz-agent/internal/logx"
+	"xentz-agent/internal/netcond"
+	"xentz-agent/internal/power"
 	"xentz-agent/internal/state"
 )
 
-func Run(ctx context.Context, cfg config.Config, autoInit bool) state.LastRun {
+// Options control a single backup or retention run
+type Options struct {
+	AutoInit bool // Initialize the repository if it doesn't exist (backup only)
+	DryRun   bool // Preview only: nothing is written to the repository
+	Quiet    bool // Don't stream restic's own output (progress lines are still logged)
+	Verbose  int  // Pass -v (-vv, ...) to restic and stream its output even when Quiet
+}
+
+// stream reports whether restic's output should be copied to stdout as it arrives
+func (o Options) stream() bool {
+	return !o.Quiet || o.Verbose > 0
+}
+
+// verboseArgs returns restic's -v flag repeated opts.Verbose times (none by default)
+func verboseArgs(opts Options) []string {
+	if opts.Verbose <= 0 {
+		return nil
+	}
+	return []string{"-" + strings.Repeat("v", opts.Verbose)}
+}
+
+// Run performs one restic backup of cfg.Include.
+// With opts.DryRun, restic only reports what would be backed up and the repository is never initialized.
+func Run(ctx context.Context, cfg config.Config, opts Options) (result state.LastRun) {
 	start := time.Now()
+	defer func() { result = timedOut(ctx, start, result) }()
+
+	if !opts.DryRun {
+		if reason := skipReason(ctx, cfg); reason != "" {
+			return state.NewLastRunSkipped(start, reason)
+		}
+	}
 
 	if len(cfg.Include) == 0 {
-		return state.NewLastRunError(time.Since(start), 0, "no include paths configured")
+		return failedRun(start, KindConfigInvalid, "no include paths configured")
 	}
 	if cfg.Restic.Repository == "" {
-		return state.NewLastRunError(time.Since(start), 0, "restic.repository is required")
+		return failedRun(start, KindConfigInvalid, "restic.repository is required")
 	}
-	if cfg.Restic.PasswordFile == "" {
-		return state.NewLastRunError(time.Since(start), 0, "restic.password_file is required (MVP)")
+	env, err := resticEnv(cfg)
+	if err != nil {
+		return failedRun(start, KindConfigInvalid, err.Error())
 	}
 
 	// Ensure restic exists
 	if _, err := exec.LookPath("restic"); err != nil {
-		return state.NewLastRunError(time.Since(start), 0, "restic not found in PATH (install restic first)")
+		return failedRun(start, KindResticMissing, "restic not found in PATH (install restic first)")
+	}
+	if err := checkResticVersion(ctx); err != nil {
+		return failedRun(start, KindResticMissing, err.Error())
 	}
 
 	// Check if repository exists and is initialized
 	// Only auto-init if explicitly enabled (prevents accidental repo creation)
-	if err := checkOrInitRepo(ctx, cfg, autoInit); err != nil {
-		return state.NewLastRunError(time.Since(start), 0, "repo init check failed: "+err.Error())
+	if err := checkOrInitRepo(ctx, env, opts.AutoInit && !opts.DryRun); err != nil {
+		kind, _ := classifyResticError(err.Error())
+		if kind == KindUnknown {
+			kind = KindRepoUnreachable
+		}
+		return failedRun(start, kind, "repo init check failed: "+err.Error())
 	}
 
-	args := []string{"backup", "--json"}
-	for _, ex := range cfg.Exclude {
-		args = append(args, "--exclude", ex)
+	// Expand ~ and $VARS so restic never sees them literally
+	cfg.Include = expandPaths(cfg.Include)
+	cfg.Exclude = expandPatterns(cfg.Exclude)
+
+	// A missing include path (e.g. an unmounted drive) would otherwise be skipped silently
+	present, missing := splitMissing(cfg.Include)
+	if len(missing) > 0 {
+		if cfg.FailOnMissingInclude {
+			res := failedRun(start, KindConfigInvalid, "include paths not found: "+strings.Join(missing, ", "))
+			res.SkippedPaths = missing
+			return res
+		}
+		logx.Printf("warning: skipping include paths that do not exist: %s", strings.Join(missing, ", "))
+		if len(present) == 0 {
+			res := failedRun(start, KindConfigInvalid, "none of the include paths exist: "+strings.Join(missing, ", "))
+			res.SkippedPaths = missing
+			return res
+		}
+		cfg.Include = present
 	}
-	// Consider adding: --one-file-system, --exclude-caches, etc. later.
-	// Add -- before include paths to prevent flag injection if paths start with -
-	args = append(args, "--")
-	args = append(args, cfg.Include...)
 
-	cmd := exec.CommandContext(ctx, "restic", args...)
-	cmd.Env = append(cmd.Environ(),
-		"RESTIC_REPOSITORY="+cfg.Restic.Repository,
-		"RESTIC_PASSWORD_FILE="+expandHome(cfg.Restic.PasswordFile),
-	)
+	// Exclude files must exist, otherwise restic fails with an opaque error
+	var excludeFiles []string
+	for _, f := range cfg.ExcludeFiles {
+		path := ExpandPath(f)
+		if _, err := os.Stat(path); err != nil {
+			return failedRun(start, KindConfigInvalid, "exclude file not found: "+path)
+		}
+		excludeFiles = append(excludeFiles, path)
+	}
+
+	// Hooks change the system (dump a database, stop a service), so previews skip them
+	if opts.DryRun {
+		res := runBackup(ctx, cfg, env, excludeFiles, opts, start)
+		res.SkippedPaths = missing
+		return res
+	}
+
+	// A failing pre-hook aborts the backup; post-hooks still run so they can undo its work
+	var res state.LastRun
+	if err := runHooks(ctx, "pre-backup", cfg.PreBackup, nil); err != nil {
+		res = failedRun(start, KindUnknown, err.Error())
+	} else {
+		res = runBackup(ctx, cfg, env, excludeFiles, opts, start)
+	}
+	res.SkippedPaths = missing
+
+	postEnv := []string{"XENTZ_BACKUP_STATUS=" + res.Status, "XENTZ_SNAPSHOT_ID=" + res.SnapshotID}
+	if err := runHooks(ctx, "post-backup", cfg.PostBackup, postEnv); err != nil {
+		if res.Status == "success" {
+			// The snapshot was written; keep its stats but flag the run
+			res.Status = "degraded"
+			res.Error = err.Error()
+		} else {
+			res.Error += "\n" + err.Error()
+		}
+	}
+	return res
+}
+
+// skipReason returns why the backup should not run now under cfg's conditions ("" to run).
+// Conditions that cannot be determined never skip the backup.
+func skipReason(ctx context.Context, cfg config.Config) string {
+	if cfg.RequireACPower {
+		onBattery, err := power.OnBattery(ctx)
+		if err != nil {
+			logx.Printf("warning: require_ac_power: %v (backing up anyway)", err)
+		} else if onBattery {
+			return "running on battery power"
+		}
+	}
+	if cfg.RequireNetwork {
+		online, err := netcond.Online()
+		if err != nil {
+			logx.Printf("warning: require_network: %v (backing up anyway)", err)
+		} else if !online {
+			return "no network connection"
+		}
+	}
+	if cfg.SkipOnMetered {
+		metered, reason, err := netcond.Metered(ctx)
+		if err != nil {
+			logx.Printf("warning: skip_on_metered: %v (backing up anyway)", err)
+		} else if metered {
+			return reason
+		}
+	}
+	return ""
+}
+
+// runBackup runs `restic backup` for the already-expanded cfg and parses its summary
+func runBackup(ctx context.Context, cfg config.Config, env, excludeFiles []string, opts Options, start time.Time) state.LastRun {
+	// Newer flags are dropped rather than failing the backup on older restic versions
+	if cfg.Restic.Compression != "" && !resticSupports(ctx, "restic.compression", resticCompressionVersion) {
+		cfg.Restic.Compression = ""
+	}
+	if cfg.Restic.PackSizeMiB > 0 && !resticSupports(ctx, "restic.pack_size_mib", resticPackSizeVersion) {
+		cfg.Restic.PackSizeMiB = 0
+	}
+	if cfg.Restic.ReadConcurrency > 0 && !resticSupports(ctx, "restic.read_concurrency", resticReadConcurrencyVersion) {
+		cfg.Restic.ReadConcurrency = 0
+	}
 
+	args := backupArgs(cfg, excludeFiles, opts)
+	logx.Debugf("running restic %s", strings.Join(args, " "))
+
+	// Retry transient backend/network failures with exponential backoff
+	maxAttempts, delay := retryPolicy(cfg)
 	var out bytes.Buffer
 	var jsonOut bytes.Buffer
-	cmd.Stderr = &out     // Errors go to stderr
-	cmd.Stdout = &jsonOut // JSON output goes to stdout
+	var err error
+	var stats *resticStats
+	attempt := 0
+	unlockTried := false
+	for {
+		attempt++
+		out.Reset()
+		jsonOut.Reset()
+
+		cmd := exec.CommandContext(ctx, "restic", args...)
+		cmd.Env = append(cmd.Environ(), env...)
+		// Errors go to stderr, JSON status/summary messages to stdout.
+		// Both are captured; stderr is streamed unless quiet, progress is always logged (throttled).
+		cmd.Stderr = &teeWriter{buf: &out, stream: opts.stream()}
+		cmd.Stdout = &progressWriter{buf: &jsonOut, verbose: opts.Verbose > 0}
+
+		err = cmd.Run()
+
+		// Parse JSON output to extract stats. A run that created its snapshot despite read errors
+		// is done: retrying it (its errors may look transient) would only add duplicate snapshots.
+		stats = parseResticJSON(jsonOut.Bytes(), out.Bytes())
+		if partialSnapshot(err, stats, opts.DryRun) {
+			err = nil
+			break
+		}
 
-	err := cmd.Run()
-	dur := time.Since(start)
+		// A lock left behind by a killed run would fail every backup until removed
+		if err != nil && !unlockTried && isLockError(out.String()) {
+			unlockTried = true
+			removed, unlockErr := removeStaleLocks(ctx, env, staleLockAge(cfg))
+			if unlockErr != nil {
+				logx.Printf("warning: not removing repository lock: %v", unlockErr)
+			}
+			if removed {
+				continue
+			}
+		}
+		if err == nil || attempt >= maxAttempts || ctx.Err() != nil || !isTransientResticError(out.String()) {
+			break
+		}
+		logx.Printf("restic backup failed with a transient error (attempt %d/%d), retrying in %s...",
+			attempt, maxAttempts, delay)
+		if !sleepCtx(ctx, delay) {
+			break
+		}
+		delay *= 2
+	}
 
 	if err != nil {
 		// Keep last ~8KB of output so status is readable
 		msg := tail(out.String(), 8192)
-		return state.NewLastRunError(dur, 0, "restic backup failed: "+err.Error()+"\n"+msg)
+		kind, _ := classifyResticError(out.String())
+		res := failedRun(start, kind, "restic backup failed: "+err.Error()+"\n"+msg)
+		res.Attempts = attempt
+		return res
 	}
 
-	// Parse JSON output to extract stats
-	stats := parseResticJSON(jsonOut.Bytes())
-	if stats != nil {
-		return state.NewLastRunSuccessWithStats(
-			dur,
-			stats.FilesTotal,
-			stats.BytesTotal,
-			stats.DataAddedBytes,
-			stats.SnapshotID,
-		)
+	res := successRun(start, stats)
+	res.Attempts = attempt
+	return res
+}
+
+// partialSnapshot reports whether restic exited with code 3: the snapshot was created (or, in
+// a dry run, would be), but some source files could not be read.
+func partialSnapshot(err error, stats *resticStats, dryRun bool) bool {
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr) && exitErr.ExitCode() == 3 &&
+		stats != nil && (stats.SnapshotID != "" || dryRun)
+}
+
+// successRun builds the LastRun for a backup restic completed, flagged "degraded" when files
+// could not be read.
+func successRun(start time.Time, stats *resticStats) state.LastRun {
+	if stats == nil {
+		// Fallback to basic success if JSON parsing fails
+		return state.NewLastRunSuccess(start, 0)
 	}
+	res := state.NewLastRunSuccessWithStats(
+		start,
+		stats.FilesTotal,
+		stats.BytesTotal,
+		stats.DataAddedBytes,
+		stats.SnapshotID,
+	)
+	if stats.ErrorsCount > 0 {
+		// The snapshot is incomplete: flag the run instead of reporting plain success
+		res.Status = "degraded"
+		res.ErrorsCount = stats.ErrorsCount
+		res.ErrorSample = stats.ErrorSample
+		res.Error = fmt.Sprintf("restic could not read %d file(s): %s", stats.ErrorsCount, stats.ErrorSample[0])
+	}
+	return res
+}
+
+// backupArgs builds the `restic backup` arguments for cfg.
+// excludeFiles are the already-resolved exclude file paths.
+func backupArgs(cfg config.Config, excludeFiles []string, opts Options) []string {
+	args := []string{"backup", "--json"}
+	if opts.DryRun {
+		args = append(args, "--dry-run")
+	}
+	args = append(args, verboseArgs(opts)...)
+	args = append(args, limitArgs(cfg)...)
+	for _, ex := range cfg.Exclude {
+		args = append(args, "--exclude", ex)
+	}
+	for _, f := range excludeFiles {
+		args = append(args, "--exclude-file", f)
+	}
+	for _, t := range snapshotTags(cfg) {
+		args = append(args, "--tag", t)
+	}
+	if cfg.Restic.OneFileSystem {
+		args = append(args, "--one-file-system")
+	}
+	if cfg.Restic.ExcludeCaches {
+		args = append(args, "--exclude-caches")
+	}
+	if cfg.Restic.Compression != "" {
+		args = append(args, "--compression", cfg.Restic.Compression)
+	}
+	if cfg.Restic.PackSizeMiB > 0 {
+		args = append(args, "--pack-size", strconv.Itoa(cfg.Restic.PackSizeMiB))
+	}
+	if cfg.Restic.ReadConcurrency > 0 {
+		args = append(args, "--read-concurrency", strconv.Itoa(cfg.Restic.ReadConcurrency))
+	}
+	// Add -- before include paths to prevent flag injection if paths start with -
+	args = append(args, "--")
+	args = append(args, cfg.Include...)
+	return args
+}
 
-	// Fallback to basic success if JSON parsing fails
-	return state.NewLastRunSuccess(dur, 0)
+// snapshotTags returns the tags for a new snapshot: the configured tags (each once, in order)
+// plus the device tag when enrolled, so tag-scoped retention finds the snapshot even if the
+// server config omits the tag
+func snapshotTags(cfg config.Config) []string {
+	var tags []string
+	for _, t := range cfg.Tags {
+		if !slices.Contains(tags, t) {
+			tags = append(tags, t)
+		}
+	}
+	if cfg.DeviceID != "" && !slices.Contains(tags, config.DeviceTag(cfg.DeviceID)) {
+		tags = append(tags, config.DeviceTag(cfg.DeviceID))
+	}
+	return tags
+}
+
+// limitArgs returns restic's bandwidth limit flags for cfg (empty when unlimited)
+func limitArgs(cfg config.Config) []string {
+	var args []string
+	if cfg.Restic.UploadLimitKiB > 0 {
+		args = append(args, "--limit-upload", strconv.Itoa(cfg.Restic.UploadLimitKiB))
+	}
+	if cfg.Restic.DownloadLimitKiB > 0 {
+		args = append(args, "--limit-download", strconv.Itoa(cfg.Restic.DownloadLimitKiB))
+	}
+	return args
 }
 
 // checkOrInitRepo checks if the repository exists and is initialized.
 // If autoInit is true and the repo doesn't exist, it will attempt to initialize it.
 // If autoInit is false and the repo doesn't exist, it returns an error.
-func checkOrInitRepo(ctx context.Context, cfg config.Config, autoInit bool) error {
+// env is the repository/password environment from resticEnv.
+func checkOrInitRepo(ctx context.Context, env []string, autoInit bool) error {
 	// "restic cat config" succeeds only if repo exists and is initialized
 	cmd := exec.CommandContext(ctx, "restic", "cat", "config")
-	cmd.Env = append(cmd.Environ(),
-		"RESTIC_REPOSITORY="+cfg.Restic.Repository,
-		"RESTIC_PASSWORD_FILE="+expandHome(cfg.Restic.PasswordFile),
-	)
+	cmd.Env = append(cmd.Environ(), env...)
 	var out bytes.Buffer
 	cmd.Stdout = &out
 	cmd.Stderr = &out
@@ -106,7 +374,7 @@ func checkOrInitRepo(ctx context.Context, cfg config.Config, autoInit bool) erro
 
 	// Repository doesn't exist or isn't initialized
 	if !autoInit {
-		return fmt.Errorf("repository does not exist or is not initialized (use --auto-init to automatically initialize, or run 'restic init' manually)")
+		return fmt.Errorf("repository does not exist or is not initialized (use --auto-init to automatically initialize, or run 'restic init' manually)\noutput: %s", tail(out.String(), 2048))
 	}
 
 	// Auto-init is enabled, attempt to initialize
@@ -163,6 +431,47 @@ func expandHome(p string) string {
 	return p
 }
 
+// ExpandPath expands environment variables and ~ in p and makes it absolute
+func ExpandPath(p string) string {
+	return expandHome(os.ExpandEnv(p))
+}
+
+// expandPaths returns paths with ExpandPath applied to each entry
+func expandPaths(paths []string) []string {
+	out := make([]string, 0, len(paths))
+	for _, p := range paths {
+		out = append(out, ExpandPath(p))
+	}
+	return out
+}
+
+// splitMissing separates paths into those that exist and those that don't
+func splitMissing(paths []string) (present, missing []string) {
+	for _, p := range paths {
+		if _, err := os.Stat(p); err != nil {
+			missing = append(missing, p)
+			continue
+		}
+		present = append(present, p)
+	}
+	return present, missing
+}
+
+// expandPatterns expands environment variables and a leading ~ in exclude patterns.
+// Unlike ExpandPath, relative patterns (e.g. "*.tmp") are left relative so restic
+// keeps matching them anywhere in the tree.
+func expandPatterns(patterns []string) []string {
+	out := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		p = os.ExpandEnv(p)
+		if p == "~" || strings.HasPrefix(p, "~/") {
+			p = expandHome(p)
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
 func tail(s string, max int) string {
 	if len(s) <= max {
 		return s
@@ -170,35 +479,56 @@ func tail(s string, max int) string {
 	return s[len(s)-max:]
 }
 
+// Errors kept in LastRun.ErrorSample, and the length each is truncated to
+const (
+	maxErrorSample       = 5
+	maxErrorSampleLength = 200
+)
+
 // resticStats contains parsed statistics from restic JSON output
 type resticStats struct {
 	FilesTotal     int64
 	BytesTotal     int64
 	DataAddedBytes int64
 	SnapshotID     string
+
+	// Non-fatal errors: files restic could not read, which are missing from the snapshot
+	ErrorsCount int
+	ErrorSample []string
 }
 
-// parseResticJSON parses restic JSON output and extracts summary statistics
-func parseResticJSON(data []byte) *resticStats {
-	// Restic outputs JSON objects, one per line
-	scanner := bufio.NewScanner(bytes.NewReader(data))
+// parseResticJSON parses restic JSON output (stdout, and stderr where restic writes its
+// {"message_type":"error"} messages) and extracts the summary statistics and error count.
+// It returns nil without a summary.
+func parseResticJSON(streams ...[]byte) *resticStats {
 	var summary map[string]interface{}
-
-	for scanner.Scan() {
-		line := scanner.Bytes()
-		if len(line) == 0 {
-			continue
-		}
-
-		var msg map[string]interface{}
-		if err := json.Unmarshal(line, &msg); err != nil {
-			continue
-		}
-
-		// Look for summary message
-		if msgType, ok := msg["message_type"].(string); ok && msgType == "summary" {
-			summary = msg
-			break
+	var errorsCount int
+	var errorSample []string
+
+	for _, data := range streams {
+		// Restic outputs JSON objects, one per line
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			if len(line) == 0 {
+				continue
+			}
+
+			var msg map[string]interface{}
+			if err := json.Unmarshal(line, &msg); err != nil {
+				continue
+			}
+
+			switch msg["message_type"] {
+			case "summary":
+				summary = msg
+			case "error":
+				errorsCount++
+				if len(errorSample) < maxErrorSample {
+					errorSample = append(errorSample, resticErrorText(msg))
+				}
+			}
 		}
 	}
 
@@ -206,7 +536,7 @@ func parseResticJSON(data []byte) *resticStats {
 		return nil
 	}
 
-	stats := &resticStats{}
+	stats := &resticStats{ErrorsCount: errorsCount, ErrorSample: errorSample}
 
 	// Extract files_total (sum of files_new, files_changed, files_unmodified)
 	if filesNew, ok := getFloat64(summary, "files_new"); ok {
@@ -237,6 +567,24 @@ func parseResticJSON(data []byte) *resticStats {
 	return stats
 }
 
+// resticErrorText formats a restic error message such as
+// {"message_type":"error","error":{"message":"open /x: permission denied"},"during":"archival","item":"/x"}
+func resticErrorText(msg map[string]interface{}) string {
+	text := "unknown error"
+	if e, ok := msg["error"].(map[string]interface{}); ok {
+		if m, ok := e["message"].(string); ok && m != "" {
+			text = m
+		}
+	}
+	if item, ok := msg["item"].(string); ok && item != "" && !strings.Contains(text, item) {
+		text = item + ": " + text
+	}
+	if len(text) > maxErrorSampleLength {
+		text = text[:maxErrorSampleLength] + "..."
+	}
+	return text
+}
+
 // getFloat64 safely extracts a float64 from a map, handling both float64 and int types
 func getFloat64(m map[string]interface{}, key string) (float64, bool) {
 	val, ok := m[key]
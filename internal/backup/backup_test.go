@@ -0,0 +1,281 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"xentz-agent/internal/config"
+)
+
+const testSummary = `{"message_type":"summary","files_new":2,"files_changed":1,"files_unmodified":7,` +
+	`"total_bytes_processed":4096,"bytes_added":512,"snapshot_id":"1a2b3c4d"}`
+
+func resticErrorLine(item, msg string) string {
+	return fmt.Sprintf(`{"message_type":"error","error":{"message":%q},"during":"archival","item":%q}`, msg, item)
+}
+
+func TestParseResticJSONErrors(t *testing.T) {
+	stdout := `{"message_type":"status","percent_done":0.5}` + "\n" + testSummary + "\n"
+	stderr := resticErrorLine("/home/u/secret", "open /home/u/secret: permission denied") + "\n" +
+		"Warning: at least one source file could not be read\n" +
+		resticErrorLine("/mnt/nfs/x", "read /mnt/nfs/x: i/o timeout") + "\n"
+
+	stats := parseResticJSON([]byte(stdout), []byte(stderr))
+	if stats == nil {
+		t.Fatal("parseResticJSON returned nil with a summary")
+	}
+	if stats.SnapshotID != "1a2b3c4d" || stats.FilesTotal != 10 || stats.BytesTotal != 4096 || stats.DataAddedBytes != 512 {
+		t.Errorf("summary stats = %+v", stats)
+	}
+	if stats.ErrorsCount != 2 {
+		t.Errorf("ErrorsCount = %d, want 2", stats.ErrorsCount)
+	}
+	want := []string{"open /home/u/secret: permission denied", "read /mnt/nfs/x: i/o timeout"}
+	if strings.Join(stats.ErrorSample, "|") != strings.Join(want, "|") {
+		t.Errorf("ErrorSample = %q, want %q", stats.ErrorSample, want)
+	}
+}
+
+func TestParseResticJSONNoSummary(t *testing.T) {
+	stderr := resticErrorLine("/x", "permission denied")
+	if stats := parseResticJSON(nil, []byte(stderr)); stats != nil {
+		t.Errorf("parseResticJSON without a summary = %+v, want nil", stats)
+	}
+}
+
+func TestParseResticJSONSampleLimits(t *testing.T) {
+	var stderr strings.Builder
+	long := strings.Repeat("a", 3*maxErrorSampleLength)
+	stderr.WriteString(resticErrorLine("/long", long) + "\n")
+	for i := range 2 * maxErrorSample {
+		stderr.WriteString(resticErrorLine(fmt.Sprintf("/f%d", i), "permission denied") + "\n")
+	}
+
+	stats := parseResticJSON([]byte(testSummary), []byte(stderr.String()))
+	if stats.ErrorsCount != 2*maxErrorSample+1 {
+		t.Errorf("ErrorsCount = %d, want %d", stats.ErrorsCount, 2*maxErrorSample+1)
+	}
+	if len(stats.ErrorSample) != maxErrorSample {
+		t.Fatalf("len(ErrorSample) = %d, want %d", len(stats.ErrorSample), maxErrorSample)
+	}
+	if got := stats.ErrorSample[0]; len(got) != maxErrorSampleLength+len("...") || !strings.HasSuffix(got, "...") {
+		t.Errorf("long error not truncated: %d bytes", len(got))
+	}
+	if got := stats.ErrorSample[1]; got != "/f0: permission denied" {
+		t.Errorf("ErrorSample[1] = %q", got)
+	}
+}
+
+func TestSuccessRunDegraded(t *testing.T) {
+	stderr := resticErrorLine("/etc/shadow", "open /etc/shadow: permission denied") + "\n" +
+		resticErrorLine("/root/.ssh", "open /root/.ssh: permission denied")
+	stats := parseResticJSON([]byte(testSummary), []byte(stderr))
+
+	res := successRun(time.Now(), stats)
+	if res.Status != "degraded" {
+		t.Errorf("Status = %q, want degraded", res.Status)
+	}
+	if res.SnapshotID != "1a2b3c4d" || res.ErrorsCount != 2 || len(res.ErrorSample) != 2 {
+		t.Errorf("result = %+v", res)
+	}
+	if want := "restic could not read 2 file(s): open /etc/shadow: permission denied"; res.Error != want {
+		t.Errorf("Error = %q, want %q", res.Error, want)
+	}
+
+	if res := successRun(time.Now(), parseResticJSON([]byte(testSummary))); res.Status != "success" || res.Error != "" {
+		t.Errorf("clean run = %+v, want success", res)
+	}
+}
+
+func TestPartialSnapshot(t *testing.T) {
+	exit3 := exec.Command("sh", "-c", "exit 3").Run()
+	if _, ok := exit3.(*exec.ExitError); !ok {
+		t.Skipf("no sh to produce exit code 3: %v", exit3)
+	}
+	exit1 := exec.Command("sh", "-c", "exit 1").Run()
+	withSnapshot := &resticStats{SnapshotID: "1a2b3c4d"}
+
+	tests := []struct {
+		name   string
+		err    error
+		stats  *resticStats
+		dryRun bool
+		want   bool
+	}{
+		{"exit 3 with snapshot", exit3, withSnapshot, false, true},
+		{"exit 3 without summary", exit3, nil, false, false},
+		{"exit 3 without snapshot", exit3, &resticStats{}, false, false},
+		{"exit 3 dry run", exit3, &resticStats{}, true, true},
+		{"exit 1 with snapshot", exit1, withSnapshot, false, false},
+		{"success", nil, withSnapshot, false, false},
+	}
+	for _, tt := range tests {
+		if got := partialSnapshot(tt.err, tt.stats, tt.dryRun); got != tt.want {
+			t.Errorf("%s: partialSnapshot = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSnapshotTags(t *testing.T) {
+	tests := []struct {
+		name     string
+		tags     []string
+		deviceID string
+		want     []string
+	}{
+		{"none", nil, "", nil},
+		{"configured", []string{"laptop", "daily"}, "", []string{"laptop", "daily"}},
+		{"duplicates", []string{"laptop", "daily", "laptop", "daily"}, "", []string{"laptop", "daily"}},
+		{"device tag added", []string{"laptop"}, "dev-1", []string{"laptop", "device:dev-1"}},
+		{"device tag only", nil, "dev-1", []string{"device:dev-1"}},
+		{"device tag kept in place", []string{"device:dev-1", "laptop", "device:dev-1"}, "dev-1", []string{"device:dev-1", "laptop"}},
+	}
+	for _, tt := range tests {
+		var cfg config.Config
+		cfg.Tags = tt.tags
+		cfg.DeviceID = tt.deviceID
+		if got := snapshotTags(cfg); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: snapshotTags = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBackupArgsTags(t *testing.T) {
+	var cfg config.Config
+	cfg.Include = []string{"/home/u", "-odd-name"}
+	cfg.Exclude = []string{"*.tmp"}
+	cfg.Tags = []string{"laptop", "daily", "laptop"}
+	cfg.DeviceID = "dev-1"
+
+	got := backupArgs(cfg, []string{"/etc/xentz/excludes"}, Options{})
+	want := []string{
+		"backup", "--json",
+		"--exclude", "*.tmp",
+		"--exclude-file", "/etc/xentz/excludes",
+		"--tag", "laptop", "--tag", "daily", "--tag", "device:dev-1",
+		"--", "/home/u", "-odd-name",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("backupArgs =\n%q\nwant\n%q", got, want)
+	}
+
+	// Building the args must not modify the config's tags
+	if !slices.Equal(cfg.Tags, []string{"laptop", "daily", "laptop"}) {
+		t.Errorf("cfg.Tags modified: %q", cfg.Tags)
+	}
+}
+
+func TestBackupArgsFilesystem(t *testing.T) {
+	tests := []struct {
+		name          string
+		oneFileSystem bool
+		excludeCaches bool
+		want          []string
+	}{
+		{"defaults", false, false, nil},
+		{"one file system", true, false, []string{"--one-file-system"}},
+		{"exclude caches", false, true, []string{"--exclude-caches"}},
+		{"both", true, true, []string{"--one-file-system", "--exclude-caches"}},
+	}
+	for _, tt := range tests {
+		var cfg config.Config
+		cfg.Include = []string{"/home/u"}
+		cfg.Restic.OneFileSystem = tt.oneFileSystem
+		cfg.Restic.ExcludeCaches = tt.excludeCaches
+
+		want := append(append([]string{"backup", "--json"}, tt.want...), "--", "/home/u")
+		if got := backupArgs(cfg, nil, Options{}); !slices.Equal(got, want) {
+			t.Errorf("%s: backupArgs = %q, want %q", tt.name, got, want)
+		}
+	}
+}
+
+func TestBackupArgsPerformance(t *testing.T) {
+	tests := []struct {
+		name            string
+		readConcurrency int
+		packSizeMiB     int
+		want            []string
+	}{
+		{"defaults", 0, 0, nil},
+		{"read concurrency", 4, 0, []string{"--read-concurrency", "4"}},
+		{"pack size", 0, 64, []string{"--pack-size", "64"}},
+		{"both", 8, 32, []string{"--pack-size", "32", "--read-concurrency", "8"}},
+	}
+	for _, tt := range tests {
+		var cfg config.Config
+		cfg.Include = []string{"/home/u"}
+		cfg.Restic.ReadConcurrency = tt.readConcurrency
+		cfg.Restic.PackSizeMiB = tt.packSizeMiB
+
+		want := append(append([]string{"backup", "--json"}, tt.want...), "--", "/home/u")
+		if got := backupArgs(cfg, nil, Options{}); !slices.Equal(got, want) {
+			t.Errorf("%s: backupArgs = %q, want %q", tt.name, got, want)
+		}
+	}
+}
+
+func TestExpandPaths(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("XENTZ_DATA", filepath.Join(home, "data"))
+	absolute := filepath.Join(home, "abs")
+
+	include := []string{"~", "~/Documents", "$HOME/Pictures", "${HOME}/Music", "$XENTZ_DATA/db", absolute}
+	want := []string{
+		home,
+		filepath.Join(home, "Documents"),
+		filepath.Join(home, "Pictures"),
+		filepath.Join(home, "Music"),
+		filepath.Join(home, "data", "db"),
+		absolute,
+	}
+	if got := expandPaths(include); !slices.Equal(got, want) {
+		t.Errorf("expandPaths =\n%q\nwant\n%q", got, want)
+	}
+
+	exclude := []string{"~/.cache", "$HOME/Downloads/*.iso", "*.tmp", "node_modules", "~user/x"}
+	want = []string{
+		filepath.Join(home, ".cache"),
+		home + "/Downloads/*.iso",
+		"*.tmp",
+		"node_modules",
+		"~user/x",
+	}
+	if got := expandPatterns(exclude); !slices.Equal(got, want) {
+		t.Errorf("expandPatterns =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestRunMissingIncludeIsConfigInvalid(t *testing.T) {
+	cfg, _ := fakeRestic(t, `echo '`+testSummary+`'`)
+	missing := filepath.Join(t.TempDir(), "unmounted")
+
+	tests := []struct {
+		name    string
+		include []string
+		failOn  bool
+		want    string
+	}{
+		{"fail_on_missing_include", []string{cfg.Include[0], missing}, true, "include paths not found: " + missing},
+		{"none exist", []string{missing}, false, "none of the include paths exist: " + missing},
+	}
+	for _, tt := range tests {
+		cfg.Include = tt.include
+		cfg.FailOnMissingInclude = tt.failOn
+		res := Run(context.Background(), cfg, Options{Quiet: true})
+		if res.Status != "error" || res.ErrorKind != string(KindConfigInvalid) || res.Error != tt.want {
+			t.Errorf("%s: Run = %s (%s): %q; want config_invalid: %q", tt.name, res.Status, res.ErrorKind, res.Error, tt.want)
+		}
+		if !slices.Equal(res.SkippedPaths, []string{missing}) {
+			t.Errorf("%s: SkippedPaths = %q, want %q", tt.name, res.SkippedPaths, missing)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+	"time"
+
+	"xentz-agent/internal/config"
+	"xentz-agent/internal/logx"
+	"xentz-agent/internal/state"
+)
+
+// RunCheck verifies the repository's structure with `restic check`.
+// opts.AutoInit and opts.DryRun are ignored.
+func RunCheck(ctx context.Context, cfg config.Config, opts Options) (result state.LastRun) {
+	start := time.Now()
+	defer func() { result = timedOut(ctx, start, result) }()
+
+	if cfg.Restic.Repository == "" {
+		return failedRun(start, KindConfigInvalid, "restic.repository is required")
+	}
+	env, err := resticEnv(cfg)
+	if err != nil {
+		return failedRun(start, KindConfigInvalid, err.Error())
+	}
+	if _, err := exec.LookPath("restic"); err != nil {
+		return failedRun(start, KindResticMissing, "restic not found in PATH")
+	}
+	if err := checkResticVersion(ctx); err != nil {
+		return failedRun(start, KindResticMissing, err.Error())
+	}
+
+	args := append([]string{"check"}, verboseArgs(opts)...)
+	args = append(args, limitArgs(cfg)...)
+	logx.Debugf("running restic %s", strings.Join(args, " "))
+
+	var out bytes.Buffer
+	err = runCheck(ctx, args, env, &out, opts.stream())
+	// A lock left behind by a killed run would fail every check until removed
+	if err != nil && isLockError(out.String()) {
+		removed, unlockErr := removeStaleLocks(ctx, env, staleLockAge(cfg))
+		if unlockErr != nil {
+			logx.Printf("warning: not removing repository lock: %v", unlockErr)
+		}
+		if removed {
+			out.Reset()
+			err = runCheck(ctx, args, env, &out, opts.stream())
+		}
+	}
+
+	if err != nil {
+		kind, _ := classifyResticError(out.String())
+		return failedRun(start, kind, "restic check failed: "+err.Error()+"\n"+tail(out.String(), 8192))
+	}
+	return state.NewLastRunSuccess(start, 0)
+}
+
+// runCheck runs `restic check` with args, capturing its output in out (and copying it to
+// stdout with stream)
+func runCheck(ctx context.Context, args, env []string, out *bytes.Buffer, stream bool) error {
+	cmd := exec.CommandContext(ctx, "restic", args...)
+	cmd.Env = append(cmd.Environ(), env...)
+	tee := &teeWriter{buf: out, stream: stream}
+	cmd.Stdout = tee
+	cmd.Stderr = tee
+	return cmd.Run()
+}
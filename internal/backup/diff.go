@@ -0,0 +1,81 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+
+	"xentz-agent/internal/config"
+)
+
+// DiffStats counts what `restic diff` found added or removed between two snapshots
+type DiffStats struct {
+	Files int   `json:"files"`
+	Dirs  int   `json:"dirs"`
+	Bytes int64 `json:"bytes"`
+}
+
+// DiffSummary is the typed form of the statistics printed by `restic diff --json`
+type DiffSummary struct {
+	SourceSnapshot string    `json:"source_snapshot"`
+	TargetSnapshot string    `json:"target_snapshot"`
+	ChangedFiles   int       `json:"changed_files"`
+	Added          DiffStats `json:"added"`
+	Removed        DiffStats `json:"removed"`
+}
+
+// Diff compares snapshots a and b (b defaults to "latest") with `restic diff`
+func Diff(ctx context.Context, cfg config.Config, a, b string) (DiffSummary, error) {
+	if a == "" {
+		return DiffSummary{}, fmt.Errorf("snapshot ID is required")
+	}
+	if b == "" {
+		b = "latest"
+	}
+	if cfg.Restic.Repository == "" {
+		return DiffSummary{}, fmt.Errorf("restic.repository is required")
+	}
+	env, err := resticEnv(cfg)
+	if err != nil {
+		return DiffSummary{}, err
+	}
+	if _, err := exec.LookPath("restic"); err != nil {
+		return DiffSummary{}, fmt.Errorf("restic not found in PATH (install restic first)")
+	}
+
+	out, err := resticOutput(ctx, env, "diff", "--json", a, b)
+	if err != nil {
+		return DiffSummary{}, err
+	}
+	return parseDiffJSON(out)
+}
+
+// parseDiffJSON extracts the statistics message from `restic diff --json` output,
+// which prints one JSON object per line ("change" lines followed by "statistics")
+func parseDiffJSON(data []byte) (DiffSummary, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+		var msg struct {
+			MessageType string `json:"message_type"`
+			DiffSummary
+		}
+		if err := json.Unmarshal(line, &msg); err != nil {
+			continue
+		}
+		if msg.MessageType == "statistics" {
+			return msg.DiffSummary, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return DiffSummary{}, fmt.Errorf("read diff output: %w", err)
+	}
+	return DiffSummary{}, fmt.Errorf("restic diff printed no statistics (restic 0.12+ is required for --json)")
+}
@@ -0,0 +1,116 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"xentz-agent/internal/state"
+)
+
+// ErrorKind classifies why a backup or retention run failed (stored in LastRun.ErrorKind)
+type ErrorKind string
+
+const (
+	KindRepoUnreachable ErrorKind = "repo_unreachable" // Repository backend can't be reached or isn't initialized
+	KindAuthFailed      ErrorKind = "auth_failed"      // Wrong repository password or backend credentials
+	KindResticMissing   ErrorKind = "restic_missing"   // restic not installed, too old, or not runnable
+	KindRepoLocked      ErrorKind = "repo_locked"      // Repository locked by another restic process
+	KindTransient       ErrorKind = "transient"        // Backend/network failure that may clear up on retry
+	KindConfigInvalid   ErrorKind = "config_invalid"   // Missing or invalid local settings
+	KindTimeout         ErrorKind = "timeout"          // The run hit its time limit (config "timeouts")
+	KindUnknown         ErrorKind = "unknown"
+)
+
+// authResticErrors are credential failures. Status codes are matched with restic's wording
+// around them, not alone: bare digits also turn up in paths, sizes and snapshot IDs.
+var authResticErrors = []string{
+	"wrong password",
+	"no key found",
+	"unauthorized",
+	"forbidden",
+	"response (401)",
+	"response (403)",
+	"status code 401",
+	"status code 403",
+}
+
+// missingRepoErrors mean the repository isn't there (yet)
+var missingRepoErrors = []string{
+	"does not exist",
+	"is not a repository",
+	"unable to open config file",
+}
+
+// unreachableResticErrors mean the backend could not be contacted at all
+var unreachableResticErrors = []string{
+	"no such host",
+	"connection refused",
+	"network is unreachable",
+	"no route to host",
+}
+
+// transientResticErrors are backend/network failures that usually clear up on retry
+var transientResticErrors = []string{
+	"connection reset",
+	"broken pipe",
+	"timeout",
+	"timed out",
+	"temporary failure",
+	"unexpected eof",
+	"500 internal server error",
+	"502 bad gateway",
+	"503 service unavailable",
+	"504 gateway timeout",
+}
+
+// resticErrorClasses are checked in order: auth, lock and missing-repository errors win
+// over network errors, since retrying cannot fix them
+var resticErrorClasses = []struct {
+	kind     ErrorKind
+	retry    bool
+	patterns []string
+}{
+	{KindRepoLocked, false, []string{"already locked", "unable to create lock"}},
+	{KindAuthFailed, false, authResticErrors},
+	{KindRepoUnreachable, false, missingRepoErrors},
+	{KindRepoUnreachable, true, unreachableResticErrors},
+	{KindTransient, true, transientResticErrors},
+}
+
+// classifyResticError maps restic's error output to an ErrorKind, and reports whether
+// the failure is worth retrying (network or backend 5xx)
+func classifyResticError(output string) (kind ErrorKind, retry bool) {
+	output = strings.ToLower(output)
+	for _, c := range resticErrorClasses {
+		for _, p := range c.patterns {
+			if strings.Contains(output, p) {
+				return c.kind, c.retry
+			}
+		}
+	}
+	return KindUnknown, false
+}
+
+// timedOut marks a failed run as KindTimeout when ctx's deadline has passed: restic was
+// killed, and its own error output ("signal: killed") would hide why
+func timedOut(ctx context.Context, start time.Time, res state.LastRun) state.LastRun {
+	if res.Status != "error" || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return res
+	}
+	msg := "operation timed out"
+	if deadline, ok := ctx.Deadline(); ok {
+		msg += " after " + deadline.Sub(start).Round(time.Second).String()
+	}
+	res.Error = msg + "\n" + res.Error
+	res.ErrorKind = string(KindTimeout)
+	return res
+}
+
+// failedRun returns an "error" LastRun for msg, classified as kind
+func failedRun(start time.Time, kind ErrorKind, msg string) state.LastRun {
+	res := state.NewLastRunError(start, 0, msg)
+	res.ErrorKind = string(kind)
+	return res
+}
@@ -0,0 +1,74 @@
+package backup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"xentz-agent/internal/state"
+)
+
+func TestClassifyResticError(t *testing.T) {
+	tests := []struct {
+		output string
+		kind   ErrorKind
+		retry  bool
+	}{
+		{"Fatal: wrong password or no key found", KindAuthFailed, false},
+		{"Fatal: unable to open config file: unexpected HTTP response (401): 401 Unauthorized", KindAuthFailed, false},
+		{"Fatal: server response unexpected: 403 Forbidden", KindAuthFailed, false},
+		{"Fatal: Stat: unexpected response status code 403", KindAuthFailed, false},
+		{"unable to create lock in backend: repository is already locked by PID 1234", KindRepoLocked, false},
+		{"Fatal: unable to open config file: Stat: stat /srv/repo/config: no such file or directory\nIs there a repository at the following location?\nrepository does not exist", KindRepoUnreachable, false},
+		{"Fatal: unable to open repository: dial tcp: lookup backup.example.com: no such host", KindRepoUnreachable, true},
+		{"dial tcp 10.0.0.5:8000: connect: connection refused", KindRepoUnreachable, true},
+		{"Save(<data/1234abcd>) returned error: read: connection reset by peer", KindTransient, true},
+		{"unexpected HTTP response (503): 503 Service Unavailable", KindTransient, true},
+		{"error: open /home/u/report-401.pdf: permission denied\nprocessed 1403 files, 401.5 MiB", KindUnknown, false},
+		{"snapshot 40312403 saved", KindUnknown, false},
+		{"", KindUnknown, false},
+	}
+	for _, tt := range tests {
+		kind, retry := classifyResticError(tt.output)
+		if kind != tt.kind || retry != tt.retry {
+			t.Errorf("classifyResticError(%q) = %s, %v; want %s, %v", tt.output, kind, retry, tt.kind, tt.retry)
+		}
+	}
+}
+
+func TestTimedOut(t *testing.T) {
+	start := time.Now().Add(-2 * time.Minute)
+	expired, cancel := context.WithDeadline(context.Background(), start.Add(90*time.Second))
+	defer cancel()
+	failed := failedRun(start, KindUnknown, "signal: killed")
+
+	res := timedOut(expired, start, failed)
+	if res.ErrorKind != string(KindTimeout) {
+		t.Errorf("ErrorKind = %q, want %q", res.ErrorKind, KindTimeout)
+	}
+	if want := "operation timed out after 1m30s\nsignal: killed"; res.Error != want {
+		t.Errorf("Error = %q, want %q", res.Error, want)
+	}
+
+	// A successful run that finished just as the deadline passed is left alone
+	success := state.NewLastRunSuccess(start, 0)
+	if res := timedOut(expired, start, success); res.Status != "success" || res.Error != "" || res.ErrorKind != "" {
+		t.Errorf("timedOut(success) = %+v, want it unchanged", res)
+	}
+
+	// So is a failure while the deadline has not passed, or without one
+	live, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	for _, ctx := range []context.Context{live, context.Background()} {
+		if res := timedOut(ctx, start, failed); res.Error != "signal: killed" || res.ErrorKind != string(KindUnknown) {
+			t.Errorf("timedOut(live ctx) = %+v, want it unchanged", res)
+		}
+	}
+
+	// A cancelled run (e.g. on shutdown) is not a timeout
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if res := timedOut(cancelled, start, failed); res.ErrorKind != string(KindUnknown) {
+		t.Errorf("timedOut(cancelled ctx) ErrorKind = %q, want %q", res.ErrorKind, KindUnknown)
+	}
+}
@@ -0,0 +1,53 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"xentz-agent/internal/logx"
+)
+
+// hookTimeout bounds how long a single pre- or post-backup hook may run (shortened in tests)
+var hookTimeout = 15 * time.Minute
+
+// runHooks runs each hook command in order with env appended to the agent's environment.
+// Hook output is streamed to stderr (the agent log). It stops at the first failing hook
+// and returns an error carrying the tail of that hook's output.
+func runHooks(ctx context.Context, stage string, hooks [][]string, env []string) error {
+	for i, argv := range hooks {
+		if len(argv) == 0 || argv[0] == "" {
+			return fmt.Errorf("%s hook %d: empty command", stage, i)
+		}
+		logx.Printf("Running %s hook: %s", stage, strings.Join(argv, " "))
+		if err := runHook(ctx, argv, env); err != nil {
+			return fmt.Errorf("%s hook %q failed: %w", stage, argv[0], err)
+		}
+	}
+	return nil
+}
+
+func runHook(ctx context.Context, argv []string, env []string) error {
+	hookCtx, cancel := context.WithTimeout(ctx, hookTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(hookCtx, argv[0], argv[1:]...)
+	cmd.Env = append(cmd.Environ(), env...)
+	var out bytes.Buffer
+	w := io.MultiWriter(&out, os.Stderr)
+	cmd.Stdout = w
+	cmd.Stderr = w
+
+	if err := cmd.Run(); err != nil {
+		if hookCtx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("timed out after %s", hookTimeout)
+		}
+		return fmt.Errorf("%w\n%s", err, tail(out.String(), 2048))
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"xentz-agent/internal/config"
+)
+
+// fakeRestic puts a `restic` shell script on PATH that logs its arguments to the returned
+// file. `restic backup` runs backupScript; other commands succeed.
+func fakeRestic(t *testing.T, backupScript string) (cfg config.Config, calls string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake restic is a shell script")
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh to run the fake restic")
+	}
+	dir := t.TempDir()
+	calls = filepath.Join(dir, "calls")
+	script := `#!/bin/sh
+echo "$*" >> "` + calls + `"
+case "$1" in
+version) echo "restic 0.17.3 compiled with go1.23.4 on linux/amd64" ;;
+backup) ` + backupScript + ` ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(dir, "restic"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("RESTIC_PASSWORD", "")
+
+	cfg.Include = []string{t.TempDir()}
+	cfg.Restic.Repository = "rest:https://backup.example.com/dev-1"
+	cfg.Restic.PasswordFile = filepath.Join(dir, "restic.pw")
+	return cfg, calls
+}
+
+// resticCalls returns the commands the fake restic was run with
+func resticCalls(t *testing.T, calls string) []string {
+	t.Helper()
+	b, err := os.ReadFile(calls)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	var commands []string
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		if cmd, _, _ := strings.Cut(line, " "); cmd != "" {
+			commands = append(commands, cmd)
+		}
+	}
+	return commands
+}
+
+// statusHook returns a hook that writes $XENTZ_BACKUP_STATUS to the returned file
+func statusHook(t *testing.T) ([]string, string) {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "status")
+	return []string{"sh", "-c", `printf "$XENTZ_BACKUP_STATUS" > "` + file + `"`}, file
+}
+
+func readStatus(t *testing.T, file string) string {
+	t.Helper()
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("post-backup hook did not run: %v", err)
+	}
+	return string(b)
+}
+
+func TestRunPreHookFailureAbortsBackup(t *testing.T) {
+	cfg, calls := fakeRestic(t, `echo '`+testSummary+`'`)
+	postHook, statusFile := statusHook(t)
+	cfg.PreBackup = [][]string{{"sh", "-c", "echo dump failed; exit 4"}, {"sh", "-c", "exit 0"}}
+	cfg.PostBackup = [][]string{postHook}
+
+	res := Run(context.Background(), cfg, Options{Quiet: true})
+	if res.Status != "error" || !strings.Contains(res.Error, `pre-backup hook "sh" failed: exit status 4`) {
+		t.Errorf("Run = %s: %q, want a pre-backup hook error", res.Status, res.Error)
+	}
+	if !strings.Contains(res.Error, "dump failed") {
+		t.Errorf("Error = %q, want the hook's output", res.Error)
+	}
+	for _, cmd := range resticCalls(t, calls) {
+		if cmd == "backup" {
+			t.Error("restic backup ran after the pre-backup hook failed")
+		}
+	}
+	if got := readStatus(t, statusFile); got != "error" {
+		t.Errorf("post-backup hook saw status %q, want error", got)
+	}
+}
+
+func TestRunPostHookAfterFailedBackup(t *testing.T) {
+	cfg, calls := fakeRestic(t, `echo "Fatal: wrong password or no key found" >&2; exit 1`)
+	postHook, statusFile := statusHook(t)
+	cfg.PostBackup = [][]string{postHook}
+
+	res := Run(context.Background(), cfg, Options{Quiet: true})
+	if res.Status != "error" || res.ErrorKind != string(KindAuthFailed) {
+		t.Errorf("Run = %s (%s): %q, want an auth error", res.Status, res.ErrorKind, res.Error)
+	}
+	if got := resticCalls(t, calls); !strings.Contains(strings.Join(got, " "), "backup") {
+		t.Errorf("restic calls = %q, want a backup", got)
+	}
+	if got := readStatus(t, statusFile); got != "error" {
+		t.Errorf("post-backup hook saw status %q, want error", got)
+	}
+}
+
+func TestRunPostHookFailureDegrades(t *testing.T) {
+	cfg, _ := fakeRestic(t, `echo '`+testSummary+`'`)
+	cfg.PostBackup = [][]string{{"sh", "-c", "exit 1"}}
+
+	res := Run(context.Background(), cfg, Options{Quiet: true})
+	if res.Status != "degraded" || res.SnapshotID != "1a2b3c4d" || !strings.Contains(res.Error, "post-backup hook") {
+		t.Errorf("Run = %+v, want a degraded run keeping the snapshot", res)
+	}
+}
+
+func TestRunHookTimeout(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("no sleep command")
+	}
+	saved := hookTimeout
+	hookTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { hookTimeout = saved })
+
+	start := time.Now()
+	err := runHooks(context.Background(), "pre-backup", [][]string{{"sleep", "10"}}, nil)
+	if err == nil || err.Error() != `pre-backup hook "sleep" failed: timed out after 100ms` {
+		t.Errorf("runHooks = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("runHooks took %s, want the hook killed at the timeout", elapsed)
+	}
+}
+
+func TestRunHooksEnv(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh to run the hooks")
+	}
+	out := filepath.Join(t.TempDir(), "env")
+	hooks := [][]string{
+		{"sh", "-c", `printf "$XENTZ_SNAPSHOT_ID" > "` + out + `"`},
+		{"sh", "-c", "exit 3"},
+		{"sh", "-c", `echo never > "` + out + `"`},
+	}
+	err := runHooks(context.Background(), "post-backup", hooks, []string{"XENTZ_SNAPSHOT_ID=1a2b3c4d"})
+	if err == nil || !strings.Contains(err.Error(), "exit status 3") {
+		t.Errorf("runHooks = %v, want the second hook's failure", err)
+	}
+	// The first hook saw the env; the third never ran
+	if b, err := os.ReadFile(out); err != nil || string(b) != "1a2b3c4d" {
+		t.Errorf("hook output = %q, %v; want 1a2b3c4d", b, err)
+	}
+	if err := runHooks(context.Background(), "pre-backup", [][]string{{}}, nil); err == nil {
+		t.Error("runHooks with an empty command: want an error")
+	}
+}
@@ -0,0 +1,116 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"xentz-agent/internal/config"
+	"xentz-agent/internal/logx"
+)
+
+// defaultStaleLockAge is how old a lock from this host must be before it is removed automatically
+const defaultStaleLockAge = time.Hour
+
+// resticLock is the subset of `restic cat lock` output used to judge staleness
+type resticLock struct {
+	Time     time.Time `json:"time"`
+	Hostname string    `json:"hostname"`
+	PID      int       `json:"pid"`
+}
+
+// staleLockAge returns the configured stale lock threshold
+func staleLockAge(cfg config.Config) time.Duration {
+	if cfg.Restic.StaleLockMinutes > 0 {
+		return time.Duration(cfg.Restic.StaleLockMinutes) * time.Minute
+	}
+	return defaultStaleLockAge
+}
+
+// isLockError reports whether restic failed because the repository is locked
+func isLockError(output string) bool {
+	return strings.Contains(output, "repository is already locked") || strings.Contains(output, "unable to create lock")
+}
+
+// removeStaleLocks runs `restic unlock` if every lock in the repository belongs to this host
+// and is older than maxAge. It never touches a repository holding another host's lock,
+// since `restic unlock` cannot be limited to a single lock. It returns true if locks were removed.
+func removeStaleLocks(ctx context.Context, env []string, maxAge time.Duration) (bool, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return false, fmt.Errorf("get hostname: %w", err)
+	}
+
+	ids, err := resticOutput(ctx, env, "list", "locks", "--no-lock")
+	if err != nil {
+		return false, fmt.Errorf("list locks: %w", err)
+	}
+
+	found := 0
+	scanner := bufio.NewScanner(bytes.NewReader(ids))
+	for scanner.Scan() {
+		id := strings.TrimSpace(scanner.Text())
+		if id == "" {
+			continue
+		}
+		data, err := resticOutput(ctx, env, "cat", "lock", id, "--no-lock")
+		if err != nil {
+			// The lock may have been released in the meantime
+			continue
+		}
+		var lock resticLock
+		if err := json.Unmarshal(data, &lock); err != nil {
+			return false, fmt.Errorf("parse lock %s: %w", id, err)
+		}
+		if lock.Hostname != hostname {
+			return false, fmt.Errorf("repository is locked by another host (%s, pid %d); not removing it", lock.Hostname, lock.PID)
+		}
+		if age := time.Since(lock.Time); age < maxAge {
+			return false, fmt.Errorf("lock held by pid %d is only %s old (stale after %s)", lock.PID, age.Round(time.Second), maxAge)
+		}
+		found++
+	}
+	if found == 0 {
+		return false, nil
+	}
+
+	if _, err := resticOutput(ctx, env, "unlock"); err != nil {
+		return false, fmt.Errorf("unlock: %w", err)
+	}
+	logx.Printf("Removed %d stale lock(s) left by an earlier run on this host", found)
+	return true, nil
+}
+
+// Unlock runs `restic unlock` for the configured repository. restic only removes locks it
+// considers stale; with removeAll every lock is removed, including those of running operations.
+func Unlock(ctx context.Context, cfg config.Config, removeAll bool) error {
+	env, err := resticEnv(cfg)
+	if err != nil {
+		return err
+	}
+	args := []string{"unlock"}
+	if removeAll {
+		args = append(args, "--remove-all")
+	}
+	_, err = resticOutput(ctx, env, args...)
+	return err
+}
+
+// resticOutput runs restic with env and returns its stdout, including stderr in the error
+func resticOutput(ctx context.Context, env []string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "restic", args...)
+	cmd.Env = append(cmd.Environ(), env...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("restic %s failed: %w\n%s", args[0], err, tail(stderr.String(), 2048))
+	}
+	return out, nil
+}
@@ -0,0 +1,83 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+
+	"xentz-agent/internal/config"
+)
+
+// Mount runs `restic mount dir` in the foreground so snapshots can be browsed as files.
+// It blocks until restic exits; Ctrl-C is left to restic, which unmounts before exiting.
+func Mount(ctx context.Context, cfg config.Config, dir string) error {
+	if runtime.GOOS == "windows" {
+		return fmt.Errorf("mount is not supported on Windows (restic mount needs FUSE)")
+	}
+	if cfg.Restic.Repository == "" {
+		return fmt.Errorf("restic.repository is required")
+	}
+	if info, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("mount point: %w", err)
+	} else if !info.IsDir() {
+		return fmt.Errorf("mount point %s is not a directory", dir)
+	}
+	if err := checkFUSE(); err != nil {
+		return err
+	}
+	env, err := resticEnv(cfg)
+	if err != nil {
+		return err
+	}
+	if _, err := exec.LookPath("restic"); err != nil {
+		return fmt.Errorf("restic not found in PATH (install restic first)")
+	}
+
+	cmd := exec.CommandContext(ctx, "restic", "mount", dir)
+	cmd.Env = append(cmd.Environ(), env...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// The terminal sends Ctrl-C to restic too; keep the agent alive until restic has unmounted
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("restic mount failed: %w", err)
+	}
+	return nil
+}
+
+// checkFUSE returns an error when FUSE, which restic mount needs, is clearly not installed
+func checkFUSE() error {
+	switch runtime.GOOS {
+	case "darwin":
+		for _, fs := range []string{"/Library/Filesystems/macfuse.fs", "/Library/Filesystems/osxfuse.fs"} {
+			if _, err := os.Stat(fs); err == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("FUSE not available: install macFUSE (https://osxfuse.github.io) to use mount")
+	case "linux":
+		if _, err := os.Stat("/dev/fuse"); err != nil {
+			return fmt.Errorf("FUSE not available: /dev/fuse is missing (load the fuse module or install fuse3)")
+		}
+		if _, err := exec.LookPath("fusermount3"); err == nil {
+			return nil
+		}
+		if _, err := exec.LookPath("fusermount"); err != nil {
+			return fmt.Errorf("FUSE not available: fusermount not found in PATH (install fuse3)")
+		}
+		return nil
+	default:
+		if _, err := os.Stat("/dev/fuse"); err != nil {
+			return fmt.Errorf("FUSE not available: /dev/fuse is missing")
+		}
+		return nil
+	}
+}
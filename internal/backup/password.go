@@ -0,0 +1,95 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"xentz-agent/internal/config"
+	"xentz-agent/internal/secret"
+)
+
+// passwordCommandTimeout bounds how long a configured password command may run (shortened in tests)
+var passwordCommandTimeout = 30 * time.Second
+
+// resticEnv returns the environment variables that point restic at the configured
+// repository and password. It is resolved once per run (a keychain lookup may be
+// slow or prompt the user) and appended to each restic command's environment.
+func resticEnv(cfg config.Config) ([]string, error) {
+	env := []string{"RESTIC_REPOSITORY=" + cfg.Restic.Repository}
+
+	// Precedence: explicit RESTIC_PASSWORD env > password command > keychain > password file
+	if os.Getenv("RESTIC_PASSWORD") != "" {
+		// Already in the process environment, which restic inherits
+		return env, nil
+	}
+	if len(cfg.Restic.PasswordCommand) > 0 {
+		password, err := runPasswordCommand(cfg.Restic.PasswordCommand)
+		if err != nil {
+			return nil, fmt.Errorf("restic password: %w", err)
+		}
+		return append(env, "RESTIC_PASSWORD="+password), nil
+	}
+
+	switch cfg.Restic.PasswordSource {
+	case config.PasswordSourceKeychain:
+		store, err := secret.Keychain()
+		if err != nil {
+			return nil, fmt.Errorf("restic password: %w", err)
+		}
+		password, err := store.Get(secret.ResticPasswordAccount)
+		if err != nil {
+			return nil, fmt.Errorf("restic password: keychain: %w", err)
+		}
+		if password == "" {
+			return nil, fmt.Errorf("restic password: keychain entry is empty")
+		}
+		env = append(env, "RESTIC_PASSWORD="+password)
+	case "", config.PasswordSourceFile:
+		if cfg.Restic.PasswordFile == "" {
+			return nil, fmt.Errorf("restic.password_file is required")
+		}
+		env = append(env, "RESTIC_PASSWORD_FILE="+PasswordFile(cfg))
+	default:
+		return nil, fmt.Errorf("unknown restic.password_source %q (expected %q or %q)",
+			cfg.Restic.PasswordSource, config.PasswordSourceFile, config.PasswordSourceKeychain)
+	}
+
+	return env, nil
+}
+
+// PasswordFile returns restic.password_file as passed to restic, with a leading ~ expanded
+// ("" when unset)
+func PasswordFile(cfg config.Config) string {
+	if cfg.Restic.PasswordFile == "" {
+		return ""
+	}
+	return expandHome(cfg.Restic.PasswordFile)
+}
+
+// runPasswordCommand runs argv and returns its stdout with the trailing newline removed
+func runPasswordCommand(argv []string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), passwordCommandTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("password command timed out after %s", passwordCommandTimeout)
+		}
+		return "", fmt.Errorf("password command failed: %w: %s", err, tail(strings.TrimSpace(stderr.String()), 512))
+	}
+
+	password := strings.TrimRight(string(out), "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("password command produced no output")
+	}
+	return password, nil
+}
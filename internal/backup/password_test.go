@@ -0,0 +1,137 @@
+package backup
+
+import (
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"xentz-agent/internal/config"
+)
+
+// shCommand returns argv running script with sh, skipping the test where there is no sh
+func shCommand(t *testing.T, script string) []string {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh to run the password command")
+	}
+	return []string{"sh", "-c", script}
+}
+
+func TestRunPasswordCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		want    string
+		wantErr string
+	}{
+		{"prints password", `echo "s3cret pass"`, "s3cret pass", ""},
+		{"CRLF", `printf 'pw\r\n'`, "pw", ""},
+		{"no trailing newline", `printf pw`, "pw", ""},
+		{"exits non-zero", `echo "vault sealed" >&2; exit 2`, "", "password command failed: exit status 2: vault sealed"},
+		{"empty output", `true`, "", "password command produced no output"},
+		{"only a newline", `echo`, "", "password command produced no output"},
+	}
+	for _, tt := range tests {
+		got, err := runPasswordCommand(shCommand(t, tt.script))
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("%s: runPasswordCommand = %q, %v; want error %q", tt.name, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: runPasswordCommand = %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+
+	if _, err := runPasswordCommand([]string{filepath.Join(t.TempDir(), "missing")}); err == nil {
+		t.Error("runPasswordCommand with a missing command: want an error")
+	}
+}
+
+func TestRunPasswordCommandTimeout(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("no sleep command")
+	}
+	saved := passwordCommandTimeout
+	passwordCommandTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { passwordCommandTimeout = saved })
+
+	start := time.Now()
+	_, err := runPasswordCommand([]string{"sleep", "10"})
+	if err == nil || !strings.Contains(err.Error(), "password command timed out after 100ms") {
+		t.Errorf("runPasswordCommand = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("runPasswordCommand took %s, want it killed at the timeout", elapsed)
+	}
+}
+
+func TestResticEnv(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("RESTIC_PASSWORD", "")
+	const repo = "RESTIC_REPOSITORY=rest:https://backup.example.com/dev-1"
+
+	tests := []struct {
+		name       string
+		envPass    string
+		restic     config.Restic
+		want       []string
+		wantErr    bool
+		needsShell bool
+	}{
+		{"password file", "", config.Restic{PasswordFile: "/etc/xentz/restic.pw"},
+			[]string{repo, "RESTIC_PASSWORD_FILE=/etc/xentz/restic.pw"}, false, false},
+		{"password file in home", "", config.Restic{PasswordFile: "~/.xentz-agent/restic.pw"},
+			[]string{repo, "RESTIC_PASSWORD_FILE=" + filepath.Join(home, ".xentz-agent", "restic.pw")}, false, false},
+		{"command over file", "", config.Restic{PasswordFile: "/etc/xentz/restic.pw", PasswordCommand: []string{"sh", "-c", "echo from-command"}},
+			[]string{repo, "RESTIC_PASSWORD=from-command"}, false, true},
+		{"command over keychain", "", config.Restic{PasswordSource: config.PasswordSourceKeychain, PasswordCommand: []string{"sh", "-c", "echo from-command"}},
+			[]string{repo, "RESTIC_PASSWORD=from-command"}, false, true},
+		{"environment over command", "from-env", config.Restic{PasswordCommand: []string{"sh", "-c", "exit 1"}},
+			[]string{repo}, false, false},
+		{"environment over file", "from-env", config.Restic{PasswordFile: "/etc/xentz/restic.pw"},
+			[]string{repo}, false, false},
+		{"failing command", "", config.Restic{PasswordFile: "/etc/xentz/restic.pw", PasswordCommand: []string{"sh", "-c", "exit 1"}},
+			nil, true, true},
+		{"no password", "", config.Restic{}, nil, true, false},
+		{"unknown source", "", config.Restic{PasswordSource: "vault"}, nil, true, false},
+	}
+	for _, tt := range tests {
+		if tt.needsShell {
+			if _, err := exec.LookPath("sh"); err != nil {
+				continue
+			}
+		}
+		t.Setenv("RESTIC_PASSWORD", tt.envPass)
+		var cfg config.Config
+		cfg.Restic = tt.restic
+		cfg.Restic.Repository = "rest:https://backup.example.com/dev-1"
+
+		got, err := resticEnv(cfg)
+		if (err != nil) != tt.wantErr || !slices.Equal(got, tt.want) {
+			t.Errorf("%s: resticEnv = %q, %v; want %q (error: %v)", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestPasswordFile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	for file, want := range map[string]string{
+		"":                         "",
+		"~/.xentz-agent/restic.pw": filepath.Join(home, ".xentz-agent", "restic.pw"),
+	} {
+		var cfg config.Config
+		cfg.Restic.PasswordFile = file
+		if got := PasswordFile(cfg); got != want {
+			t.Errorf("PasswordFile(%q) = %q, want %q", file, got, want)
+		}
+	}
+}
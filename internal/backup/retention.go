@@ -3,48 +3,111 @@ package backup
 import (
 	"bytes"
 	"context"
-	"os"
 	"os/exec"
+	"strings"
 	"time"
 
 	"xentz-agent/internal/config"
+	"xentz-agent/internal/logx"
 	"xentz-agent/internal/state"
 )
 
-func RunRetention(ctx context.Context, cfg config.Config) state.LastRun {
+// RunRetention applies the retention policy with `restic forget` (and prune if configured).
+// With opts.DryRun, restic only lists the snapshots that would be removed.
+// opts.AutoInit is ignored.
+func RunRetention(ctx context.Context, cfg config.Config, opts Options) (result state.LastRun) {
 	start := time.Now()
+	defer func() { result = timedOut(ctx, start, result) }()
 
 	if cfg.Restic.Repository == "" {
-		return state.NewLastRunError(time.Since(start), 0, "restic.repository is required")
+		return failedRun(start, KindConfigInvalid, "restic.repository is required")
 	}
-	if cfg.Restic.PasswordFile == "" {
-		return state.NewLastRunError(time.Since(start), 0, "restic.password_file is required")
+	env, err := resticEnv(cfg)
+	if err != nil {
+		return failedRun(start, KindConfigInvalid, err.Error())
 	}
 	if _, err := exec.LookPath("restic"); err != nil {
-		return state.NewLastRunError(time.Since(start), 0, "restic not found in PATH")
+		return failedRun(start, KindResticMissing, "restic not found in PATH")
+	}
+	if err := checkResticVersion(ctx); err != nil {
+		return failedRun(start, KindResticMissing, err.Error())
 	}
 
 	// Check repository connectivity with a short timeout before proceeding
 	// This prevents hanging if the repository server is down
-	os.Stderr.WriteString("Checking repository connectivity...\n")
+	if !opts.Quiet {
+		logx.Println("Checking repository connectivity...")
+	}
 	connectCtx, connectCancel := context.WithTimeout(ctx, 30*time.Second)
 	defer connectCancel()
-	if err := checkRepositoryConnectivity(connectCtx, cfg); err != nil {
+	if err := checkRepositoryConnectivity(connectCtx, env); err != nil {
 		if connectCtx.Err() == context.DeadlineExceeded {
-			return state.NewLastRunError(time.Since(start), 0, "repository connection timeout: repository server appears to be unreachable or down\nCheck that the repository server is online and accessible.")
+			return failedRun(start, KindRepoUnreachable, "repository connection timeout: repository server appears to be unreachable or down\nCheck that the repository server is online and accessible.")
 		}
-		return state.NewLastRunError(time.Since(start), 0, "repository not reachable: "+err.Error()+"\nCheck that the repository server is online and accessible.")
+		return failedRun(start, KindRepoUnreachable, "repository not reachable: "+err.Error()+"\nCheck that the repository server is online and accessible.")
+	}
+	if !opts.Quiet {
+		logx.Println("Repository is reachable. Starting retention/prune operation...")
 	}
-	os.Stderr.WriteString("Repository is reachable. Starting retention/prune operation...\n")
-
-	args := []string{"forget"}
 
 	r := cfg.Retention
 	// If user never set retention, refuse to run (prevents accidental nukes / weird defaults)
-	if r.KeepLast == 0 && r.KeepDaily == 0 && r.KeepWeekly == 0 && r.KeepMonthly == 0 && r.KeepYearly == 0 {
-		return state.NewLastRunError(time.Since(start), 0, "retention policy not configured (set keep_* values)")
+	if !r.Configured() {
+		return failedRun(start, KindConfigInvalid, "retention policy not configured (set keep_* or keep_within* values)")
 	}
+	// Without a scope tag, a tag-scoped forget would apply to every device's snapshots
+	if r.TagScoped && len(forgetScope(cfg)) == 0 {
+		return failedRun(start, KindConfigInvalid, "retention.tag_scoped is set but there is no device ID or tag to scope to")
+	}
+
+	args := forgetArgs(cfg, opts)
+	logx.Debugf("running restic %s", strings.Join(args, " "))
 
+	var out bytes.Buffer
+	err = runForget(ctx, args, env, &out, opts.stream())
+	// A lock left behind by a killed run would fail every prune until removed
+	if err != nil && isLockError(out.String()) {
+		removed, unlockErr := removeStaleLocks(ctx, env, staleLockAge(cfg))
+		if unlockErr != nil {
+			logx.Printf("warning: not removing repository lock: %v", unlockErr)
+		}
+		if removed {
+			out.Reset()
+			err = runForget(ctx, args, env, &out, opts.stream())
+		}
+	}
+
+	if err != nil {
+		kind, _ := classifyResticError(out.String())
+		return failedRun(start, kind, "restic forget/prune failed: "+err.Error()+"\n"+tail(out.String(), 8192))
+	}
+	return state.NewLastRunSuccess(start, 0)
+}
+
+// runForget runs `restic forget` with args, capturing its output in out.
+// With stream, output is also copied to stdout as it arrives.
+func runForget(ctx context.Context, args, env []string, out *bytes.Buffer, stream bool) error {
+	cmd := exec.CommandContext(ctx, "restic", args...)
+	cmd.Env = append(cmd.Environ(), env...)
+
+	// Stream output to both terminal and buffer for error reporting
+	// This allows users to see progress during long-running prune operations
+	tee := &teeWriter{buf: out, stream: stream}
+	cmd.Stdout = tee
+	cmd.Stderr = tee
+	return cmd.Run()
+}
+
+// forgetArgs builds the `restic forget` arguments for the retention policy in cfg
+func forgetArgs(cfg config.Config, opts Options) []string {
+	args := []string{"forget"}
+	if opts.DryRun {
+		args = append(args, "--dry-run")
+	}
+	args = append(args, verboseArgs(opts)...)
+	args = append(args, limitArgs(cfg)...)
+
+	r := cfg.Retention
 	if r.KeepLast > 0 {
 		args = append(args, "--keep-last", itoa(r.KeepLast))
 	}
@@ -60,31 +123,47 @@ func RunRetention(ctx context.Context, cfg config.Config) state.LastRun {
 	if r.KeepYearly > 0 {
 		args = append(args, "--keep-yearly", itoa(r.KeepYearly))
 	}
-
-	if r.Prune {
-		args = append(args, "--prune")
+	for _, within := range []struct{ flag, value string }{
+		{"--keep-within", r.KeepWithin},
+		{"--keep-within-hourly", r.KeepWithinHourly},
+		{"--keep-within-daily", r.KeepWithinDaily},
+		{"--keep-within-weekly", r.KeepWithinWeekly},
+		{"--keep-within-monthly", r.KeepWithinMonthly},
+		{"--keep-within-yearly", r.KeepWithinYearly},
+	} {
+		if within.value != "" {
+			args = append(args, within.flag, within.value)
+		}
 	}
 
-	cmd := exec.CommandContext(ctx, "restic", args...)
-	cmd.Env = append(cmd.Environ(),
-		"RESTIC_REPOSITORY="+cfg.Restic.Repository,
-		"RESTIC_PASSWORD_FILE="+expandHome(cfg.Restic.PasswordFile),
-	)
+	for _, t := range r.KeepTags {
+		args = append(args, "--keep-tag", t)
+	}
 
-	// Stream output to both terminal and buffer for error reporting
-	// This allows users to see progress during long-running prune operations
-	var out bytes.Buffer
-	tee := &teeWriter{buf: &out, stream: true}
-	cmd.Stdout = tee
-	cmd.Stderr = tee
+	// Scope forget to this device's snapshots, so a device never prunes another's in a shared repository
+	if scope := forgetScope(cfg); r.TagScoped && len(scope) > 0 {
+		args = append(args, "--tag", strings.Join(scope, ","))
+	}
 
-	err := cmd.Run()
-	dur := time.Since(start)
+	if r.Prune {
+		args = append(args, "--prune")
+		if r.PruneMaxUnused != "" {
+			args = append(args, "--max-unused", r.PruneMaxUnused)
+		}
+		if r.PruneMaxRepackSize != "" {
+			args = append(args, "--max-repack-size", r.PruneMaxRepackSize)
+		}
+	}
+	return args
+}
 
-	if err != nil {
-		return state.NewLastRunError(dur, 0, "restic forget/prune failed: "+err.Error()+"\n"+tail(out.String(), 8192))
+// forgetScope returns the tags a tag-scoped forget is limited to (all must match): the device tag
+// when enrolled, else the configured tags
+func forgetScope(cfg config.Config) []string {
+	if cfg.DeviceID != "" {
+		return []string{config.DeviceTag(cfg.DeviceID)}
 	}
-	return state.NewLastRunSuccess(dur, 0)
+	return cfg.Tags
 }
 
 // tiny helpers (avoid fmt import in hot path)
@@ -104,15 +183,23 @@ func itoa(i int) string {
 
 // expandHome and tail are defined in backup.go (same package)
 
-// checkRepositoryConnectivity verifies the repository is reachable with a quick test
-func checkRepositoryConnectivity(ctx context.Context, cfg config.Config) error {
+// CheckConnectivity verifies the configured repository is reachable.
+// It is a read-only check suitable for diagnostics.
+func CheckConnectivity(ctx context.Context, cfg config.Config) error {
+	env, err := resticEnv(cfg)
+	if err != nil {
+		return err
+	}
+	return checkRepositoryConnectivity(ctx, env)
+}
+
+// checkRepositoryConnectivity verifies the repository is reachable with a quick test.
+// env is the repository/password environment from resticEnv.
+func checkRepositoryConnectivity(ctx context.Context, env []string) error {
 	// Use a quick "snapshots" command with --last 1 to test connectivity
 	// This is faster than "cat config" and will fail quickly if unreachable
 	cmd := exec.CommandContext(ctx, "restic", "snapshots", "--last", "1")
-	cmd.Env = append(cmd.Environ(),
-		"RESTIC_REPOSITORY="+cfg.Restic.Repository,
-		"RESTIC_PASSWORD_FILE="+expandHome(cfg.Restic.PasswordFile),
-	)
+	cmd.Env = append(cmd.Environ(), env...)
 	var out bytes.Buffer
 	cmd.Stdout = &out
 	cmd.Stderr = &out
@@ -148,22 +235,3 @@ func contains(s, substr string) bool {
 	}
 	return false
 }
-
-// teeWriter writes to both a buffer and stdout for streaming output
-type teeWriter struct {
-	buf    *bytes.Buffer
-	stream bool
-}
-
-func (t *teeWriter) Write(p []byte) (n int, err error) {
-	// Write to buffer
-	n, err = t.buf.Write(p)
-	if err != nil {
-		return n, err
-	}
-	// Also write to stdout for real-time progress
-	if t.stream {
-		os.Stdout.Write(p)
-	}
-	return n, nil
-}
\ No newline at end of file
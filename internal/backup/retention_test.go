@@ -0,0 +1,127 @@
+package backup
+
+import (
+	"slices"
+	"testing"
+
+	"xentz-agent/internal/config"
+)
+
+func TestForgetArgsKeepWithin(t *testing.T) {
+	var cfg config.Config
+	cfg.Retention = config.Retention{
+		KeepLast:          3,
+		KeepWithin:        "2d",
+		KeepWithinHourly:  "1d12h",
+		KeepWithinDaily:   "7d",
+		KeepWithinWeekly:  "1m",
+		KeepWithinMonthly: "1y",
+		KeepWithinYearly:  "5y",
+	}
+	want := []string{
+		"forget",
+		"--keep-last", "3",
+		"--keep-within", "2d",
+		"--keep-within-hourly", "1d12h",
+		"--keep-within-daily", "7d",
+		"--keep-within-weekly", "1m",
+		"--keep-within-monthly", "1y",
+		"--keep-within-yearly", "5y",
+	}
+	if got := forgetArgs(cfg, Options{}); !slices.Equal(got, want) {
+		t.Errorf("forgetArgs =\n%q\nwant\n%q", got, want)
+	}
+
+	// Unset durations are left out
+	cfg.Retention = config.Retention{KeepWithinDaily: "30d"}
+	want = []string{"forget", "--keep-within-daily", "30d"}
+	if got := forgetArgs(cfg, Options{}); !slices.Equal(got, want) {
+		t.Errorf("forgetArgs =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestRetentionConfigured(t *testing.T) {
+	tests := []struct {
+		name string
+		r    config.Retention
+		want bool
+	}{
+		{"nothing", config.Retention{}, false},
+		{"keep_tags only", config.Retention{KeepTags: []string{"keep"}}, false},
+		{"prune only", config.Retention{Prune: true}, false},
+		{"keep_last", config.Retention{KeepLast: 1}, true},
+		{"keep_yearly", config.Retention{KeepYearly: 1}, true},
+		{"keep_within", config.Retention{KeepWithin: "2d"}, true},
+		{"keep_within_hourly", config.Retention{KeepWithinHourly: "1d"}, true},
+		{"keep_within_daily", config.Retention{KeepWithinDaily: "7d"}, true},
+		{"keep_within_weekly", config.Retention{KeepWithinWeekly: "1m"}, true},
+		{"keep_within_monthly", config.Retention{KeepWithinMonthly: "1y"}, true},
+		{"keep_within_yearly", config.Retention{KeepWithinYearly: "5y"}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.r.Configured(); got != tt.want {
+			t.Errorf("%s: Configured() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestForgetArgsTags(t *testing.T) {
+	var cfg config.Config
+	cfg.DeviceID = "dev-1"
+	cfg.Tags = []string{"laptop"}
+	cfg.Retention = config.Retention{
+		KeepDaily: 7,
+		KeepTags:  []string{"keep", "legal-hold"},
+		TagScoped: true,
+	}
+	want := []string{
+		"forget",
+		"--keep-daily", "7",
+		"--keep-tag", "keep", "--keep-tag", "legal-hold",
+		"--tag", "device:dev-1",
+	}
+	if got := forgetArgs(cfg, Options{}); !slices.Equal(got, want) {
+		t.Errorf("forgetArgs =\n%q\nwant\n%q", got, want)
+	}
+
+	// Not enrolled: scoped to all of the config's tags
+	cfg.DeviceID = ""
+	cfg.Tags = []string{"laptop", "daily"}
+	want[len(want)-1] = "laptop,daily"
+	if got := forgetArgs(cfg, Options{}); !slices.Equal(got, want) {
+		t.Errorf("forgetArgs without a device ID =\n%q\nwant\n%q", got, want)
+	}
+
+	// Without tag_scoped, forget covers every snapshot in the repository
+	cfg.DeviceID = "dev-1"
+	cfg.Retention.TagScoped = false
+	if got := forgetArgs(cfg, Options{}); slices.Contains(got, "--tag") {
+		t.Errorf("forgetArgs without tag_scoped = %q, want no --tag", got)
+	}
+}
+
+func TestForgetArgsPrune(t *testing.T) {
+	tests := []struct {
+		name string
+		r    config.Retention
+		want []string
+	}{
+		{"no prune", config.Retention{KeepLast: 3, PruneMaxUnused: "5%"},
+			[]string{"forget", "--keep-last", "3"}},
+		{"prune", config.Retention{KeepLast: 3, Prune: true},
+			[]string{"forget", "--keep-last", "3", "--prune"}},
+		{"max unused", config.Retention{KeepLast: 3, Prune: true, PruneMaxUnused: "5%"},
+			[]string{"forget", "--keep-last", "3", "--prune", "--max-unused", "5%"}},
+		{"max repack size", config.Retention{KeepLast: 3, Prune: true, PruneMaxRepackSize: "2G"},
+			[]string{"forget", "--keep-last", "3", "--prune", "--max-repack-size", "2G"}},
+		{"both", config.Retention{KeepLast: 3, Prune: true, PruneMaxUnused: "unlimited", PruneMaxRepackSize: "500M"},
+			[]string{"forget", "--keep-last", "3", "--prune", "--max-unused", "unlimited", "--max-repack-size", "500M"}},
+	}
+	for _, tt := range tests {
+		var cfg config.Config
+		cfg.Retention = tt.r
+		if got := forgetArgs(cfg, Options{}); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: forgetArgs =\n%q\nwant\n%q", tt.name, got, tt.want)
+		}
+	}
+}
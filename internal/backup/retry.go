@@ -0,0 +1,46 @@
+package backup
+
+import (
+	"context"
+	"time"
+
+	"xentz-agent/internal/config"
+)
+
+// Defaults for retrying a `restic backup` that failed with a transient error
+const (
+	defaultBackupAttempts   = 3
+	defaultBackupRetryDelay = 30 * time.Second
+)
+
+// retryPolicy returns the total attempts and the initial retry delay for cfg
+func retryPolicy(cfg config.Config) (attempts int, delay time.Duration) {
+	attempts = cfg.Retry.Attempts
+	if attempts <= 0 {
+		attempts = defaultBackupAttempts
+	}
+	delay = time.Duration(cfg.Retry.DelaySeconds) * time.Second
+	if delay <= 0 {
+		delay = defaultBackupRetryDelay
+	}
+	return attempts, delay
+}
+
+// isTransientResticError reports whether restic's error output indicates a failure
+// worth retrying (network or backend 5xx), as opposed to auth or lock errors.
+func isTransientResticError(output string) bool {
+	_, retry := classifyResticError(output)
+	return retry
+}
+
+// sleepCtx waits for d or until ctx is done. It returns false if ctx ended first.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
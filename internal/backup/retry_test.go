@@ -0,0 +1,43 @@
+package backup
+
+import (
+	"testing"
+	"time"
+
+	"xentz-agent/internal/config"
+)
+
+func TestIsTransientResticError(t *testing.T) {
+	tests := []struct {
+		output string
+		want   bool
+	}{
+		{"Save(<data/1234abcd>) returned error: read tcp 10.0.0.2:51234->10.0.0.5:443: read: connection reset by peer", true},
+		{"unexpected HTTP response (503): 503 Service Unavailable", true},
+		{"Fatal: unable to open repository: dial tcp: lookup backup.example.com: no such host", true},
+		{"Fatal: wrong password or no key found", false},
+		{"Fatal: unable to create lock in backend: repository is already locked exclusively by PID 1234", false},
+		// Auth and lock errors win even when the output also mentions a network failure
+		{"Fatal: wrong password or no key found\nconnection reset by peer", false},
+		{"Fatal: some other problem", false},
+	}
+	for _, tt := range tests {
+		if got := isTransientResticError(tt.output); got != tt.want {
+			t.Errorf("isTransientResticError(%q) = %v, want %v", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	attempts, delay := retryPolicy(config.Config{})
+	if attempts != defaultBackupAttempts || delay != defaultBackupRetryDelay {
+		t.Errorf("default retryPolicy = %d, %s", attempts, delay)
+	}
+
+	var cfg config.Config
+	cfg.Retry.Attempts = 5
+	cfg.Retry.DelaySeconds = 2
+	if attempts, delay := retryPolicy(cfg); attempts != 5 || delay != 2*time.Second {
+		t.Errorf("retryPolicy = %d, %s; want 5, 2s", attempts, delay)
+	}
+}
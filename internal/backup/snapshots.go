@@ -0,0 +1,69 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"xentz-agent/internal/config"
+)
+
+// Snapshot is a single entry from `restic snapshots --json`
+type Snapshot struct {
+	ID       string    `json:"id"`
+	ShortID  string    `json:"short_id"`
+	Time     time.Time `json:"time"`
+	Hostname string    `json:"hostname"`
+	Username string    `json:"username,omitempty"`
+	Paths    []string  `json:"paths"`
+	Tags     []string  `json:"tags,omitempty"`
+}
+
+// ListSnapshots returns the snapshots stored in the configured repository.
+// An empty repository yields an empty slice, not an error.
+func ListSnapshots(ctx context.Context, cfg config.Config) ([]Snapshot, error) {
+	if cfg.Restic.Repository == "" {
+		return nil, fmt.Errorf("restic.repository is required")
+	}
+	env, err := resticEnv(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := exec.LookPath("restic"); err != nil {
+		return nil, fmt.Errorf("restic not found in PATH (install restic first)")
+	}
+
+	cmd := exec.CommandContext(ctx, "restic", "snapshots", "--json")
+	cmd.Env = append(cmd.Environ(), env...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("restic snapshots failed: %w\n%s", err, tail(stderr.String(), 8192))
+	}
+
+	return parseSnapshotsJSON(stdout.Bytes())
+}
+
+// parseSnapshotsJSON parses the JSON array printed by `restic snapshots --json`
+func parseSnapshotsJSON(data []byte) ([]Snapshot, error) {
+	data = bytes.TrimSpace(data)
+	// Some restic versions print nothing at all for an empty repository
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return []Snapshot{}, nil
+	}
+
+	var snapshots []Snapshot
+	if err := json.Unmarshal(data, &snapshots); err != nil {
+		return nil, fmt.Errorf("parse snapshots output: %w", err)
+	}
+	if snapshots == nil {
+		snapshots = []Snapshot{}
+	}
+	return snapshots, nil
+}
@@ -0,0 +1,62 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"time"
+
+	"xentz-agent/internal/config"
+	"xentz-agent/internal/state"
+)
+
+// restic stats modes
+const (
+	StatsModeRestoreSize     = "restore-size"
+	StatsModeFilesByContents = "files-by-contents"
+	StatsModeBlobsPerFile    = "blobs-per-file"
+	StatsModeRawData         = "raw-data"
+)
+
+// StatsModes lists the modes accepted by RepoStats
+var StatsModes = []string{StatsModeRestoreSize, StatsModeFilesByContents, StatsModeBlobsPerFile, StatsModeRawData}
+
+// RepoStats runs `restic stats --json --mode mode` (restore-size if empty). On large repositories
+// this reads a lot of metadata; it is stopped when ctx expires.
+func RepoStats(ctx context.Context, cfg config.Config, mode string) (state.RepoStats, error) {
+	if mode == "" {
+		mode = StatsModeRestoreSize
+	}
+	if !slices.Contains(StatsModes, mode) {
+		return state.RepoStats{}, fmt.Errorf("unknown stats mode %q (expected one of %v)", mode, StatsModes)
+	}
+	if cfg.Restic.Repository == "" {
+		return state.RepoStats{}, fmt.Errorf("restic.repository is required")
+	}
+	env, err := resticEnv(cfg)
+	if err != nil {
+		return state.RepoStats{}, err
+	}
+	if _, err := exec.LookPath("restic"); err != nil {
+		return state.RepoStats{}, fmt.Errorf("restic not found in PATH (install restic first)")
+	}
+
+	out, err := resticOutput(ctx, env, "stats", "--json", "--mode", mode)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return state.RepoStats{}, fmt.Errorf("restic stats timed out (large repositories can take a while): %w", err)
+		}
+		return state.RepoStats{}, err
+	}
+
+	var stats state.RepoStats
+	if err := json.Unmarshal(out, &stats); err != nil {
+		return state.RepoStats{}, fmt.Errorf("parse stats output: %w", err)
+	}
+	stats.Mode = mode
+	stats.TimeUTC = time.Now().UTC().Format(time.RFC3339)
+	return stats, nil
+}
@@ -0,0 +1,101 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"xentz-agent/internal/humanize"
+	"xentz-agent/internal/logx"
+)
+
+// progressInterval is the minimum time between printed progress lines
+const progressInterval = 10 * time.Second
+
+// teeWriter writes to both a buffer and stdout for streaming output
+type teeWriter struct {
+	buf    *bytes.Buffer
+	stream bool
+}
+
+func (t *teeWriter) Write(p []byte) (n int, err error) {
+	// Write to buffer
+	n, err = t.buf.Write(p)
+	if err != nil {
+		return n, err
+	}
+	// Also write to stdout for real-time progress
+	if t.stream {
+		os.Stdout.Write(p)
+	}
+	return n, nil
+}
+
+// progressWriter captures restic's --json stdout for the final summary and, as lines
+// arrive, logs a throttled progress line from restic's periodic status messages
+type progressWriter struct {
+	buf     *bytes.Buffer
+	partial []byte
+	lastAt  time.Time
+	verbose bool // Log restic's per-file verbose_status messages (with --verbose)
+}
+
+// resticStatus is restic's periodic {"message_type":"status"} backup message
+type resticStatus struct {
+	MessageType      string  `json:"message_type"`
+	PercentDone      float64 `json:"percent_done"`
+	TotalFiles       int64   `json:"total_files"`
+	FilesDone        int64   `json:"files_done"`
+	TotalBytes       int64   `json:"total_bytes"`
+	BytesDone        int64   `json:"bytes_done"`
+	SecondsRemaining int64   `json:"seconds_remaining"`
+	Action           string  `json:"action"` // verbose_status only: new, unchanged, modified, scan_finished
+	Item             string  `json:"item"`   // verbose_status only: the file or directory
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.buf.Write(b)
+	if err != nil {
+		return n, err
+	}
+	p.partial = append(p.partial, b...)
+	for {
+		i := bytes.IndexByte(p.partial, '\n')
+		if i < 0 {
+			break
+		}
+		p.logStatus(p.partial[:i])
+		p.partial = p.partial[i+1:]
+	}
+	// Don't keep consumed lines alive in the backing array
+	p.partial = append([]byte(nil), p.partial...)
+	return n, nil
+}
+
+func (p *progressWriter) logStatus(line []byte) {
+	var st resticStatus
+	if err := json.Unmarshal(line, &st); err != nil {
+		return
+	}
+	// With --json, restic reports -v output as verbose_status messages on stdout
+	if st.MessageType == "verbose_status" && p.verbose {
+		logx.Printf("restic: %s %s", st.Action, st.Item)
+		return
+	}
+	if st.MessageType != "status" {
+		return
+	}
+	if time.Since(p.lastAt) < progressInterval {
+		return
+	}
+	p.lastAt = time.Now()
+
+	msg := fmt.Sprintf("progress: %d%% (%s/%s, %d/%d files)", int(st.PercentDone*100),
+		humanize.BytesSI(st.BytesDone), humanize.BytesSI(st.TotalBytes), st.FilesDone, st.TotalFiles)
+	if st.SecondsRemaining > 0 {
+		msg += fmt.Sprintf(", ETA %s", (time.Duration(st.SecondsRemaining) * time.Second).String())
+	}
+	logx.Println(msg)
+}
@@ -0,0 +1,106 @@
+package backup
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// progressLines feeds chunks to a progressWriter and returns the log lines it printed
+func progressLines(t *testing.T, p *progressWriter, chunks ...string) []string {
+	t.Helper()
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	flags := log.Flags()
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(flags)
+	})
+
+	for _, chunk := range chunks {
+		if n, err := p.Write([]byte(chunk)); err != nil || n != len(chunk) {
+			t.Fatalf("Write(%q) = %d, %v", chunk, n, err)
+		}
+	}
+	out := strings.TrimSpace(logged.String())
+	if out == "" {
+		return nil
+	}
+	return strings.Split(out, "\n")
+}
+
+const (
+	statusLine = `{"message_type":"status","percent_done":0.25,"total_files":400,"files_done":100,` +
+		`"total_bytes":2000000000,"bytes_done":500000000,"seconds_remaining":90}`
+	verboseLine = `{"message_type":"verbose_status","action":"new","item":"/home/u/report.pdf"}`
+)
+
+func TestProgressWriter(t *testing.T) {
+	var buf bytes.Buffer
+	p := &progressWriter{buf: &buf}
+	input := statusLine + "\n" + testSummary + "\n"
+
+	// A status line split across writes is logged once it is complete
+	lines := progressLines(t, p, input[:30], input[30:80], input[80:])
+	want := []string{"progress: 25% (500.0 MB/2.0 GB, 100/400 files), ETA 1m30s"}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("logged %q, want %q", lines, want)
+	}
+	// Everything is kept for the summary
+	if buf.String() != input {
+		t.Errorf("buffer = %q, want the full output", buf.String())
+	}
+	if stats := parseResticJSON(buf.Bytes(), nil); stats == nil || stats.SnapshotID != "1a2b3c4d" {
+		t.Errorf("summary from the buffer = %+v", stats)
+	}
+	if len(p.partial) != 0 {
+		t.Errorf("partial = %q, want nothing left over", p.partial)
+	}
+}
+
+func TestProgressWriterThrottle(t *testing.T) {
+	p := &progressWriter{buf: &bytes.Buffer{}}
+	lines := progressLines(t, p, statusLine+"\n", statusLine+"\n", statusLine+"\n")
+	if len(lines) != 1 {
+		t.Errorf("logged %d progress lines within %s, want 1: %q", len(lines), progressInterval, lines)
+	}
+
+	// Another status after the interval is logged
+	p.lastAt = time.Now().Add(-progressInterval)
+	if lines := progressLines(t, p, statusLine+"\n"); len(lines) != 1 {
+		t.Errorf("logged %q after the interval, want one progress line", lines)
+	}
+}
+
+func TestProgressWriterVerbose(t *testing.T) {
+	input := verboseLine + "\nnot json\n" + `{"message_type":"error"}` + "\n"
+
+	quiet := &progressWriter{buf: &bytes.Buffer{}}
+	if lines := progressLines(t, quiet, input); len(lines) != 0 {
+		t.Errorf("logged %q without verbose, want nothing", lines)
+	}
+
+	verbose := &progressWriter{buf: &bytes.Buffer{}, verbose: true}
+	lines := progressLines(t, verbose, input[:20], input[20:])
+	if len(lines) != 1 || lines[0] != "restic: new /home/u/report.pdf" {
+		t.Errorf("logged %q with verbose, want the verbose_status item", lines)
+	}
+}
+
+func TestProgressWriterPartialLine(t *testing.T) {
+	p := &progressWriter{buf: &bytes.Buffer{}}
+	// No newline yet: nothing is logged until the line is complete
+	if lines := progressLines(t, p, statusLine); len(lines) != 0 {
+		t.Errorf("logged %q for an incomplete line", lines)
+	}
+	if string(p.partial) != statusLine {
+		t.Errorf("partial = %q, want the incomplete line", p.partial)
+	}
+	if lines := progressLines(t, p, "\n"); len(lines) != 1 {
+		t.Errorf("logged %q once the line completed, want one progress line", lines)
+	}
+}
@@ -0,0 +1,120 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"xentz-agent/internal/logx"
+)
+
+// Semver is a parsed major.minor.patch version
+type Semver struct {
+	Major, Minor, Patch int
+}
+
+func (v Semver) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// AtLeast reports whether v is the same as or newer than o
+func (v Semver) AtLeast(o Semver) bool {
+	if v.Major != o.Major {
+		return v.Major > o.Major
+	}
+	if v.Minor != o.Minor {
+		return v.Minor > o.Minor
+	}
+	return v.Patch >= o.Patch
+}
+
+// MinResticVersion is the oldest restic the agent runs against
+var MinResticVersion = Semver{0, 12, 0}
+
+// restic 0.14 added --compression and --pack-size, 0.15 backup --read-concurrency
+var (
+	resticCompressionVersion     = Semver{0, 14, 0}
+	resticPackSizeVersion        = Semver{0, 14, 0}
+	resticReadConcurrencyVersion = Semver{0, 15, 0}
+)
+
+var (
+	resticVersionMu  sync.Mutex
+	resticVersionRaw string // Empty until `restic version` succeeded
+	resticVersion    Semver
+)
+
+// ResticVersion returns the installed restic version as printed (e.g. "0.16.4") and parsed.
+// The first successful `restic version` is cached for the life of the process; failures
+// (including a cancelled ctx) are not, so a later call probes again.
+func ResticVersion(ctx context.Context) (string, Semver, error) {
+	resticVersionMu.Lock()
+	defer resticVersionMu.Unlock()
+	if resticVersionRaw != "" {
+		return resticVersionRaw, resticVersion, nil
+	}
+	out, err := exec.CommandContext(ctx, "restic", "version").Output()
+	if err != nil {
+		return "", Semver{}, fmt.Errorf("restic version: %w", err)
+	}
+	raw, v, err := parseResticVersion(string(out))
+	if err != nil {
+		return "", Semver{}, err
+	}
+	resticVersionRaw, resticVersion = raw, v
+	return raw, v, nil
+}
+
+// checkResticVersion returns an error if the installed restic is older than MinResticVersion.
+// A version that cannot be determined only warns, so unusual builds still run.
+func checkResticVersion(ctx context.Context) error {
+	raw, v, err := ResticVersion(ctx)
+	if err != nil {
+		logx.Printf("warning: could not determine restic version: %v", err)
+		return nil
+	}
+	if !v.AtLeast(MinResticVersion) {
+		return fmt.Errorf("restic %s is too old (need %s or newer)", raw, MinResticVersion)
+	}
+	return nil
+}
+
+// resticAtLeast reports whether the installed restic is at least min
+func resticAtLeast(ctx context.Context, min Semver) (bool, error) {
+	_, v, err := ResticVersion(ctx)
+	if err != nil {
+		return false, err
+	}
+	return v.AtLeast(min), nil
+}
+
+// resticSupports reports whether the installed restic is at least min, warning that setting is
+// ignored when it is not (or when the version cannot be determined)
+func resticSupports(ctx context.Context, setting string, min Semver) bool {
+	ok, err := resticAtLeast(ctx, min)
+	if err != nil {
+		logx.Printf("warning: ignoring %s: %v", setting, err)
+	} else if !ok {
+		logx.Printf("warning: ignoring %s: requires restic %d.%d or newer", setting, min.Major, min.Minor)
+	}
+	return ok
+}
+
+// parseResticVersion extracts the version from output like
+// "restic 0.16.4 compiled with go1.21.6 on linux/amd64"
+func parseResticVersion(out string) (string, Semver, error) {
+	fields := strings.Fields(out)
+	if len(fields) < 2 || fields[0] != "restic" {
+		return "", Semver{}, fmt.Errorf("unexpected restic version output: %q", tail(strings.TrimSpace(out), 128))
+	}
+	raw := fields[1]
+	// Development builds look like "0.16.4-dev (compiled manually)"
+	core, _, _ := strings.Cut(raw, "-")
+	var v Semver
+	if n, _ := fmt.Sscanf(core, "%d.%d.%d", &v.Major, &v.Minor, &v.Patch); n < 2 {
+		return "", Semver{}, fmt.Errorf("unexpected restic version %q", raw)
+	}
+	return raw, v, nil
+}
@@ -0,0 +1,100 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestParseResticVersion(t *testing.T) {
+	tests := []struct {
+		out  string
+		raw  string
+		want Semver
+	}{
+		{"restic 0.16.4 compiled with go1.21.6 on linux/amd64\n", "0.16.4", Semver{0, 16, 4}},
+		{"restic 0.17.3 compiled with go1.23.4 on darwin/arm64", "0.17.3", Semver{0, 17, 3}},
+		{"restic 0.9.6 compiled with go1.13.4 on linux/amd64", "0.9.6", Semver{0, 9, 6}},
+		{"restic 0.16.4-dev (compiled manually) compiled with go1.22.0 on linux/amd64", "0.16.4-dev", Semver{0, 16, 4}},
+		{"restic 0.18.0-rc.1 compiled with go1.24.0 on windows/amd64\r\n", "0.18.0-rc.1", Semver{0, 18, 0}},
+		{"restic 1.0 compiled with go1.25 on linux/amd64", "1.0", Semver{1, 0, 0}},
+	}
+	for _, tt := range tests {
+		raw, v, err := parseResticVersion(tt.out)
+		if err != nil || raw != tt.raw || v != tt.want {
+			t.Errorf("parseResticVersion(%q) = %q, %v, %v; want %q, %v", tt.out, raw, v, err, tt.raw, tt.want)
+		}
+	}
+
+	for _, out := range []string{
+		"",
+		"restic",
+		"rustic 0.7.0",
+		"bash: restic: command not found",
+		"restic unknown compiled with go1.21.6 on linux/amd64",
+		"restic v0.16.4 compiled with go1.21.6 on linux/amd64",
+	} {
+		if raw, v, err := parseResticVersion(out); err == nil {
+			t.Errorf("parseResticVersion(%q) = %q, %v; want an error", out, raw, v)
+		}
+	}
+}
+
+func TestSemverAtLeast(t *testing.T) {
+	tests := []struct {
+		v, min Semver
+		want   bool
+	}{
+		{Semver{0, 16, 4}, Semver{0, 12, 0}, true},
+		{Semver{0, 12, 0}, Semver{0, 12, 0}, true},
+		{Semver{0, 11, 9}, Semver{0, 12, 0}, false},
+		{Semver{1, 0, 0}, Semver{0, 15, 0}, true},
+		{Semver{0, 14, 1}, Semver{0, 15, 0}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.v.AtLeast(tt.min); got != tt.want {
+			t.Errorf("%v.AtLeast(%v) = %v, want %v", tt.v, tt.min, got, tt.want)
+		}
+	}
+}
+
+func TestResticVersionNotCachingFailures(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake restic is a shell script")
+	}
+	resetVersion := func() {
+		resticVersionMu.Lock()
+		resticVersionRaw, resticVersion = "", Semver{}
+		resticVersionMu.Unlock()
+	}
+	resetVersion()
+	t.Cleanup(resetVersion)
+
+	dir := t.TempDir()
+	t.Setenv("PATH", dir)
+	restic := filepath.Join(dir, "restic")
+
+	// A cancelled probe fails, but must not disable detection for later calls
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := os.WriteFile(restic, []byte("#!/bin/sh\necho restic 0.16.4 compiled with go1.21.6 on linux/amd64\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ResticVersion(cancelled); err == nil {
+		t.Fatal("ResticVersion with a cancelled ctx: want an error")
+	}
+	raw, v, err := ResticVersion(context.Background())
+	if err != nil || raw != "0.16.4" || v != (Semver{0, 16, 4}) {
+		t.Fatalf("ResticVersion after a cancelled probe = %q, %v, %v; want 0.16.4", raw, v, err)
+	}
+
+	// Once known, the version is cached
+	if err := os.WriteFile(restic, []byte("#!/bin/sh\nexit 1\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if raw, _, err := ResticVersion(context.Background()); err != nil || raw != "0.16.4" {
+		t.Errorf("cached ResticVersion = %q, %v; want 0.16.4", raw, err)
+	}
+}
@@ -1,18 +1,144 @@
 package config
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"xentz-agent/internal/fsutil"
 )
 
 type Schedule struct {
 	// MVP: daily at HH:MM local time (launchd handles scheduling)
 	DailyAt string `json:"daily_at"`
+	// Run every N minutes instead (min 15, under a day). Takes precedence over DailyAt.
+	IntervalMinutes int `json:"interval_minutes,omitempty"`
+
+	// How often the DailyAt run happens: "daily" (default), "weekly" on DayOfWeek ("sun".."sat")
+	// or "monthly" on DayOfMonth (1-28)
+	Frequency  string `json:"frequency,omitempty"`
+	DayOfWeek  string `json:"day_of_week,omitempty"`
+	DayOfMonth int    `json:"day_of_month,omitempty"`
+
+	// Optional weekly retention run: HH:MM local time on RetentionDay ("sun".."sat", default "sun")
+	RetentionWeeklyAt string `json:"retention_weekly_at,omitempty"`
+	RetentionDay      string `json:"retention_day,omitempty"`
+
+	// Random delay of up to this many seconds before each scheduled run, to spread fleet load
+	JitterSeconds int `json:"jitter_seconds,omitempty"`
+
+	// Run a catch-up backup from other scheduled commands when the last successful backup is overdue
+	CatchUp bool `json:"catch_up,omitempty"`
 }
+
+// Schedule frequencies
+const (
+	FrequencyDaily   = "daily"
+	FrequencyWeekly  = "weekly"
+	FrequencyMonthly = "monthly"
+)
+
+// Restic password sources
+const (
+	PasswordSourceFile     = "file"
+	PasswordSourceKeychain = "keychain"
+)
+
+// Restic compression modes (restic 0.14+)
+const (
+	CompressionAuto = "auto"
+	CompressionMax  = "max"
+	CompressionOff  = "off"
+)
+
 type Restic struct {
 	Repository   string `json:"repository"`              // e.g. "rest:https://.../restic/dr-core-backups-demo/client-123/"
 	PasswordFile string `json:"password_file,omitempty"` // e.g. "~/.xentz-agent/restic.pw"
+	// Where the password is read from: "file" (default, PasswordFile) or "keychain" (OS credential store)
+	PasswordSource string `json:"password_source,omitempty"`
+	// Command (argv) whose stdout is the password, like restic's --password-command.
+	// Takes precedence over PasswordSource; only honored from the local config.
+	PasswordCommand []string `json:"password_command,omitempty"`
+
+	// Bandwidth limits in KiB/s (0 = unlimited), passed as restic --limit-upload/--limit-download
+	UploadLimitKiB   int `json:"upload_limit_kib,omitempty"`
+	DownloadLimitKiB int `json:"download_limit_kib,omitempty"`
+
+	// Passed as restic --one-file-system (don't cross into other mounts) and --exclude-caches
+	OneFileSystem bool `json:"one_file_system,omitempty"`
+	ExcludeCaches bool `json:"exclude_caches,omitempty"`
+
+	// Compression mode: "auto", "max" or "off" (empty = restic default, flag omitted)
+	Compression string `json:"compression,omitempty"`
+
+	// Performance tuning (0 = restic default): files read in parallel (restic 0.15+) and
+	// target pack file size in MiB, 4-128 (restic 0.14+)
+	ReadConcurrency int `json:"read_concurrency,omitempty"`
+	PackSizeMiB     int `json:"pack_size_mib,omitempty"`
+
+	// Locks left by this host older than this are removed automatically (default 60)
+	StaleLockMinutes int `json:"stale_lock_minutes,omitempty"`
+}
+
+// Retry policy for `restic backup` runs that fail with a transient (network/backend) error
+type Retry struct {
+	Attempts     int `json:"attempts,omitempty"`      // Total attempts including the first (default 3)
+	DelaySeconds int `json:"delay_seconds,omitempty"` // Delay before the first retry, doubled each time (default 30)
+}
+
+// Timeouts limit how long backup, retention and check runs may take, in hours (0 = the default)
+type Timeouts struct {
+	BackupHours    int `json:"backup_hours,omitempty"`    // Default 6
+	RetentionHours int `json:"retention_hours,omitempty"` // Default 2
+	CheckHours     int `json:"check_hours,omitempty"`     // Default 6
+}
+
+// Default run timeouts
+const (
+	DefaultBackupTimeout    = 6 * time.Hour
+	DefaultRetentionTimeout = 2 * time.Hour
+	DefaultCheckTimeout     = 6 * time.Hour
+)
+
+// Backup returns the backup timeout
+func (t Timeouts) Backup() time.Duration {
+	return hoursOr(t.BackupHours, DefaultBackupTimeout)
+}
+
+// Retention returns the retention timeout
+func (t Timeouts) Retention() time.Duration {
+	return hoursOr(t.RetentionHours, DefaultRetentionTimeout)
+}
+
+// Check returns the repository check timeout
+func (t Timeouts) Check() time.Duration {
+	return hoursOr(t.CheckHours, DefaultCheckTimeout)
+}
+
+func hoursOr(hours int, def time.Duration) time.Duration {
+	if hours > 0 {
+		return time.Duration(hours) * time.Hour
+	}
+	return def
+}
+
+// NotifyConfig selects how failed runs are announced
+type NotifyConfig struct {
+	Enabled    bool   `json:"enabled,omitempty"`
+	Type       string `json:"type,omitempty"`        // "desktop" (default) or "webhook"
+	WebhookURL string `json:"webhook_url,omitempty"` // Receives the run as a JSON POST (type "webhook")
+	Format     string `json:"format,omitempty"`      // Webhook payload: "raw" (default), "slack" or "teams"
 }
 
 type Retention struct {
@@ -22,32 +148,241 @@ type Retention struct {
 	KeepMonthly int `json:"keep_monthly,omitempty"`
 	KeepYearly  int `json:"keep_yearly,omitempty"`
 
+	// Time-based policy: keep snapshots (or the last one per hour/day/...) newer than a duration
+	// such as "30d" or "1y6m" (units y, m, d, h), passed as restic --keep-within*
+	KeepWithin        string `json:"keep_within,omitempty"`
+	KeepWithinHourly  string `json:"keep_within_hourly,omitempty"`
+	KeepWithinDaily   string `json:"keep_within_daily,omitempty"`
+	KeepWithinWeekly  string `json:"keep_within_weekly,omitempty"`
+	KeepWithinMonthly string `json:"keep_within_monthly,omitempty"`
+	KeepWithinYearly  string `json:"keep_within_yearly,omitempty"`
+
 	// Prune policy
 	Prune bool `json:"prune"` // recommended true
+	// Cheaper partial prunes (only with Prune): tolerated unused space such as "5%", "2G" or
+	// "unlimited" (restic --max-unused), and a cap on data repacked per run such as "500M"
+	PruneMaxUnused     string `json:"prune_max_unused,omitempty"`
+	PruneMaxRepackSize string `json:"prune_max_repack_size,omitempty"`
+
+	// Never forget snapshots carrying any of these tags (restic --keep-tag)
+	KeepTags []string `json:"keep_tags,omitempty"`
+
+	// Only forget this device's snapshots (its device tag), or those carrying all of the config's
+	// tags when not enrolled
+	TagScoped bool `json:"tag_scoped,omitempty"`
 }
 
 type Config struct {
 	// Enrollment fields (server-issued identifiers)
-	InstallToken string `json:"install_token,omitempty"` // Temporary token for enrollment (not stored after enrollment)
-	TenantID     string `json:"tenant_id,omitempty"`     // Server-assigned tenant/customer ID
-	DeviceID     string `json:"device_id,omitempty"`     // Server-assigned device identifier
+	InstallToken string `json:"install_token,omitempty"`  // Temporary token for enrollment (not stored after enrollment)
+	TenantID     string `json:"tenant_id,omitempty"`      // Server-assigned tenant/customer ID
+	DeviceID     string `json:"device_id,omitempty"`      // Server-assigned device identifier
 	DeviceAPIKey string `json:"device_api_key,omitempty"` // Long-lived API key for fetching config
-	UserID       string `json:"user_id,omitempty"`       // User identifier (username or UUID)
+	UserID       string `json:"user_id,omitempty"`        // User identifier (username or UUID)
 
 	// Control plane and scheduling
-	ServerURL string   `json:"server_url,omitempty"` // Base URL for control plane
-	Enabled   *bool    `json:"enabled,omitempty"`    // Kill-switch: if false, agent must stop all operations (server-controlled)
-	Schedule  Schedule `json:"schedule"`
-	Include   []string `json:"include"`
-	Exclude   []string `json:"exclude,omitempty"`
-	Restic    Restic   `json:"restic"`
+	ServerURL    string    `json:"server_url,omitempty"` // Base URL for control plane
+	Enabled      *bool     `json:"enabled,omitempty"`    // Kill-switch: if false, agent must stop all operations (server-controlled)
+	Schedule     Schedule  `json:"schedule"`
+	Include      []string  `json:"include"`
+	Exclude      []string  `json:"exclude,omitempty"`
+	ExcludeFiles []string  `json:"exclude_files,omitempty"` // Files with exclude patterns, passed as restic --exclude-file
+	Tags         []string  `json:"tags,omitempty"`          // Snapshot tags, passed as restic --tag
+	Restic       Restic    `json:"restic"`
+	Retention    Retention `json:"retention,omitempty"`
+	Retry        Retry     `json:"retry,omitempty"`
+	AutoInit     bool      `json:"auto_init,omitempty"` // Initialize the repository on backup if it doesn't exist (default: false)
+
+	// Agent version policy (server-controlled): agents below MinAgentVersion, or not on
+	// TargetAgentVersion, warn on every run or self-update when AutoUpdate is set
+	MinAgentVersion    string `json:"min_agent_version,omitempty"`
+	TargetAgentVersion string `json:"target_agent_version,omitempty"`
+	AutoUpdate         bool   `json:"auto_update,omitempty"`
+
+	// TLS for control plane requests: extra CA bundle, and a client certificate/key for mutual TLS.
+	// Local config only: they name local files.
+	CACertFile     string `json:"ca_cert_file,omitempty"`
+	ClientCertFile string `json:"client_cert_file,omitempty"`
+	ClientKeyFile  string `json:"client_key_file,omitempty"`
+	// Pin the control plane's TLS certificate (SHA-256 of the leaf) instead of trusting its CA chain.
+	// Local config only.
+	ServerCertFingerprint string `json:"server_cert_fingerprint,omitempty"`
+	// Proxy for control plane requests (http, https or socks5 URL). Overrides HTTP(S)_PROXY; local config only.
+	ProxyURL string `json:"proxy_url,omitempty"`
+	// Reject private and link-local server addresses (validation.ValidateServerURLStrict), for deployments
+	// whose control plane is always public. Local config only.
+	StrictServerValidation bool `json:"strict_server_validation,omitempty"`
+	// Also resolve the server hostname (and redirect targets) and reject loopback/link-local/metadata
+	// addresses it points at. Local config only.
+	ResolveServerHost bool `json:"resolve_server_host,omitempty"`
+	// Timeout for control plane requests in seconds (default 30, clamped to 5-300). Local config only.
+	HTTPTimeoutSeconds int `json:"http_timeout_seconds,omitempty"`
+	// Parallel requests when flushing spooled reports one by one (default 4, max 16). Local config only.
+	ReportWorkers int `json:"report_workers,omitempty"`
+	// Cap on the total size of spooled reports (default 100MB), and how long an unsent report is kept
+	// (default 720 = 30 days). Local config only.
+	SpoolMaxBytes    int64 `json:"spool_max_bytes,omitempty"`
+	SpoolMaxAgeHours int   `json:"spool_max_age_hours,omitempty"`
+	// How old the cached server config may get while the server is unreachable (default 168 = 7 days),
+	// and whether an older cache fails the run (strict) or is used with a warning. Local config only.
+	MaxCacheAgeHours int  `json:"max_cache_age_hours,omitempty"`
+	StrictCache      bool `json:"strict_cache,omitempty"`
+
+	// Commands (argv) run before and after each backup. Local config only: never taken from the server.
+	PreBackup  [][]string `json:"pre_backup,omitempty"`
+	PostBackup [][]string `json:"post_backup,omitempty"`
+
+	// Announce failed backup and retention runs. Local config only.
+	Notify NotifyConfig `json:"notify,omitempty"`
+
+	// Install the scheduled jobs system-wide (root systemd units on Linux, LaunchDaemons on macOS)
+	// so they run with nobody logged in, as SystemUser (default root). Local config only.
+	SystemService bool   `json:"system_service,omitempty"`
+	SystemUser    string `json:"system_user,omitempty"`
+
+	// Rotation of the scheduler's agent.out.log/agent.err.log (defaults: 10MB, keep 3)
+	LogMaxSizeMB int `json:"log_max_size_mb,omitempty"`
+	LogKeep      int `json:"log_keep,omitempty"`
+
+	// Fail the backup when an include path is missing (e.g. an unmounted drive) instead of skipping it
+	FailOnMissingInclude bool `json:"fail_on_missing_include,omitempty"`
+
+	// Skip backups while on a metered connection (cellular, phone hotspot); best-effort detection
+	SkipOnMetered bool `json:"skip_on_metered,omitempty"`
+	// Skip backups while running on battery (machines without a battery always count as on AC)
+	RequireACPower bool `json:"require_ac_power,omitempty"`
+	// Skip backups while the machine has no network connection (no interface with a routable address)
+	RequireNetwork bool `json:"require_network,omitempty"`
+	// Wait until the user has been idle for a few minutes before backing up, for at most
+	// MaxDeferMinutes (default 60); the backup then runs anyway
+	DeferWhileActive bool `json:"defer_while_active,omitempty"`
+	MaxDeferMinutes  int  `json:"max_defer_minutes,omitempty"`
+
+	// Jobs done by `xentz-agent run`, for a single scheduled job instead of separate backup and
+	// retention jobs: a backup, retention once a week, and `restic check` every CheckIntervalHours
+	// (default 168 = 7 days). With none set, run does a backup and retention.
+	RunBackup          bool `json:"run_backup,omitempty"`
+	RunRetention       bool `json:"run_retention,omitempty"`
+	RunCheck           bool `json:"run_check,omitempty"`
+	CheckIntervalHours int  `json:"check_interval_hours,omitempty"`
+
+	// Time limits for backup, retention and check runs (defaults 6h, 2h and 6h)
+	Timeouts Timeouts `json:"timeouts,omitempty"`
+
+	// Named backup sets with their own paths, schedule and retention (optional)
+	Profiles map[string]ProfileConfig `json:"profiles,omitempty"`
+}
+
+// Configured reports whether any keep_* value is set. keep_tags alone does not count:
+// restic would forget every snapshot without one of the tags.
+func (r Retention) Configured() bool {
+	return r.KeepLast > 0 || r.KeepDaily > 0 || r.KeepWeekly > 0 || r.KeepMonthly > 0 || r.KeepYearly > 0 ||
+		r.KeepWithin != "" || r.KeepWithinHourly != "" || r.KeepWithinDaily != "" ||
+		r.KeepWithinWeekly != "" || r.KeepWithinMonthly != "" || r.KeepWithinYearly != ""
+}
+
+// ProfileConfig is a named backup set. Empty schedule/retention fall back to the top-level values.
+type ProfileConfig struct {
+	Include   []string  `json:"include"`
+	Exclude   []string  `json:"exclude,omitempty"`
+	Schedule  Schedule  `json:"schedule,omitempty"`
 	Retention Retention `json:"retention,omitempty"`
 }
 
+// ParseSizeKiB parses a human-readable size such as "500K", "2M", "1.5M" or "1G" into KiB,
+// rounded to a whole KiB. A bare number is taken as KiB; "" and "0" mean 0 (unlimited).
+func ParseSizeKiB(input string) (int, error) {
+	s := strings.TrimSpace(strings.ToUpper(input))
+	if s == "" {
+		return 0, nil
+	}
+
+	multiplier := 1
+	for _, unit := range []struct {
+		suffix string
+		mult   int
+	}{
+		{"GIB", 1024 * 1024}, {"GB", 1024 * 1024}, {"G", 1024 * 1024},
+		{"MIB", 1024}, {"MB", 1024}, {"M", 1024},
+		{"KIB", 1}, {"KB", 1}, {"K", 1},
+	} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			multiplier = unit.mult
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+		return 0, fmt.Errorf("invalid size %q: expected a number with optional K, M or G suffix", input)
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("invalid size %q: must not be negative", input)
+	}
+	kib := math.Round(n * float64(multiplier))
+	if kib > math.MaxInt32 {
+		return 0, fmt.Errorf("invalid size %q: too large", input)
+	}
+	return int(kib), nil
+}
+
+// DeviceTag returns the snapshot tag identifying snapshots made by a device
+func DeviceTag(deviceID string) string {
+	return "device:" + deviceID
+}
+
+// ValidateProfileName checks that a profile name is safe to use in scheduler job names and file names
+func ValidateProfileName(name string) error {
+	if name == "" || len(name) > 64 {
+		return fmt.Errorf("profile name must be 1-64 characters")
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return fmt.Errorf("profile name %q may only contain letters, digits, '-' and '_'", name)
+		}
+	}
+	return nil
+}
+
+// ForProfile returns the config to use for the named profile.
+// An empty name returns the top-level config unchanged (backward compatible single-profile mode).
+func (c Config) ForProfile(name string) (Config, error) {
+	if name == "" {
+		return c, nil
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		return Config{}, fmt.Errorf("profile %q not found in config", name)
+	}
+	out := c
+	out.Include = p.Include
+	out.Exclude = p.Exclude
+	if p.Schedule.DailyAt != "" || p.Schedule.IntervalMinutes != 0 || p.Schedule.Frequency != "" {
+		out.Schedule.DailyAt = p.Schedule.DailyAt
+		out.Schedule.IntervalMinutes = p.Schedule.IntervalMinutes
+		out.Schedule.Frequency = p.Schedule.Frequency
+		out.Schedule.DayOfWeek = p.Schedule.DayOfWeek
+		out.Schedule.DayOfMonth = p.Schedule.DayOfMonth
+	}
+	if !reflect.DeepEqual(p.Retention, Retention{}) {
+		out.Retention = p.Retention
+	}
+	return out, nil
+}
+
+// EnvConfigPath names the environment variable that overrides the default config path
+const EnvConfigPath = "XENTZ_CONFIG"
+
+// ResolvePath returns the config file to use: override (the --config flag) if set, then
+// $XENTZ_CONFIG, then ~/.xentz-agent/config.json.
 func ResolvePath(override string) (string, error) {
 	if override != "" {
 		return override, nil
 	}
+	if p := os.Getenv(EnvConfigPath); p != "" {
+		return p, nil
+	}
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return "", err
@@ -68,7 +403,7 @@ func Write(path string, cfg Config) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, b, 0o600)
+	return fsutil.WriteFileAtomic(path, b, 0o600)
 }
 
 func Read(path string) (Config, error) {
@@ -92,20 +427,126 @@ func GetCachedConfigPath() (string, error) {
 	return filepath.Join(home, ".xentz-agent", "config-cached.json"), nil
 }
 
-// WriteCached writes the config to the cached config file
-func WriteCached(cfg Config) error {
+// DefaultMaxCacheAge is how long a cached server config is trusted when max_cache_age_hours is unset
+const DefaultMaxCacheAge = 7 * 24 * time.Hour
+
+// CachePolicy controls how LoadWithFallback treats a cached config that is older than MaxAge
+type CachePolicy struct {
+	MaxAge time.Duration // 0 = DefaultMaxCacheAge
+	Strict bool          // Refuse a stale cache instead of warning
+}
+
+// CachePolicy returns the local config's cache policy
+func (c Config) CachePolicy() CachePolicy {
+	return CachePolicy{
+		MaxAge: time.Duration(c.MaxCacheAgeHours) * time.Hour,
+		Strict: c.StrictCache,
+	}
+}
+
+// ErrCacheTampered is returned when the cached config's signature does not verify
+var ErrCacheTampered = errors.New("cached config failed verification (modified, or signed with another device API key)")
+
+// cachedConfig is the on-disk format of the cached config: the server config, when it was
+// fetched, and an HMAC-SHA256 over both keyed by the device API key, so local edits to the
+// cache (to redirect backups or widen retention) are detected
+type cachedConfig struct {
+	FetchedAt time.Time       `json:"fetched_at"`
+	Config    json.RawMessage `json:"config"`
+	HMAC      string          `json:"hmac"`
+}
+
+// cacheMAC signs the compact config JSON and its fetch time
+func cacheMAC(key string, fetchedAt time.Time, compactCfg []byte) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(fetchedAt.UTC().Format(time.RFC3339Nano) + "\n"))
+	mac.Write(compactCfg)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// WriteCached writes the config to the cached config file, stamped with the current time
+// and signed with deviceAPIKey
+func WriteCached(cfg Config, deviceAPIKey string) error {
+	return writeCachedAt(cfg, time.Now().UTC(), deviceAPIKey)
+}
+
+// ResignCached re-signs the cached config after the device API key was rotated, keeping
+// its fetch time. A missing or unverifiable cache is left alone.
+func ResignCached(oldKey, newKey string) error {
+	cfg, fetchedAt, err := ReadCachedAt(oldKey)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return writeCachedAt(cfg, fetchedAt, newKey)
+}
+
+func writeCachedAt(cfg Config, fetchedAt time.Time, deviceAPIKey string) error {
+	if deviceAPIKey == "" {
+		return fmt.Errorf("device API key is required to sign the cached config")
+	}
 	cachePath, err := GetCachedConfigPath()
 	if err != nil {
 		return err
 	}
-	return Write(cachePath, cfg)
+	if err := EnsureDirFor(cachePath); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(cachedConfig{
+		FetchedAt: fetchedAt,
+		Config:    raw,
+		HMAC:      cacheMAC(deviceAPIKey, fetchedAt, raw),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(cachePath, b, 0o600)
+}
+
+// ReadCached reads the cached config file, verifying its signature with deviceAPIKey
+func ReadCached(deviceAPIKey string) (Config, error) {
+	cfg, _, err := ReadCachedAt(deviceAPIKey)
+	return cfg, err
 }
 
-// ReadCached reads the cached config file
-func ReadCached() (Config, error) {
+// ReadCachedAt is ReadCached, also returning when the config was fetched from the server.
+// Unsigned caches written by older agents are rejected; the next successful fetch replaces them.
+func ReadCachedAt(deviceAPIKey string) (Config, time.Time, error) {
 	cachePath, err := GetCachedConfigPath()
 	if err != nil {
-		return Config{}, err
+		return Config{}, time.Time{}, err
+	}
+	b, err := os.ReadFile(cachePath)
+	if err != nil {
+		return Config{}, time.Time{}, err
+	}
+	var cached cachedConfig
+	if err := json.Unmarshal(b, &cached); err != nil {
+		return Config{}, time.Time{}, err
+	}
+	if cached.Config == nil || cached.HMAC == "" {
+		return Config{}, time.Time{}, fmt.Errorf("cached config is not signed (written by an older agent)")
+	}
+
+	// The file is indented; the signature covers the compact JSON
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, cached.Config); err != nil {
+		return Config{}, time.Time{}, err
+	}
+	want := cacheMAC(deviceAPIKey, cached.FetchedAt, compact.Bytes())
+	if deviceAPIKey == "" || !hmac.Equal([]byte(want), []byte(cached.HMAC)) {
+		return Config{}, time.Time{}, ErrCacheTampered
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(compact.Bytes(), &cfg); err != nil {
+		return Config{}, time.Time{}, err
 	}
-	return Read(cachePath)
+	return cfg, cached.FetchedAt, nil
 }
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useTempHome points the cached config path at a fresh temporary home for the test
+func useTempHome(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	cachePath, err := GetCachedConfigPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cachePath
+}
+
+func TestCachedConfigRoundTrip(t *testing.T) {
+	useTempHome(t)
+	cfg := Config{ServerURL: "https://control.example.com", Include: []string{"/home/u"}}
+	if err := WriteCached(cfg, "key-1"); err != nil {
+		t.Fatalf("WriteCached: %v", err)
+	}
+	got, fetchedAt, err := ReadCachedAt("key-1")
+	if err != nil {
+		t.Fatalf("ReadCachedAt: %v", err)
+	}
+	if got.ServerURL != cfg.ServerURL || len(got.Include) != 1 || got.Include[0] != "/home/u" {
+		t.Errorf("ReadCachedAt = %+v", got)
+	}
+	if fetchedAt.IsZero() {
+		t.Error("fetched_at not set")
+	}
+
+	// Rotating the key re-signs the cache
+	if err := ResignCached("key-1", "key-2"); err != nil {
+		t.Fatalf("ResignCached: %v", err)
+	}
+	if _, err := ReadCached("key-2"); err != nil {
+		t.Errorf("ReadCached with the new key: %v", err)
+	}
+}
+
+func TestCachedConfigTampered(t *testing.T) {
+	cachePath := useTempHome(t)
+	cfg := Config{ServerURL: "https://control.example.com", Include: []string{"/home/u"}}
+	if err := WriteCached(cfg, "key-1"); err != nil {
+		t.Fatalf("WriteCached: %v", err)
+	}
+	signed, err := os.ReadFile(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Signed with a different key
+	if _, err := ReadCached("other-key"); !errors.Is(err, ErrCacheTampered) {
+		t.Errorf("ReadCached with another key: %v, want ErrCacheTampered", err)
+	}
+	if _, err := ReadCached(""); !errors.Is(err, ErrCacheTampered) {
+		t.Errorf("ReadCached without a key: %v, want ErrCacheTampered", err)
+	}
+
+	edits := []struct{ name, old, new string }{
+		{"redirected include", `"/home/u"`, `"/etc"`},
+		{"changed fetched_at", `"fetched_at": "2`, `"fetched_at": "1`}, // A thousand years earlier
+		{"replaced hmac", `"hmac": "`, `"hmac": "00`},
+	}
+	for _, e := range edits {
+		if !bytes.Contains(signed, []byte(e.old)) {
+			t.Fatalf("%s: %q not in cache:\n%s", e.name, e.old, signed)
+		}
+		if err := os.WriteFile(cachePath, bytes.Replace(signed, []byte(e.old), []byte(e.new), 1), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadCached("key-1"); !errors.Is(err, ErrCacheTampered) {
+			t.Errorf("%s: ReadCached = %v, want ErrCacheTampered", e.name, err)
+		}
+	}
+
+	// Unsigned cache written by an older agent
+	if err := os.WriteFile(cachePath, []byte(`{"server_url":"https://control.example.com"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadCached("key-1"); err == nil {
+		t.Error("ReadCached accepted an unsigned cache")
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	defaultPath := filepath.Join(home, ".xentz-agent", "config.json")
+
+	tests := []struct {
+		name     string
+		override string
+		env      string
+		want     string
+	}{
+		{"default", "", "", defaultPath},
+		{"environment", "", "/etc/xentz/env.json", "/etc/xentz/env.json"},
+		{"flag", "/etc/xentz/flag.json", "", "/etc/xentz/flag.json"},
+		{"flag over environment", "/etc/xentz/flag.json", "/etc/xentz/env.json", "/etc/xentz/flag.json"},
+	}
+	for _, tt := range tests {
+		t.Setenv(EnvConfigPath, tt.env)
+		got, err := ResolvePath(tt.override)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: ResolvePath(%q) = %q, %v; want %q", tt.name, tt.override, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseSizeKiB(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int
+	}{
+		{"", 0},
+		{"0", 0},
+		{"0K", 0},
+		{"500", 500},
+		{"500K", 500},
+		{"500k", 500},
+		{"500KiB", 500},
+		{"2M", 2048},
+		{"2MB", 2048},
+		{" 2 M ", 2048},
+		{"1.5M", 1536},
+		{"0.5K", 1}, // Rounded to a whole KiB
+		{"1G", 1024 * 1024},
+		{"1GiB", 1024 * 1024},
+	}
+	for _, tt := range tests {
+		got, err := ParseSizeKiB(tt.input)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseSizeKiB(%q) = %d, %v; want %d", tt.input, got, err, tt.want)
+		}
+	}
+
+	for _, input := range []string{"-1", "-1M", "abc", "M", "2X", "1e400", "NaN", "Inf", "3000G"} {
+		if got, err := ParseSizeKiB(input); err == nil {
+			t.Errorf("ParseSizeKiB(%q) = %d, want an error", input, got)
+		}
+	}
+}
@@ -2,17 +2,26 @@ package config
 
 import (
 	"bytes"
+	"cmp"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"strings"
 	"time"
 
-	"xentz-agent/internal/validation"
+	"xentz-agent/internal/httpx"
+	"xentz-agent/internal/logx"
 )
 
+// ErrKeyExpiring is returned (wrapped) when the server rejects the device API key with a
+// "key_expiring" hint: the key can still be rotated, but no longer fetches config
+var ErrKeyExpiring = errors.New("device API key is expiring (rotate it with `xentz-agent rotate-key`)")
+
+// ErrKeyRevoked is returned (wrapped) when the server rejects the device API key outright
+var ErrKeyRevoked = errors.New("invalid or revoked device API key")
+
 // FetchFromServer fetches configuration from the server using the device API key
 func FetchFromServer(serverURL, deviceAPIKey string) (Config, error) {
 	if serverURL == "" {
@@ -23,7 +32,7 @@ func FetchFromServer(serverURL, deviceAPIKey string) (Config, error) {
 	}
 
 	// Validate server URL to prevent SSRF
-	if err := validation.ValidateServerURL(serverURL); err != nil {
+	if err := httpx.ValidateServerURL(serverURL); err != nil {
 		return Config{}, fmt.Errorf("invalid server URL: %w", err)
 	}
 
@@ -37,10 +46,7 @@ func FetchFromServer(serverURL, deviceAPIKey string) (Config, error) {
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", deviceAPIKey))
 	req.Header.Set("Accept", "application/json")
 
-	// Set timeout
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
+	client := httpx.Client()
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -50,15 +56,18 @@ func FetchFromServer(serverURL, deviceAPIKey string) (Config, error) {
 
 	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
 		var errMsg bytes.Buffer
-		errMsg.ReadFrom(resp.Body)
-		return Config{}, fmt.Errorf("authentication failed (status %d): invalid or revoked device API key", resp.StatusCode)
+		io.CopyN(&errMsg, resp.Body, 512)
+		if resp.StatusCode == http.StatusUnauthorized && strings.Contains(errMsg.String(), "key_expiring") {
+			return Config{}, fmt.Errorf("authentication failed (status %d): %w", resp.StatusCode, ErrKeyExpiring)
+		}
+		return Config{}, fmt.Errorf("authentication failed (status %d): %w", resp.StatusCode, ErrKeyRevoked)
 	}
 
 	if resp.StatusCode != http.StatusOK {
 		var errMsg bytes.Buffer
 		// Limit error message to prevent information leakage
 		io.CopyN(&errMsg, resp.Body, 512) // Limit to 512 bytes
-		errStr := strings.TrimSpace(errMsg.String())
+		errStr := strings.TrimSpace(logx.Redact(errMsg.String()))
 		// Remove newlines and limit length
 		errStr = strings.ReplaceAll(errStr, "\n", " ")
 		errStr = strings.ReplaceAll(errStr, "\r", " ")
@@ -80,8 +89,8 @@ func FetchFromServer(serverURL, deviceAPIKey string) (Config, error) {
 		return Config{}, fmt.Errorf("device is disabled by server (kill-switch activated)")
 	}
 
-	// Validate required fields
-	if len(cfg.Include) == 0 {
+	// Validate required fields (profiles may carry the include paths instead)
+	if len(cfg.Include) == 0 && len(cfg.Profiles) == 0 {
 		return Config{}, fmt.Errorf("server config missing required field: include")
 	}
 	if cfg.Restic.Repository == "" {
@@ -95,6 +104,15 @@ func FetchFromServer(serverURL, deviceAPIKey string) (Config, error) {
 	if len(cfg.Exclude) > 1000 {
 		return Config{}, fmt.Errorf("too many exclude paths (max 1000)")
 	}
+	if len(cfg.ExcludeFiles) > 100 {
+		return Config{}, fmt.Errorf("too many exclude files (max 100)")
+	}
+	if cfg.Restic.UploadLimitKiB < 0 || cfg.Restic.DownloadLimitKiB < 0 {
+		return Config{}, fmt.Errorf("bandwidth limits must not be negative")
+	}
+	if len(cfg.Tags) > 100 {
+		return Config{}, fmt.Errorf("too many tags (max 100)")
+	}
 
 	// Validate paths
 	validatePath := func(path string) error {
@@ -118,6 +136,44 @@ func FetchFromServer(serverURL, deviceAPIKey string) (Config, error) {
 		}
 	}
 
+	for i, path := range cfg.ExcludeFiles {
+		if err := validatePath(path); err != nil {
+			return Config{}, fmt.Errorf("invalid exclude file at index %d: %w", i, err)
+		}
+	}
+
+	for i, tag := range cfg.Tags {
+		if tag == "" || len(tag) > 256 || strings.ContainsAny(tag, ",\x00") {
+			return Config{}, fmt.Errorf("invalid tag at index %d", i)
+		}
+	}
+
+	for name, p := range cfg.Profiles {
+		if err := ValidateProfileName(name); err != nil {
+			return Config{}, fmt.Errorf("invalid profile: %w", err)
+		}
+		if len(p.Include) == 0 {
+			return Config{}, fmt.Errorf("profile %q missing required field: include", name)
+		}
+		if len(p.Include) > 1000 || len(p.Exclude) > 1000 {
+			return Config{}, fmt.Errorf("profile %q has too many paths (max 1000)", name)
+		}
+		for i, path := range p.Include {
+			if err := validatePath(path); err != nil {
+				return Config{}, fmt.Errorf("profile %q: invalid include path at index %d: %w", name, i, err)
+			}
+		}
+		for i, path := range p.Exclude {
+			if err := validatePath(path); err != nil {
+				return Config{}, fmt.Errorf("profile %q: invalid exclude path at index %d: %w", name, i, err)
+			}
+		}
+	}
+
+	if err := Validate(cfg); err != nil {
+		return Config{}, fmt.Errorf("invalid server config: %w", err)
+	}
+
 	return cfg, nil
 }
 
@@ -129,8 +185,8 @@ func FetchAndCache(serverURL, deviceAPIKey string) (Config, error) {
 	}
 
 	// Cache the config
-	if err := WriteCached(cfg); err != nil {
-		log.Printf("warning: failed to cache config: %v", err)
+	if err := WriteCached(cfg, deviceAPIKey); err != nil {
+		logx.Printf("warning: failed to cache config: %v", err)
 		// Continue even if caching fails
 	}
 
@@ -140,11 +196,12 @@ func FetchAndCache(serverURL, deviceAPIKey string) (Config, error) {
 // LoadWithFallback attempts to fetch config from server, falling back to cached config if server is unreachable
 // IMPORTANT: If server returns enabled=false (kill-switch), this function will return an error and NOT use cached config.
 // This ensures that a disabled device cannot continue operating even with cached config.
-func LoadWithFallback(serverURL, deviceAPIKey string) (Config, error) {
+// A cache older than policy.MaxAge fails with policy.Strict, otherwise it is used with a warning.
+func LoadWithFallback(serverURL, deviceAPIKey string, policy CachePolicy) (Config, error) {
 	// Try to fetch from server
 	cfg, err := FetchAndCache(serverURL, deviceAPIKey)
 	if err == nil {
-		log.Println("✓ Config fetched from server and cached")
+		logx.Println("✓ Config fetched from server and cached")
 		return cfg, nil
 	}
 
@@ -161,10 +218,10 @@ func LoadWithFallback(serverURL, deviceAPIKey string) (Config, error) {
 	}
 
 	// For other errors (network issues, etc.), we can fall back to cached config
-	log.Printf("warning: failed to fetch config from server: %v", err)
-	log.Println("Attempting to use cached config...")
+	logx.Printf("warning: failed to fetch config from server: %v", err)
+	logx.Println("Attempting to use cached config...")
 
-	cachedCfg, cacheErr := ReadCached()
+	cachedCfg, fetchedAt, cacheErr := ReadCachedAt(deviceAPIKey)
 	if cacheErr != nil {
 		return Config{}, fmt.Errorf("config fetch failed and no cached config available: %w (cache error: %v)", err, cacheErr)
 	}
@@ -175,6 +232,16 @@ func LoadWithFallback(serverURL, deviceAPIKey string) (Config, error) {
 		return Config{}, fmt.Errorf("device is disabled (cached config shows enabled=false)")
 	}
 
-	log.Println("⚠ Using cached config (server unreachable or config fetch failed)")
+	// Don't run an obsolete include/retention policy forever while the server stays unreachable
+	maxAge := cmp.Or(policy.MaxAge, DefaultMaxCacheAge)
+	if age := time.Since(fetchedAt); age > maxAge {
+		age = age.Round(time.Minute)
+		if policy.Strict {
+			return Config{}, fmt.Errorf("config fetch failed and the cached config is %s old (max %s, strict_cache is set): %w", age, maxAge, err)
+		}
+		logx.Printf("warning: ⚠ cached config is STALE: fetched %s ago (max %s); it may no longer match the server's policy", age, maxAge)
+	}
+
+	logx.Println("⚠ Using cached config (server unreachable or config fetch failed)")
 	return cachedCfg, nil
 }
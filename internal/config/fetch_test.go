@@ -0,0 +1,110 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"xentz-agent/internal/httpx"
+)
+
+// unreachableServer returns a server URL whose requests fail with a network error: they go
+// through a proxy port nothing listens on (the SSRF checks refuse a loopback server URL)
+func unreachableServer(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := "http://" + l.Addr().String()
+	l.Close()
+	if err := httpx.Configure(httpx.Options{ProxyURL: proxy}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { httpx.Configure(httpx.Options{}) })
+	return "http://control.example.com"
+}
+
+// captureLog returns the buffer the log is written to for the rest of the test
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+func TestLoadWithFallbackCache(t *testing.T) {
+	serverURL := unreachableServer(t)
+	policy := CachePolicy{MaxAge: 24 * time.Hour}
+	cached := Config{ServerURL: serverURL, Include: []string{"/home/u"}}
+
+	tests := []struct {
+		name      string
+		age       time.Duration
+		strict    bool
+		wantErr   bool
+		wantStale bool
+	}{
+		{"fresh", time.Hour, false, false, false},
+		{"fresh, strict", time.Hour, true, false, false},
+		{"stale", 48 * time.Hour, false, false, true},
+		{"stale, strict", 48 * time.Hour, true, true, false},
+	}
+	for _, tt := range tests {
+		useTempHome(t)
+		logged := captureLog(t)
+		if err := writeCachedAt(cached, time.Now().Add(-tt.age), "key-1"); err != nil {
+			t.Fatal(err)
+		}
+
+		policy.Strict = tt.strict
+		cfg, err := LoadWithFallback(serverURL, "key-1", policy)
+		if tt.wantErr {
+			if err == nil || !strings.Contains(err.Error(), "strict_cache is set") {
+				t.Errorf("%s: LoadWithFallback = %v, want a stale cache error", tt.name, err)
+			}
+			if !errors.Is(err, httpx.ErrProxy) {
+				t.Errorf("%s: error %v does not wrap the fetch error", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: LoadWithFallback: %v", tt.name, err)
+			continue
+		}
+		if len(cfg.Include) != 1 || cfg.Include[0] != "/home/u" {
+			t.Errorf("%s: LoadWithFallback = %+v, want the cached config", tt.name, cfg)
+		}
+		if stale := strings.Contains(logged.String(), "cached config is STALE"); stale != tt.wantStale {
+			t.Errorf("%s: stale warning logged = %v, want %v:\n%s", tt.name, stale, tt.wantStale, logged)
+		}
+	}
+}
+
+func TestLoadWithFallbackNoCache(t *testing.T) {
+	serverURL := unreachableServer(t)
+	useTempHome(t)
+	captureLog(t)
+	if _, err := LoadWithFallback(serverURL, "key-1", CachePolicy{}); err == nil || !strings.Contains(err.Error(), "no cached config") {
+		t.Errorf("LoadWithFallback without a cache = %v, want an error", err)
+	}
+}
+
+func TestLoadWithFallbackDisabledCache(t *testing.T) {
+	serverURL := unreachableServer(t)
+	useTempHome(t)
+	captureLog(t)
+	disabled := false
+	if err := WriteCached(Config{Enabled: &disabled, Include: []string{"/home/u"}}, "key-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadWithFallback(serverURL, "key-1", CachePolicy{}); err == nil || !strings.Contains(err.Error(), "enabled=false") {
+		t.Errorf("LoadWithFallback with a disabled cache = %v, want an error", err)
+	}
+}
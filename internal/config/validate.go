@@ -0,0 +1,336 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"xentz-agent/internal/httpx"
+	"xentz-agent/internal/notify"
+	"xentz-agent/internal/validation"
+	"xentz-agent/internal/version"
+)
+
+// Validate checks cfg for values that would only fail later at schedule or backup time.
+// Every problem found is reported at once, joined into a single error.
+func Validate(cfg Config) error {
+	var errs []error
+
+	if err := ValidateSchedule(cfg.Schedule); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Schedule.RetentionWeeklyAt != "" {
+		if _, _, err := ParseHHMM(cfg.Schedule.RetentionWeeklyAt); err != nil {
+			errs = append(errs, fmt.Errorf("schedule.retention_weekly_at %q: %w", cfg.Schedule.RetentionWeeklyAt, err))
+		}
+	}
+	if cfg.Schedule.JitterSeconds < 0 {
+		errs = append(errs, fmt.Errorf("schedule.jitter_seconds must not be negative"))
+	}
+	if cfg.Schedule.RetentionDay != "" {
+		if _, err := ParseWeekday(cfg.Schedule.RetentionDay); err != nil {
+			errs = append(errs, fmt.Errorf("schedule.retention_day %q: %w", cfg.Schedule.RetentionDay, err))
+		}
+	}
+	for _, path := range cfg.Include {
+		if !isAbsPath(path) {
+			errs = append(errs, fmt.Errorf("include path %q is not absolute", path))
+		}
+	}
+	if cfg.ServerURL != "" {
+		validate := validation.ValidateServerURL
+		if cfg.StrictServerValidation {
+			validate = validation.ValidateServerURLStrict
+		}
+		if err := validate(cfg.ServerURL); err != nil {
+			errs = append(errs, fmt.Errorf("server_url: %w", err))
+		}
+	}
+	if err := validateRetention(cfg.Retention); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.HTTPTimeoutSeconds < 0 {
+		errs = append(errs, fmt.Errorf("http_timeout_seconds must not be negative"))
+	}
+	if cfg.SpoolMaxBytes < 0 {
+		errs = append(errs, fmt.Errorf("spool_max_bytes must be positive"))
+	}
+	if cfg.SpoolMaxAgeHours < 0 {
+		errs = append(errs, fmt.Errorf("spool_max_age_hours must be positive"))
+	}
+	for _, t := range []struct {
+		name  string
+		hours int
+	}{
+		{"timeouts.backup_hours", cfg.Timeouts.BackupHours},
+		{"timeouts.retention_hours", cfg.Timeouts.RetentionHours},
+		{"timeouts.check_hours", cfg.Timeouts.CheckHours},
+	} {
+		if t.hours < 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", t.name))
+		}
+	}
+	if cfg.CheckIntervalHours < 0 {
+		errs = append(errs, fmt.Errorf("check_interval_hours must not be negative"))
+	}
+	if cfg.ReportWorkers < 0 {
+		errs = append(errs, fmt.Errorf("report_workers must not be negative"))
+	}
+	if cfg.MaxCacheAgeHours < 0 {
+		errs = append(errs, fmt.Errorf("max_cache_age_hours must not be negative"))
+	}
+	if cfg.ProxyURL != "" {
+		if err := httpx.ValidateProxyURL(cfg.ProxyURL); err != nil {
+			errs = append(errs, fmt.Errorf("proxy_url: %w", err))
+		}
+	}
+	if cfg.ServerCertFingerprint != "" {
+		if _, err := httpx.ParseFingerprint(cfg.ServerCertFingerprint); err != nil {
+			errs = append(errs, fmt.Errorf("server_cert_fingerprint: %w", err))
+		}
+	}
+	if cfg.MinAgentVersion != "" && !version.IsRelease(cfg.MinAgentVersion) {
+		errs = append(errs, fmt.Errorf("min_agent_version %q: expected MAJOR.MINOR.PATCH", cfg.MinAgentVersion))
+	}
+	if cfg.TargetAgentVersion != "" && !version.IsRelease(cfg.TargetAgentVersion) {
+		errs = append(errs, fmt.Errorf("target_agent_version %q: expected MAJOR.MINOR.PATCH", cfg.TargetAgentVersion))
+	}
+	if cfg.MaxDeferMinutes < 0 || cfg.MaxDeferMinutes > 24*60 {
+		errs = append(errs, fmt.Errorf("max_defer_minutes must be between 0 and 1440"))
+	}
+	if cfg.SystemUser != "" && !cfg.SystemService {
+		errs = append(errs, fmt.Errorf("system_user is only used with system_service"))
+	}
+	if cfg.LogMaxSizeMB < 0 || cfg.LogKeep < 0 {
+		errs = append(errs, fmt.Errorf("log_max_size_mb and log_keep must not be negative"))
+	}
+	if cfg.Retry.Attempts < 0 || cfg.Retry.Attempts > 10 {
+		errs = append(errs, fmt.Errorf("retry.attempts must be between 0 and 10"))
+	}
+	if cfg.Retry.DelaySeconds < 0 {
+		errs = append(errs, fmt.Errorf("retry.delay_seconds must not be negative"))
+	}
+	if cfg.Restic.ReadConcurrency < 0 {
+		errs = append(errs, fmt.Errorf("restic.read_concurrency must not be negative"))
+	}
+	if cfg.Restic.PackSizeMiB != 0 && (cfg.Restic.PackSizeMiB < 4 || cfg.Restic.PackSizeMiB > 128) {
+		errs = append(errs, fmt.Errorf("restic.pack_size_mib must be between 4 and 128"))
+	}
+	switch cfg.Restic.Compression {
+	case "", CompressionAuto, CompressionMax, CompressionOff:
+	default:
+		errs = append(errs, fmt.Errorf("restic.compression %q: expected %q, %q or %q",
+			cfg.Restic.Compression, CompressionAuto, CompressionMax, CompressionOff))
+	}
+
+	for i, argv := range cfg.PreBackup {
+		if len(argv) == 0 || argv[0] == "" {
+			errs = append(errs, fmt.Errorf("pre_backup hook %d: empty command", i))
+		}
+	}
+	for i, argv := range cfg.PostBackup {
+		if len(argv) == 0 || argv[0] == "" {
+			errs = append(errs, fmt.Errorf("post_backup hook %d: empty command", i))
+		}
+	}
+
+	if cfg.Notify.Enabled {
+		if _, err := notify.New(cfg.Notify.Type, cfg.Notify.WebhookURL, cfg.Notify.Format); err != nil {
+			errs = append(errs, fmt.Errorf("notify: %w", err))
+		} else if cfg.Notify.Type == notify.TypeWebhook {
+			if err := httpx.ValidateServerURL(cfg.Notify.WebhookURL); err != nil {
+				errs = append(errs, fmt.Errorf("notify.webhook_url: %w", err))
+			}
+		}
+	}
+
+	for name, p := range cfg.Profiles {
+		if err := ValidateSchedule(p.Schedule); err != nil {
+			errs = append(errs, fmt.Errorf("profile %q: %w", name, err))
+		}
+		for _, path := range p.Include {
+			if !isAbsPath(path) {
+				errs = append(errs, fmt.Errorf("profile %q: include path %q is not absolute", name, path))
+			}
+		}
+		if err := validateRetention(p.Retention); err != nil {
+			errs = append(errs, fmt.Errorf("profile %q: %w", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ParseWeekday parses a day name such as "sun" or "Sunday"
+func ParseWeekday(s string) (time.Weekday, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := strings.ToLower(d.String())
+		if s == name || s == name[:3] {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("expected a day of the week (sun..sat)")
+}
+
+// ParseHHMM parses a 24h "HH:MM" time as used by schedule.daily_at
+func ParseHHMM(s string) (hour, minute int, err error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("expected HH:MM")
+	}
+	var h, m int
+	_, err = fmt.Sscanf(parts[0], "%d", &h)
+	if err != nil {
+		return 0, 0, err
+	}
+	_, err = fmt.Sscanf(parts[1], "%d", &m)
+	if err != nil {
+		return 0, 0, err
+	}
+	if h < 0 || h > 23 || m < 0 || m > 59 {
+		return 0, 0, fmt.Errorf("out of range")
+	}
+	return h, m, nil
+}
+
+// isAbsPath reports whether path is absolute once environment variables are expanded.
+// Home-relative paths (~, ~/...) count as absolute since the agent expands them before use.
+func isAbsPath(path string) bool {
+	path = os.ExpandEnv(path)
+	return path == "~" || strings.HasPrefix(path, "~/") || filepath.IsAbs(path)
+}
+
+// Bounds for schedule.interval_minutes (a day or more is what daily_at is for)
+const (
+	MinIntervalMinutes = 15
+	MaxIntervalMinutes = 24*60 - 1
+)
+
+// Highest schedule.day_of_month; later days don't exist in every month
+const MaxDayOfMonth = 28
+
+// ValidateSchedule checks the backup time fields, including that the day fields match the frequency
+func ValidateSchedule(s Schedule) error {
+	var errs []error
+	if s.DailyAt != "" {
+		if _, _, err := ParseHHMM(s.DailyAt); err != nil {
+			errs = append(errs, fmt.Errorf("schedule.daily_at %q: %w", s.DailyAt, err))
+		}
+	}
+	if s.IntervalMinutes != 0 && (s.IntervalMinutes < MinIntervalMinutes || s.IntervalMinutes > MaxIntervalMinutes) {
+		errs = append(errs, fmt.Errorf("schedule.interval_minutes must be between %d and %d", MinIntervalMinutes, MaxIntervalMinutes))
+	}
+
+	switch s.Frequency {
+	case "", FrequencyDaily:
+		if s.DayOfWeek != "" || s.DayOfMonth != 0 {
+			errs = append(errs, fmt.Errorf("schedule.day_of_week and day_of_month require frequency %q or %q", FrequencyWeekly, FrequencyMonthly))
+		}
+	case FrequencyWeekly:
+		if s.DayOfWeek == "" {
+			errs = append(errs, fmt.Errorf("schedule.frequency %q requires day_of_week", s.Frequency))
+		} else if _, err := ParseWeekday(s.DayOfWeek); err != nil {
+			errs = append(errs, fmt.Errorf("schedule.day_of_week %q: %w", s.DayOfWeek, err))
+		}
+		if s.DayOfMonth != 0 {
+			errs = append(errs, fmt.Errorf("schedule.day_of_month is only valid with frequency %q", FrequencyMonthly))
+		}
+	case FrequencyMonthly:
+		if s.DayOfMonth < 1 || s.DayOfMonth > MaxDayOfMonth {
+			errs = append(errs, fmt.Errorf("schedule.frequency %q requires day_of_month between 1 and %d", s.Frequency, MaxDayOfMonth))
+		}
+		if s.DayOfWeek != "" {
+			errs = append(errs, fmt.Errorf("schedule.day_of_week is only valid with frequency %q", FrequencyWeekly))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("schedule.frequency %q: expected %q, %q or %q",
+			s.Frequency, FrequencyDaily, FrequencyWeekly, FrequencyMonthly))
+	}
+	if s.IntervalMinutes != 0 && s.Frequency != "" && s.Frequency != FrequencyDaily {
+		errs = append(errs, fmt.Errorf("schedule.interval_minutes cannot be combined with frequency %q", s.Frequency))
+	}
+	return errors.Join(errs...)
+}
+
+func validateRetention(r Retention) error {
+	var errs []error
+	if r.KeepLast < 0 || r.KeepDaily < 0 || r.KeepWeekly < 0 || r.KeepMonthly < 0 || r.KeepYearly < 0 {
+		errs = append(errs, fmt.Errorf("retention keep_* values must not be negative"))
+	}
+	for _, d := range []struct{ name, value string }{
+		{"keep_within", r.KeepWithin},
+		{"keep_within_hourly", r.KeepWithinHourly},
+		{"keep_within_daily", r.KeepWithinDaily},
+		{"keep_within_weekly", r.KeepWithinWeekly},
+		{"keep_within_monthly", r.KeepWithinMonthly},
+		{"keep_within_yearly", r.KeepWithinYearly},
+	} {
+		if d.value != "" && !validRetentionDuration(d.value) {
+			errs = append(errs, fmt.Errorf("retention %s %q: expected a duration like 30d or 1y6m (units y, m, d, h)", d.name, d.value))
+		}
+	}
+	if (r.PruneMaxUnused != "" || r.PruneMaxRepackSize != "") && !r.Prune {
+		errs = append(errs, fmt.Errorf("retention prune_max_unused and prune_max_repack_size require prune"))
+	}
+	if r.PruneMaxUnused != "" && !validMaxUnused(r.PruneMaxUnused) {
+		errs = append(errs, fmt.Errorf("retention prune_max_unused %q: expected a percentage (5%%), a size (2G) or \"unlimited\"", r.PruneMaxUnused))
+	}
+	if r.PruneMaxRepackSize != "" && !validResticSize(r.PruneMaxRepackSize) {
+		errs = append(errs, fmt.Errorf("retention prune_max_repack_size %q: expected a size such as 500M or 2G", r.PruneMaxRepackSize))
+	}
+	return errors.Join(errs...)
+}
+
+// validMaxUnused reports whether s is a restic --max-unused value: "unlimited", a percentage
+// from 0 to 100 (e.g. "5%" or "2.5%") or a size
+func validMaxUnused(s string) bool {
+	if s == "unlimited" {
+		return true
+	}
+	if p, ok := strings.CutSuffix(s, "%"); ok {
+		v, err := strconv.ParseFloat(p, 64)
+		return err == nil && v >= 0 && v <= 100
+	}
+	return validResticSize(s)
+}
+
+// validResticSize reports whether s is a restic size: digits with an optional k, m, g or t suffix
+func validResticSize(s string) bool {
+	if s != "" && strings.ContainsRune("kKmMgGtT", rune(s[len(s)-1])) {
+		s = s[:len(s)-1]
+	}
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// validRetentionDuration reports whether s is a restic --keep-within duration:
+// one or more <number><unit> parts with units y, m, d and h, e.g. "2y5m7d3h"
+func validRetentionDuration(s string) bool {
+	if s == "" {
+		return false
+	}
+	digits := 0
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case (r == 'y' || r == 'm' || r == 'd' || r == 'h') && digits > 0:
+			digits = 0
+		default:
+			return false
+		}
+	}
+	return digits == 0
+}
@@ -0,0 +1,57 @@
+package config
+
+import "testing"
+
+func TestValidateRetentionPrune(t *testing.T) {
+	tests := []struct {
+		name    string
+		r       Retention
+		wantErr bool
+	}{
+		{"unset", Retention{Prune: true}, false},
+		{"percentage", Retention{Prune: true, PruneMaxUnused: "5%"}, false},
+		{"fractional percentage", Retention{Prune: true, PruneMaxUnused: "2.5%"}, false},
+		{"size", Retention{Prune: true, PruneMaxUnused: "2G"}, false},
+		{"unlimited", Retention{Prune: true, PruneMaxUnused: "unlimited"}, false},
+		{"repack size", Retention{Prune: true, PruneMaxRepackSize: "500M"}, false},
+		{"repack size in bytes", Retention{Prune: true, PruneMaxRepackSize: "1048576"}, false},
+		{"over 100%", Retention{Prune: true, PruneMaxUnused: "150%"}, true},
+		{"negative percentage", Retention{Prune: true, PruneMaxUnused: "-5%"}, true},
+		{"bare percent", Retention{Prune: true, PruneMaxUnused: "%"}, true},
+		{"unknown unit", Retention{Prune: true, PruneMaxUnused: "2X"}, true},
+		{"fractional size", Retention{Prune: true, PruneMaxRepackSize: "1.5G"}, true},
+		{"percentage repack size", Retention{Prune: true, PruneMaxRepackSize: "5%"}, true},
+		{"unlimited repack size", Retention{Prune: true, PruneMaxRepackSize: "unlimited"}, true},
+		{"suffix only", Retention{Prune: true, PruneMaxRepackSize: "G"}, true},
+		{"without prune", Retention{PruneMaxUnused: "5%"}, true},
+		{"repack size without prune", Retention{PruneMaxRepackSize: "2G"}, true},
+	}
+	for _, tt := range tests {
+		if err := validateRetention(tt.r); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validateRetention = %v, want error: %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateCompression(t *testing.T) {
+	tests := []struct {
+		compression string
+		wantErr     bool
+	}{
+		{"", false},
+		{CompressionAuto, false},
+		{CompressionOff, false},
+		{CompressionMax, false},
+		{"Max", true},
+		{"fastest", true},
+		{"zstd", true},
+		{" auto", true},
+	}
+	for _, tt := range tests {
+		var cfg Config
+		cfg.Restic.Compression = tt.compression
+		if err := Validate(cfg); (err != nil) != tt.wantErr {
+			t.Errorf("Validate(compression %q) = %v, want error: %v", tt.compression, err, tt.wantErr)
+		}
+	}
+}
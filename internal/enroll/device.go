@@ -0,0 +1,100 @@
+package enroll
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"xentz-agent/internal/httpx"
+	"xentz-agent/internal/logx"
+)
+
+// RotateKeyResponse is received from the server when rotating the device API key
+type RotateKeyResponse struct {
+	DeviceAPIKey string `json:"device_api_key"`
+}
+
+// RotateKey exchanges the current device API key for a new one.
+// The caller must persist the new key before discarding the current one.
+func RotateKey(serverURL, currentKey string) (string, error) {
+	if currentKey == "" {
+		return "", fmt.Errorf("device API key is required")
+	}
+	if err := httpx.ValidateServerURL(serverURL); err != nil {
+		return "", fmt.Errorf("invalid server URL: %w", err)
+	}
+
+	// Note: nginx proxies /control/* to the control plane backend
+	url := fmt.Sprintf("%s/control/v1/rotate-key", serverURL)
+	req, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", currentKey))
+	req.Header.Set("Accept", "application/json")
+
+	client := httpx.Client()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("key rotation request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errMsg bytes.Buffer
+		// Limit and scrub the body: it may echo a key back
+		io.CopyN(&errMsg, resp.Body, 512)
+		return "", fmt.Errorf("key rotation failed (status %d): %s", resp.StatusCode, logx.Redact(errMsg.String()))
+	}
+
+	var rotateResp RotateKeyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rotateResp); err != nil {
+		return "", fmt.Errorf("decode key rotation response: %w", err)
+	}
+	if rotateResp.DeviceAPIKey == "" {
+		return "", fmt.Errorf("server did not return device_api_key")
+	}
+	if rotateResp.DeviceAPIKey == currentKey {
+		return "", fmt.Errorf("server returned the current key")
+	}
+	return rotateResp.DeviceAPIKey, nil
+}
+
+// Deregister asks the control plane to revoke this device and its API key.
+// A device the server no longer knows (404) counts as already deregistered.
+func Deregister(serverURL, deviceAPIKey string) error {
+	if deviceAPIKey == "" {
+		return fmt.Errorf("device API key is required")
+	}
+	if err := httpx.ValidateServerURL(serverURL); err != nil {
+		return fmt.Errorf("invalid server URL: %w", err)
+	}
+
+	// Note: nginx proxies /control/* to the control plane backend
+	url := fmt.Sprintf("%s/control/v1/device", serverURL)
+	req, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", deviceAPIKey))
+
+	client := httpx.Client()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("deregister request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	default:
+		var errMsg bytes.Buffer
+		io.CopyN(&errMsg, resp.Body, 512)
+		return fmt.Errorf("deregister failed (status %d): %s", resp.StatusCode, logx.Redact(errMsg.String()))
+	}
+}
@@ -2,23 +2,43 @@ package enroll
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"os/user"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
-	"xentz-agent/internal/validation"
+	"xentz-agent/internal/backup"
+	"xentz-agent/internal/fsutil"
+	"xentz-agent/internal/httpx"
+	"xentz-agent/internal/logx"
+	"xentz-agent/internal/version"
 )
 
 // DeviceMetadata contains device information sent during enrollment
 type DeviceMetadata struct {
-	Hostname string `json:"hostname"`
-	OS       string `json:"os"`
-	Arch     string `json:"arch"`
+	Hostname      string `json:"hostname"`
+	OS            string `json:"os"`
+	Arch          string `json:"arch"`
+	ResticVersion string `json:"restic_version,omitempty"` // Empty if restic is not installed yet
+	DeviceUUID    string `json:"device_uuid,omitempty"`    // Stable local identity from ~/.xentz-agent/device_uuid
+
+	// Inventory, collected best-effort (empty when not available on this platform)
+	AgentVersion string `json:"agent_version,omitempty"`
+	OSVersion    string `json:"os_version,omitempty"` // Release and build, e.g. "14.5 (23F79)"
+	CPUCount     int    `json:"cpu_count,omitempty"`
+	MemoryBytes  int64  `json:"memory_bytes,omitempty"` // Installed RAM
+	Serial       string `json:"serial,omitempty"`       // Hardware serial number
+	Timezone     string `json:"timezone,omitempty"`     // IANA name where available, e.g. "Europe/Berlin"
 }
 
 // EnrollmentRequest is sent to the server during enrollment
@@ -31,11 +51,13 @@ type EnrollmentRequest struct {
 
 // EnrollmentResponse is received from the server
 type EnrollmentResponse struct {
-	TenantID     string `json:"tenant_id"`
-	DeviceID     string `json:"device_id"`
-	DeviceAPIKey string `json:"device_api_key"`     // Long-lived, revocable API key for future requests
-	RepoPath     string `json:"repo_path"`          // Full repository URL or path
-	Password     string `json:"password,omitempty"` // Optional: server-generated password
+	TenantID       string `json:"tenant_id"`
+	DeviceID       string `json:"device_id"`
+	DeviceAPIKey   string `json:"device_api_key"`             // Long-lived, revocable API key for future requests
+	RepoPath       string `json:"repo_path"`                  // Full repository URL or path
+	Password       string `json:"password,omitempty"`         // Optional: server-generated password
+	RepoBase       string `json:"repo_base,omitempty"`        // Repository URL without the device/user segments
+	AppendUserPath bool   `json:"append_user_path,omitempty"` // Build the path as repo_base/device_id/user_id
 }
 
 // EnrollmentResult contains the enrollment data to store in config
@@ -54,11 +76,29 @@ func GetDeviceMetadata() (DeviceMetadata, error) {
 		return DeviceMetadata{}, fmt.Errorf("get hostname: %w", err)
 	}
 
-	return DeviceMetadata{
-		Hostname: hostname,
-		OS:       runtime.GOOS,
-		Arch:     runtime.GOARCH,
-	}, nil
+	metadata := DeviceMetadata{
+		Hostname:     hostname,
+		OS:           runtime.GOOS,
+		Arch:         runtime.GOARCH,
+		AgentVersion: version.Version,
+		OSVersion:    osVersion(),
+		CPUCount:     runtime.NumCPU(),
+		MemoryBytes:  totalMemory(),
+		Serial:       serialNumber(),
+		Timezone:     timezone(),
+	}
+	if v, _, err := backup.ResticVersion(context.Background()); err == nil {
+		metadata.ResticVersion = v
+	}
+	// Lets the control plane recognize a re-enrollment of the same machine
+	if home, err := os.UserHomeDir(); err == nil {
+		id, err := GetOrCreateDeviceUUID(filepath.Join(home, ".xentz-agent"))
+		if err != nil {
+			logx.Printf("warning: device UUID: %v", err)
+		}
+		metadata.DeviceUUID = id
+	}
+	return metadata, nil
 }
 
 // GetUserID returns the user identifier (username by default)
@@ -70,9 +110,21 @@ func GetUserID() (string, error) {
 	return currentUser.Username, nil
 }
 
+// Enrollment retry policy: attempts in total, with the delay doubling after each failure.
+// A Retry-After header overrides the delay (up to maxRetryAfter).
+const (
+	DefaultAttempts = 3
+	maxRetryAfter   = 5 * time.Minute
+)
+
+// retryDelay is the delay before the first retry (shortened in tests)
+var retryDelay = 2 * time.Second
+
 // Enroll calls the control plane API to enroll the device and get server-issued identifiers
-// includePaths are sent to the control plane so it can store and return them in config
-func Enroll(token, serverURL string, includePaths []string) (*EnrollmentResult, error) {
+// includePaths are sent to the control plane so it can store and return them in config.
+// Network errors and 5xx/429 responses are retried up to attempts times (DefaultAttempts if <= 0);
+// other errors such as a bad or expired token (400/401/403) fail immediately.
+func Enroll(token, serverURL string, includePaths []string, attempts int) (*EnrollmentResult, error) {
 	if token == "" {
 		return nil, fmt.Errorf("install token is required")
 	}
@@ -81,7 +133,7 @@ func Enroll(token, serverURL string, includePaths []string) (*EnrollmentResult,
 	}
 
 	// Validate server URL to prevent SSRF
-	if err := validation.ValidateServerURL(serverURL); err != nil {
+	if err := httpx.ValidateServerURL(serverURL); err != nil {
 		return nil, fmt.Errorf("invalid server URL: %w", err)
 	}
 
@@ -110,67 +162,176 @@ func Enroll(token, serverURL string, includePaths []string) (*EnrollmentResult,
 		return nil, fmt.Errorf("marshal enrollment request: %w", err)
 	}
 
+	enrollmentResp, err := enrollWithRetry(serverURL, token, jsonData, attempts)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := resultFrom(enrollmentResp, userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid enrollment response: %w", err)
+	}
+	return result, nil
+}
+
+// enrollWithRetry sends the enrollment request, retrying transient failures up to
+// attempts times (DefaultAttempts if <= 0)
+func enrollWithRetry(serverURL, token string, jsonData []byte, attempts int) (*EnrollmentResponse, error) {
+	if attempts <= 0 {
+		attempts = DefaultAttempts
+	}
+	delay := retryDelay
+	for attempt := 1; ; attempt++ {
+		enrollmentResp, retryAfter, retry, err := enrollOnce(serverURL, token, jsonData)
+		if err == nil {
+			return enrollmentResp, nil
+		}
+		if !retry {
+			return nil, err
+		}
+		if attempt >= attempts {
+			return nil, fmt.Errorf("%w (gave up after %d attempts)", err, attempts)
+		}
+		wait := delay
+		if retryAfter > 0 {
+			wait = min(retryAfter, maxRetryAfter)
+		}
+		logx.Printf("warning: enrollment attempt %d/%d failed: %v; retrying in %s", attempt, attempts, err, wait)
+		time.Sleep(wait)
+		delay *= 2
+	}
+}
+
+// FromFile enrolls from a provisioning file holding the fields the control plane would
+// return (tenant_id, device_id, device_api_key, repo_path or repo_base, password), for
+// machines that can't reach the control plane. It warns if the file is world-readable.
+func FromFile(path string) (*EnrollmentResult, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("enrollment file: %w", err)
+	}
+	// Windows has no Unix permission bits to check
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0o004 != 0 {
+		logx.Printf("warning: enrollment file %s is world-readable; it contains the device API key (chmod 600 it)", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("enrollment file: %w", err)
+	}
+	var resp EnrollmentResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("parse enrollment file %s: %w", path, err)
+	}
+
+	var userID string
+	if resp.AppendUserPath {
+		if userID, err = GetUserID(); err != nil {
+			return nil, fmt.Errorf("get user ID: %w", err)
+		}
+	}
+	result, err := resultFrom(&resp, userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid enrollment file %s: %w", path, err)
+	}
+	return result, nil
+}
+
+// resultFrom validates an enrollment response (from the server or a provisioning file)
+// and builds the result to store in config
+func resultFrom(resp *EnrollmentResponse, userID string) (*EnrollmentResult, error) {
+	if resp.TenantID == "" {
+		return nil, fmt.Errorf("missing tenant_id")
+	}
+	if resp.DeviceID == "" {
+		return nil, fmt.Errorf("missing device_id")
+	}
+	if resp.DeviceAPIKey == "" {
+		return nil, fmt.Errorf("missing device_api_key")
+	}
+	repoPath, err := repoPathFor(resp, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EnrollmentResult{
+		TenantID:     resp.TenantID,
+		DeviceID:     resp.DeviceID,
+		DeviceAPIKey: resp.DeviceAPIKey,
+		RepoPath:     repoPath,
+		Password:     resp.Password,
+	}, nil
+}
+
+// repoPathFor returns the repository for an enrollment response. A server asking for
+// append_user_path gets {repo_base}/{device_id}/{user_id}, with each segment escaped;
+// otherwise repo_path is the complete path and is used as-is.
+func repoPathFor(resp *EnrollmentResponse, userID string) (string, error) {
+	if !resp.AppendUserPath {
+		if resp.RepoPath == "" {
+			return "", fmt.Errorf("missing repo_path")
+		}
+		return resp.RepoPath, nil
+	}
+	if resp.RepoBase == "" {
+		return "", fmt.Errorf("append_user_path is set but repo_base is missing")
+	}
+	if userID == "" {
+		return "", fmt.Errorf("append_user_path is set but there is no user ID")
+	}
+	return strings.TrimRight(resp.RepoBase, "/") + "/" + url.PathEscape(resp.DeviceID) + "/" + url.PathEscape(userID), nil
+}
+
+// enrollOnce sends one enrollment request. It reports whether a failure is transient
+// (network error, 5xx, 429) and any delay the server asked for with Retry-After.
+func enrollOnce(serverURL, token string, jsonData []byte) (*EnrollmentResponse, time.Duration, bool, error) {
 	// Make POST request to /control/v1/install with Authorization Bearer header
 	// Note: nginx proxies /control/* to the control plane backend
 	url := fmt.Sprintf("%s/control/v1/install", serverURL)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest("POST", url, bytes.NewReader(jsonData))
 	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
+		return nil, 0, false, fmt.Errorf("create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
 
-	// Set timeout
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
+	client := httpx.Client()
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("enrollment request failed: %w", err)
+		return nil, 0, true, fmt.Errorf("enrollment request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		var errMsg bytes.Buffer
-		errMsg.ReadFrom(resp.Body)
-		return nil, fmt.Errorf("enrollment failed (status %d): %s", resp.StatusCode, errMsg.String())
+		// Limit and scrub the body: it may echo the install token back
+		io.CopyN(&errMsg, resp.Body, 512)
+		err := fmt.Errorf("enrollment failed (status %d): %s", resp.StatusCode, logx.Redact(errMsg.String()))
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return nil, parseRetryAfter(resp.Header.Get("Retry-After")), retry, err
 	}
 
 	// Parse response
 	var enrollmentResp EnrollmentResponse
 	if err := json.NewDecoder(resp.Body).Decode(&enrollmentResp); err != nil {
-		return nil, fmt.Errorf("decode enrollment response: %w", err)
+		return nil, 0, false, fmt.Errorf("decode enrollment response: %w", err)
 	}
+	return &enrollmentResp, 0, false, nil
+}
 
-	// Validate response
-	if enrollmentResp.TenantID == "" {
-		return nil, fmt.Errorf("server did not return tenant_id")
-	}
-	if enrollmentResp.DeviceID == "" {
-		return nil, fmt.Errorf("server did not return device_id")
+// parseRetryAfter parses a Retry-After header (delay in seconds or an HTTP date); 0 if absent or invalid
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
 	}
-	if enrollmentResp.DeviceAPIKey == "" {
-		return nil, fmt.Errorf("server did not return device_api_key")
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
 	}
-	if enrollmentResp.RepoPath == "" {
-		return nil, fmt.Errorf("server did not return repo_path")
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0)
 	}
-
-	// Construct full repository path if needed
-	repoPath := enrollmentResp.RepoPath
-	// If server returns a base path, append user_id
-	// If server returns full path, use it as-is
-	// We assume server returns full path including user_id, but if not, we can construct it
-	// For now, use the repo_path as-is since server should return complete path
-
-	return &EnrollmentResult{
-		TenantID:     enrollmentResp.TenantID,
-		DeviceID:     enrollmentResp.DeviceID,
-		DeviceAPIKey: enrollmentResp.DeviceAPIKey,
-		RepoPath:     repoPath,
-		Password:     enrollmentResp.Password,
-	}, nil
+	return 0
 }
 
 // IsEnrolled checks if the device is already enrolled (has DeviceID)
@@ -207,3 +368,52 @@ func GetOrCreateUserID(configDir string) (string, error) {
 
 	return userID, nil
 }
+
+// GetOrCreateDeviceUUID returns the random UUID identifying this installation, creating
+// and storing it in configDir/device_uuid on first use. Unlike the server-assigned device
+// ID, it survives re-enrollment.
+func GetOrCreateDeviceUUID(configDir string) (string, error) {
+	uuidFile := filepath.Join(configDir, "device_uuid")
+
+	if data, err := os.ReadFile(uuidFile); err == nil {
+		if id := strings.TrimSpace(string(data)); validUUID(id) {
+			return id, nil
+		}
+	}
+
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("generate device UUID: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40 // Version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	id := fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+
+	if err := os.MkdirAll(configDir, 0o700); err != nil {
+		return "", fmt.Errorf("create config dir: %w", err)
+	}
+	if err := fsutil.WriteFileAtomic(uuidFile, []byte(id+"\n"), 0o600); err != nil {
+		return "", fmt.Errorf("write device UUID: %w", err)
+	}
+	return id, nil
+}
+
+// validUUID reports whether s looks like a UUID (8-4-4-4-12 hex digits)
+func validUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+package enroll
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// enrollServer answers the first failures requests with status, then enrolls the device
+func enrollServer(t *testing.T, failures int32, status int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		if r.URL.Path != "/control/v1/install" || r.Header.Get("Authorization") != "Bearer install-token" {
+			t.Errorf("request %d: %s %s with Authorization %q", n, r.Method, r.URL.Path, r.Header.Get("Authorization"))
+		}
+		if n <= failures {
+			http.Error(w, "try again later", status)
+			return
+		}
+		json.NewEncoder(w).Encode(EnrollmentResponse{
+			TenantID:     "tenant-1",
+			DeviceID:     "dev-1",
+			DeviceAPIKey: "device-key",
+			RepoPath:     "rest:https://backup.example.com/tenant-1/dev-1",
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func shortRetryDelay(t *testing.T) {
+	t.Helper()
+	saved := retryDelay
+	retryDelay = time.Millisecond
+	t.Cleanup(func() { retryDelay = saved })
+}
+
+func TestEnrollRetries(t *testing.T) {
+	shortRetryDelay(t)
+	srv, calls := enrollServer(t, 2, http.StatusServiceUnavailable)
+
+	resp, err := enrollWithRetry(srv.URL, "install-token", []byte(`{}`), 3)
+	if err != nil {
+		t.Fatalf("enrollWithRetry: %v", err)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("attempts = %d, want 3", n)
+	}
+	result, err := resultFrom(resp, "u")
+	if err != nil {
+		t.Fatalf("resultFrom: %v", err)
+	}
+	if result.TenantID != "tenant-1" || result.DeviceID != "dev-1" || result.DeviceAPIKey != "device-key" ||
+		result.RepoPath != "rest:https://backup.example.com/tenant-1/dev-1" {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestEnrollGivesUp(t *testing.T) {
+	shortRetryDelay(t)
+	srv, calls := enrollServer(t, 5, http.StatusBadGateway)
+
+	_, err := enrollWithRetry(srv.URL, "install-token", []byte(`{}`), 3)
+	if err == nil || !strings.Contains(err.Error(), "gave up after 3 attempts") {
+		t.Errorf("enrollWithRetry = %v, want it to give up after 3 attempts", err)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("attempts = %d, want 3", n)
+	}
+}
+
+func TestEnrollClientErrorNotRetried(t *testing.T) {
+	shortRetryDelay(t)
+	for _, status := range []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden} {
+		srv, calls := enrollServer(t, 1, status)
+
+		_, err := enrollWithRetry(srv.URL, "install-token", []byte(`{}`), 3)
+		if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("status %d", status)) {
+			t.Errorf("status %d: enrollWithRetry = %v, want an error", status, err)
+		}
+		if n := calls.Load(); n != 1 {
+			t.Errorf("status %d: attempts = %d, want 1", status, n)
+		}
+	}
+}
+
+func TestRepoPathFor(t *testing.T) {
+	tests := []struct {
+		name    string
+		resp    EnrollmentResponse
+		userID  string
+		want    string
+		wantErr bool
+	}{
+		{"complete repo_path", EnrollmentResponse{DeviceID: "dev-1", RepoPath: "rest:https://backup.example.com/t/dev-1/u"}, "u",
+			"rest:https://backup.example.com/t/dev-1/u", false},
+		{"repo_path ignores user", EnrollmentResponse{DeviceID: "dev-1", RepoPath: "s3:s3.example.com/bucket/dev-1"}, "",
+			"s3:s3.example.com/bucket/dev-1", false},
+		{"missing repo_path", EnrollmentResponse{DeviceID: "dev-1"}, "u", "", true},
+		{"repo_base", EnrollmentResponse{DeviceID: "dev-1", RepoBase: "rest:https://backup.example.com/t", AppendUserPath: true}, "alice",
+			"rest:https://backup.example.com/t/dev-1/alice", false},
+		{"repo_base with trailing slash", EnrollmentResponse{DeviceID: "dev-1", RepoBase: "rest:https://backup.example.com/t/", AppendUserPath: true}, "alice",
+			"rest:https://backup.example.com/t/dev-1/alice", false},
+		{"repo_base wins over repo_path", EnrollmentResponse{DeviceID: "dev-1", RepoPath: "rest:https://old.example.com/x", RepoBase: "rest:https://backup.example.com/t", AppendUserPath: true}, "alice",
+			"rest:https://backup.example.com/t/dev-1/alice", false},
+		{"username with spaces", EnrollmentResponse{DeviceID: "dev-1", RepoBase: "rest:https://backup.example.com/t", AppendUserPath: true}, "john doe",
+			"rest:https://backup.example.com/t/dev-1/john%20doe", false},
+		{"Windows domain user", EnrollmentResponse{DeviceID: "dev 1", RepoBase: "rest:https://backup.example.com/t", AppendUserPath: true}, `CORP\jdoe`,
+			"rest:https://backup.example.com/t/dev%201/CORP%5Cjdoe", false},
+		{"missing repo_base", EnrollmentResponse{DeviceID: "dev-1", RepoPath: "rest:https://backup.example.com/t", AppendUserPath: true}, "alice", "", true},
+		{"missing user", EnrollmentResponse{DeviceID: "dev-1", RepoBase: "rest:https://backup.example.com/t", AppendUserPath: true}, "", "", true},
+	}
+	for _, tt := range tests {
+		got, err := repoPathFor(&tt.resp, tt.userID)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%s: repoPathFor = %q, %v; want %q (error: %v)", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package enroll
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sysinfoTimeout bounds each external command used to collect device inventory
+const sysinfoTimeout = 5 * time.Second
+
+// cmdOutput runs name with args and returns its trimmed stdout ("" on any error)
+func cmdOutput(name string, args ...string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), sysinfoTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, name, args...).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// powershell runs a PowerShell command and returns its trimmed output ("" on any error)
+func powershell(command string) string {
+	return cmdOutput("powershell", "-NoProfile", "-NonInteractive", "-Command", command)
+}
+
+// osVersion returns the OS release and build, e.g. "14.5 (23F79)" on macOS or
+// "Ubuntu 24.04 LTS (6.8.0-45-generic)" on Linux
+func osVersion() string {
+	switch runtime.GOOS {
+	case "darwin":
+		v := cmdOutput("sw_vers", "-productVersion")
+		if b := cmdOutput("sw_vers", "-buildVersion"); v != "" && b != "" {
+			v += " (" + b + ")"
+		}
+		return v
+	case "linux":
+		v := osReleaseName("/etc/os-release")
+		if k := cmdOutput("uname", "-r"); k != "" {
+			if v == "" {
+				return k
+			}
+			v += " (" + k + ")"
+		}
+		return v
+	case "windows":
+		// "Microsoft Windows [Version 10.0.22631.4317]"
+		if m := regexp.MustCompile(`\[Version ([0-9.]+)\]`).FindStringSubmatch(cmdOutput("cmd", "/c", "ver")); m != nil {
+			return m[1]
+		}
+		return ""
+	default:
+		return cmdOutput("uname", "-r")
+	}
+}
+
+// osReleaseName returns PRETTY_NAME from an os-release file
+func osReleaseName(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if v, ok := strings.CutPrefix(sc.Text(), "PRETTY_NAME="); ok {
+			return strings.Trim(v, `"'`)
+		}
+	}
+	return ""
+}
+
+// totalMemory returns the installed RAM in bytes (0 if unknown)
+func totalMemory() int64 {
+	var s string
+	switch runtime.GOOS {
+	case "darwin":
+		s = cmdOutput("sysctl", "-n", "hw.memsize")
+	case "linux":
+		return memTotalLinux("/proc/meminfo")
+	case "windows":
+		s = powershell("(Get-CimInstance Win32_ComputerSystem).TotalPhysicalMemory")
+	default:
+		s = cmdOutput("sysctl", "-n", "hw.physmem")
+	}
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
+
+// memTotalLinux parses "MemTotal:  16303740 kB" from /proc/meminfo
+func memTotalLinux(path string) int64 {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kib, _ := strconv.ParseInt(fields[1], 10, 64)
+			return kib * 1024
+		}
+	}
+	return 0
+}
+
+// serialNumber returns the machine's hardware serial number where the OS exposes it to
+// unprivileged users ("" otherwise; on Linux the DMI serial is usually root-only)
+func serialNumber() string {
+	var s string
+	switch runtime.GOOS {
+	case "darwin":
+		// "IOPlatformSerialNumber" = "C02XXXXXXXXX"
+		m := regexp.MustCompile(`"IOPlatformSerialNumber" = "([^"]*)"`).FindStringSubmatch(
+			cmdOutput("ioreg", "-rd1", "-c", "IOPlatformExpertDevice"))
+		if m != nil {
+			s = m[1]
+		}
+	case "linux":
+		if b, err := os.ReadFile("/sys/class/dmi/id/product_serial"); err == nil {
+			s = strings.TrimSpace(string(b))
+		}
+	case "windows":
+		s = powershell("(Get-CimInstance Win32_BIOS).SerialNumber")
+	default:
+		s = cmdOutput("kenv", "-q", "smbios.system.serial")
+	}
+	// Firmware placeholders are not serials
+	switch strings.ToLower(s) {
+	case "", "0", "none", "default string", "to be filled by o.e.m.", "system serial number":
+		return ""
+	}
+	return s
+}
+
+// timezone returns the IANA time zone name (e.g. "Europe/Berlin") when it can be
+// determined, otherwise the zone abbreviation and UTC offset (e.g. "CET+01:00")
+func timezone() string {
+	if tz := os.Getenv("TZ"); tz != "" && !strings.HasPrefix(tz, ":") {
+		return tz
+	}
+	if runtime.GOOS == "windows" {
+		// Windows zone names such as "W. Europe Standard Time"
+		if name := cmdOutput("tzutil", "/g"); name != "" {
+			return name
+		}
+	} else if target, err := filepath.EvalSymlinks("/etc/localtime"); err == nil {
+		if _, name, ok := strings.Cut(target, "zoneinfo/"); ok {
+			return name
+		}
+	}
+	name, offset := time.Now().Zone()
+	sign := "+"
+	if offset < 0 {
+		sign, offset = "-", -offset
+	}
+	return name + sign + time.Unix(int64(offset), 0).UTC().Format("15:04")
+}
@@ -0,0 +1,102 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+// dirEntries returns the names in dir
+func dirEntries(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteFileAtomic(path, []byte("new contents"), 0o600); err != nil {
+		t.Fatalf("WriteFileAtomic: %v", err)
+	}
+	if got, err := os.ReadFile(path); err != nil || string(got) != "new contents" {
+		t.Errorf("file = %q, %v; want the new contents", got, err)
+	}
+	if runtime.GOOS != "windows" {
+		if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+			t.Errorf("mode = %v, %v; want 0600", info.Mode().Perm(), err)
+		}
+	}
+	if names := dirEntries(t, dir); !slices.Equal(names, []string{"config.json"}) {
+		t.Errorf("directory holds %q, want only config.json (no temp file)", names)
+	}
+}
+
+func TestWriteFileAtomicFailedRename(t *testing.T) {
+	dir := t.TempDir()
+	// A non-empty directory can't be replaced by a file, so the final rename fails
+	path := filepath.Join(dir, "state")
+	if err := os.Mkdir(path, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(path, "last_run.json"), []byte("old"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteFileAtomic(path, []byte("new"), 0o600); err == nil {
+		t.Fatal("WriteFileAtomic over a directory: want an error")
+	}
+	if got, err := os.ReadFile(filepath.Join(path, "last_run.json")); err != nil || string(got) != "old" {
+		t.Errorf("original = %q, %v; want it untouched", got, err)
+	}
+	if names := dirEntries(t, dir); !slices.Equal(names, []string{"state"}) {
+		t.Errorf("directory holds %q, want the temp file removed", names)
+	}
+}
+
+func TestWriteFileAtomicUnwritableDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("directory permissions are not enforced on Windows")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, []byte("old"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(dir, 0o500); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(dir, 0o700) })
+	if f, err := os.CreateTemp(dir, "probe"); err == nil {
+		f.Close()
+		os.Remove(f.Name())
+		t.Skip("directory is still writable (running as root?)")
+	}
+
+	if err := WriteFileAtomic(path, []byte("new"), 0o600); err == nil {
+		t.Fatal("WriteFileAtomic in a read-only directory: want an error")
+	}
+	if got, err := os.ReadFile(path); err != nil || string(got) != "old" {
+		t.Errorf("original = %q, %v; want it untouched", got, err)
+	}
+}
+
+func TestWriteFileAtomicMissingDir(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "config.json")
+	if err := WriteFileAtomic(path, []byte("new"), 0o600); err == nil {
+		t.Error("WriteFileAtomic in a missing directory: want an error")
+	}
+}
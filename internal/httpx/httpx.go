@@ -0,0 +1,241 @@
+package httpx
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"xentz-agent/internal/validation"
+)
+
+// Request timeout for control plane calls: DefaultTimeout unless configured, clamped to MinTimeout-MaxTimeout
+const (
+	DefaultTimeout = 30 * time.Second
+	MinTimeout     = 5 * time.Second
+	MaxTimeout     = 300 * time.Second
+)
+
+// maxRedirects caps how many redirects a control plane request follows
+const maxRedirects = 5
+
+// Options configure TLS and proxying for control plane requests
+type Options struct {
+	CACertFile     string // PEM bundle trusted in addition to the system roots
+	ClientCertFile string // PEM client certificate for mutual TLS (requires ClientKeyFile)
+	ClientKeyFile  string
+	// SHA-256 fingerprint of the server's leaf certificate. When set, only that certificate is
+	// accepted (instead of verifying the CA chain). Not compatible with https:// proxies.
+	ServerCertFingerprint string
+
+	// Proxy for all requests, overriding HTTP_PROXY/HTTPS_PROXY/NO_PROXY (which apply otherwise)
+	ProxyURL string
+
+	// Check server URLs and redirects with validation.ValidateServerURLStrict (no private IPs)
+	StrictServerValidation bool
+	// Also resolve server hostnames and reject ones pointing at blocked addresses
+	ResolveServerHost bool
+
+	// Request timeout (0 = DefaultTimeout), clamped to MinTimeout-MaxTimeout
+	Timeout time.Duration
+}
+
+// ErrProxy is wrapped by errors reaching or negotiating with the proxy, as opposed to the server
+var ErrProxy = errors.New("proxy connection failed")
+
+// ErrRedirectRefused is wrapped when a redirect points at a URL that fails SSRF validation
+var ErrRedirectRefused = errors.New("refusing redirect")
+
+var (
+	mu        sync.Mutex
+	transport http.RoundTripper
+	external  http.RoundTripper // For ExternalClient: proxy only, system TLS roots
+	strict    bool
+	resolve   bool
+	timeout   = DefaultTimeout
+)
+
+func init() {
+	transport, _ = newTransport(Options{}) // Can't fail without options
+	external = transport
+}
+
+// Configure sets the TLS, proxy and URL validation options used by every client returned from Client.
+// It is called once the local config is known; until then Client uses the system defaults.
+func Configure(opts Options) error {
+	t, err := newTransport(opts)
+	if err != nil {
+		return err
+	}
+	ext, err := newTransport(Options{ProxyURL: opts.ProxyURL})
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	transport = t
+	external = ext
+	strict = opts.StrictServerValidation
+	resolve = opts.ResolveServerHost
+	timeout = ClampTimeout(opts.Timeout)
+	mu.Unlock()
+	return nil
+}
+
+// ValidateServerURL checks serverURL against SSRF with validation.ValidateServerURL,
+// or validation.ValidateServerURLStrict when strict validation is configured
+// (validation.ValidateResolvedServerURL when host resolution is configured)
+func ValidateServerURL(serverURL string) error {
+	mu.Lock()
+	useStrict, useResolve := strict, resolve
+	mu.Unlock()
+	if useResolve {
+		return validation.ValidateResolvedServerURL(serverURL, useStrict)
+	}
+	if useStrict {
+		return validation.ValidateServerURLStrict(serverURL)
+	}
+	return validation.ValidateServerURL(serverURL)
+}
+
+// Client returns an HTTP client for control plane requests with the configured timeout.
+// Redirects are followed only to URLs that pass the same SSRF checks as the server URL.
+func Client() *http.Client {
+	mu.Lock()
+	defer mu.Unlock()
+	return &http.Client{
+		Timeout:       timeout,
+		Transport:     transport,
+		CheckRedirect: checkRedirect,
+	}
+}
+
+// ExternalClient is like Client, but for third-party endpoints such as notification webhooks:
+// it uses the configured proxy, but none of the control plane's TLS settings (CA bundle,
+// client certificate, certificate pin)
+func ExternalClient() *http.Client {
+	mu.Lock()
+	defer mu.Unlock()
+	return &http.Client{
+		Timeout:       timeout,
+		Transport:     external,
+		CheckRedirect: checkRedirect,
+	}
+}
+
+// checkRedirect refuses redirect chains longer than maxRedirects and redirects to blocked hosts
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if err := ValidateServerURL(req.URL.String()); err != nil {
+		return fmt.Errorf("%w to %s: %w", ErrRedirectRefused, req.URL.Redacted(), err)
+	}
+	return nil
+}
+
+// ClampTimeout returns d limited to MinTimeout-MaxTimeout, or DefaultTimeout if d is 0
+func ClampTimeout(d time.Duration) time.Duration {
+	if d == 0 {
+		return DefaultTimeout
+	}
+	return min(max(d, MinTimeout), MaxTimeout)
+}
+
+// ValidateProxyURL checks that proxyURL is an absolute http, https or socks5 URL
+func ValidateProxyURL(proxyURL string) error {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return fmt.Errorf("invalid proxy URL %q: scheme must be http, https or socks5", proxyURL)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid proxy URL %q: missing host", proxyURL)
+	}
+	return nil
+}
+
+// proxyErrorTransport marks failures to reach the proxy with ErrProxy so callers can tell them
+// apart (a refused CONNECT is marked by newTransport's OnProxyConnectResponse)
+type proxyErrorTransport struct {
+	base http.RoundTripper
+}
+
+func (t proxyErrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	var opErr *net.OpError
+	if err != nil && errors.As(err, &opErr) && opErr.Op == "proxyconnect" {
+		return nil, fmt.Errorf("%w: %w", ErrProxy, err)
+	}
+	return resp, err
+}
+
+func newTransport(opts Options) (http.RoundTripper, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.ProxyURL != "" {
+		if err := ValidateProxyURL(opts.ProxyURL); err != nil {
+			return nil, err
+		}
+		proxy, _ := url.Parse(opts.ProxyURL) // Validated above
+		t.Proxy = http.ProxyURL(proxy)
+	}
+	t.OnProxyConnectResponse = func(_ context.Context, proxyURL *url.URL, _ *http.Request, res *http.Response) error {
+		if res.StatusCode != http.StatusOK {
+			return fmt.Errorf("%w: %s refused CONNECT: %s", ErrProxy, proxyURL.Redacted(), res.Status)
+		}
+		return nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if opts.CACertFile != "" {
+		pem, err := os.ReadFile(opts.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA certificate: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in %s", opts.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if opts.ServerCertFingerprint != "" {
+		pin, err := ParseFingerprint(opts.ServerCertFingerprint)
+		if err != nil {
+			return nil, err
+		}
+		// The proxy's TLS handshake would be checked against the pin too
+		if strings.HasPrefix(opts.ProxyURL, "https:") {
+			return nil, fmt.Errorf("a pinned server certificate can't be used with an https:// proxy")
+		}
+		// Chain and hostname checks are replaced by the pin (VerifyConnection still runs)
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = pinVerifier(pin)
+	}
+	if opts.ClientCertFile != "" || opts.ClientKeyFile != "" {
+		if opts.ClientCertFile == "" || opts.ClientKeyFile == "" {
+			return nil, fmt.Errorf("client certificate and key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.ClientCertFile, opts.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	t.TLSClientConfig = tlsConfig
+	return proxyErrorTransport{base: t}, nil
+}
@@ -0,0 +1,143 @@
+package httpx
+
+import (
+	"encoding/pem"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// configure applies opts for the test and restores the defaults afterwards
+func configure(t *testing.T, opts Options) {
+	t.Helper()
+	if err := Configure(opts); err != nil {
+		t.Fatalf("Configure(%+v): %v", opts, err)
+	}
+	t.Cleanup(func() { Configure(Options{}) })
+}
+
+func clientGet(url string) error {
+	resp, err := Client().Get(url)
+	if err == nil {
+		resp.Body.Close()
+	}
+	return err
+}
+
+func TestCACertFile(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(srv.Close)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The system roots don't know the test server's self-signed certificate
+	configure(t, Options{})
+	if err := clientGet(srv.URL); !IsTLSError(err) {
+		t.Errorf("request without the CA bundle = %v, want a certificate verification error", err)
+	}
+
+	configure(t, Options{CACertFile: caFile})
+	if err := clientGet(srv.URL); err != nil {
+		t.Errorf("request trusting the CA bundle: %v", err)
+	}
+
+	notPEM := filepath.Join(t.TempDir(), "ca.txt")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Configure(Options{CACertFile: notPEM}); err == nil {
+		t.Error("Configure with a file without certificates: want an error")
+	}
+	if err := Configure(Options{CACertFile: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+		t.Error("Configure with a missing CA file: want an error")
+	}
+}
+
+func TestProxyURL(t *testing.T) {
+	var forwarded, connects atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodConnect:
+			// Refuse tunnels, like a proxy requiring authentication
+			connects.Add(1)
+			w.WriteHeader(http.StatusProxyAuthRequired)
+		case r.URL.Host == "control.example.com":
+			forwarded.Add(1)
+			w.Write([]byte("via proxy"))
+		default:
+			t.Errorf("unexpected proxied request %s %s", r.Method, r.URL)
+		}
+	}))
+	t.Cleanup(proxy.Close)
+
+	configure(t, Options{ProxyURL: proxy.URL})
+	if err := clientGet("http://control.example.com/control/v1/config"); err != nil {
+		t.Errorf("request through the proxy: %v", err)
+	}
+	if n := forwarded.Load(); n != 1 {
+		t.Errorf("proxy forwarded %d requests, want 1", n)
+	}
+
+	err := clientGet("https://control.example.com/control/v1/config")
+	if !errors.Is(err, ErrProxy) {
+		t.Errorf("request through a proxy refusing CONNECT = %v, want ErrProxy", err)
+	}
+	if n := connects.Load(); n != 1 {
+		t.Errorf("proxy got %d CONNECT requests, want 1", n)
+	}
+}
+
+func TestProxyUnreachable(t *testing.T) {
+	// A port nothing listens on any more
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	configure(t, Options{ProxyURL: "http://" + addr})
+	if err := clientGet("http://control.example.com/control/v1/config"); !errors.Is(err, ErrProxy) {
+		t.Errorf("request through an unreachable proxy = %v, want ErrProxy", err)
+	}
+}
+
+func TestRedirectToBlockedHost(t *testing.T) {
+	for _, target := range []string{
+		"http://169.254.169.254/latest/meta-data/",
+		"http://127.0.0.1:8080/admin",
+		"http://localhost/admin",
+		"http://[::1]/admin",
+	} {
+		// The test server itself is on loopback: only the redirect goes through checkRedirect
+		srv := httptest.NewServer(http.RedirectHandler(target, http.StatusFound))
+		err := clientGet(srv.URL)
+		srv.Close()
+		if !errors.Is(err, ErrRedirectRefused) {
+			t.Errorf("redirect to %s = %v, want ErrRedirectRefused", target, err)
+		}
+	}
+}
+
+func TestRedirectLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://control.example.com/loop", http.StatusFound)
+	}))
+	t.Cleanup(srv.Close)
+	// Route the allowed redirect target back to the test server
+	configure(t, Options{ProxyURL: srv.URL})
+
+	err := clientGet("http://control.example.com/start")
+	if err == nil || !strings.Contains(err.Error(), "stopped after 5 redirects") {
+		t.Errorf("redirect loop = %v, want it stopped after %d redirects", err, maxRedirects)
+	}
+}
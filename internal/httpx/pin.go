@@ -0,0 +1,117 @@
+package httpx
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// ErrCertMismatch is returned when the server's certificate doesn't match the pinned fingerprint
+var ErrCertMismatch = errors.New("server certificate does not match the pinned server_cert_fingerprint")
+
+// IsTLSError reports whether err is a TLS handshake or certificate verification failure
+func IsTLSError(err error) bool {
+	var (
+		verifyErr    *tls.CertificateVerificationError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+		recordErr    tls.RecordHeaderError
+		alertErr     tls.AlertError
+	)
+	if err == nil {
+		return false
+	}
+	// net/http replaces the RecordHeaderError of a plain HTTP server with a bare error
+	if strings.Contains(err.Error(), "server gave HTTP response to HTTPS client") {
+		return true
+	}
+	return errors.Is(err, ErrCertMismatch) ||
+		errors.As(err, &verifyErr) || errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) ||
+		errors.As(err, &invalidErr) || errors.As(err, &recordErr) || errors.As(err, &alertErr)
+}
+
+// ParseFingerprint decodes a SHA-256 certificate fingerprint written as hex, with or without
+// colons and an optional "sha256:" prefix (e.g. the output of openssl x509 -fingerprint -sha256)
+func ParseFingerprint(s string) ([]byte, error) {
+	h := strings.ToLower(strings.TrimSpace(s))
+	h = strings.TrimPrefix(h, "sha256:")
+	h = strings.TrimPrefix(h, "sha256 fingerprint=")
+	h = strings.NewReplacer(":", "", " ", "").Replace(h)
+	b, err := hex.DecodeString(h)
+	if err != nil || len(b) != sha256.Size {
+		return nil, fmt.Errorf("invalid SHA-256 fingerprint %q: expected 64 hex digits", s)
+	}
+	return b, nil
+}
+
+// Fingerprint returns the SHA-256 fingerprint of cert as colon-separated uppercase hex
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// pinVerifier returns a VerifyConnection callback accepting only a leaf certificate with
+// the given SHA-256 fingerprint. It replaces CA chain verification, so a pinned server may
+// use a self-signed certificate.
+func pinVerifier(pin []byte) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return fmt.Errorf("server presented no certificate")
+		}
+		leaf := cs.PeerCertificates[0]
+		sum := sha256.Sum256(leaf.Raw)
+		if !bytes.Equal(sum[:], pin) {
+			return fmt.Errorf("%w (got %s)", ErrCertMismatch, Fingerprint(leaf))
+		}
+		return nil
+	}
+}
+
+// ServerCertificate connects directly to serverURL (an https URL) and returns its leaf
+// certificate without verifying it, so an admin can check and pin its fingerprint
+func ServerCertificate(ctx context.Context, serverURL string) (*x509.Certificate, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server URL: %w", err)
+	}
+	if u.Scheme != "https" || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid server URL %q: expected https://host", serverURL)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	mu.Lock()
+	d := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: timeout},
+		Config: &tls.Config{
+			ServerName:         u.Hostname(),
+			InsecureSkipVerify: true, // Only reading the certificate; nothing is sent
+		},
+	}
+	mu.Unlock()
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", u.Host, err)
+	}
+	defer conn.Close()
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%s presented no certificate", u.Host)
+	}
+	return certs[0], nil
+}
@@ -0,0 +1,78 @@
+package httpx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseFingerprint(t *testing.T) {
+	sum := sha256.Sum256([]byte("certificate"))
+	plain := hex.EncodeToString(sum[:])
+	var colons []string
+	for i := 0; i < len(plain); i += 2 {
+		colons = append(colons, strings.ToUpper(plain[i:i+2]))
+	}
+	colon := strings.Join(colons, ":")
+
+	for _, s := range []string{
+		plain,
+		strings.ToUpper(plain),
+		colon,
+		"sha256:" + plain,
+		"SHA256:" + colon,
+		"sha256 Fingerprint=" + colon, // openssl x509 -noout -fingerprint -sha256
+		"  " + colon + "\n",
+	} {
+		got, err := ParseFingerprint(s)
+		if err != nil || !bytes.Equal(got, sum[:]) {
+			t.Errorf("ParseFingerprint(%q) = %x, %v; want %x", s, got, err, sum)
+		}
+	}
+
+	for _, s := range []string{"", plain[:62], plain + "00", "zz" + plain[2:], "sha1:" + plain} {
+		if _, err := ParseFingerprint(s); err == nil {
+			t.Errorf("ParseFingerprint(%q): want an error", s)
+		}
+	}
+}
+
+func TestPinnedServerCertificate(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(srv.Close)
+	get := func(fingerprint string) error {
+		transport, err := newTransport(Options{ServerCertFingerprint: fingerprint})
+		if err != nil {
+			t.Fatalf("newTransport: %v", err)
+		}
+		resp, err := (&http.Client{Transport: transport}).Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	// The self-signed test certificate is accepted when pinned
+	if err := get(Fingerprint(srv.Certificate())); err != nil {
+		t.Errorf("request with the matching pin: %v", err)
+	}
+
+	other := sha256.Sum256([]byte("another certificate"))
+	err := get(hex.EncodeToString(other[:]))
+	if !errors.Is(err, ErrCertMismatch) {
+		t.Errorf("request with a mismatched pin = %v, want ErrCertMismatch", err)
+	}
+	if !IsTLSError(err) {
+		t.Errorf("IsTLSError(%v) = false", err)
+	}
+
+	// Without a pin the untrusted certificate is rejected by chain verification
+	if err := get(""); !IsTLSError(err) || errors.Is(err, ErrCertMismatch) {
+		t.Errorf("request without a pin = %v, want a certificate verification error", err)
+	}
+}
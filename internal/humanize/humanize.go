@@ -0,0 +1,35 @@
+package humanize
+
+import "fmt"
+
+// Bytes formats n with binary units (powers of 1024), e.g. "11.8 MiB"
+func Bytes(n int64) string {
+	return format(n, 1024, "KMGTPE", "i")
+}
+
+// BytesSI formats n with SI units (powers of 1000), e.g. "12.3 MB"
+func BytesSI(n int64) string {
+	return format(n, 1000, "kMGTPE", "")
+}
+
+func format(n int64, unit uint64, prefixes, infix string) string {
+	sign, abs := "", uint64(n)
+	if n < 0 {
+		sign, abs = "-", -uint64(n) // Also correct for math.MinInt64
+	}
+	if abs < unit {
+		return fmt.Sprintf("%s%d B", sign, abs)
+	}
+	div, exp := unit, 0
+	for m := abs / unit; m >= unit && exp < len(prefixes)-1; m /= unit {
+		div *= unit
+		exp++
+	}
+	value := float64(abs) / float64(div)
+	// Move up a unit rather than print e.g. "1024.0 KiB"
+	if value >= float64(unit)-0.05 && exp < len(prefixes)-1 {
+		value /= float64(unit)
+		exp++
+	}
+	return fmt.Sprintf("%s%.1f %c%sB", sign, value, prefixes[exp], infix)
+}
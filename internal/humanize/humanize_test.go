@@ -0,0 +1,54 @@
+package humanize
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1, "1 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{1<<20 - 1, "1.0 MiB"}, // Not "1024.0 KiB"
+		{1 << 20, "1.0 MiB"},
+		{12345678, "11.8 MiB"},
+		{1<<30 + 1<<29, "1.5 GiB"},
+		{1 << 40, "1.0 TiB"},
+		{1 << 50, "1.0 PiB"},
+		{math.MaxInt64, "8.0 EiB"},
+		{-1536, "-1.5 KiB"},
+		{math.MinInt64, "-8.0 EiB"},
+	}
+	for _, tt := range tests {
+		if got := Bytes(tt.n); got != tt.want {
+			t.Errorf("Bytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestBytesSI(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{999, "999 B"},
+		{1000, "1.0 kB"},
+		{1024, "1.0 kB"},
+		{1500, "1.5 kB"},
+		{999_999, "1.0 MB"},
+		{12_345_678, "12.3 MB"},
+		{1_000_000_000_000, "1.0 TB"},
+	}
+	for _, tt := range tests {
+		if got := BytesSI(tt.n); got != tt.want {
+			t.Errorf("BytesSI(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
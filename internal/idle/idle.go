@@ -0,0 +1,128 @@
+// Package idle measures how long the user has been idle (no keyboard or mouse input), so
+// backups can wait until the machine is not in use.
+package idle
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Detector returns how long the user has been idle
+type Detector func(ctx context.Context) (time.Duration, error)
+
+// Default is the platform's idle time detector. It can be replaced, e.g. by tests or
+// by platforms with a better source.
+var Default Detector = systemIdleTime
+
+// WaitUntil polls detect every poll interval until the user has been idle for threshold,
+// and reports whether that happened before maxWait elapsed. A detector error ends the wait
+// (as if idle) so an unsupported platform never holds up a backup.
+func WaitUntil(ctx context.Context, detect Detector, threshold, maxWait, poll time.Duration) (bool, error) {
+	deadline := time.Now().Add(maxWait)
+	for {
+		idle, err := detect(ctx)
+		if err != nil {
+			return true, err
+		}
+		if idle >= threshold {
+			return true, nil
+		}
+		if !time.Now().Before(deadline) {
+			return false, nil
+		}
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(min(poll, time.Until(deadline))):
+		}
+	}
+}
+
+// detectTimeout bounds the external commands used for detection
+const detectTimeout = 10 * time.Second
+
+func systemIdleTime(ctx context.Context) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, detectTimeout)
+	defer cancel()
+
+	switch runtime.GOOS {
+	case "darwin":
+		out, err := exec.CommandContext(ctx, "ioreg", "-c", "IOHIDSystem", "-d", "4").Output()
+		if err != nil {
+			return 0, fmt.Errorf("ioreg: %w", err)
+		}
+		return parseHIDIdleTime(string(out))
+	case "windows":
+		return idleTimeWindows()
+	case "linux":
+		// xprintidle needs an X display; logind covers Wayland and sessions without DISPLAY
+		if os.Getenv("DISPLAY") != "" {
+			if out, err := exec.CommandContext(ctx, "xprintidle").Output(); err == nil {
+				return parseXprintidle(string(out))
+			}
+		}
+		out, err := exec.CommandContext(ctx, "loginctl", "show-user", strconv.Itoa(os.Getuid()),
+			"-p", "IdleHint", "-p", "IdleSinceHint").Output()
+		if err != nil {
+			return 0, fmt.Errorf("loginctl: %w", err)
+		}
+		return parseLogindIdle(string(out), time.Now())
+	default:
+		return 0, fmt.Errorf("idle detection is not supported on %s", runtime.GOOS)
+	}
+}
+
+// parseHIDIdleTime extracts HIDIdleTime (nanoseconds) from `ioreg -c IOHIDSystem` output,
+// e.g. `    | |   "HIDIdleTime" = 1234567890`
+func parseHIDIdleTime(out string) (time.Duration, error) {
+	for _, line := range strings.Split(out, "\n") {
+		_, value, ok := strings.Cut(line, `"HIDIdleTime" = `)
+		if !ok {
+			continue
+		}
+		ns, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("parse HIDIdleTime %q: %w", strings.TrimSpace(value), err)
+		}
+		return time.Duration(ns), nil
+	}
+	return 0, fmt.Errorf("HIDIdleTime not found in ioreg output")
+}
+
+// parseXprintidle parses xprintidle's output: the idle time in milliseconds
+func parseXprintidle(out string) (time.Duration, error) {
+	ms, err := strconv.ParseInt(strings.TrimSpace(out), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse xprintidle output %q: %w", strings.TrimSpace(out), err)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// parseLogindIdle parses `loginctl show-user -p IdleHint -p IdleSinceHint` output.
+// IdleSinceHint is in microseconds since the epoch; a user that is not idle has been idle 0s.
+func parseLogindIdle(out string, now time.Time) (time.Duration, error) {
+	props := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(line), "="); ok {
+			props[key] = value
+		}
+	}
+	switch props["IdleHint"] {
+	case "no":
+		return 0, nil
+	case "yes":
+	default:
+		return 0, fmt.Errorf("logind did not report IdleHint")
+	}
+	us, err := strconv.ParseInt(props["IdleSinceHint"], 10, 64)
+	if err != nil || us <= 0 {
+		return 0, fmt.Errorf("logind did not report IdleSinceHint")
+	}
+	return max(now.Sub(time.UnixMicro(us)), 0), nil
+}
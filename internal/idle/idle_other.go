@@ -0,0 +1,12 @@
+//go:build !windows
+
+package idle
+
+import (
+	"fmt"
+	"time"
+)
+
+func idleTimeWindows() (time.Duration, error) {
+	return 0, fmt.Errorf("GetLastInputInfo is only available on Windows")
+}
@@ -0,0 +1,32 @@
+package idle
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var (
+	user32               = syscall.NewLazyDLL("user32.dll")
+	kernel32             = syscall.NewLazyDLL("kernel32.dll")
+	procGetLastInputInfo = user32.NewProc("GetLastInputInfo")
+	procGetTickCount     = kernel32.NewProc("GetTickCount")
+)
+
+// lastInputInfo mirrors the Win32 LASTINPUTINFO structure
+type lastInputInfo struct {
+	cbSize uint32
+	dwTime uint32
+}
+
+func idleTimeWindows() (time.Duration, error) {
+	info := lastInputInfo{cbSize: uint32(unsafe.Sizeof(lastInputInfo{}))}
+	ret, _, err := procGetLastInputInfo.Call(uintptr(unsafe.Pointer(&info)))
+	if ret == 0 {
+		return 0, fmt.Errorf("GetLastInputInfo: %w", err)
+	}
+	now, _, _ := procGetTickCount.Call()
+	// Both are milliseconds since boot in 32 bits; unsigned subtraction handles the 49-day wrap
+	return time.Duration(uint32(now)-info.dwTime) * time.Millisecond, nil
+}
@@ -0,0 +1,66 @@
+package install
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"xentz-agent/internal/config"
+)
+
+// isBSD reports whether goos is one of the BSDs scheduled through cron
+func isBSD(goos string) bool {
+	return goos == "freebsd" || goos == "openbsd"
+}
+
+// BSDCronInstall schedules the agent with the user's crontab on FreeBSD and OpenBSD
+func BSDCronInstall(configPath string) error {
+	if !isBSD(runtime.GOOS) {
+		return fmt.Errorf("BSDCronInstall can only run on FreeBSD or OpenBSD")
+	}
+
+	// Read config to get schedule time (HH:MM) and profiles
+	cfg, err := config.Read(configPath)
+	if err != nil {
+		return err
+	}
+	jobs, err := scheduledJobs(configPath, cfg)
+	if err != nil {
+		return err
+	}
+
+	exePath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if !filepath.IsAbs(exePath) {
+		absPath, err := filepath.Abs(exePath)
+		if err != nil {
+			return fmt.Errorf("get absolute path: %w", err)
+		}
+		exePath = absPath
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(home, ".xentz-agent", "logs"), 0o700); err != nil {
+		return err
+	}
+
+	// Start from a clean slate so changed schedules don't leave old entries behind
+	if err := uninstallCron(); err != nil {
+		return fmt.Errorf("remove existing crontab entries: %w", err)
+	}
+	return installCron(exePath, jobs, home)
+}
+
+// BSDCronUninstall removes the agent's crontab entries
+func BSDCronUninstall(configPath string) error {
+	if !isBSD(runtime.GOOS) {
+		return fmt.Errorf("BSDCronUninstall can only run on FreeBSD or OpenBSD")
+	}
+	return uninstallCron()
+}
@@ -1,21 +1,305 @@
 package install
 
 import (
+	"cmp"
 	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
 	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"xentz-agent/internal/config"
+	"xentz-agent/internal/logx"
 )
 
+// Options control how Install registers the scheduled jobs
+type Options struct {
+	// Also run daily and interval jobs once right away; otherwise they only run on schedule
+	// (cron never runs jobs at install time)
+	RunNow bool
+	// Windows system-wide install: password of the system_user account, stored with the task
+	// (prompted for when empty; not needed for SYSTEM)
+	RunPassword string
+}
+
 // Install installs the agent scheduler for the current operating system
-func Install(configPath string) error {
+func Install(configPath string, opts Options) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return MacOSLaunchdInstall(configPath, opts)
+	case "windows":
+		return WindowsTaskSchedulerInstall(configPath, opts)
+	case "linux":
+		return LinuxSystemdInstall(configPath, opts)
+	case "freebsd", "openbsd":
+		return BSDCronInstall(configPath)
+	default:
+		return fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+}
+
+// scheduledJob is one agent invocation registered with the OS scheduler
+type scheduledJob struct {
+	suffix string   // Appended to scheduler names; empty for the default job
+	args   []string // Agent arguments after the executable path
+	hour   int
+	minute int
+
+	// Interval jobs run every interval instead of daily at hour:minute
+	interval time.Duration
+
+	// Weekly jobs run only on weekday, monthly jobs (monthDay > 0) only on that day of the month.
+	// Daily and interval jobs also run once at install/load time.
+	weekly   bool
+	weekday  time.Weekday
+	monthDay int
+
+	// Random delay before the run (systemd: RandomizedDelaySec, Task Scheduler: RandomDelay,
+	// elsewhere the agent's --jitter)
+	jitter time.Duration
+}
+
+// agentArgs returns the job's arguments for schedulers without native jitter support,
+// adding --jitter so the agent sleeps in-process before running
+func (j scheduledJob) agentArgs() []string {
+	if j.jitter <= 0 {
+		return j.args
+	}
+	args := append([]string{}, j.args...)
+	return append(args, "--jitter", j.jitter.String())
+}
+
+// runOnLoad reports whether the job should also run right after install/load.
+// Weekly and monthly jobs wait for their day.
+func (j scheduledJob) runOnLoad() bool {
+	return !j.weekly && j.monthDay == 0
+}
+
+// Defaults for the weekly retention job
+const (
+	retentionJobSuffix  = "retention"
+	defaultRetentionAt  = "03:00"
+	defaultRetentionDay = time.Sunday
+)
+
+// backupJob returns a job timed by sched: every IntervalMinutes if set, otherwise at DailyAt
+// daily, weekly or monthly according to Frequency
+func backupJob(sched config.Schedule) (scheduledJob, error) {
+	if err := config.ValidateSchedule(sched); err != nil {
+		return scheduledJob{}, err
+	}
+	if sched.IntervalMinutes != 0 {
+		return scheduledJob{interval: time.Duration(sched.IntervalMinutes) * time.Minute}, nil
+	}
+	hour, minute, err := config.ParseHHMM(sched.DailyAt)
+	if err != nil {
+		return scheduledJob{}, fmt.Errorf("daily_at %q: %w", sched.DailyAt, err)
+	}
+	job := scheduledJob{hour: hour, minute: minute}
+	switch sched.Frequency {
+	case config.FrequencyWeekly:
+		job.weekly = true
+		job.weekday, _ = config.ParseWeekday(sched.DayOfWeek) // validated above
+	case config.FrequencyMonthly:
+		job.monthDay = sched.DayOfMonth
+	}
+	return job, nil
+}
+
+// scheduledJobs returns the jobs to register for cfg: the default backup job
+// (unless only profiles are configured) plus one backup job per profile.
+func scheduledJobs(configPath string, cfg config.Config) ([]scheduledJob, error) {
+	var jobs []scheduledJob
+
+	if len(cfg.Profiles) == 0 || len(cfg.Include) > 0 {
+		job, err := backupJob(cfg.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule: %w", err)
+		}
+		job.args = []string{"backup", "--quiet", "--config", configPath}
+		jobs = append(jobs, job)
+	}
+
+	// Sort profile names so job registration order is stable
+	names := make([]string, 0, len(cfg.Profiles))
+	for name := range cfg.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := config.ValidateProfileName(name); err != nil {
+			return nil, err
+		}
+		if name == retentionJobSuffix {
+			return nil, fmt.Errorf("profile name %q is reserved for the retention job", name)
+		}
+		profileCfg, err := cfg.ForProfile(name)
+		if err != nil {
+			return nil, err
+		}
+		job, err := backupJob(profileCfg.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("profile %q: invalid schedule: %w", name, err)
+		}
+		job.suffix = name
+		job.args = []string{"backup", "--quiet", "--config", configPath, "--profile", name}
+		jobs = append(jobs, job)
+	}
+
+	// Weekly retention, when a policy is configured locally or a time was requested
+	if cfg.Schedule.RetentionWeeklyAt != "" || cfg.Retention.Configured() {
+		at := cfg.Schedule.RetentionWeeklyAt
+		if at == "" {
+			at = defaultRetentionAt
+		}
+		hour, minute, err := config.ParseHHMM(at)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --retention-at (%q): %w", at, err)
+		}
+		day := defaultRetentionDay
+		if cfg.Schedule.RetentionDay != "" {
+			day, err = config.ParseWeekday(cfg.Schedule.RetentionDay)
+			if err != nil {
+				return nil, fmt.Errorf("invalid --retention-day (%q): %w", cfg.Schedule.RetentionDay, err)
+			}
+		}
+		jobs = append(jobs, scheduledJob{
+			suffix:  retentionJobSuffix,
+			args:    []string{"retention", "--quiet", "--config", configPath},
+			hour:    hour,
+			minute:  minute,
+			weekly:  true,
+			weekday: day,
+		})
+	}
+
+	jitter := time.Duration(cfg.Schedule.JitterSeconds) * time.Second
+	for i := range jobs {
+		jobs[i].jitter = jitter
+	}
+
+	return jobs, nil
+}
+
+// SchedulerInfo is what the OS scheduler reports about the agent's jobs, in the same shape on
+// every platform
+type SchedulerInfo struct {
+	Scheduler string      `json:"scheduler"` // "systemd", "systemd (system)", "launchd", "launchd (system)", "Task Scheduler" or "cron"
+	Jobs      []JobStatus `json:"jobs"`      // Empty when nothing is registered
+}
+
+// JobStatus describes one registered job
+type JobStatus struct {
+	Name    string    `json:"name"`              // Unit, label or task name
+	Enabled bool      `json:"enabled"`           // Registered and allowed to run on schedule
+	NextRun time.Time `json:"next_run,omitzero"` // Zero when the scheduler doesn't report it
+}
+
+// SchedulerStatus queries the OS scheduler for the agent's jobs
+func SchedulerStatus() (SchedulerInfo, error) {
+	var info SchedulerInfo
+	var err error
+	switch runtime.GOOS {
+	case "darwin":
+		info, err = macOSSchedulerStatus()
+	case "windows":
+		info, err = windowsSchedulerStatus()
+	case "linux":
+		info, err = linuxSchedulerStatus()
+	case "freebsd", "openbsd":
+		info, err = cronSchedulerStatus()
+	default:
+		return SchedulerInfo{}, fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+	if info.Jobs == nil {
+		info.Jobs = []JobStatus{}
+	}
+	return info, err
+}
+
+// Uninstall removes the agent scheduler for the current operating system.
+// It is idempotent: nothing is reported as an error if the scheduler is not installed.
+func Uninstall(configPath string) error {
 	switch runtime.GOOS {
 	case "darwin":
-		return MacOSLaunchdInstall(configPath)
+		return MacOSLaunchdUninstall(configPath)
 	case "windows":
-		return WindowsTaskSchedulerInstall(configPath)
+		return WindowsTaskSchedulerUninstall(configPath)
 	case "linux":
-		return LinuxSystemdInstall(configPath)
+		return LinuxSystemdUninstall(configPath)
+	case "freebsd", "openbsd":
+		return BSDCronUninstall(configPath)
 	default:
 		return fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
 	}
 }
 
+// RequireAdmin fails unless the agent runs with the privileges a system-wide install needs:
+// root, or on Windows an elevated (administrator) prompt
+func RequireAdmin() error {
+	if runtime.GOOS == "windows" {
+		// Only administrators may query the server's sessions
+		if exec.Command("net", "session").Run() != nil {
+			return fmt.Errorf("system-wide install needs administrator rights: run it from an elevated prompt")
+		}
+		return nil
+	}
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("system-wide install needs root: run it with sudo")
+	}
+	return nil
+}
+
+// systemUser looks up the account system-wide jobs run as ("" = root)
+func systemUser(name string) (*user.User, error) {
+	u, err := user.Lookup(cmp.Or(name, "root"))
+	if err != nil {
+		return nil, fmt.Errorf("system_user: %w", err)
+	}
+	return u, nil
+}
+
+// systemLogDir creates the log directory of a system-wide install in runAs's home, owned by
+// runAs, so the agent's log rotation finds it. It warns when runAs may not be able to read
+// configPath.
+func systemLogDir(runAs *user.User, configPath string) (string, error) {
+	logDir := filepath.Join(runAs.HomeDir, ".xentz-agent", "logs")
+	if err := os.MkdirAll(logDir, 0o700); err != nil {
+		return "", err
+	}
+	uid, err := strconv.Atoi(runAs.Uid)
+	if err != nil {
+		return "", fmt.Errorf("user %s: uid %q: %w", runAs.Username, runAs.Uid, err)
+	}
+	gid, err := strconv.Atoi(runAs.Gid)
+	if err != nil {
+		return "", fmt.Errorf("user %s: gid %q: %w", runAs.Username, runAs.Gid, err)
+	}
+	for _, dir := range []string{filepath.Dir(logDir), logDir} {
+		if err := os.Chown(dir, uid, gid); err != nil {
+			return "", err
+		}
+	}
+	if uid != 0 && !strings.HasPrefix(configPath, runAs.HomeDir+string(filepath.Separator)) {
+		logx.Printf("warning: jobs run as %s, which must be able to read %s", runAs.Username, configPath)
+	}
+	return logDir, nil
+}
+
+// removeFileIfExists deletes path and logs it; a missing file is not an error
+func removeFileIfExists(path string) error {
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("remove %s: %w", path, err)
+	}
+	logx.Printf("removed %s", path)
+	return nil
+}
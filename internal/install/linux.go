@@ -4,30 +4,58 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"os/user"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
 	"xentz-agent/internal/config"
+	"xentz-agent/internal/logx"
 )
 
 const (
 	linuxServiceName = "xentz-agent"
+
+	// Comment line written above each crontab entry the agent manages
+	cronMarker = "# xentz-agent managed"
+
+	// Unit directory for system-wide installs (config "system_service")
+	systemdSystemDir = "/etc/systemd/system"
 )
 
-func LinuxSystemdInstall(configPath string) error {
+func LinuxSystemdInstall(configPath string, opts Options) error {
 	if runtime.GOOS != "linux" {
 		return fmt.Errorf("LinuxSystemdInstall can only run on Linux")
 	}
 
-	// Read config to get schedule time (HH:MM)
+	// Read config to get schedule time (HH:MM) and profiles
 	cfg, err := config.Read(configPath)
 	if err != nil {
 		return err
 	}
-	hour, minute, err := parseHHMM(cfg.Schedule.DailyAt)
+	jobs, err := scheduledJobs(configPath, cfg)
 	if err != nil {
-		return fmt.Errorf("invalid --daily-at (%q): %w", cfg.Schedule.DailyAt, err)
+		return err
+	}
+
+	var runAs *user.User
+	if cfg.SystemService {
+		if err := RequireAdmin(); err != nil {
+			return err
+		}
+		if _, err := exec.LookPath("systemctl"); err != nil {
+			return fmt.Errorf("system-wide install needs systemd (systemctl not found)")
+		}
+		if runAs, err = systemUser(cfg.SystemUser); err != nil {
+			return err
+		}
+	}
+
+	// Start from a clean slate: switching schedules (or between systemd and cron, or user and
+	// system units) must not leave an old timer or crontab line behind
+	if err := linuxRemoveExisting(); err != nil {
+		return fmt.Errorf("remove existing scheduling: %w", err)
 	}
 
 	exePath, err := os.Executable()
@@ -42,6 +70,16 @@ func LinuxSystemdInstall(configPath string) error {
 		exePath = absPath
 	}
 
+	if runAs != nil {
+		logDir, err := systemLogDir(runAs, configPath)
+		if err != nil {
+			return err
+		}
+		stdoutPath := filepath.Join(logDir, "agent.out.log")
+		stderrPath := filepath.Join(logDir, "agent.err.log")
+		return installSystemdUnits(exePath, jobs, systemdSystemDir, stdoutPath, stderrPath, runAs.Username, opts.RunNow)
+	}
+
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return err
@@ -56,11 +94,12 @@ func LinuxSystemdInstall(configPath string) error {
 
 	// Check if systemd user services are available
 	if hasSystemd() {
-		return installSystemdUserService(exePath, configPath, hour, minute, stdoutPath, stderrPath, home)
+		serviceDir := filepath.Join(home, ".config", "systemd", "user")
+		return installSystemdUnits(exePath, jobs, serviceDir, stdoutPath, stderrPath, "", opts.RunNow)
 	}
 
 	// Fallback to cron
-	return installCron(exePath, configPath, hour, minute, home)
+	return installCron(exePath, jobs, home)
 }
 
 func hasSystemd() bool {
@@ -74,47 +113,74 @@ func hasSystemd() bool {
 	return cmd.Run() == nil
 }
 
-func installSystemdUserService(exePath, configPath string, hour, minute int, stdoutPath, stderrPath, home string) error {
-	// Create systemd user service directory
-	serviceDir := filepath.Join(home, ".config", "systemd", "user")
-	if err := os.MkdirAll(serviceDir, 0o755); err != nil {
-		return fmt.Errorf("create systemd user dir: %w", err)
+// systemdUnitName returns the unit base name for a job suffix
+func systemdUnitName(suffix string) string {
+	if suffix == "" {
+		return linuxServiceName
 	}
+	return linuxServiceName + "-" + suffix
+}
 
-	serviceFile := filepath.Join(serviceDir, linuxServiceName+".service")
-	serviceContent := buildSystemdService(exePath, configPath, hour, minute, stdoutPath, stderrPath)
+// systemctl returns a systemctl command for the user manager, or the system manager with system
+func systemctl(system bool, args ...string) *exec.Cmd {
+	if !system {
+		args = append([]string{"--user"}, args...)
+	}
+	return exec.Command("systemctl", args...)
+}
 
-	if err := os.WriteFile(serviceFile, []byte(serviceContent), 0o644); err != nil {
-		return fmt.Errorf("write systemd service: %w", err)
+// installSystemdUnits writes a service and timer per job to serviceDir and starts the timers.
+// With runAs set, they are system units running as that user; otherwise user units.
+func installSystemdUnits(exePath string, jobs []scheduledJob, serviceDir, stdoutPath, stderrPath, runAs string, runNow bool) error {
+	system := runAs != ""
+	if err := os.MkdirAll(serviceDir, 0o755); err != nil {
+		return fmt.Errorf("create systemd unit dir: %w", err)
 	}
 
-	// Create timer file for scheduled execution
-	timerFile := filepath.Join(serviceDir, linuxServiceName+".timer")
-	timerContent := buildSystemdTimer(hour, minute)
+	for _, job := range jobs {
+		unit := systemdUnitName(job.suffix)
+
+		serviceFile := filepath.Join(serviceDir, unit+".service")
+		serviceContent := buildSystemdService(exePath, job.args, stdoutPath, stderrPath, runAs)
 
-	if err := os.WriteFile(timerFile, []byte(timerContent), 0o644); err != nil {
-		return fmt.Errorf("write systemd timer: %w", err)
+		if err := os.WriteFile(serviceFile, []byte(serviceContent), 0o644); err != nil {
+			return fmt.Errorf("write systemd service: %w", err)
+		}
+
+		// Create timer file for scheduled execution
+		timerFile := filepath.Join(serviceDir, unit+".timer")
+		timerContent := buildSystemdTimer(job)
+
+		if err := os.WriteFile(timerFile, []byte(timerContent), 0o644); err != nil {
+			return fmt.Errorf("write systemd timer: %w", err)
+		}
 	}
 
-	// Reload systemd user daemon
-	reloadCmd := exec.Command("systemctl", "--user", "daemon-reload")
+	// Reload the systemd manager
+	reloadCmd := systemctl(system, "daemon-reload")
 	if output, err := reloadCmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("reload systemd daemon: %w\noutput: %s", err, string(output))
 	}
 
-	// Enable and start the timer
-	enableCmd := exec.Command("systemctl", "--user", "enable", linuxServiceName+".timer")
-	if output, err := enableCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("enable systemd timer: %w\noutput: %s", err, string(output))
-	}
+	for _, job := range jobs {
+		unit := systemdUnitName(job.suffix)
 
-	startCmd := exec.Command("systemctl", "--user", "start", linuxServiceName+".timer")
-	if output, err := startCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("start systemd timer: %w\noutput: %s", err, string(output))
-	}
+		// Enable and start the timer
+		enableCmd := systemctl(system, "enable", unit+".timer")
+		if output, err := enableCmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("enable systemd timer: %w\noutput: %s", err, string(output))
+		}
+
+		startCmd := systemctl(system, "start", unit+".timer")
+		if output, err := startCmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("start systemd timer: %w\noutput: %s", err, string(output))
+		}
 
-	// Run the service once immediately
-	_ = exec.Command("systemctl", "--user", "start", linuxServiceName+".service").Run()
+		// Run daily jobs once immediately (never an unplanned retention/prune)
+		if runNow && job.runOnLoad() {
+			_ = systemctl(system, "start", unit+".service").Run()
+		}
+	}
 
 	return nil
 }
@@ -145,39 +211,64 @@ func escapeSystemdPath(path string) string {
 	return result.String()
 }
 
-func buildSystemdService(exePath, configPath string, hour, minute int, stdoutPath, stderrPath string) string {
-	// Escape paths for systemd ExecStart
-	exePathEscaped := escapeSystemdPath(exePath)
-	configPathEscaped := escapeSystemdPath(configPath)
+// buildSystemdService returns the service unit for a job. runAs sets User= (system units only).
+func buildSystemdService(exePath string, args []string, stdoutPath, stderrPath, runAs string) string {
+	// Escape paths and arguments for systemd ExecStart
+	execStart := []string{escapeSystemdPath(exePath)}
+	for _, arg := range args {
+		execStart = append(execStart, escapeSystemdPath(arg))
+	}
 	stdoutPathEscaped := escapeSystemdPath(stdoutPath)
 	stderrPathEscaped := escapeSystemdPath(stderrPath)
+	// User= also sets HOME, where the agent keeps its state and spool
+	user, wantedBy := "", "default.target"
+	if runAs != "" {
+		user, wantedBy = "User="+runAs+"\n", "multi-user.target"
+	}
 
+	// Exit codes 6 (another run holds the lock) and 7 (backup skipped) are not failures
 	return fmt.Sprintf(`[Unit]
-Description=xentz-agent backup service
+Description=xentz-agent %s service
 After=network.target
 
 [Service]
 Type=oneshot
-ExecStart=%s backup --config %s
+%sExecStart=%s
+SuccessExitStatus=6 7
 StandardOutput=append:%s
 StandardError=append:%s
 
 [Install]
-WantedBy=default.target
-`, exePathEscaped, configPathEscaped, stdoutPathEscaped, stderrPathEscaped)
+WantedBy=%s
+`, args[0], user, strings.Join(execStart, " "), stdoutPathEscaped, stderrPathEscaped, wantedBy)
 }
 
-func buildSystemdTimer(hour, minute int) string {
+func buildSystemdTimer(job scheduledJob) string {
+	var schedule string
+	if job.interval > 0 {
+		// First run one interval after the timer starts, then every interval after the last run.
+		// The immediate run for runNow is the explicit service start in installSystemdUnits.
+		minutes := int(job.interval.Minutes())
+		schedule = fmt.Sprintf("OnActiveSec=%dmin\nOnUnitActiveSec=%dmin", minutes, minutes)
+	} else {
+		weekday, monthDay := "", "*"
+		if job.weekly {
+			weekday = job.weekday.String()[:3] + " "
+		} else if job.monthDay > 0 {
+			monthDay = fmt.Sprintf("%02d", job.monthDay)
+		}
+		schedule = fmt.Sprintf("OnCalendar=%s*-*-%s %02d:%02d:00\nPersistent=true", weekday, monthDay, job.hour, job.minute)
+	}
 	return fmt.Sprintf(`[Unit]
-Description=xentz-agent backup timer
+Description=xentz-agent %s timer
 
 [Timer]
-OnCalendar=*-*-* %02d:%02d:00
-Persistent=true
+%s
+RandomizedDelaySec=%d
 
 [Install]
 WantedBy=timers.target
-`, hour, minute)
+`, job.args[0], schedule, int(job.jitter.Seconds()))
 }
 
 // escapeCronPath escapes a path for use in cron by wrapping in single quotes
@@ -198,41 +289,41 @@ func escapeCronPath(path string) string {
 	return result.String()
 }
 
-func installCron(exePath, configPath string, hour, minute int, home string) error {
+func installCron(exePath string, jobs []scheduledJob, home string) error {
 	// Get current user's crontab
 	crontabCmd := exec.Command("crontab", "-l")
 	currentCron, _ := crontabCmd.Output() // Ignore error if no crontab exists
 
 	// Escape paths for cron (wrap in single quotes)
 	exePathEscaped := escapeCronPath(exePath)
-	configPathEscaped := escapeCronPath(configPath)
 	logDirEscaped := escapeCronPath(filepath.Join(home, ".xentz-agent", "logs"))
 
-	// Build cron entry
+	// Build cron entries
 	// Format: minute hour * * * command
 	// Use single quotes to prevent shell interpretation of paths
-	cronEntry := fmt.Sprintf("%d %d * * * %s backup --config %s >> %s/agent.out.log 2>> %s/agent.err.log\n",
-		minute, hour, exePathEscaped, configPathEscaped, logDirEscaped, logDirEscaped)
-
-	// Check if entry already exists
-	if strings.Contains(string(currentCron), exePath) {
-		// Remove old entry
-		lines := strings.Split(string(currentCron), "\n")
-		var newLines []string
-		for _, line := range lines {
-			if !strings.Contains(line, exePath) {
-				newLines = append(newLines, line)
-			}
+	var cronEntries strings.Builder
+	for _, job := range jobs {
+		command := exePathEscaped
+		for _, arg := range job.agentArgs() {
+			command += " " + escapeCronPath(arg)
 		}
-		currentCron = []byte(strings.Join(newLines, "\n"))
+		schedule, err := cronSchedule(job)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&cronEntries, "%s\n%s %s >> %s/agent.out.log 2>> %s/agent.err.log\n",
+			cronMarker, schedule, command, logDirEscaped, logDirEscaped)
 	}
 
-	// Add new entry
+	// Remove old entries if they already exist
+	currentCron = []byte(removeCronEntries(string(currentCron), exePath))
+
+	// Add new entries
 	newCron := string(currentCron)
 	if newCron != "" && !strings.HasSuffix(newCron, "\n") {
 		newCron += "\n"
 	}
-	newCron += cronEntry
+	newCron += cronEntries.String()
 
 	// Write new crontab
 	writeCmd := exec.Command("crontab", "-")
@@ -243,3 +334,228 @@ func installCron(exePath, configPath string, hour, minute int, home string) erro
 
 	return nil
 }
+
+// cronSchedule returns the five cron time fields for job. Intervals must divide an hour
+// or a day evenly, since cron step syntax restarts at each hour/day boundary.
+func cronSchedule(job scheduledJob) (string, error) {
+	if job.interval > 0 {
+		minutes := int(job.interval.Minutes())
+		switch {
+		case minutes < 60 && 60%minutes == 0:
+			return fmt.Sprintf("*/%d * * * *", minutes), nil
+		case minutes%60 == 0 && 24%(minutes/60) == 0:
+			return fmt.Sprintf("0 */%d * * *", minutes/60), nil
+		default:
+			return "", fmt.Errorf("interval of %d minutes cannot be expressed in cron; use a divisor of 60 minutes or 24 hours", minutes)
+		}
+	}
+	monthDay, weekday := "*", "*"
+	if job.weekly {
+		weekday = fmt.Sprint(int(job.weekday))
+	} else if job.monthDay > 0 {
+		monthDay = fmt.Sprint(job.monthDay)
+	}
+	return fmt.Sprintf("%d %d %s * %s", job.minute, job.hour, monthDay, weekday), nil
+}
+
+// removeCronEntries returns crontab without the agent's managed entries: each cronMarker
+// line and the entry below it. Unmarked entries written by older versions are recognized
+// by legacyExePath together with the agent's log redirection.
+func removeCronEntries(crontab, legacyExePath string) string {
+	lines := strings.Split(crontab, "\n")
+	var newLines []string
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if strings.TrimSpace(line) == cronMarker {
+			i++ // Skip the managed entry too
+			continue
+		}
+		if legacyExePath != "" && strings.Contains(line, legacyExePath) && strings.Contains(line, "/agent.out.log") {
+			continue
+		}
+		newLines = append(newLines, line)
+	}
+	return strings.Join(newLines, "\n")
+}
+
+// linuxSchedulerStatus reports the agent's systemd timers (system-wide units first), or its
+// crontab entries when there are none
+func linuxSchedulerStatus() (SchedulerInfo, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return SchedulerInfo{}, err
+	}
+	for _, units := range []struct {
+		dir       string
+		system    bool
+		scheduler string
+	}{
+		{systemdSystemDir, true, "systemd (system)"},
+		{filepath.Join(home, ".config", "systemd", "user"), false, "systemd"},
+	} {
+		timerFiles, err := filepath.Glob(filepath.Join(units.dir, linuxServiceName+"*.timer"))
+		if err != nil {
+			return SchedulerInfo{}, err
+		}
+		if len(timerFiles) == 0 {
+			continue
+		}
+		info := SchedulerInfo{Scheduler: units.scheduler}
+		for _, timerFile := range timerFiles {
+			timer := filepath.Base(timerFile)
+			job := JobStatus{Name: timer}
+			out, _ := systemctl(units.system, "is-enabled", timer).Output()
+			job.Enabled = strings.TrimSpace(string(out)) == "enabled"
+			out, err := systemctl(units.system, "show", timer, "--property=NextElapseUSecRealtime", "--value").Output()
+			if err == nil {
+				job.NextRun = parseSystemdTime(string(out))
+			}
+			info.Jobs = append(info.Jobs, job)
+		}
+		return info, nil
+	}
+	return cronSchedulerStatus()
+}
+
+// parseSystemdTime parses a timestamp as printed by systemctl show, such as
+// "Thu 2026-10-15 02:00:00 CEST" in the local time zone (zero if empty or unparseable)
+func parseSystemdTime(s string) time.Time {
+	t, err := time.ParseInLocation("Mon 2006-01-02 15:04:05 MST", strings.TrimSpace(s), time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// cronSchedulerStatus reports the agent's entries in the user's crontab. Cron doesn't report
+// run times, and its entries can't be disabled.
+func cronSchedulerStatus() (SchedulerInfo, error) {
+	info := SchedulerInfo{Scheduler: "cron"}
+	if _, err := exec.LookPath("crontab"); err != nil {
+		return info, nil
+	}
+	currentCron, err := exec.Command("crontab", "-l").Output()
+	if err != nil {
+		// No crontab for this user
+		return info, nil
+	}
+	lines := strings.Split(string(currentCron), "\n")
+	for i := 0; i+1 < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) != cronMarker {
+			continue
+		}
+		// The entry is "m h dom mon dow 'exe' 'arg'... >> log"; name it by the time fields and arguments
+		fields := strings.Fields(lines[i+1])
+		name := lines[i+1]
+		if len(fields) > 6 {
+			name = strings.Join(fields[:5], " ")
+			for _, arg := range fields[6:] {
+				if arg == ">>" {
+					break
+				}
+				name += " " + strings.Trim(arg, "'")
+			}
+		}
+		info.Jobs = append(info.Jobs, JobStatus{Name: name, Enabled: true})
+		i++
+	}
+	return info, nil
+}
+
+// LinuxSystemdUninstall disables the systemd timers (or removes the cron entries)
+// and deletes the generated unit files. System-wide units need root.
+func LinuxSystemdUninstall(configPath string) error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("LinuxSystemdUninstall can only run on Linux")
+	}
+	return linuxRemoveExisting()
+}
+
+// linuxRemoveExisting disables and deletes every xentz-agent systemd unit and removes the crontab entries
+func linuxRemoveExisting() error {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+
+	if err := removeSystemdUnits(filepath.Join(home, ".config", "systemd", "user"), false); err != nil {
+		return err
+	}
+	if err := removeSystemdUnits(systemdSystemDir, true); err != nil {
+		return err
+	}
+	return uninstallCron()
+}
+
+// removeSystemdUnits disables and deletes the xentz-agent units in serviceDir
+// (system units with system, which needs root)
+func removeSystemdUnits(serviceDir string, system bool) error {
+	// Matches the default unit and per-profile units (xentz-agent-<profile>)
+	timerFiles, err := filepath.Glob(filepath.Join(serviceDir, linuxServiceName+"*.timer"))
+	if err != nil {
+		return err
+	}
+	serviceFiles, err := filepath.Glob(filepath.Join(serviceDir, linuxServiceName+"*.service"))
+	if err != nil {
+		return err
+	}
+	if len(timerFiles)+len(serviceFiles) == 0 {
+		return nil
+	}
+	if system {
+		if err := RequireAdmin(); err != nil {
+			return fmt.Errorf("system-wide units are installed in %s: %w", serviceDir, err)
+		}
+	}
+
+	manager := system || hasSystemd()
+	if manager {
+		for _, timerFile := range timerFiles {
+			timer := filepath.Base(timerFile)
+			disableCmd := systemctl(system, "disable", "--now", timer)
+			if output, err := disableCmd.CombinedOutput(); err != nil {
+				return fmt.Errorf("disable systemd timer: %w\noutput: %s", err, string(output))
+			}
+			logx.Printf("disabled systemd timer %s", timer)
+		}
+	}
+
+	for _, path := range append(timerFiles, serviceFiles...) {
+		if err := removeFileIfExists(path); err != nil {
+			return err
+		}
+	}
+	if manager {
+		_ = systemctl(system, "daemon-reload").Run()
+	}
+	return nil
+}
+
+// uninstallCron removes the agent's entry from the user's crontab, if present
+func uninstallCron() error {
+	if _, err := exec.LookPath("crontab"); err != nil {
+		return nil
+	}
+	currentCron, err := exec.Command("crontab", "-l").Output()
+	if err != nil {
+		// No crontab for this user
+		return nil
+	}
+
+	exePath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	newCron := removeCronEntries(string(currentCron), exePath)
+	if newCron == string(currentCron) {
+		return nil
+	}
+
+	writeCmd := exec.Command("crontab", "-")
+	writeCmd.Stdin = strings.NewReader(newCron)
+	if output, err := writeCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("write crontab: %w\noutput: %s", err, string(output))
+	}
+	logx.Println("removed crontab entries")
+	return nil
+}
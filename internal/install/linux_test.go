@@ -0,0 +1,140 @@
+package install
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildSystemdTimer(t *testing.T) {
+	tests := []struct {
+		name string
+		job  scheduledJob
+		want []string
+		not  []string
+	}{
+		{
+			name: "daily",
+			job:  scheduledJob{args: []string{"backup"}, hour: 2, minute: 30},
+			want: []string{"OnCalendar=*-*-* 02:30:00\n", "Persistent=true\n", "RandomizedDelaySec=0\n"},
+			not:  []string{"OnActiveSec"},
+		},
+		{
+			name: "weekly",
+			job:  scheduledJob{suffix: "retention", args: []string{"retention"}, hour: 3, weekly: true, weekday: time.Sunday},
+			want: []string{"Description=xentz-agent retention timer\n", "OnCalendar=Sun *-*-* 03:00:00\n", "Persistent=true\n"},
+		},
+		{
+			name: "weekly monday",
+			job:  scheduledJob{args: []string{"backup"}, hour: 23, minute: 59, weekly: true, weekday: time.Monday},
+			want: []string{"OnCalendar=Mon *-*-* 23:59:00\n"},
+		},
+		{
+			name: "monthly",
+			job:  scheduledJob{args: []string{"backup"}, hour: 1, minute: 5, monthDay: 7},
+			want: []string{"OnCalendar=*-*-07 01:05:00\n", "Persistent=true\n"},
+		},
+		{
+			name: "monthly 28th with jitter",
+			job:  scheduledJob{args: []string{"backup"}, hour: 4, monthDay: 28, jitter: 30 * time.Minute},
+			want: []string{"OnCalendar=*-*-28 04:00:00\n", "RandomizedDelaySec=1800\n"},
+		},
+		{
+			// The immediate first run is the service start at install, not the timer
+			name: "interval",
+			job:  scheduledJob{args: []string{"backup"}, interval: 4 * time.Hour},
+			want: []string{"OnActiveSec=240min\n", "OnUnitActiveSec=240min\n"},
+			not:  []string{"OnCalendar", "Persistent"},
+		},
+	}
+	for _, tt := range tests {
+		timer := buildSystemdTimer(tt.job)
+		for _, s := range tt.want {
+			if !strings.Contains(timer, s) {
+				t.Errorf("%s: timer missing %q:\n%s", tt.name, s, timer)
+			}
+		}
+		for _, s := range tt.not {
+			if strings.Contains(timer, s) {
+				t.Errorf("%s: timer contains %q:\n%s", tt.name, s, timer)
+			}
+		}
+	}
+}
+
+func TestRemoveCronEntries(t *testing.T) {
+	crontab := strings.Join([]string{
+		"MAILTO=admin@example.com",
+		"# nightly report",
+		"0 6 * * * /usr/local/bin/report.sh",
+		cronMarker,
+		"30 2 * * * '/opt/xentz/xentz-agent' 'backup' >> '/home/u/.xentz-agent/logs'/agent.out.log 2>> '/home/u/.xentz-agent/logs'/agent.err.log",
+		"# another tool that mentions /usr/bin/xentz-agent",
+		"*/5 * * * * /usr/bin/xentz-agent-exporter --once",
+		// Unmarked entry from an older version, at the old binary path
+		"0 3 * * 0 '/usr/bin/xentz-agent' 'retention' >> '/home/u/.xentz-agent/logs'/agent.out.log 2>> '/home/u/.xentz-agent/logs'/agent.err.log",
+		"  " + cronMarker + "  ",
+		"0 4 1 * * '/moved/xentz-agent' 'check' >> '/home/u/.xentz-agent/logs'/agent.out.log",
+		"",
+	}, "\n")
+
+	want := strings.Join([]string{
+		"MAILTO=admin@example.com",
+		"# nightly report",
+		"0 6 * * * /usr/local/bin/report.sh",
+		"# another tool that mentions /usr/bin/xentz-agent",
+		"*/5 * * * * /usr/bin/xentz-agent-exporter --once",
+		"",
+	}, "\n")
+	if got := removeCronEntries(crontab, "/usr/bin/xentz-agent"); got != want {
+		t.Errorf("removeCronEntries =\n%s\nwant\n%s", got, want)
+	}
+
+	// Without a legacy path only marked entries go
+	if got := removeCronEntries(crontab, ""); !strings.Contains(got, "'/usr/bin/xentz-agent' 'retention'") ||
+		strings.Contains(got, cronMarker) || strings.Contains(got, "'check'") {
+		t.Errorf("removeCronEntries without legacy path =\n%s", got)
+	}
+}
+
+func TestInstallCronTwice(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell script as crontab")
+	}
+	dir := t.TempDir()
+	crontabFile := filepath.Join(dir, "crontab.txt")
+	fake := "#!/bin/sh\ncase \"$1\" in\n-l) cat \"$FAKE_CRONTAB\" 2>/dev/null || exit 1 ;;\n-) cat > \"$FAKE_CRONTAB\" ;;\nesac\n"
+	if err := os.WriteFile(filepath.Join(dir, "crontab"), []byte(fake), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_CRONTAB", crontabFile)
+	foreign := "0 6 * * * /usr/local/bin/report.sh\n"
+	if err := os.WriteFile(crontabFile, []byte(foreign), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs := []scheduledJob{{args: []string{"backup"}, hour: 2, minute: 30}}
+	home := filepath.Join(dir, "home")
+	for _, exe := range []string{"/usr/bin/xentz-agent", "/opt/xentz/xentz-agent"} { // Binary moved in between
+		if err := installCron(exe, jobs, home); err != nil {
+			t.Fatalf("installCron(%s): %v", exe, err)
+		}
+	}
+
+	b, err := os.ReadFile(crontabFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(b)
+	if n := strings.Count(got, cronMarker); n != 1 {
+		t.Errorf("%d managed entries, want 1:\n%s", n, got)
+	}
+	if !strings.HasPrefix(got, foreign) || !strings.Contains(got, "'/opt/xentz/xentz-agent' 'backup'") ||
+		strings.Contains(got, "/usr/bin/xentz-agent") {
+		t.Errorf("crontab after reinstall:\n%s", got)
+	}
+}
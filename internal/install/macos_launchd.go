@@ -5,89 +5,198 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"os/user"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"xentz-agent/internal/config"
+	"xentz-agent/internal/logx"
 )
 
 const (
 	label = "com.xentz.agent"
+
+	// Plist directory for system-wide installs (config "system_service")
+	launchDaemonsDir = "/Library/LaunchDaemons"
 )
 
-func MacOSLaunchdInstall(configPath string) error {
-	// Read config to get schedule time (HH:MM)
+func MacOSLaunchdInstall(configPath string, opts Options) error {
+	// Read config to get schedule time (HH:MM) and profiles
 	cfg, err := config.Read(configPath)
 	if err != nil {
 		return err
 	}
-	hour, minute, err := parseHHMM(cfg.Schedule.DailyAt)
+	jobs, err := scheduledJobs(configPath, cfg)
 	if err != nil {
-		return fmt.Errorf("invalid --daily-at (%q): %w", cfg.Schedule.DailyAt, err)
+		return err
 	}
 
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return err
+	var runAs *user.User
+	if cfg.SystemService {
+		if err := RequireAdmin(); err != nil {
+			return err
+		}
+		if runAs, err = systemUser(cfg.SystemUser); err != nil {
+			return err
+		}
 	}
 
-	plistDir := filepath.Join(home, "Library", "LaunchAgents")
-	if err := os.MkdirAll(plistDir, 0o755); err != nil {
-		return err
+	// Start from a clean slate so renamed/removed profiles (or a switch between per-user
+	// agents and daemons) don't leave jobs behind
+	if err := macOSRemoveExisting(); err != nil {
+		return fmt.Errorf("remove existing launchd agents: %w", err)
 	}
-	plistPath := filepath.Join(plistDir, label+".plist")
 
 	exePath, err := os.Executable()
 	if err != nil {
 		return err
 	}
 
-	logDir := filepath.Join(home, ".xentz-agent", "logs")
-	if err := os.MkdirAll(logDir, 0o700); err != nil {
-		return err
+	// Load via launchctl: per-user agents in the gui domain, daemons in the system domain.
+	// We’ll do: bootstrap, then enable, then kickstart (existing agents were booted out above).
+	var plistDir, logDir, domain string
+	if runAs != nil {
+		plistDir, domain = launchDaemonsDir, "system"
+		if logDir, err = systemLogDir(runAs, configPath); err != nil {
+			return err
+		}
+	} else {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		plistDir = filepath.Join(home, "Library", "LaunchAgents")
+		if err := os.MkdirAll(plistDir, 0o755); err != nil {
+			return err
+		}
+		logDir = filepath.Join(home, ".xentz-agent", "logs")
+		if err := os.MkdirAll(logDir, 0o700); err != nil {
+			return err
+		}
+		domain = fmt.Sprintf("gui/%d", os.Getuid())
 	}
 	stdoutPath := filepath.Join(logDir, "agent.out.log")
 	stderrPath := filepath.Join(logDir, "agent.err.log")
 
-	plist := buildPlist(exePath, configPath, hour, minute, stdoutPath, stderrPath)
-	if err := os.WriteFile(plistPath, []byte(plist), 0o644); err != nil {
-		return err
-	}
+	for _, job := range jobs {
+		jobLabel := launchdLabel(job.suffix)
+		plistPath := filepath.Join(plistDir, jobLabel+".plist")
 
-	// Load via launchctl (per-user domain)
-	// We’ll do: launchctl bootout gui/<uid> <plist> (ignore errors), then bootstrap, then enable, then kickstart.
-	uid := os.Getuid()
-	domain := fmt.Sprintf("gui/%d", uid)
+		plist := buildPlist(jobLabel, exePath, job, stdoutPath, stderrPath, opts.RunNow, runAs)
+		if err := os.WriteFile(plistPath, []byte(plist), 0o644); err != nil {
+			return err
+		}
 
-	_ = exec.Command("launchctl", "bootout", domain, plistPath).Run()
-	if err := exec.Command("launchctl", "bootstrap", domain, plistPath).Run(); err != nil {
-		return fmt.Errorf("launchctl bootstrap: %w", err)
+		if err := exec.Command("launchctl", "bootstrap", domain, plistPath).Run(); err != nil {
+			return fmt.Errorf("launchctl bootstrap %s: %w", jobLabel, err)
+		}
+		_ = exec.Command("launchctl", "enable", domain+"/"+jobLabel).Run()
+		if opts.RunNow && job.runOnLoad() {
+			_ = exec.Command("launchctl", "kickstart", "-k", domain+"/"+jobLabel).Run()
+		}
 	}
-	_ = exec.Command("launchctl", "enable", domain+"/"+label).Run()
-	_ = exec.Command("launchctl", "kickstart", "-k", domain+"/"+label).Run()
 
 	return nil
 }
 
-func parseHHMM(s string) (hour, minute int, err error) {
-	parts := strings.Split(s, ":")
-	if len(parts) != 2 {
-		return 0, 0, fmt.Errorf("expected HH:MM")
+// launchdLabel returns the launchd label for a job suffix
+func launchdLabel(suffix string) string {
+	if suffix == "" {
+		return label
 	}
-	var h, m int
-	_, err = fmt.Sscanf(parts[0], "%d", &h)
+	return label + "." + suffix
+}
+
+// MacOSLaunchdUninstall unloads the launchd agents (default and per-profile) and removes their plists.
+// System-wide daemons need root.
+func MacOSLaunchdUninstall(configPath string) error {
+	return macOSRemoveExisting()
+}
+
+// macOSRemoveExisting boots out every xentz-agent launchd agent and daemon and deletes its plist
+func macOSRemoveExisting() error {
+	home, err := os.UserHomeDir()
 	if err != nil {
-		return 0, 0, err
+		return err
 	}
-	_, err = fmt.Sscanf(parts[1], "%d", &m)
+	if err := removeLaunchdJobs(filepath.Join(home, "Library", "LaunchAgents"), fmt.Sprintf("gui/%d", os.Getuid())); err != nil {
+		return err
+	}
+	return removeLaunchdJobs(launchDaemonsDir, "system")
+}
+
+// removeLaunchdJobs boots the xentz-agent jobs in plistDir out of domain and deletes their plists
+func removeLaunchdJobs(plistDir, domain string) error {
+	plists, err := filepath.Glob(filepath.Join(plistDir, label+"*.plist"))
 	if err != nil {
-		return 0, 0, err
+		return err
 	}
-	if h < 0 || h > 23 || m < 0 || m > 59 {
-		return 0, 0, fmt.Errorf("out of range")
+	if len(plists) > 0 && domain == "system" {
+		if err := RequireAdmin(); err != nil {
+			return fmt.Errorf("system-wide daemons are installed in %s: %w", plistDir, err)
+		}
 	}
-	return h, m, nil
+
+	for _, plistPath := range plists {
+		jobLabel := strings.TrimSuffix(filepath.Base(plistPath), ".plist")
+		if err := exec.Command("launchctl", "bootout", domain+"/"+jobLabel).Run(); err == nil {
+			logx.Printf("unloaded launchd agent %s", jobLabel)
+		}
+		if err := removeFileIfExists(plistPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// macOSSchedulerStatus reports the agent's launchd jobs (system-wide daemons first). launchd
+// doesn't report when a calendar job runs next.
+func macOSSchedulerStatus() (SchedulerInfo, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return SchedulerInfo{}, err
+	}
+	for _, jobs := range []struct {
+		dir, domain, scheduler string
+	}{
+		{launchDaemonsDir, "system", "launchd (system)"},
+		{filepath.Join(home, "Library", "LaunchAgents"), fmt.Sprintf("gui/%d", os.Getuid()), "launchd"},
+	} {
+		plists, err := filepath.Glob(filepath.Join(jobs.dir, label+"*.plist"))
+		if err != nil {
+			return SchedulerInfo{}, err
+		}
+		if len(plists) == 0 {
+			continue
+		}
+		disabled, _ := exec.Command("launchctl", "print-disabled", jobs.domain).Output()
+		info := SchedulerInfo{Scheduler: jobs.scheduler}
+		for _, plistPath := range plists {
+			jobLabel := strings.TrimSuffix(filepath.Base(plistPath), ".plist")
+			// print fails for jobs that aren't loaded
+			loaded := exec.Command("launchctl", "print", jobs.domain+"/"+jobLabel).Run() == nil
+			info.Jobs = append(info.Jobs, JobStatus{
+				Name:    jobLabel,
+				Enabled: loaded && !launchdDisabled(string(disabled), jobLabel),
+			})
+		}
+		return info, nil
+	}
+	return SchedulerInfo{Scheduler: "launchd"}, nil
+}
+
+// launchdDisabled reports whether launchctl print-disabled output marks jobLabel as disabled,
+// with a line such as `"com.xentz.agent" => disabled` (older macOS: `=> true`)
+func launchdDisabled(printDisabled, jobLabel string) bool {
+	for _, line := range strings.Split(printDisabled, "\n") {
+		name, state, ok := strings.Cut(strings.TrimSpace(line), "=>")
+		if ok && strings.Trim(strings.TrimSpace(name), `"`) == jobLabel {
+			state = strings.TrimSpace(state)
+			return state == "disabled" || state == "true"
+		}
+	}
+	return false
 }
 
 // escapeXML escapes XML special characters in a string
@@ -112,14 +221,54 @@ func escapeXML(s string) string {
 	return result.String()
 }
 
-func buildPlist(exePath, configPath string, hour, minute int, stdoutPath, stderrPath string) string {
-	// launchd expects ProgramArguments as array; we run `backup`
-	// StartCalendarInterval handles daily schedule. RunAtLoad gives a run on install/boot.
-	// Escape XML special characters in paths
-	exePathEscaped := escapeXML(exePath)
-	configPathEscaped := escapeXML(configPath)
+// buildPlist returns the launchd plist for a job. With runAs, it is a daemon running as that user.
+func buildPlist(jobLabel, exePath string, job scheduledJob, stdoutPath, stderrPath string, runNow bool, runAs *user.User) string {
+	// launchd expects ProgramArguments as array; we run the agent with the job's arguments
+	// StartCalendarInterval handles the daily (or weekly/monthly) schedule, StartInterval interval schedules.
+	// RunAtLoad gives daily and interval jobs a run on install/boot (not with runNow off, since
+	// bootstrapping the plist would start it).
+	// launchd has no working power or network conditions (KeepAlive NetworkState is ignored since
+	// 10.10), so require_ac_power and require_network are checked by the agent at backup start.
+	// A calendar run missed while asleep runs on wake. No StartInterval watchdog job is added for
+	// runs skipped by those checks: they wait for the next run, or catch_up from retention/checkin.
+	// Escape XML special characters in paths and arguments
+	var programArgs strings.Builder
+	fmt.Fprintf(&programArgs, "      <string>%s</string>\n", escapeXML(exePath))
+	for _, arg := range job.agentArgs() {
+		fmt.Fprintf(&programArgs, "      <string>%s</string>\n", escapeXML(arg))
+	}
 	stdoutPathEscaped := escapeXML(stdoutPath)
 	stderrPathEscaped := escapeXML(stderrPath)
+	var schedule string
+	if job.interval > 0 {
+		schedule = fmt.Sprintf("    <key>StartInterval</key><integer>%d</integer>\n", int(job.interval.Seconds()))
+	} else {
+		dayKey := ""
+		if job.weekly {
+			// launchd weekdays are 0 (Sunday) through 6, like time.Weekday
+			dayKey = fmt.Sprintf("      <key>Weekday</key><integer>%d</integer>\n", int(job.weekday))
+		} else if job.monthDay > 0 {
+			dayKey = fmt.Sprintf("      <key>Day</key><integer>%d</integer>\n", job.monthDay)
+		}
+		schedule = fmt.Sprintf(`    <key>StartCalendarInterval</key>
+    <dict>
+%s      <key>Hour</key><integer>%d</integer>
+      <key>Minute</key><integer>%d</integer>
+    </dict>
+`, dayKey, job.hour, job.minute)
+	}
+
+	// Daemons get the user's HOME, where the agent keeps its config, state and spool
+	var account string
+	if runAs != nil {
+		account = fmt.Sprintf(`    <key>UserName</key><string>%s</string>
+    <key>EnvironmentVariables</key>
+    <dict>
+      <key>HOME</key><string>%s</string>
+    </dict>
+
+`, escapeXML(runAs.Username), escapeXML(runAs.HomeDir))
+	}
 
 	var b bytes.Buffer
 	fmt.Fprintf(&b, `<?xml version="1.0" encoding="UTF-8"?>
@@ -130,27 +279,18 @@ func buildPlist(exePath, configPath string, hour, minute int, stdoutPath, stderr
 
     <key>ProgramArguments</key>
     <array>
-      <string>%s</string>
-      <string>backup</string>
-      <string>--config</string>
-      <string>%s</string>
-    </array>
-
-    <key>RunAtLoad</key><true/>
+%s    </array>
 
-    <key>StartCalendarInterval</key>
-    <dict>
-      <key>Hour</key><integer>%d</integer>
-      <key>Minute</key><integer>%d</integer>
-    </dict>
+    <key>RunAtLoad</key><%t/>
 
+%s%s
     <key>StandardOutPath</key><string>%s</string>
     <key>StandardErrorPath</key><string>%s</string>
 
     <key>ProcessType</key><string>Background</string>
   </dict>
 </plist>
-`, label, exePathEscaped, configPathEscaped, hour, minute, stdoutPathEscaped, stderrPathEscaped)
+`, escapeXML(jobLabel), programArgs.String(), runNow && job.runOnLoad(), account, schedule, stdoutPathEscaped, stderrPathEscaped)
 
 	// Small trick: add a comment-like timestamp to help debugging (doesn't affect plist parsing)
 	_ = time.Now().UTC()
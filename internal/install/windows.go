@@ -1,32 +1,62 @@
 package install
 
 import (
+	"encoding/csv"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"time"
+	"unicode/utf16"
 
 	"xentz-agent/internal/config"
+	"xentz-agent/internal/logx"
 )
 
 const (
 	windowsTaskName = "xentz-agent"
 )
 
-func WindowsTaskSchedulerInstall(configPath string) error {
+func WindowsTaskSchedulerInstall(configPath string, opts Options) error {
 	if runtime.GOOS != "windows" {
 		return fmt.Errorf("WindowsTaskSchedulerInstall can only run on Windows")
 	}
 
-	// Read config to get schedule time (HH:MM)
+	// Read config to get schedule time (HH:MM) and profiles
 	cfg, err := config.Read(configPath)
 	if err != nil {
 		return err
 	}
-	hour, minute, err := parseHHMM(cfg.Schedule.DailyAt)
+	jobs, err := scheduledJobs(configPath, cfg)
 	if err != nil {
-		return fmt.Errorf("invalid --daily-at (%q): %w", cfg.Schedule.DailyAt, err)
+		return err
+	}
+
+	// System-wide tasks run whether or not anyone is logged on: as SYSTEM, or as system_user
+	// with its password stored by Task Scheduler
+	var account []string
+	if cfg.SystemService {
+		if err := RequireAdmin(); err != nil {
+			return err
+		}
+		account = []string{"/RU", "SYSTEM"}
+		if cfg.SystemUser != "" {
+			password := opts.RunPassword
+			if password == "" {
+				if password, err = promptPassword(fmt.Sprintf("Password for %s", cfg.SystemUser)); err != nil {
+					return err
+				}
+			}
+			logx.AddSecret(password)
+			account = []string{"/RU", cfg.SystemUser, "/RP", password}
+		}
+	}
+
+	// Start from a clean slate so renamed/removed profiles don't leave tasks behind
+	if err := windowsRemoveExisting(); err != nil {
+		return fmt.Errorf("remove existing scheduled tasks: %w", err)
 	}
 
 	exePath, err := os.Executable()
@@ -55,37 +85,297 @@ func WindowsTaskSchedulerInstall(configPath string) error {
 	stdoutPath := filepath.Join(logDir, "agent.out.log")
 	stderrPath := filepath.Join(logDir, "agent.err.log")
 
-	// Create a batch file wrapper to handle logging
-	batchFile := filepath.Join(home, ".xentz-agent", "run-backup.bat")
+	for _, job := range jobs {
+		taskName := windowsTaskNameFor(job.suffix)
+
+		// Create a batch file wrapper to handle logging. Jitter is the trigger's RandomDelay.
+		batchFile := filepath.Join(home, ".xentz-agent", windowsBatchName(job.suffix))
+		if err := writeTaskBatch(batchFile, exePath, job.args, stdoutPath, stderrPath); err != nil {
+			return err
+		}
+
+		if err := createTaskXML(taskName, batchFile, buildTaskXML(job, batchFile, cfg, time.Now()), account); err != nil {
+			// Fall back to plain schtasks flags (e.g. a Task Scheduler that rejects the definition):
+			// no wake-to-run or missed-run catch-up, and the agent applies the jitter itself
+			logx.Printf("warning: %v", err)
+			logx.Printf("registering %s without wake-to-run and missed-run catch-up", taskName)
+			if err := writeTaskBatch(batchFile, exePath, job.agentArgs(), stdoutPath, stderrPath); err != nil {
+				return err
+			}
+			if err := createTaskSimple(taskName, batchFile, job, account, cfg.SystemService); err != nil {
+				return err
+			}
+		}
+
+		// Run daily tasks immediately to test (never an unplanned retention/prune)
+		if opts.RunNow && job.runOnLoad() {
+			_ = exec.Command("schtasks", "/Run", "/TN", taskName).Run()
+		}
+	}
+
+	return nil
+}
+
+// writeTaskBatch writes the batch wrapper running the agent with args, appending its output
+// to the log files
+func writeTaskBatch(batchFile, exePath string, args []string, stdoutPath, stderrPath string) error {
+	var quotedArgs []string
+	for _, arg := range args {
+		quotedArgs = append(quotedArgs, fmt.Sprintf(`"%s"`, arg))
+	}
 	batchContent := fmt.Sprintf(`@echo off
-"%s" backup --config "%s" >> "%s" 2>> "%s"
-`, exePath, configPath, stdoutPath, stderrPath)
-	
+"%s" %s >> "%s" 2>> "%s"
+`, exePath, strings.Join(quotedArgs, " "), stdoutPath, stderrPath)
+
 	if err := os.WriteFile(batchFile, []byte(batchContent), 0o644); err != nil {
 		return fmt.Errorf("write batch file: %w", err)
 	}
+	return nil
+}
+
+// createTaskXML registers taskName from the XML definition def, run as account (schtasks
+// /RU and /RP arguments; empty for the current user)
+func createTaskXML(taskName, batchFile, def string, account []string) error {
+	// Format: schtasks /Create /TN "TaskName" /XML task.xml [/RU user [/RP password]] /F
+	xmlFile := strings.TrimSuffix(batchFile, ".bat") + ".xml"
+	if err := os.WriteFile(xmlFile, utf16File(def), 0o644); err != nil {
+		return fmt.Errorf("write task definition: %w", err)
+	}
+	defer os.Remove(xmlFile)
 
-	// Delete existing task if it exists (ignore errors)
-	_ = exec.Command("schtasks", "/Delete", "/TN", windowsTaskName, "/F").Run()
+	createArgs := []string{"/Create", "/TN", taskName, "/XML", xmlFile}
+	createArgs = append(createArgs, account...)
+	createArgs = append(createArgs, "/F") // Force creation (overwrite if exists)
+	output, err := exec.Command("schtasks", createArgs...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("create scheduled task %s from XML: %w\noutput: %s", taskName, err, logx.Redact(string(output)))
+	}
+	return nil
+}
 
-	// Create new scheduled task
+// createTaskSimple registers taskName with schtasks schedule flags only
+func createTaskSimple(taskName, batchFile string, job scheduledJob, account []string, system bool) error {
 	// Format: schtasks /Create /TN "TaskName" /TR "Command" /SC DAILY /ST HH:MM
-	createCmd := exec.Command("schtasks", "/Create",
-		"/TN", windowsTaskName,
+	// (weekly jobs: /SC WEEKLY /D SUN, monthly jobs: /SC MONTHLY /D 15, interval jobs: /SC MINUTE /MO N)
+	schedule := []string{"/SC", "DAILY"}
+	if job.interval > 0 {
+		schedule = []string{"/SC", "MINUTE", "/MO", fmt.Sprint(int(job.interval.Minutes()))}
+	} else if job.weekly {
+		schedule = []string{"/SC", "WEEKLY", "/D", strings.ToUpper(job.weekday.String()[:3])}
+	} else if job.monthDay > 0 {
+		schedule = []string{"/SC", "MONTHLY", "/D", fmt.Sprint(job.monthDay)}
+	}
+	createArgs := []string{"/Create",
+		"/TN", taskName,
 		"/TR", fmt.Sprintf(`"%s"`, batchFile),
-		"/SC", "DAILY",
-		"/ST", fmt.Sprintf("%02d:%02d", hour, minute),
-		"/F", // Force creation (overwrite if exists)
-	)
+	}
+	createArgs = append(createArgs, schedule...)
+	createArgs = append(createArgs, "/ST", fmt.Sprintf("%02d:%02d", job.hour, job.minute))
+	createArgs = append(createArgs, account...)
+	if system {
+		createArgs = append(createArgs, "/RL", "HIGHEST")
+	}
+	createArgs = append(createArgs, "/F") // Force creation (overwrite if exists)
 
-	output, err := createCmd.CombinedOutput()
+	output, err := exec.Command("schtasks", createArgs...).CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("create scheduled task: %w\noutput: %s", err, string(output))
+		return fmt.Errorf("create scheduled task %s: %w\noutput: %s", taskName, err, logx.Redact(string(output)))
+	}
+	return nil
+}
+
+// windowsTaskNameFor returns the scheduled task name for a job suffix
+func windowsTaskNameFor(suffix string) string {
+	if suffix == "" {
+		return windowsTaskName
 	}
+	return windowsTaskName + "-" + suffix
+}
 
-	// Run the task immediately to test
-	_ = exec.Command("schtasks", "/Run", "/TN", windowsTaskName).Run()
+// windowsBatchName returns the batch wrapper file name for a job suffix
+func windowsBatchName(suffix string) string {
+	if suffix == "" {
+		return "run-backup.bat"
+	}
+	return "run-backup-" + suffix + ".bat"
+}
 
+// listWindowsTasks returns the names of all registered xentz-agent scheduled tasks
+func listWindowsTasks() []string {
+	output, err := exec.Command("schtasks", "/Query", "/FO", "CSV", "/NH").Output()
+	if err != nil {
+		return nil
+	}
+	var tasks []string
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), ",", 2)
+		if len(fields) == 0 {
+			continue
+		}
+		name := strings.TrimPrefix(strings.Trim(fields[0], `"`), `\`)
+		if name == windowsTaskName || strings.HasPrefix(name, windowsTaskName+"-") {
+			tasks = append(tasks, name)
+		}
+	}
+	return tasks
+}
+
+// windowsSchedulerStatus reports the agent's scheduled tasks
+func windowsSchedulerStatus() (SchedulerInfo, error) {
+	info := SchedulerInfo{Scheduler: "Task Scheduler"}
+	for _, taskName := range listWindowsTasks() {
+		job := JobStatus{Name: taskName}
+		// Columns: TaskName, Next Run Time, Status (Ready, Running or Disabled)
+		out, err := exec.Command("schtasks", "/Query", "/TN", taskName, "/FO", "CSV", "/NH").Output()
+		if err != nil {
+			return info, fmt.Errorf("query scheduled task %s: %w", taskName, err)
+		}
+		fields, err := csv.NewReader(strings.NewReader(string(out))).Read()
+		if err == nil && len(fields) >= 3 {
+			job.NextRun = parseWindowsTime(fields[len(fields)-2])
+			job.Enabled = fields[len(fields)-1] != "Disabled"
+		}
+		info.Jobs = append(info.Jobs, job)
+	}
+	return info, nil
+}
+
+// parseWindowsTime parses a schtasks time in the common US or ISO layouts. The layout
+// follows the system locale, so others (and "N/A") give the zero time.
+func parseWindowsTime(s string) time.Time {
+	for _, layout := range []string{"1/2/2006 3:04:05 PM", "2006-01-02 15:04:05", "02/01/2006 15:04:05"} {
+		if t, err := time.ParseInLocation(layout, strings.TrimSpace(s), time.Local); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// WindowsTaskSchedulerUninstall deletes the scheduled tasks (default and per-profile) and their batch wrappers
+func WindowsTaskSchedulerUninstall(configPath string) error {
+	if runtime.GOOS != "windows" {
+		return fmt.Errorf("WindowsTaskSchedulerUninstall can only run on Windows")
+	}
+	return windowsRemoveExisting()
+}
+
+// windowsRemoveExisting deletes every xentz-agent scheduled task and batch wrapper
+func windowsRemoveExisting() error {
+	// Only delete tasks that exist so the command stays idempotent
+	for _, taskName := range listWindowsTasks() {
+		output, err := exec.Command("schtasks", "/Delete", "/TN", taskName, "/F").CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("delete scheduled task: %w\noutput: %s", err, string(output))
+		}
+		logx.Printf("deleted scheduled task %s", taskName)
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	batchFiles, err := filepath.Glob(filepath.Join(home, ".xentz-agent", "run-backup*.bat"))
+	if err != nil {
+		return err
+	}
+	for _, batchFile := range batchFiles {
+		if err := removeFileIfExists(batchFile); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// buildTaskXML returns the Task Scheduler definition for job, running batchFile. Tasks start
+// as soon as possible after a missed start (machine off) and wake the machine to run. With
+// require_ac_power they don't start on battery, and with system_service they run with the
+// highest privileges (the account itself is set with schtasks /RU).
+func buildTaskXML(job scheduledJob, batchFile string, cfg config.Config, now time.Time) string {
+	start := time.Date(now.Year(), now.Month(), now.Day(), job.hour, job.minute, 0, 0, time.Local)
+	// Task Scheduler rejects trigger elements out of schema order: repetition, start, enabled,
+	// random delay, schedule
+	trigger, repetition, delay, schedule := "CalendarTrigger", "", "", ""
+	if job.jitter > 0 {
+		delay = fmt.Sprintf("      <RandomDelay>PT%dS</RandomDelay>\n", int(job.jitter.Seconds()))
+	}
+	switch {
+	case job.interval > 0:
+		trigger = "TimeTrigger"
+		repetition = fmt.Sprintf("      <Repetition>\n        <Interval>PT%dM</Interval>\n      </Repetition>\n", int(job.interval.Minutes()))
+	case job.weekly:
+		schedule = fmt.Sprintf("      <ScheduleByWeek>\n        <DaysOfWeek><%s /></DaysOfWeek>\n        <WeeksInterval>1</WeeksInterval>\n      </ScheduleByWeek>\n", job.weekday)
+	case job.monthDay > 0:
+		var months strings.Builder
+		for m := time.January; m <= time.December; m++ {
+			fmt.Fprintf(&months, "<%s />", m)
+		}
+		schedule = fmt.Sprintf("      <ScheduleByMonth>\n        <DaysOfMonth><Day>%d</Day></DaysOfMonth>\n        <Months>%s</Months>\n      </ScheduleByMonth>\n", job.monthDay, months.String())
+	default:
+		schedule = "      <ScheduleByDay>\n        <DaysInterval>1</DaysInterval>\n      </ScheduleByDay>\n"
+	}
+
+	principal := "      <LogonType>InteractiveToken</LogonType>\n      <RunLevel>LeastPrivilege</RunLevel>\n"
+	if cfg.SystemService {
+		principal = "      <RunLevel>HighestAvailable</RunLevel>\n"
+	}
+
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-16"?>
+<Task version="1.2" xmlns="http://schemas.microsoft.com/windows/2004/02/mit/task">
+  <RegistrationInfo>
+    <Description>xentz-agent %s</Description>
+  </RegistrationInfo>
+  <Triggers>
+    <%s>
+%s      <StartBoundary>%s</StartBoundary>
+      <Enabled>true</Enabled>
+%s%s    </%s>
+  </Triggers>
+  <Principals>
+    <Principal id="Author">
+%s    </Principal>
+  </Principals>
+  <Settings>
+    <MultipleInstancesPolicy>IgnoreNew</MultipleInstancesPolicy>
+    <DisallowStartIfOnBatteries>%t</DisallowStartIfOnBatteries>
+    <StopIfGoingOnBatteries>false</StopIfGoingOnBatteries>
+    <StartWhenAvailable>true</StartWhenAvailable>
+    <Enabled>true</Enabled>
+    <WakeToRun>true</WakeToRun>
+  </Settings>
+  <Actions Context="Author">
+    <Exec>
+      <Command>%s</Command>
+    </Exec>
+  </Actions>
+</Task>
+`, escapeXML(job.args[0]), trigger, repetition, start.Format("2006-01-02T15:04:05"), delay, schedule, trigger, principal, cfg.RequireACPower, escapeXML(batchFile))
+}
+
+// utf16File encodes s as UTF-16LE with a byte order mark, the encoding schtasks /XML expects
+func utf16File(s string) []byte {
+	b := []byte{0xFF, 0xFE}
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(u), byte(u>>8))
+	}
+	return b
+}
+
+// promptPassword reads a password from the console without echoing it.
+// PowerShell must not run with -NonInteractive here: Read-Host fails in that mode.
+func promptPassword(prompt string) (string, error) {
+	const script = `$p = Read-Host -AsSecureString -Prompt $env:XENTZ_PROMPT; ` +
+		`[Runtime.InteropServices.Marshal]::PtrToStringBSTR([Runtime.InteropServices.Marshal]::SecureStringToBSTR($p))`
+	cmd := exec.Command("powershell", "-NoProfile", "-Command", script)
+	cmd.Env = append(os.Environ(), "XENTZ_PROMPT="+prompt)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("read password: %w", err)
+	}
+	password := strings.TrimRight(string(out), "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("no password entered (pass --run-password)")
+	}
+	return password, nil
+}
@@ -0,0 +1,116 @@
+package install
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"xentz-agent/internal/config"
+)
+
+// checkWellFormed parses a task definition (its UTF-16 declaration is only applied on disk)
+func checkWellFormed(t *testing.T, name, def string) {
+	t.Helper()
+	d := xml.NewDecoder(strings.NewReader(def))
+	d.CharsetReader = func(_ string, r io.Reader) (io.Reader, error) { return r, nil }
+	for {
+		if _, err := d.Token(); err == io.EOF {
+			return
+		} else if err != nil {
+			t.Fatalf("%s: task XML is not well-formed: %v\n%s", name, err, def)
+		}
+	}
+}
+
+// inOrder reports whether the parts appear in s in the given order
+func inOrder(s string, parts ...string) bool {
+	for _, p := range parts {
+		i := strings.Index(s, p)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(p):]
+	}
+	return true
+}
+
+func TestBuildTaskXML(t *testing.T) {
+	now := time.Date(2026, 3, 10, 15, 0, 0, 0, time.Local)
+	batch := `C:\Users\A & B\.xentz-agent\run-backup.bat`
+	tests := []struct {
+		name string
+		job  scheduledJob
+		cfg  config.Config
+		want []string // In document order
+		not  []string
+	}{
+		{
+			name: "daily",
+			job:  scheduledJob{args: []string{"backup"}, hour: 2, minute: 30},
+			want: []string{
+				"<Description>xentz-agent backup</Description>",
+				"<CalendarTrigger>", "<StartBoundary>2026-03-10T02:30:00</StartBoundary>", "<Enabled>true</Enabled>",
+				"<ScheduleByDay>", "<DaysInterval>1</DaysInterval>", "</CalendarTrigger>",
+				"<LogonType>InteractiveToken</LogonType>", "<RunLevel>LeastPrivilege</RunLevel>",
+				"<DisallowStartIfOnBatteries>false</DisallowStartIfOnBatteries>",
+				"<StartWhenAvailable>true</StartWhenAvailable>", "<Enabled>true</Enabled>", "<WakeToRun>true</WakeToRun>",
+				`<Command>C:\Users\A &amp; B\.xentz-agent\run-backup.bat</Command>`,
+			},
+			not: []string{"<RandomDelay>", "<Repetition>"},
+		},
+		{
+			name: "interval with jitter",
+			job:  scheduledJob{args: []string{"backup"}, hour: 15, minute: 0, interval: 4 * time.Hour, jitter: 30 * time.Minute},
+			want: []string{
+				"<TimeTrigger>", "<Repetition>", "<Interval>PT240M</Interval>", "</Repetition>",
+				"<StartBoundary>2026-03-10T15:00:00</StartBoundary>", "<Enabled>true</Enabled>",
+				"<RandomDelay>PT1800S</RandomDelay>", "</TimeTrigger>",
+			},
+			not: []string{"<CalendarTrigger>", "<ScheduleBy"},
+		},
+		{
+			name: "weekly",
+			job:  scheduledJob{suffix: "retention", args: []string{"retention"}, hour: 3, weekly: true, weekday: time.Sunday},
+			want: []string{
+				"<CalendarTrigger>", "<StartBoundary>2026-03-10T03:00:00</StartBoundary>",
+				"<ScheduleByWeek>", "<DaysOfWeek><Sunday /></DaysOfWeek>", "<WeeksInterval>1</WeeksInterval>",
+			},
+			not: []string{"<ScheduleByDay>", "<ScheduleByMonth>"},
+		},
+		{
+			name: "monthly",
+			job:  scheduledJob{args: []string{"backup"}, hour: 1, minute: 5, monthDay: 15},
+			want: []string{
+				"<ScheduleByMonth>", "<DaysOfMonth><Day>15</Day></DaysOfMonth>",
+				"<Months><January /><February />", "<December /></Months>",
+			},
+			not: []string{"<ScheduleByDay>", "<ScheduleByWeek>"},
+		},
+		{
+			name: "battery and system service",
+			job:  scheduledJob{args: []string{"backup"}, hour: 2},
+			cfg:  config.Config{RequireACPower: true, SystemService: true},
+			want: []string{
+				"<RunLevel>HighestAvailable</RunLevel>",
+				"<DisallowStartIfOnBatteries>true</DisallowStartIfOnBatteries>",
+				"<StopIfGoingOnBatteries>false</StopIfGoingOnBatteries>",
+				"<WakeToRun>true</WakeToRun>",
+			},
+			not: []string{"<LogonType>"},
+		},
+	}
+	for _, tt := range tests {
+		def := buildTaskXML(tt.job, batch, tt.cfg, now)
+		checkWellFormed(t, tt.name, def)
+		if !inOrder(def, tt.want...) {
+			t.Errorf("%s: task XML missing or out of order, want %q:\n%s", tt.name, tt.want, def)
+		}
+		for _, s := range tt.not {
+			if strings.Contains(def, s) {
+				t.Errorf("%s: task XML contains %q:\n%s", tt.name, s, def)
+			}
+		}
+	}
+}
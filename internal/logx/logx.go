@@ -0,0 +1,118 @@
+// Package logx is the agent's logger. It writes the standard library's text format by
+// default and structured JSON (level, msg, ts plus job/device_id) when configured.
+package logx
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Log formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+var (
+	jsonLogger *slog.Logger // nil in text mode
+	job        string       // added to JSON records as "job"
+	deviceID   string       // added to JSON records as "device_id"
+	verbosity  int          // Debugf only logs when > 0
+)
+
+// Setup selects the log format ("text" or "json"; empty means text)
+func Setup(format string) error {
+	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
+	switch format {
+	case "", FormatText:
+		jsonLogger = nil
+	case FormatJSON:
+		jsonLogger = slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{
+			Level: slog.LevelDebug, // Debugf filters on verbosity itself
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				switch a.Key {
+				case slog.TimeKey:
+					a.Key = "ts"
+				case slog.LevelKey:
+					a.Value = slog.StringValue(strings.ToLower(a.Value.String()))
+				}
+				return a
+			},
+		}))
+	default:
+		return fmt.Errorf("unknown log format %q (expected %q or %q)", format, FormatText, FormatJSON)
+	}
+	return nil
+}
+
+// SetJob attaches the running command (backup, retention, ...) to subsequent JSON records
+func SetJob(name string) {
+	job = name
+}
+
+// SetDeviceID attaches the enrolled device ID to subsequent JSON records
+func SetDeviceID(id string) {
+	deviceID = id
+}
+
+// SetVerbosity sets the --verbose level; 0 (the default) turns off debug logging
+func SetVerbosity(level int) {
+	verbosity = level
+}
+
+// Debugf logs a debug message, only when running with --verbose
+func Debugf(format string, v ...any) {
+	if verbosity > 0 {
+		output(slog.LevelDebug, fmt.Sprintf(format, v...))
+	}
+}
+
+func Printf(format string, v ...any) {
+	output(slog.LevelInfo, fmt.Sprintf(format, v...))
+}
+
+func Println(v ...any) {
+	output(slog.LevelInfo, strings.TrimSuffix(fmt.Sprintln(v...), "\n"))
+}
+
+func Fatalf(format string, v ...any) {
+	Exitf(1, format, v...)
+}
+
+// Exitf logs an error and exits with the given status code
+func Exitf(code int, format string, v ...any) {
+	output(slog.LevelError, fmt.Sprintf(format, v...))
+	os.Exit(code)
+}
+
+func Fatal(v ...any) {
+	output(slog.LevelError, fmt.Sprint(v...))
+	os.Exit(1)
+}
+
+func output(level slog.Level, msg string) {
+	msg = Redact(msg)
+	if jsonLogger == nil {
+		if level == slog.LevelDebug {
+			msg = "debug: " + msg
+		}
+		// Skip output, the Printf/Fatalf wrapper, and report the caller
+		log.Output(3, msg)
+		return
+	}
+	if level == slog.LevelInfo && strings.HasPrefix(strings.ToLower(msg), "warning") {
+		level = slog.LevelWarn
+	}
+	var attrs []any
+	if job != "" {
+		attrs = append(attrs, "job", job)
+	}
+	if deviceID != "" {
+		attrs = append(attrs, "device_id", deviceID)
+	}
+	jsonLogger.Log(context.Background(), level, msg, attrs...)
+}
@@ -0,0 +1,70 @@
+package logx
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Defaults for RotateFiles
+const (
+	DefaultMaxLogBytes = 10 << 20 // 10MB
+	DefaultKeepLogs    = 3
+)
+
+// AgentLogFiles returns the scheduler log files written under ~/.xentz-agent/logs
+func AgentLogFiles(home string) []string {
+	dir := filepath.Join(home, ".xentz-agent", "logs")
+	return []string{filepath.Join(dir, "agent.out.log"), filepath.Join(dir, "agent.err.log")}
+}
+
+// RotateFiles rolls each file larger than maxBytes to file.1, shifting older copies
+// (file.1 -> file.2 ...) and keeping at most keep rotated files. Zero values use the defaults.
+// A file held open by the scheduler keeps receiving this run's output in file.1; the next
+// run starts a fresh file.
+func RotateFiles(paths []string, maxBytes int64, keep int) error {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxLogBytes
+	}
+	if keep <= 0 {
+		keep = DefaultKeepLogs
+	}
+
+	var errs []error
+	for _, path := range paths {
+		if err := rotateFile(path, maxBytes, keep); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func rotateFile(path string, maxBytes int64, keep int) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if info.Size() <= maxBytes {
+		return nil
+	}
+
+	// Drop the oldest, then shift the rest up by one
+	if err := os.Remove(fmt.Sprintf("%s.%d", path, keep)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("rotate %s: %w", path, err)
+	}
+	for i := keep - 1; i >= 1; i-- {
+		from := fmt.Sprintf("%s.%d", path, i)
+		if err := os.Rename(from, fmt.Sprintf("%s.%d", path, i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("rotate %s: %w", path, err)
+		}
+	}
+	if err := os.Rename(path, path+".1"); err != nil {
+		// Windows cannot rename a file the scheduler still has open; try again next run
+		return fmt.Errorf("rotate %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+// Package netcond detects whether the machine is online and whether the current network
+// connection is metered (cellular, a phone hotspot, or marked as metered by the user).
+// Detection is best-effort: when the platform gives no answer, Metered returns an error and
+// callers should assume unmetered.
+package netcond
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// ErrUnknown is returned when the connection's cost could not be determined
+var ErrUnknown = errors.New("metered state unknown")
+
+// detectTimeout bounds the external commands used for detection
+const detectTimeout = 10 * time.Second
+
+// Metered reports whether the current connection is metered, with a short reason when it is
+func Metered(ctx context.Context) (bool, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, detectTimeout)
+	defer cancel()
+
+	switch runtime.GOOS {
+	case "linux":
+		return meteredLinux(ctx)
+	case "darwin":
+		return meteredDarwin(ctx)
+	case "windows":
+		return meteredWindows(ctx)
+	default:
+		return false, "", fmt.Errorf("%w: not supported on %s", ErrUnknown, runtime.GOOS)
+	}
+}
+
+// meteredLinux asks NetworkManager for its global Metered property
+func meteredLinux(ctx context.Context) (bool, string, error) {
+	out, err := exec.CommandContext(ctx, "busctl", "get-property",
+		"org.freedesktop.NetworkManager", "/org/freedesktop/NetworkManager",
+		"org.freedesktop.NetworkManager", "Metered").Output()
+	if err != nil {
+		return false, "", fmt.Errorf("%w: NetworkManager not available: %v", ErrUnknown, err)
+	}
+	return parseNetworkManagerMetered(string(out))
+}
+
+// parseNetworkManagerMetered parses busctl output such as "u 4". NetworkManager's NMMetered
+// values are 0 unknown, 1 yes, 2 no, 3 guess-yes and 4 guess-no.
+func parseNetworkManagerMetered(out string) (bool, string, error) {
+	fields := strings.Fields(out)
+	if len(fields) != 2 || fields[0] != "u" {
+		return false, "", fmt.Errorf("%w: unexpected NetworkManager output %q", ErrUnknown, strings.TrimSpace(out))
+	}
+	switch fields[1] {
+	case "1":
+		return true, "NetworkManager reports a metered connection", nil
+	case "3":
+		return true, "NetworkManager guesses a metered connection (e.g. mobile broadband or a phone hotspot)", nil
+	case "2", "4":
+		return false, "", nil
+	default:
+		return false, "", fmt.Errorf("%w: NetworkManager does not know", ErrUnknown)
+	}
+}
+
+// meteredDarwin has no system-wide "metered" flag to read, so it recognizes an iPhone
+// Personal Hotspot by its fixed 172.20.10.0/28 subnet on the default route's gateway
+func meteredDarwin(ctx context.Context) (bool, string, error) {
+	out, err := exec.CommandContext(ctx, "route", "-n", "get", "default").Output()
+	if err != nil {
+		return false, "", fmt.Errorf("%w: route: %v", ErrUnknown, err)
+	}
+	return parseDarwinDefaultRoute(string(out))
+}
+
+// iPhone Personal Hotspot clients always get an address in this subnet
+var personalHotspotNet = &net.IPNet{IP: net.IPv4(172, 20, 10, 0), Mask: net.CIDRMask(28, 32)}
+
+// parseDarwinDefaultRoute parses `route -n get default` output for the gateway line
+func parseDarwinDefaultRoute(out string) (bool, string, error) {
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !ok || key != "gateway" {
+			continue
+		}
+		gateway := net.ParseIP(strings.TrimSpace(value))
+		if gateway == nil {
+			break
+		}
+		if personalHotspotNet.Contains(gateway) {
+			return true, "connected through an iPhone Personal Hotspot", nil
+		}
+		return false, "", nil
+	}
+	return false, "", fmt.Errorf("%w: no default gateway", ErrUnknown)
+}
+
+// meteredWindows reads the cost of the internet connection profile, which covers cellular
+// connections and networks the user set as metered
+func meteredWindows(ctx context.Context) (bool, string, error) {
+	const script = `$p = [Windows.Networking.Connectivity.NetworkInformation,Windows.Networking.Connectivity,ContentType=WindowsRuntime]::GetInternetConnectionProfile(); ` +
+		`if ($p) { $p.GetConnectionCost().NetworkCostType }`
+	out, err := exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", script).Output()
+	if err != nil {
+		return false, "", fmt.Errorf("%w: powershell: %v", ErrUnknown, err)
+	}
+	return parseWindowsCostType(string(out))
+}
+
+// parseWindowsCostType parses a NetworkCostType: Unrestricted, Fixed, Variable or Unknown
+func parseWindowsCostType(out string) (bool, string, error) {
+	switch strings.TrimSpace(out) {
+	case "Unrestricted":
+		return false, "", nil
+	case "Fixed", "Variable":
+		return true, fmt.Sprintf("Windows reports a metered connection (cost: %s)", strings.TrimSpace(out)), nil
+	case "":
+		return false, "", fmt.Errorf("%w: no internet connection profile", ErrUnknown)
+	default:
+		return false, "", fmt.Errorf("%w: connection cost %q", ErrUnknown, strings.TrimSpace(out))
+	}
+}
+
+// Online reports whether any network interface other than loopback is up and running (has a
+// link) with a routable (not link-local) address. Bridges such as docker0 or a VM's keep their
+// address while the machine is offline, but are not running without attached links.
+// It can't tell whether the repository is reachable, only that the machine is not offline.
+func Online() (bool, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return false, fmt.Errorf("list network interfaces: %w", err)
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagRunning == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if ok && ipNet.IP.IsGlobalUnicast() {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
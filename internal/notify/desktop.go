@@ -0,0 +1,53 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Desktop shows a native notification to the logged-in user: Notification Center on macOS,
+// a toast on Windows, notify-send (libnotify) on Linux and the BSDs
+type Desktop struct{}
+
+// Environment variables carrying the notification text to osascript and PowerShell, so it
+// never has to be quoted into a script
+const (
+	envTitle   = "XENTZ_NOTIFY_TITLE"
+	envMessage = "XENTZ_NOTIFY_MESSAGE"
+)
+
+// windowsToast shows a toast through the WinRT notification API
+var windowsToast = strings.Join([]string{
+	`[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null`,
+	`$t = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)`,
+	`$x = $t.GetElementsByTagName('text')`,
+	`$x.Item(0).AppendChild($t.CreateTextNode($env:` + envTitle + `)) > $null`,
+	`$x.Item(1).AppendChild($t.CreateTextNode($env:` + envMessage + `)) > $null`,
+	`[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('xentz-agent').Show([Windows.UI.Notifications.ToastNotification]::new($t))`,
+}, "; ")
+
+// Notify shows ev as a desktop notification
+func (Desktop) Notify(ctx context.Context, ev Event) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.CommandContext(ctx, "osascript", "-e",
+			`display notification (system attribute "`+envMessage+`") with title (system attribute "`+envTitle+`")`)
+	case "windows":
+		cmd = exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", windowsToast)
+	default:
+		cmd = exec.CommandContext(ctx, "notify-send", "--app-name=xentz-agent", "--urgency=critical", "--", ev.title(), ev.message())
+	}
+	cmd.Env = append(os.Environ(), envTitle+"="+ev.title(), envMessage+"="+ev.message())
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%s: %w: %s", cmd.Args[0], err, msg)
+		}
+		return fmt.Errorf("%s: %w", cmd.Args[0], err)
+	}
+	return nil
+}
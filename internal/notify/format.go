@@ -0,0 +1,135 @@
+package notify
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"xentz-agent/internal/humanize"
+)
+
+// Webhook payload formats (config "notify.format")
+const (
+	FormatRaw   = "raw"   // The Event as JSON
+	FormatSlack = "slack" // Slack Block Kit message (incoming webhook)
+	FormatTeams = "teams" // Microsoft Teams MessageCard (incoming webhook connector)
+)
+
+// validFormat checks a webhook payload format ("" = FormatRaw)
+func validFormat(format string) error {
+	switch format {
+	case "", FormatRaw, FormatSlack, FormatTeams:
+		return nil
+	}
+	return fmt.Errorf("unknown webhook format %q (expected %q, %q or %q)", format, FormatRaw, FormatSlack, FormatTeams)
+}
+
+// render builds the webhook request body for ev in format
+func render(format string, ev Event) ([]byte, error) {
+	switch format {
+	case "", FormatRaw:
+		return json.Marshal(ev)
+	case FormatSlack:
+		return json.Marshal(slackMessage(ev))
+	case FormatTeams:
+		return json.Marshal(teamsMessage(ev))
+	}
+	return nil, validFormat(format)
+}
+
+// fact is one labelled value shown in a chat message
+type fact struct {
+	name, value string
+}
+
+// facts lists the run details shown in chat messages
+func (ev Event) facts() []fact {
+	device := cmp.Or(ev.DeviceID, ev.Hostname, "unknown")
+	if ev.Hostname != "" && ev.DeviceID != "" {
+		device = fmt.Sprintf("%s (%s)", ev.Hostname, ev.DeviceID)
+	}
+	facts := []fact{
+		{"Device", device},
+		{"Status", ev.Status},
+	}
+	if ev.Duration != "" {
+		facts = append(facts, fact{"Duration", ev.Duration})
+	}
+	if ev.Job == "backup" {
+		facts = append(facts, fact{"Data added", humanize.Bytes(ev.BytesAdded)})
+	}
+	if ev.ErrorKind != "" {
+		facts = append(facts, fact{"Error kind", ev.ErrorKind})
+	}
+	return facts
+}
+
+// Slack Block Kit: https://api.slack.com/block-kit
+type slackPayload struct {
+	Text   string       `json:"text"` // Fallback for notifications and clients without blocks
+	Blocks []slackBlock `json:"blocks"`
+}
+
+type slackBlock struct {
+	Type   string       `json:"type"`
+	Text   *slackText   `json:"text,omitempty"`
+	Fields []*slackText `json:"fields,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"` // "plain_text" or "mrkdwn"
+	Text string `json:"text"`
+}
+
+func slackMessage(ev Event) slackPayload {
+	var fields []*slackText
+	for _, f := range ev.facts() {
+		fields = append(fields, &slackText{Type: "mrkdwn", Text: fmt.Sprintf("*%s*\n%s", f.name, f.value)})
+	}
+	// A code block can't contain its own fence
+	excerpt := strings.ReplaceAll(ev.message(), "```", "'''")
+	return slackPayload{
+		Text: ev.title() + ": " + ev.message(),
+		Blocks: []slackBlock{
+			{Type: "header", Text: &slackText{Type: "plain_text", Text: ev.title()}},
+			{Type: "section", Fields: fields},
+			{Type: "section", Text: &slackText{Type: "mrkdwn", Text: "```" + excerpt + "```"}},
+		},
+	}
+}
+
+// Teams MessageCard: https://learn.microsoft.com/outlook/actionable-messages/message-card-reference
+type teamsPayload struct {
+	Type       string         `json:"@type"`
+	Context    string         `json:"@context"`
+	Summary    string         `json:"summary"`
+	ThemeColor string         `json:"themeColor"`
+	Title      string         `json:"title"`
+	Sections   []teamsSection `json:"sections"`
+}
+
+type teamsSection struct {
+	Facts []teamsFact `json:"facts"`
+	Text  string      `json:"text"`
+}
+
+type teamsFact struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func teamsMessage(ev Event) teamsPayload {
+	var facts []teamsFact
+	for _, f := range ev.facts() {
+		facts = append(facts, teamsFact{Name: f.name, Value: f.value})
+	}
+	return teamsPayload{
+		Type:       "MessageCard",
+		Context:    "https://schema.org/extensions",
+		Summary:    ev.title(),
+		ThemeColor: "D70000",
+		Title:      ev.title(),
+		Sections:   []teamsSection{{Facts: facts, Text: ev.message()}},
+	}
+}
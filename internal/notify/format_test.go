@@ -0,0 +1,94 @@
+package notify
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+var testEvent = Event{
+	Job:        "backup",
+	Status:     "error",
+	Error:      "restic backup failed: ```dial tcp: no such host```",
+	ErrorKind:  "repo_unreachable",
+	Duration:   "1m5s",
+	BytesAdded: 1536,
+	DeviceID:   "dev-1",
+	Hostname:   "laptop",
+	Time:       "2026-03-10T02:30:00Z",
+}
+
+// assertJSON compares a rendered payload with the expected JSON, ignoring formatting
+func assertJSON(t *testing.T, name string, got []byte, want string) {
+	t.Helper()
+	var g, w any
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("%s: payload is not JSON: %v\n%s", name, err, got)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("%s: bad expected JSON: %v", name, err)
+	}
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("%s payload =\n%s\nwant\n%s", name, got, want)
+	}
+}
+
+func TestRenderSlack(t *testing.T) {
+	got, err := render(FormatSlack, testEvent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, "slack", got, `{
+		"text": "xentz-agent: backup failed: restic backup failed: `+"```dial tcp: no such host```"+`",
+		"blocks": [
+			{"type": "header", "text": {"type": "plain_text", "text": "xentz-agent: backup failed"}},
+			{"type": "section", "fields": [
+				{"type": "mrkdwn", "text": "*Device*\nlaptop (dev-1)"},
+				{"type": "mrkdwn", "text": "*Status*\nerror"},
+				{"type": "mrkdwn", "text": "*Duration*\n1m5s"},
+				{"type": "mrkdwn", "text": "*Data added*\n1.5 KiB"},
+				{"type": "mrkdwn", "text": "*Error kind*\nrepo_unreachable"}
+			]},
+			{"type": "section", "text": {"type": "mrkdwn", "text": "`+"```restic backup failed: '''dial tcp: no such host'''```"+`"}}
+		]
+	}`)
+}
+
+func TestRenderTeams(t *testing.T) {
+	ev := testEvent
+	ev.Job, ev.Error, ev.ErrorKind, ev.Duration, ev.Hostname = "retention", "", "", "", ""
+	got, err := render(FormatTeams, ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, "teams", got, `{
+		"@type": "MessageCard",
+		"@context": "https://schema.org/extensions",
+		"summary": "xentz-agent: retention failed",
+		"themeColor": "D70000",
+		"title": "xentz-agent: retention failed",
+		"sections": [{
+			"facts": [
+				{"name": "Device", "value": "dev-1"},
+				{"name": "Status", "value": "error"}
+			],
+			"text": "See the agent log for details."
+		}]
+	}`)
+}
+
+func TestRenderRaw(t *testing.T) {
+	for _, format := range []string{"", FormatRaw} {
+		got, err := render(format, testEvent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ev Event
+		if err := json.Unmarshal(got, &ev); err != nil || ev != testEvent {
+			t.Errorf("render(%q) = %s, %v; want the event as JSON", format, got, err)
+		}
+	}
+	if _, err := render("discord", testEvent); err == nil {
+		t.Error("render with an unknown format: want an error")
+	}
+}
@@ -0,0 +1,67 @@
+// Package notify announces failed backup and retention runs, either to the logged-in user
+// (desktop notification) or to another system (webhook). Delivery is best-effort.
+package notify
+
+import (
+	"context"
+	"fmt"
+)
+
+// Notifier types (config "notify.type")
+const (
+	TypeDesktop = "desktop"
+	TypeWebhook = "webhook"
+)
+
+// Event describes a finished run; it is also the webhook payload
+type Event struct {
+	Job        string `json:"job"`    // "backup", "retention" or "check"
+	Status     string `json:"status"` // "error"
+	Error      string `json:"error,omitempty"`
+	ErrorKind  string `json:"error_kind,omitempty"`
+	Duration   string `json:"duration,omitempty"`
+	BytesAdded int64  `json:"bytes_added,omitempty"` // Data added to the repository (backups)
+	DeviceID   string `json:"device_id,omitempty"`
+	Hostname   string `json:"hostname,omitempty"`
+	Time       string `json:"time"` // RFC3339 UTC
+}
+
+// Notifier delivers an Event
+type Notifier interface {
+	Notify(ctx context.Context, ev Event) error
+}
+
+// New returns the Notifier for typ ("" = TypeDesktop). format selects the webhook payload
+// (FormatRaw, FormatSlack or FormatTeams; "" = FormatRaw).
+func New(typ, webhookURL, format string) (Notifier, error) {
+	switch typ {
+	case "", TypeDesktop:
+		return Desktop{}, nil
+	case TypeWebhook:
+		if webhookURL == "" {
+			return nil, fmt.Errorf("webhook notifications need a webhook URL")
+		}
+		if err := validFormat(format); err != nil {
+			return nil, err
+		}
+		return Webhook{URL: webhookURL, Format: format}, nil
+	default:
+		return nil, fmt.Errorf("unknown notification type %q (expected %q or %q)", typ, TypeDesktop, TypeWebhook)
+	}
+}
+
+// title and message are the text of a desktop notification
+func (ev Event) title() string {
+	return fmt.Sprintf("xentz-agent: %s failed", ev.Job)
+}
+
+func (ev Event) message() string {
+	msg := ev.Error
+	if len(msg) > 200 {
+		msg = msg[:200] + "..."
+	}
+	if msg == "" {
+		msg = "See the agent log for details."
+	}
+	return msg
+}
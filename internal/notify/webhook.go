@@ -0,0 +1,51 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"xentz-agent/internal/httpx"
+	"xentz-agent/internal/logx"
+)
+
+// Webhook POSTs the Event to URL as JSON, or as a Slack or Teams message (see Format).
+// It uses httpx.ExternalClient: the control plane's CA bundle and certificate pin don't apply.
+type Webhook struct {
+	URL    string
+	Format string // FormatRaw (default), FormatSlack or FormatTeams
+}
+
+// Notify posts ev to the webhook. Any 2xx answer counts as delivered.
+func (w Webhook) Notify(ctx context.Context, ev Event) error {
+	// Validate webhook URL to prevent SSRF
+	if err := httpx.ValidateServerURL(w.URL); err != nil {
+		return fmt.Errorf("invalid webhook URL: %w", err)
+	}
+
+	body, err := render(w.Format, ev)
+	if err != nil {
+		return fmt.Errorf("marshal notification: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", w.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpx.ExternalClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var errMsg bytes.Buffer
+		io.CopyN(&errMsg, resp.Body, 256)
+		return fmt.Errorf("webhook failed (status %d): %s", resp.StatusCode, strings.TrimSpace(logx.Redact(errMsg.String())))
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+// Package power detects whether the machine is running on battery. Machines without a
+// battery (desktops, servers) always report AC power.
+package power
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// detectTimeout bounds the external commands used for detection
+const detectTimeout = 10 * time.Second
+
+// OnBattery reports whether the machine is currently running on battery power
+func OnBattery(ctx context.Context) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, detectTimeout)
+	defer cancel()
+
+	switch runtime.GOOS {
+	case "darwin":
+		out, err := exec.CommandContext(ctx, "pmset", "-g", "batt").Output()
+		if err != nil {
+			return false, fmt.Errorf("pmset: %w", err)
+		}
+		return parsePmset(string(out))
+	case "windows":
+		return onBatteryWindows()
+	case "linux":
+		supplies, err := readPowerSupplies("/sys/class/power_supply")
+		if err != nil {
+			return false, err
+		}
+		return onBatteryLinux(supplies), nil
+	default:
+		return false, fmt.Errorf("power state detection is not supported on %s", runtime.GOOS)
+	}
+}
+
+// parsePmset parses `pmset -g batt`, whose first line is e.g. "Now drawing from 'Battery Power'"
+func parsePmset(out string) (bool, error) {
+	first, _, _ := strings.Cut(out, "\n")
+	_, source, ok := strings.Cut(first, "drawing from '")
+	if !ok {
+		return false, fmt.Errorf("unexpected pmset output: %q", strings.TrimSpace(first))
+	}
+	source, _, _ = strings.Cut(source, "'")
+	return source == "Battery Power", nil
+}
+
+// parseWindowsPowerStatus interprets SYSTEM_POWER_STATUS: ACLineStatus is 0 (offline), 1 (online)
+// or 255 (unknown); BatteryFlag 128 means there is no system battery
+func parseWindowsPowerStatus(acLineStatus, batteryFlag byte) (bool, error) {
+	if batteryFlag == 128 {
+		return false, nil
+	}
+	switch acLineStatus {
+	case 0:
+		return true, nil
+	case 1:
+		return false, nil
+	default:
+		return false, fmt.Errorf("AC line status unknown")
+	}
+}
+
+// powerSupply is one entry of /sys/class/power_supply
+type powerSupply struct {
+	Type   string // "Mains", "Battery", "USB", "UPS", ...
+	Online string // "1" when an external supply is connected (Mains/USB only)
+	Status string // "Charging", "Discharging", "Full", ... (Battery only)
+}
+
+// readPowerSupplies reads the type, online and status attributes of every supply under dir
+func readPowerSupplies(dir string) ([]powerSupply, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read power supplies: %w", err)
+	}
+	read := func(supply, attr string) string {
+		b, _ := os.ReadFile(filepath.Join(dir, supply, attr))
+		return strings.TrimSpace(string(b))
+	}
+	var supplies []powerSupply
+	for _, e := range entries {
+		supplies = append(supplies, powerSupply{
+			Type:   read(e.Name(), "type"),
+			Online: read(e.Name(), "online"),
+			Status: read(e.Name(), "status"),
+		})
+	}
+	return supplies, nil
+}
+
+// onBatteryLinux reports battery power when no external supply is online and a system
+// battery is discharging. No battery at all (a desktop) means AC.
+func onBatteryLinux(supplies []powerSupply) bool {
+	discharging := false
+	for _, s := range supplies {
+		switch s.Type {
+		case "Mains", "USB":
+			if s.Online == "1" {
+				return false
+			}
+		case "Battery":
+			if s.Status == "Discharging" {
+				discharging = true
+			}
+		}
+	}
+	return discharging
+}
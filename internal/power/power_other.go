@@ -0,0 +1,9 @@
+//go:build !windows
+
+package power
+
+import "fmt"
+
+func onBatteryWindows() (bool, error) {
+	return false, fmt.Errorf("GetSystemPowerStatus is only available on Windows")
+}
@@ -0,0 +1,122 @@
+package power
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParsePmset(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     string
+		want    bool
+		wantErr bool
+	}{
+		{"AC", "Now drawing from 'AC Power'\n -InternalBattery-0 (id=4653155)\t100%; charged; 0:00 remaining present: true\n", false, false},
+		{"battery", "Now drawing from 'Battery Power'\n -InternalBattery-0 (id=4653155)\t87%; discharging; 5:12 remaining present: true\n", true, false},
+		{"UPS", "Now drawing from 'UPS Power'\n", false, false},
+		{"desktop", "Now drawing from 'AC Power'\n", false, false},
+		{"garbage", "pmset: command failed\n", false, true},
+		{"empty", "", false, true},
+	}
+	for _, tt := range tests {
+		got, err := parsePmset(tt.out)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%s: parsePmset = %v, %v; want %v (error: %v)", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseWindowsPowerStatus(t *testing.T) {
+	tests := []struct {
+		name         string
+		acLineStatus byte
+		batteryFlag  byte
+		want         bool
+		wantErr      bool
+	}{
+		{"offline", 0, 0, true, false},
+		{"offline, battery low", 0, 2, true, false},
+		{"online", 1, 8, false, false},
+		{"unknown", 255, 0, false, true},
+		{"no system battery", 0, 128, false, false},
+		{"no system battery, unknown AC", 255, 128, false, false},
+	}
+	for _, tt := range tests {
+		got, err := parseWindowsPowerStatus(tt.acLineStatus, tt.batteryFlag)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%s: parseWindowsPowerStatus(%d, %d) = %v, %v; want %v (error: %v)",
+				tt.name, tt.acLineStatus, tt.batteryFlag, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// writeSupplies creates a /sys/class/power_supply fixture: supply name -> attribute -> value
+func writeSupplies(t *testing.T, supplies map[string]map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, attrs := range supplies {
+		if err := os.Mkdir(filepath.Join(dir, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		for attr, value := range attrs {
+			if err := os.WriteFile(filepath.Join(dir, name, attr), []byte(value+"\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return dir
+}
+
+func TestOnBatteryLinux(t *testing.T) {
+	tests := []struct {
+		name     string
+		supplies map[string]map[string]string
+		want     bool
+	}{
+		{"desktop", nil, false},
+		{"mains online", map[string]map[string]string{
+			"AC":   {"type": "Mains", "online": "1"},
+			"BAT0": {"type": "Battery", "status": "Charging"},
+		}, false},
+		{"discharging battery", map[string]map[string]string{
+			"AC":   {"type": "Mains", "online": "0"},
+			"BAT0": {"type": "Battery", "status": "Discharging"},
+		}, true},
+		{"USB-C charger online", map[string]map[string]string{
+			"ucsi-source-psy-USBC000-001": {"type": "USB", "online": "1"},
+			"BAT0":                        {"type": "Battery", "status": "Discharging"},
+		}, false},
+		{"full battery, mains offline", map[string]map[string]string{
+			"AC":   {"type": "Mains", "online": "0"},
+			"BAT0": {"type": "Battery", "status": "Full"},
+		}, false},
+		{"peripheral battery, mains online", map[string]map[string]string{
+			"hidpp_battery_0": {"type": "Battery", "status": "Discharging", "scope": "Device"},
+			"AC":              {"type": "Mains", "online": "1"},
+		}, false},
+	}
+	for _, tt := range tests {
+		supplies, err := readPowerSupplies(writeSupplies(t, tt.supplies))
+		if err != nil {
+			t.Fatalf("%s: readPowerSupplies: %v", tt.name, err)
+		}
+		if len(supplies) != len(tt.supplies) {
+			t.Errorf("%s: read %d supplies, want %d", tt.name, len(supplies), len(tt.supplies))
+		}
+		if got := onBatteryLinux(supplies); got != tt.want {
+			t.Errorf("%s: onBatteryLinux = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReadPowerSuppliesMissingDir(t *testing.T) {
+	supplies, err := readPowerSupplies(filepath.Join(t.TempDir(), "power_supply"))
+	if err != nil || supplies != nil {
+		t.Errorf("readPowerSupplies(missing) = %v, %v; want none and no error", supplies, err)
+	}
+	if onBatteryLinux(supplies) {
+		t.Error("no power supplies: want AC power")
+	}
+}
@@ -0,0 +1,31 @@
+package power
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32                 = syscall.NewLazyDLL("kernel32.dll")
+	procGetSystemPowerStatus = kernel32.NewProc("GetSystemPowerStatus")
+)
+
+// systemPowerStatus mirrors the Win32 SYSTEM_POWER_STATUS structure
+type systemPowerStatus struct {
+	ACLineStatus        byte
+	BatteryFlag         byte
+	BatteryLifePercent  byte
+	SystemStatusFlag    byte
+	BatteryLifeTime     uint32
+	BatteryFullLifeTime uint32
+}
+
+func onBatteryWindows() (bool, error) {
+	var status systemPowerStatus
+	ret, _, err := procGetSystemPowerStatus.Call(uintptr(unsafe.Pointer(&status)))
+	if ret == 0 {
+		return false, fmt.Errorf("GetSystemPowerStatus: %w", err)
+	}
+	return parseWindowsPowerStatus(status.ACLineStatus, status.BatteryFlag)
+}
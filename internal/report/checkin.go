@@ -0,0 +1,131 @@
+package report
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"xentz-agent/internal/fsutil"
+	"xentz-agent/internal/httpx"
+	"xentz-agent/internal/logx"
+)
+
+// Checkin is a small heartbeat telling the control plane the device is alive
+type Checkin struct {
+	DeviceID         string `json:"device_id"`
+	AgentVersion     string `json:"agent_version"`
+	OS               string `json:"os"`
+	Arch             string `json:"arch"`
+	SentAt           string `json:"sent_at"`                      // RFC3339 UTC
+	LastBackupStatus string `json:"last_backup_status,omitempty"` // "success", "degraded", "error", or empty if no backup has run
+	LastBackupAt     string `json:"last_backup_at,omitempty"`     // RFC3339 UTC
+}
+
+// getPendingCheckinPath returns the path of the spooled check-in.
+// Only the latest check-in is kept: an older heartbeat carries no extra information.
+func getPendingCheckinPath() (string, error) {
+	spoolDir, err := getSpoolDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(spoolDir, "checkin", "pending.json"), nil
+}
+
+// SendCheckin sends a heartbeat to the server
+func SendCheckin(serverURL, deviceAPIKey string, checkin Checkin) error {
+	if serverURL == "" {
+		return fmt.Errorf("server URL is required")
+	}
+	if deviceAPIKey == "" {
+		return fmt.Errorf("device API key is required")
+	}
+
+	// Validate server URL to prevent SSRF
+	if err := httpx.ValidateServerURL(serverURL); err != nil {
+		return fmt.Errorf("invalid server URL: %w", err)
+	}
+
+	jsonData, err := json.Marshal(checkin)
+	if err != nil {
+		return fmt.Errorf("marshal checkin: %w", err)
+	}
+
+	// Note: nginx proxies /control/* to the control plane backend
+	url := fmt.Sprintf("%s/control/v1/checkin", serverURL)
+	return postJSON(url, deviceAPIKey, jsonData)
+}
+
+// SendCheckinWithSpool sends a heartbeat, retrying transient failures.
+// If it still cannot be delivered it is spooled (replacing any older spooled check-in).
+func SendCheckinWithSpool(serverURL, deviceAPIKey string, checkin Checkin) error {
+	err := withRetry("checkin", defaultRetryAttempts, defaultRetryDelay, func() error {
+		return SendCheckin(serverURL, deviceAPIKey, checkin)
+	})
+	if err == nil {
+		// Anything spooled earlier is superseded by this check-in
+		if path, pathErr := getPendingCheckinPath(); pathErr == nil {
+			_ = os.Remove(path)
+		}
+		return nil
+	}
+
+	logx.Printf("warning: failed to send checkin to server: %v", err)
+	if spoolErr := spoolCheckin(checkin); spoolErr != nil {
+		logx.Printf("error: failed to spool checkin: %v", spoolErr)
+		return fmt.Errorf("send failed and spool failed: send=%v, spool=%v", err, spoolErr)
+	}
+	logx.Println("Checkin spooled for retry")
+	return err
+}
+
+// SendPendingCheckin sends a previously spooled check-in, if any
+func SendPendingCheckin(serverURL, deviceAPIKey string) error {
+	if serverURL == "" || deviceAPIKey == "" {
+		return nil
+	}
+
+	path, err := getPendingCheckinPath()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("read spooled checkin: %w", err)
+	}
+
+	var checkin Checkin
+	if err := json.Unmarshal(data, &checkin); err != nil {
+		// Corrupt spool file: drop it rather than failing forever
+		_ = os.Remove(path)
+		return fmt.Errorf("parse spooled checkin: %w", err)
+	}
+
+	if err := SendCheckin(serverURL, deviceAPIKey, checkin); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// spoolCheckin writes the check-in to the spool, replacing any older one
+func spoolCheckin(checkin Checkin) error {
+	path, err := getPendingCheckinPath()
+	if err != nil {
+		return fmt.Errorf("get spool dir: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create spool dir: %w", err)
+	}
+	data, err := json.Marshal(checkin)
+	if err != nil {
+		return fmt.Errorf("marshal checkin: %w", err)
+	}
+	if err := fsutil.WriteFileAtomic(path, data, 0o600); err != nil {
+		return fmt.Errorf("write spool file: %w", err)
+	}
+	return nil
+}
@@ -2,39 +2,143 @@ package report
 
 import (
 	"bytes"
+	"cmp"
+	"compress/gzip"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"math/rand/v2"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"xentz-agent/internal/validation"
+	"xentz-agent/internal/fsutil"
+	"xentz-agent/internal/httpx"
+	"xentz-agent/internal/humanize"
+	"xentz-agent/internal/logx"
+	"xentz-agent/internal/state"
 )
 
 const (
 	maxErrorLength    = 4096 // Maximum error message length in bytes
 	maxPendingReports = 20
+
+	// Spool file extensions; new reports are written gzip-compressed
+	spoolExtGzip = ".json.gz"
+	spoolExtJSON = ".json"
+
+	// Retry policy for sending the current run's report (1s, 2s, 4s... plus jitter)
+	defaultRetryAttempts = 3
+	defaultRetryDelay    = time.Second
+
+	// Flushing spooled reports one by one: parallel requests, and the minimum gap between
+	// request starts across all workers (at most 20 requests per second)
+	maxReportWorkers   = 16
+	reportSendInterval = 50 * time.Millisecond
 )
 
+// DefaultReportWorkers is the number of parallel requests used to flush spooled reports
+const DefaultReportWorkers = 4
+
+// Spool limits unless configured: total size of spooled reports (SpoolReport fails beyond it),
+// and the age after which CleanupOldReports deletes them unsent
+const (
+	DefaultSpoolMaxBytes = 100 * 1024 * 1024 // 100MB
+	DefaultSpoolMaxAge   = 30 * 24 * time.Hour
+)
+
+var spoolLimits = struct {
+	mu       sync.Mutex
+	maxBytes int64
+	maxAge   time.Duration
+}{maxBytes: DefaultSpoolMaxBytes, maxAge: DefaultSpoolMaxAge}
+
+// ConfigureSpool sets the spool size cap and maximum report age (0 = the default)
+func ConfigureSpool(maxBytes int64, maxAge time.Duration) {
+	spoolLimits.mu.Lock()
+	defer spoolLimits.mu.Unlock()
+	spoolLimits.maxBytes = cmp.Or(maxBytes, DefaultSpoolMaxBytes)
+	spoolLimits.maxAge = cmp.Or(maxAge, DefaultSpoolMaxAge)
+}
+
+// SpoolMaxBytes returns the configured spool size cap
+func SpoolMaxBytes() int64 {
+	spoolLimits.mu.Lock()
+	defer spoolLimits.mu.Unlock()
+	return spoolLimits.maxBytes
+}
+
+// SpoolMaxAge returns the configured age after which spooled reports are deleted unsent
+func SpoolMaxAge() time.Duration {
+	spoolLimits.mu.Lock()
+	defer spoolLimits.mu.Unlock()
+	return spoolLimits.maxAge
+}
+
 // Report represents a backup or retention run report
 type Report struct {
 	DeviceID       string `json:"device_id"`
-	Job            string `json:"job"`         // "backup" or "retention"
+	Job            string `json:"job"`         // "backup", "retention" or "check"
 	StartedAt      string `json:"started_at"`  // RFC3339 UTC
 	FinishedAt     string `json:"finished_at"` // RFC3339 UTC
-	Status         string `json:"status"`      // "success" or "failure"
+	Status         string `json:"status"`      // "success", "failure" or "skipped"
 	DurationMS     int64  `json:"duration_ms"`
 	FilesTotal     int64  `json:"files_total,omitempty"`
 	BytesTotal     int64  `json:"bytes_total,omitempty"`
 	DataAddedBytes int64  `json:"data_added_bytes,omitempty"`
 	SnapshotID     string `json:"snapshot_id,omitempty"`
-	Error          string `json:"error,omitempty"` // Truncated to 4096 bytes
+	ResticVersion  string `json:"restic_version,omitempty"`
+	RepoSizeBytes  int64  `json:"repo_size_bytes,omitempty"` // Stored (deduplicated) size from the last stats run
+	ErrorsCount    int    `json:"errors_count,omitempty"`    // Files restic could not read; the run is "degraded"
+	Error          string `json:"error,omitempty"`           // Truncated to 4096 bytes
+	ErrorKind      string `json:"error_kind,omitempty"`      // Failure category, e.g. "repo_unreachable" or "auth_failed"
+}
+
+// FromLastRun builds the report for a finished run. "error" runs are reported as "failure",
+// "skipped" runs as "skipped" (with the reason as Error), all others (including "degraded")
+// as "success". Runs recorded before LastRun had StartedAt/FinishedAt get them derived from
+// TimeUTC and the duration.
+func FromLastRun(job, deviceID string, r state.LastRun) Report {
+	status := "success"
+	switch r.Status {
+	case "error":
+		status = "failure"
+	case "skipped":
+		status = "skipped"
+	}
+	report := Report{
+		DeviceID:       deviceID,
+		Job:            job,
+		Status:         status,
+		DurationMS:     r.DurationMS,
+		FilesTotal:     r.FilesTotal,
+		BytesTotal:     r.BytesTotal,
+		DataAddedBytes: r.DataAddedBytes,
+		SnapshotID:     r.SnapshotID,
+		ErrorsCount:    r.ErrorsCount,
+		Error:          cmp.Or(r.Error, r.SkipReason),
+		ErrorKind:      r.ErrorKind,
+		StartedAt:      r.StartedAt,
+		FinishedAt:     r.FinishedAt,
+	}
+	if report.StartedAt != "" && report.FinishedAt != "" {
+		return report
+	}
+	finished, err := time.Parse(time.RFC3339, r.TimeUTC)
+	if err != nil {
+		finished = time.Now()
+	}
+	report.FinishedAt = finished.UTC().Format(time.RFC3339)
+	report.StartedAt = finished.Add(-time.Duration(r.DurationMS) * time.Millisecond).UTC().Format(time.RFC3339)
+	return report
 }
 
 // getSpoolDir returns the spool directory path
@@ -72,7 +176,7 @@ func SendReport(serverURL, deviceAPIKey string, report Report) error {
 	}
 
 	// Validate server URL to prevent SSRF
-	if err := validation.ValidateServerURL(serverURL); err != nil {
+	if err := httpx.ValidateServerURL(serverURL); err != nil {
 		return fmt.Errorf("invalid server URL: %w", err)
 	}
 
@@ -89,17 +193,42 @@ func SendReport(serverURL, deviceAPIKey string, report Report) error {
 	// Make POST request to /control/v1/report
 	// Note: nginx proxies /control/* to the control plane backend
 	url := fmt.Sprintf("%s/control/v1/report", serverURL)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	return postJSON(url, deviceAPIKey, jsonData)
+}
+
+// postJSON POSTs a gzip-compressed JSON body with the device API key.
+// If the server does not accept gzip (415), the body is resent uncompressed.
+func postJSON(url, deviceAPIKey string, jsonData []byte) error {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err := zw.Write(jsonData); err != nil {
+		return fmt.Errorf("compress request: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("compress request: %w", err)
+	}
+
+	err := doPost(url, deviceAPIKey, compressed.Bytes(), true)
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusUnsupportedMediaType {
+		return doPost(url, deviceAPIKey, jsonData, false)
+	}
+	return err
+}
+
+// doPost sends one POST request and converts non-200 responses into a StatusError
+func doPost(url, deviceAPIKey string, body []byte, gzipped bool) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
 	if err != nil {
 		return fmt.Errorf("create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	if gzipped {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", deviceAPIKey))
 
-	// Set timeout
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
+	client := httpx.Client()
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -111,45 +240,188 @@ func SendReport(serverURL, deviceAPIKey string, report Report) error {
 		var errMsg bytes.Buffer
 		// Limit error message to prevent information leakage
 		io.CopyN(&errMsg, resp.Body, 512) // Limit to 512 bytes
-		errStr := strings.TrimSpace(errMsg.String())
+		errStr := strings.TrimSpace(logx.Redact(errMsg.String()))
 		// Remove newlines and limit length
 		errStr = strings.ReplaceAll(errStr, "\n", " ")
 		errStr = strings.ReplaceAll(errStr, "\r", " ")
 		if len(errStr) > 256 {
 			errStr = errStr[:256] + "..."
 		}
-		return fmt.Errorf("report failed (status %d): %s", resp.StatusCode, errStr)
+		return &StatusError{StatusCode: resp.StatusCode, Message: errStr}
 	}
 
 	return nil
 }
 
-// checkSpoolSize checks if spool directory is within size limits
-func checkSpoolSize() error {
-	spoolDir, err := getSpoolDir()
-	if err != nil {
-		return err
+// StatusError is returned when the server answers a report with a non-200 status
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("report failed (status %d): %s", e.StatusCode, e.Message)
+}
+
+// isRetryableStatus reports whether a report rejected with this status may succeed later.
+// Server errors, timeouts and rate limiting are retried; other 4xx (bad request, auth) are not.
+func isRetryableStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return code >= 500
+	}
+}
+
+// isRetryable reports whether a SendReport error is transient (network error or retryable status).
+// TLS and certificate pin failures and refused redirects are permanent and not retried.
+func isRetryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return isRetryableStatus(statusErr.StatusCode)
+	}
+	if httpx.IsTLSError(err) || errors.Is(err, httpx.ErrRedirectRefused) {
+		return false
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// SendReportWithRetry sends a report, retrying transient failures up to attempts times in total.
+// The delay starts at baseDelay and doubles after each attempt, with up to 50% random jitter added.
+// Non-retryable failures (e.g. 401/403) are returned immediately.
+func SendReportWithRetry(serverURL, deviceAPIKey string, report Report, attempts int, baseDelay time.Duration) error {
+	return withRetry("report", attempts, baseDelay, func() error {
+		return SendReport(serverURL, deviceAPIKey, report)
+	})
+}
+
+// withRetry calls send until it succeeds, fails with a non-retryable error, or attempts run out
+func withRetry(what string, attempts int, baseDelay time.Duration, send func() error) error {
+	if attempts < 1 {
+		attempts = 1
 	}
-	var totalSize int64
+
+	var err error
+	delay := baseDelay
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = send()
+		if err == nil || !isRetryable(err) || attempt == attempts {
+			return err
+		}
+
+		wait := delay
+		if delay > 0 {
+			wait += rand.N(delay/2 + 1)
+		}
+		logx.Printf("warning: %s attempt %d/%d failed, retrying in %s: %v", what, attempt, attempts, wait.Round(time.Millisecond), err)
+		time.Sleep(wait)
+		delay *= 2
+	}
+	return err
+}
+
+// spoolUsage caches the spool's report count and size for this process, so spooling a report
+// doesn't rescan the directory. It is loaded from a scan on first use, updated when a report
+// is written, and reset after reports are removed (the next check rescans).
+var spoolUsage struct {
+	mu     sync.Mutex
+	loaded bool
+	count  int
+	bytes  int64
+}
+
+// scanSpool counts the spooled reports in spoolDir, their total size and the oldest one's
+// spool time (from the filename timestamp)
+func scanSpool(spoolDir string) (count int, size int64, oldest time.Time, err error) {
 	entries, err := os.ReadDir(spoolDir)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil // Directory doesn't exist yet, that's fine
+			return 0, 0, time.Time{}, nil // Directory doesn't exist yet, that's fine
 		}
-		return err
+		return 0, 0, time.Time{}, err
 	}
 	for _, entry := range entries {
-		if info, err := entry.Info(); err == nil {
-			totalSize += info.Size()
+		if entry.IsDir() || !isSpoolFile(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue // Removed since ReadDir
+		}
+		count++
+		size += info.Size()
+		if t, err := spoolFileTime(entry.Name()); err == nil && (oldest.IsZero() || t.Before(oldest)) {
+			oldest = t
 		}
 	}
-	const maxSpoolSize = 100 * 1024 * 1024 // 100MB
-	if totalSize > maxSpoolSize {
-		return fmt.Errorf("spool directory too large: %d bytes (max %d bytes)", totalSize, maxSpoolSize)
+	return count, size, oldest, nil
+}
+
+// SpoolStats returns the number of spooled reports, their total size and when the oldest
+// was spooled (zero if none). It always rescans the spool directory.
+func SpoolStats() (count int, size int64, oldest time.Time, err error) {
+	spoolDir, err := getSpoolDir()
+	if err != nil {
+		return 0, 0, time.Time{}, err
+	}
+	count, size, oldest, err = scanSpool(spoolDir)
+	if err != nil {
+		return 0, 0, time.Time{}, fmt.Errorf("read spool dir: %w", err)
+	}
+
+	spoolUsage.mu.Lock()
+	spoolUsage.loaded, spoolUsage.count, spoolUsage.bytes = true, count, size
+	spoolUsage.mu.Unlock()
+	return count, size, oldest, nil
+}
+
+// SpoolNearFull reports whether size has reached 80% of the spool size cap
+func SpoolNearFull(size int64) bool {
+	return size >= SpoolMaxBytes()/10*8
+}
+
+// resetSpoolUsage makes the next checkSpoolSize rescan the spool (after reports were removed)
+func resetSpoolUsage() {
+	spoolUsage.mu.Lock()
+	spoolUsage.loaded = false
+	spoolUsage.mu.Unlock()
+}
+
+// checkSpoolSize checks if spool directory is within size limits
+func checkSpoolSize(spoolDir string) error {
+	spoolUsage.mu.Lock()
+	defer spoolUsage.mu.Unlock()
+	if !spoolUsage.loaded {
+		count, size, _, err := scanSpool(spoolDir)
+		if err != nil {
+			return err
+		}
+		spoolUsage.loaded, spoolUsage.count, spoolUsage.bytes = true, count, size
+	}
+	maxBytes := SpoolMaxBytes()
+	if spoolUsage.bytes > maxBytes {
+		return fmt.Errorf("spool directory too large: %d bytes (max %d bytes)", spoolUsage.bytes, maxBytes)
+	}
+	if SpoolNearFull(spoolUsage.bytes) {
+		logx.Printf("warning: report spool is nearly full: %s of %s", humanize.Bytes(spoolUsage.bytes), humanize.Bytes(maxBytes))
 	}
 	return nil
 }
 
+// trackSpooled adds a newly written spool file to the cached usage
+func trackSpooled(size int64) {
+	spoolUsage.mu.Lock()
+	if spoolUsage.loaded {
+		spoolUsage.count++
+		spoolUsage.bytes += size
+	}
+	spoolUsage.mu.Unlock()
+}
+
 // SpoolReport writes a report to the spool directory
 func SpoolReport(report Report) error {
 	spoolDir, err := getSpoolDir()
@@ -162,7 +434,7 @@ func SpoolReport(report Report) error {
 	}
 
 	// Check spool size before writing
-	if err := checkSpoolSize(); err != nil {
+	if err := checkSpoolSize(spoolDir); err != nil {
 		return fmt.Errorf("spool size check failed: %w", err)
 	}
 
@@ -187,39 +459,185 @@ func SpoolReport(report Report) error {
 		return s
 	}
 
-	// Generate filename: {unix_timestamp}-{job}-{status}.json
-	timestamp := time.Now().Unix()
-	filename := fmt.Sprintf("%d-%s-%s.json", timestamp, sanitize(report.Job), sanitize(report.Status))
+	// Generate filename: {unix_nanoseconds}-{random}-{job}-{status}.json.gz. The timestamp is
+	// zero-padded so filenames sort oldest first; the random part keeps reports spooled in the
+	// same instant (e.g. by parallel runs) from overwriting each other.
+	filename := fmt.Sprintf("%019d-%04x-%s-%s%s", time.Now().UnixNano(), rand.IntN(0x10000), sanitize(report.Job), sanitize(report.Status), spoolExtGzip)
 	targetPath := filepath.Join(spoolDir, filename)
 
-	jsonData, err := json.MarshalIndent(report, "", "  ")
+	jsonData, err := json.Marshal(report)
 	if err != nil {
 		return fmt.Errorf("marshal report: %w", err)
 	}
 
-	if err := os.WriteFile(targetPath, jsonData, 0o600); err != nil {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err := zw.Write(jsonData); err != nil {
+		return fmt.Errorf("compress report: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("compress report: %w", err)
+	}
+
+	if err := fsutil.WriteFileAtomic(targetPath, compressed.Bytes(), 0o600); err != nil {
 		return fmt.Errorf("write spool file: %w", err)
 	}
+	trackSpooled(int64(compressed.Len()))
+
+	// Keep at most maxPendingReports spooled within the size cap, evicting the oldest
+	if err := evictOldestReports(spoolDir, maxPendingReports, SpoolMaxBytes()); err != nil {
+		logx.Printf("warning: failed to evict old spooled reports: %v", err)
+	}
+
+	return nil
+}
+
+// SendReportBatch sends several reports in a single request as a JSON array.
+// The batch is accepted or rejected as a whole.
+func SendReportBatch(serverURL, deviceAPIKey string, reports []Report) error {
+	if serverURL == "" {
+		return fmt.Errorf("server URL is required")
+	}
+	if deviceAPIKey == "" {
+		return fmt.Errorf("device API key is required")
+	}
+	if len(reports) == 0 {
+		return nil
+	}
+	if len(reports) > maxPendingReports {
+		return fmt.Errorf("batch too large: %d reports (max %d)", len(reports), maxPendingReports)
+	}
+
+	// Validate server URL to prevent SSRF
+	if err := httpx.ValidateServerURL(serverURL); err != nil {
+		return fmt.Errorf("invalid server URL: %w", err)
+	}
+
+	batch := make([]Report, len(reports))
+	for i, report := range reports {
+		if report.Error != "" {
+			report.Error = truncateError(report.Error)
+		}
+		batch[i] = report
+	}
+
+	jsonData, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("marshal report batch: %w", err)
+	}
+
+	// Note: nginx proxies /control/* to the control plane backend
+	url := fmt.Sprintf("%s/control/v1/report/batch", serverURL)
+	return postJSON(url, deviceAPIKey, jsonData)
+}
+
+// evictOldestReports deletes the oldest spool files so that at most maxCount remain and they
+// total at most maxBytes (the newest report is always kept)
+func evictOldestReports(spoolDir string, maxCount int, maxBytes int64) error {
+	entries, err := os.ReadDir(spoolDir)
+	if err != nil {
+		return err
+	}
+
+	type spoolFile struct {
+		name string
+		size int64
+	}
+	var files []spoolFile
+	var total int64
+	for _, entry := range entries {
+		if entry.IsDir() || !isSpoolFile(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, spoolFile{entry.Name(), info.Size()})
+		total += info.Size()
+	}
+	if len(files) <= maxCount && total <= maxBytes {
+		return nil
+	}
+	defer resetSpoolUsage()
 
+	// Filenames start with the unix timestamp, so sorting puts the oldest first
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+	evicted := 0
+	for len(files) > 1 && (len(files) > maxCount || total > maxBytes) {
+		f := files[0]
+		files = files[1:]
+		if err := os.Remove(filepath.Join(spoolDir, f.name)); err != nil {
+			logx.Printf("warning: failed to evict spooled report %s: %v", f.name, err)
+			continue
+		}
+		total -= f.size
+		evicted++
+	}
+	if evicted > 0 {
+		logx.Printf("Evicted %d oldest spooled report(s) (max %d pending, %s)", evicted, maxCount, humanize.Bytes(maxBytes))
+	}
 	return nil
 }
 
+// spoolFileTime returns when a report was spooled, from its filename: unix nanoseconds
+// (19 digits) or, for files spooled by older agents, unix seconds
+func spoolFileTime(name string) (time.Time, error) {
+	prefix, _, ok := strings.Cut(name, "-")
+	if !ok {
+		return time.Time{}, fmt.Errorf("no timestamp prefix")
+	}
+	ts, err := strconv.ParseInt(prefix, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(prefix) >= 19 {
+		return time.Unix(0, ts), nil
+	}
+	return time.Unix(ts, 0), nil
+}
+
+// isSpoolFile reports whether name is a spooled report (gzip or legacy uncompressed)
+func isSpoolFile(name string) bool {
+	return strings.HasSuffix(name, spoolExtGzip) || strings.HasSuffix(name, spoolExtJSON)
+}
+
+// readSpoolFile reads a spooled report, decompressing .json.gz files
+func readSpoolFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if !strings.HasSuffix(path, spoolExtGzip) {
+		return io.ReadAll(f)
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("open gzip: %w", err)
+	}
+	defer zr.Close()
+	// Reports are small; cap decompressed size to guard against corrupt or hostile files
+	return io.ReadAll(io.LimitReader(zr, 1<<20))
+}
+
 // SendReportWithSpool attempts to send report immediately, spools if it fails
 func SendReportWithSpool(serverURL, deviceAPIKey string, report Report) error {
-	// Try to send immediately
-	err := SendReport(serverURL, deviceAPIKey, report)
+	// Try to send immediately, retrying transient failures
+	err := SendReportWithRetry(serverURL, deviceAPIKey, report, defaultRetryAttempts, defaultRetryDelay)
 	if err == nil {
 		return nil
 	}
 
 	// Send failed, spool it
-	log.Printf("warning: failed to send report to server: %v", err)
+	logx.Printf("warning: failed to send report to server: %v", err)
 	if spoolErr := SpoolReport(report); spoolErr != nil {
-		log.Printf("error: failed to spool report: %v", spoolErr)
+		logx.Printf("error: failed to spool report: %v", spoolErr)
 		return fmt.Errorf("send failed and spool failed: send=%v, spool=%v", err, spoolErr)
 	}
 
-	log.Printf("Report spooled for retry: %s/%s", report.Job, report.Status)
+	logx.Printf("Report spooled for retry: %s/%s", report.Job, report.Status)
 	return err // Return original send error (non-blocking)
 }
 
@@ -238,10 +656,10 @@ func LoadPendingReports(maxCount int) ([]Report, []string, error) {
 		return nil, nil, fmt.Errorf("read spool dir: %w", err)
 	}
 
-	// Filter JSON files and sort by filename (oldest first)
+	// Filter spool files (.json.gz and legacy .json) and sort by filename (oldest first)
 	var files []string
 	for _, entry := range entries {
-		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+		if !entry.IsDir() && isSpoolFile(entry.Name()) {
 			files = append(files, entry.Name())
 		}
 	}
@@ -259,15 +677,15 @@ func LoadPendingReports(maxCount int) ([]Report, []string, error) {
 	var filenames []string
 	for _, filename := range files {
 		targetPath := filepath.Join(spoolDir, filename)
-		data, err := os.ReadFile(targetPath)
+		data, err := readSpoolFile(targetPath)
 		if err != nil {
-			log.Printf("warning: failed to read spooled report %s: %v", filename, err)
+			logx.Printf("warning: failed to read spooled report %s: %v", filename, err)
 			continue
 		}
 
 		var report Report
 		if err := json.Unmarshal(data, &report); err != nil {
-			log.Printf("warning: failed to parse spooled report %s: %v", filename, err)
+			logx.Printf("warning: failed to parse spooled report %s: %v", filename, err)
 			continue
 		}
 
@@ -285,9 +703,9 @@ func DeleteSpooledReport(filename string) error {
 		strings.Contains(filename, "..") || filepath.IsAbs(filename) {
 		return fmt.Errorf("invalid filename: %s", filename)
 	}
-	// Ensure it's a JSON file
-	if !strings.HasSuffix(filename, ".json") {
-		return fmt.Errorf("invalid filename: must be .json file")
+	// Ensure it's a spool file
+	if !isSpoolFile(filename) {
+		return fmt.Errorf("invalid filename: must be .json or .json.gz file")
 	}
 
 	spoolDir, err := getSpoolDir()
@@ -311,12 +729,14 @@ func DeleteSpooledReport(filename string) error {
 	if err := os.Remove(targetPath); err != nil {
 		return fmt.Errorf("delete spool file: %w", err)
 	}
+	resetSpoolUsage()
 
 	return nil
 }
 
-// CleanupOldReports removes reports older than maxAge
+// CleanupOldReports removes reports older than maxAge (0 = the configured SpoolMaxAge)
 func CleanupOldReports(maxAge time.Duration) error {
+	maxAge = cmp.Or(maxAge, SpoolMaxAge())
 	spoolDir, err := getSpoolDir()
 	if err != nil {
 		return fmt.Errorf("get spool dir: %w", err)
@@ -334,27 +754,19 @@ func CleanupOldReports(maxAge time.Duration) error {
 	deleted := 0
 
 	for _, entry := range entries {
-		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
-			continue
-		}
-
-		// Extract timestamp from filename: {timestamp}-{job}-{status}.json
-		parts := strings.Split(entry.Name(), "-")
-		if len(parts) < 2 {
+		if entry.IsDir() || !isSpoolFile(entry.Name()) {
 			continue
 		}
 
-		timestamp, err := strconv.ParseInt(parts[0], 10, 64)
+		fileTime, err := spoolFileTime(entry.Name())
 		if err != nil {
-			log.Printf("warning: invalid timestamp in spool file %s: %v", entry.Name(), err)
+			logx.Printf("warning: invalid timestamp in spool file %s: %v", entry.Name(), err)
 			continue
 		}
-
-		fileTime := time.Unix(timestamp, 0)
 		if fileTime.Before(cutoff) {
 			targetPath := filepath.Join(spoolDir, entry.Name())
 			if err := os.Remove(targetPath); err != nil {
-				log.Printf("warning: failed to delete old report %s: %v", entry.Name(), err)
+				logx.Printf("warning: failed to delete old report %s: %v", entry.Name(), err)
 			} else {
 				deleted++
 			}
@@ -362,55 +774,110 @@ func CleanupOldReports(maxAge time.Duration) error {
 	}
 
 	if deleted > 0 {
-		log.Printf("Cleaned up %d old reports (older than %v)", deleted, maxAge)
+		resetSpoolUsage()
+		logx.Printf("Cleaned up %d old reports (older than %v)", deleted, maxAge)
 	}
 
 	return nil
 }
 
-// SendPendingReports sends pending reports from spool directory
-func SendPendingReports(serverURL, deviceAPIKey string, maxCount int) error {
+// SendPendingReports sends pending reports from spool directory. If the server has no batch
+// route they are sent one by one by up to workers parallel requests (0 = DefaultReportWorkers).
+// It returns how many reports the server accepted and how many failed (and stay spooled).
+func SendPendingReports(serverURL, deviceAPIKey string, maxCount, workers int) (sent, failed int, err error) {
 	if serverURL == "" || deviceAPIKey == "" {
 		// Can't send reports without server URL or API key
-		return nil
+		return 0, 0, nil
+	}
+
+	// Never send more than one batch worth of reports per call
+	if maxCount > maxPendingReports {
+		maxCount = maxPendingReports
 	}
 
 	reports, filenames, err := LoadPendingReports(maxCount)
 	if err != nil {
-		return fmt.Errorf("load pending reports: %w", err)
+		return 0, 0, fmt.Errorf("load pending reports: %w", err)
 	}
 
 	if len(reports) == 0 {
-		return nil
+		return 0, 0, nil
 	}
 
-	log.Printf("Sending %d pending report(s)...", len(reports))
+	logx.Printf("Sending %d pending report(s)...", len(reports))
 
-	successCount := 0
-	for i, report := range reports {
-		// Rate limit: wait 100ms between reports to avoid flooding server
-		if i > 0 {
-			time.Sleep(100 * time.Millisecond)
-		}
-
-		err := SendReport(serverURL, deviceAPIKey, report)
-		if err != nil {
-			log.Printf("warning: failed to send pending report %s/%s: %v", report.Job, report.Status, err)
-			// Continue with next report
-			continue
+	// Prefer a single batch request; fall back to one-by-one if the server lacks the batch route
+	err = SendReportBatch(serverURL, deviceAPIKey, reports)
+	if err == nil {
+		successCount := 0
+		for _, filename := range filenames {
+			if err := DeleteSpooledReport(filename); err != nil {
+				logx.Printf("warning: failed to delete spooled report %s: %v", filename, err)
+			} else {
+				successCount++
+			}
 		}
+		logx.Printf("Successfully sent %d pending report(s) in batch", successCount)
+		return len(reports), 0, nil
+	}
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		logx.Printf("warning: failed to send pending reports in batch: %v", err)
+		return 0, len(reports), nil
+	}
 
-		// Successfully sent, delete from spool
-		if err := DeleteSpooledReport(filenames[i]); err != nil {
-			log.Printf("warning: failed to delete spooled report %s: %v", filenames[i], err)
-		} else {
-			successCount++
-		}
+	sent, failed = sendEach(reports, filenames, workers, func(report Report) error {
+		return SendReport(serverURL, deviceAPIKey, report)
+	})
+	if sent > 0 {
+		logx.Printf("Successfully sent %d pending report(s)", sent)
 	}
 
-	if successCount > 0 {
-		log.Printf("Successfully sent %d pending report(s)", successCount)
+	return sent, failed, nil
+}
+
+// sendEach sends reports one by one with send on a bounded pool of workers and deletes each
+// spool file only after its report was accepted, so failed reports stay spooled. Request starts
+// are paced by a shared ticker (reportSendInterval) rather than a sleep per report.
+// It returns how many reports were sent and how many failed.
+func sendEach(reports []Report, filenames []string, workers int, send func(Report) error) (sent, failed int) {
+	if workers <= 0 {
+		workers = DefaultReportWorkers
+	}
+	workers = min(workers, maxReportWorkers, len(reports))
+
+	ticker := time.NewTicker(reportSendInterval)
+	defer ticker.Stop()
+
+	jobs := make(chan int)
+	var (
+		wg          sync.WaitGroup
+		sentCount   atomic.Int32
+		failedCount atomic.Int32
+	)
+	for range workers {
+		wg.Go(func() {
+			for i := range jobs {
+				<-ticker.C
+				report := reports[i]
+				if err := send(report); err != nil {
+					logx.Printf("warning: failed to send pending report %s/%s: %v", report.Job, report.Status, err)
+					failedCount.Add(1)
+					continue
+				}
+				sentCount.Add(1)
+				// Each spool file belongs to exactly one job, so workers never delete the same file
+				if err := DeleteSpooledReport(filenames[i]); err != nil {
+					logx.Printf("warning: failed to delete spooled report %s: %v", filenames[i], err)
+				}
+			}
+		})
 	}
+	for i := range reports {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
 
-	return nil
+	return int(sentCount.Load()), int(failedCount.Load())
 }
@@ -0,0 +1,401 @@
+package report
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"xentz-agent/internal/httpx"
+	"xentz-agent/internal/state"
+)
+
+// statusServer answers report POSTs with the given statuses in turn (the last one repeats)
+func statusServer(t *testing.T, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		w.WriteHeader(statuses[min(n, len(statuses))-1])
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestWithRetryRecoversFromServerError(t *testing.T) {
+	srv, calls := statusServer(t, http.StatusInternalServerError, http.StatusOK)
+	err := withRetry("report", 3, time.Millisecond, func() error {
+		return postJSON(srv.URL+"/control/v1/report", "key", []byte(`{}`))
+	})
+	if err != nil {
+		t.Fatalf("withRetry: %v", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("server called %d times, want 2", got)
+	}
+}
+
+func TestWithRetryStopsOnUnauthorized(t *testing.T) {
+	srv, calls := statusServer(t, http.StatusUnauthorized)
+	err := withRetry("report", 3, time.Millisecond, func() error {
+		return postJSON(srv.URL+"/control/v1/report", "key", []byte(`{}`))
+	})
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("withRetry error = %v, want status 401", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("server called %d times, want 1", got)
+	}
+}
+
+func TestWithRetryStopsOnTLSError(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler()) // Not trusted by the default client
+	t.Cleanup(srv.Close)
+	sends := 0
+	err := withRetry("report", 3, time.Millisecond, func() error {
+		sends++
+		return postJSON(srv.URL+"/control/v1/report", "key", []byte(`{}`))
+	})
+	if !httpx.IsTLSError(err) {
+		t.Fatalf("withRetry error = %v, want a TLS error", err)
+	}
+	if sends != 1 {
+		t.Errorf("sent %d times, want 1", sends)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	urlErr := func(err error) error {
+		return fmt.Errorf("report request failed: %w", &url.Error{Op: "Post", URL: "https://example.com", Err: err})
+	}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"connection refused", urlErr(syscall.ECONNREFUSED), true},
+		{"500", &StatusError{StatusCode: http.StatusInternalServerError}, true},
+		{"503", &StatusError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"429", &StatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{"400", &StatusError{StatusCode: http.StatusBadRequest}, false},
+		{"401", &StatusError{StatusCode: http.StatusUnauthorized}, false},
+		{"403", &StatusError{StatusCode: http.StatusForbidden}, false},
+		{"unknown authority", urlErr(x509.UnknownAuthorityError{}), false},
+		{"pin mismatch", urlErr(httpx.ErrCertMismatch), false},
+		{"redirect refused", urlErr(fmt.Errorf("%w to http://127.0.0.1/: localhost not allowed", httpx.ErrRedirectRefused)), false},
+		{"other error", errors.New("marshal report: boom"), false},
+	}
+	for _, tt := range tests {
+		if got := isRetryable(tt.err); got != tt.want {
+			t.Errorf("%s: isRetryable(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+// useTempSpool points the spool directory at a fresh temporary home for the test
+func useTempSpool(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	resetSpoolUsage()
+	t.Cleanup(resetSpoolUsage)
+	spoolDir, err := getSpoolDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spoolDir
+}
+
+// spooledJobs returns the Job of every spooled report, oldest first
+func spooledJobs(t *testing.T) []string {
+	t.Helper()
+	reports, _, err := LoadPendingReports(1000)
+	if err != nil {
+		t.Fatalf("LoadPendingReports: %v", err)
+	}
+	var jobs []string
+	for _, r := range reports {
+		jobs = append(jobs, r.Job)
+	}
+	return jobs
+}
+
+func TestSpoolReportKeepsNewest(t *testing.T) {
+	useTempSpool(t)
+	var want []string
+	for i := range maxPendingReports + 5 {
+		job := fmt.Sprintf("job%02d", i)
+		if err := SpoolReport(Report{Job: job, Status: "success"}); err != nil {
+			t.Fatalf("SpoolReport %d: %v", i, err)
+		}
+		if i >= 5 {
+			want = append(want, job)
+		}
+	}
+	if got := spooledJobs(t); !slices.Equal(got, want) {
+		t.Errorf("spooled reports = %v, want the %d newest %v", got, maxPendingReports, want)
+	}
+}
+
+func TestEvictOldestReports(t *testing.T) {
+	spoolDir := t.TempDir()
+	names := []string{
+		"1700000000-backup-success.json", // Legacy: unix seconds, uncompressed
+		"1700000100000000000-0001-backup-success.json.gz",
+		"1700000200000000000-0002-retention-success.json.gz",
+		"1700000300000000000-0003-backup-error.json.gz",
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(spoolDir, name), make([]byte, 100), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(spoolDir, "notes.txt"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	remaining := func() []string {
+		entries, err := os.ReadDir(spoolDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, e := range entries {
+			if isSpoolFile(e.Name()) {
+				got = append(got, e.Name())
+			}
+		}
+		return got
+	}
+
+	// Count cap
+	if err := evictOldestReports(spoolDir, 3, 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	if got := remaining(); !slices.Equal(got, names[1:]) {
+		t.Errorf("after count cap: %v, want %v", got, names[1:])
+	}
+
+	// Size cap: 250 bytes keeps two files
+	if err := evictOldestReports(spoolDir, 10, 250); err != nil {
+		t.Fatal(err)
+	}
+	if got := remaining(); !slices.Equal(got, names[2:]) {
+		t.Errorf("after size cap: %v, want %v", got, names[2:])
+	}
+
+	// The newest report is kept even when it alone exceeds the cap
+	if err := evictOldestReports(spoolDir, 10, 10); err != nil {
+		t.Fatal(err)
+	}
+	if got := remaining(); !slices.Equal(got, names[3:]) {
+		t.Errorf("after tiny size cap: %v, want %v", got, names[3:])
+	}
+	if _, err := os.Stat(filepath.Join(spoolDir, "notes.txt")); err != nil {
+		t.Errorf("non-spool file removed: %v", err)
+	}
+}
+
+func TestSpoolReportSameSecond(t *testing.T) {
+	useTempSpool(t)
+	start := time.Now()
+	for _, job := range []string{"backup", "retention"} {
+		if err := SpoolReport(Report{Job: job, Status: "success"}); err != nil {
+			t.Fatalf("SpoolReport: %v", err)
+		}
+	}
+	if time.Since(start) >= time.Second {
+		t.Skip("spooling took a second or more")
+	}
+	if got := spooledJobs(t); !slices.Equal(got, []string{"backup", "retention"}) {
+		t.Errorf("spooled reports = %v, want both", got)
+	}
+}
+
+func TestSpoolReportIdenticalReports(t *testing.T) {
+	useTempSpool(t)
+	// The same job and status spooled twice (e.g. by parallel runs) must not share a filename
+	for range 2 {
+		if err := SpoolReport(Report{Job: "backup", Status: "error"}); err != nil {
+			t.Fatalf("SpoolReport: %v", err)
+		}
+	}
+	if got := spooledJobs(t); len(got) != 2 {
+		t.Errorf("spooled reports = %v, want 2", got)
+	}
+}
+
+func TestSpoolFileTime(t *testing.T) {
+	tests := []struct {
+		name string
+		want time.Time
+	}{
+		{"1700000000-backup-success.json", time.Unix(1700000000, 0)},
+		{"1700000000-retention-error.json.gz", time.Unix(1700000000, 0)},
+		{"1700000000123456789-00af-backup-success.json.gz", time.Unix(1700000000, 123456789)},
+		{"0000000000000000001-ffff-check-success.json.gz", time.Unix(0, 1)},
+	}
+	for _, tt := range tests {
+		got, err := spoolFileTime(tt.name)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("spoolFileTime(%q) = %v, %v; want %v", tt.name, got, err, tt.want)
+		}
+	}
+	for _, name := range []string{"backup-success.json", "nodash.json", "17e9-backup-success.json"} {
+		if _, err := spoolFileTime(name); err == nil {
+			t.Errorf("spoolFileTime(%q): want an error", name)
+		}
+	}
+}
+
+func TestLoadPendingReportsLegacyFile(t *testing.T) {
+	spoolDir := useTempSpool(t)
+	if err := os.MkdirAll(spoolDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	legacy := "1700000000-backup-success.json"
+	if err := os.WriteFile(filepath.Join(spoolDir, legacy), []byte(`{"job":"legacy","status":"success"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := SpoolReport(Report{Job: "new", Status: "success"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, filenames, err := LoadPendingReports(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filenames) != 2 || filenames[0] != legacy {
+		t.Errorf("filenames = %v, want the legacy file first", filenames)
+	}
+	if got := spooledJobs(t); !slices.Equal(got, []string{"legacy", "new"}) {
+		t.Errorf("spooled reports = %v", got)
+	}
+
+	// Old enough to be cleaned up by its legacy timestamp
+	if err := CleanupOldReports(24 * time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if got := spooledJobs(t); !slices.Equal(got, []string{"new"}) {
+		t.Errorf("after cleanup: %v, want [new]", got)
+	}
+}
+
+func TestSendEach(t *testing.T) {
+	useTempSpool(t)
+	failing := map[string]bool{"job2": true, "job5": true}
+	for i := range 8 {
+		if err := SpoolReport(Report{Job: fmt.Sprintf("job%d", i), Status: "success"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reports, filenames, err := LoadPendingReports(maxPendingReports)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Counting stub server: tracks requests in flight, fails the reports in failing
+	var calls, inFlight, maxInFlight atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(4 * reportSendInterval) // Slower than the pacing, so workers overlap
+		if failing[r.URL.Query().Get("job")] {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	const workers = 2
+	sent, failed := sendEach(reports, filenames, workers, func(report Report) error {
+		return postJSON(srv.URL+"/control/v1/report?job="+report.Job, "key", []byte(`{}`))
+	})
+	if sent != 6 || failed != 2 {
+		t.Errorf("sendEach = %d sent, %d failed; want 6, 2", sent, failed)
+	}
+	if got := calls.Load(); got != 8 {
+		t.Errorf("server called %d times, want 8", got)
+	}
+	if got := maxInFlight.Load(); got != workers {
+		t.Errorf("max requests in flight = %d, want %d", got, workers)
+	}
+	if got := spooledJobs(t); !slices.Equal(got, []string{"job2", "job5"}) {
+		t.Errorf("still spooled = %v, want the failed reports [job2 job5]", got)
+	}
+}
+
+func TestFromLastRun(t *testing.T) {
+	run := state.LastRun{
+		Status:         "success",
+		TimeUTC:        "2026-03-01T02:05:00Z",
+		StartedAt:      "2026-03-01T02:00:00Z",
+		FinishedAt:     "2026-03-01T02:05:00Z",
+		DurationMS:     300000,
+		FilesTotal:     1200,
+		BytesTotal:     5 << 30,
+		DataAddedBytes: 42 << 20,
+		SnapshotID:     "1a2b3c4d",
+	}
+	got := FromLastRun("backup", "dev-1", run)
+	want := Report{
+		DeviceID:       "dev-1",
+		Job:            "backup",
+		StartedAt:      "2026-03-01T02:00:00Z",
+		FinishedAt:     "2026-03-01T02:05:00Z",
+		Status:         "success",
+		DurationMS:     300000,
+		FilesTotal:     1200,
+		BytesTotal:     5 << 30,
+		DataAddedBytes: 42 << 20,
+		SnapshotID:     "1a2b3c4d",
+	}
+	if got != want {
+		t.Errorf("FromLastRun =\n%+v\nwant\n%+v", got, want)
+	}
+
+	tests := []struct {
+		run        state.LastRun
+		status     string
+		err        string
+		errorKind  string
+		errorCount int
+	}{
+		{state.LastRun{Status: "success"}, "success", "", "", 0},
+		{state.LastRun{Status: "degraded", ErrorsCount: 3, Error: "restic could not read 3 file(s)"}, "success", "restic could not read 3 file(s)", "", 3},
+		{state.LastRun{Status: "error", Error: "Fatal: wrong password", ErrorKind: "auth_failed"}, "failure", "Fatal: wrong password", "auth_failed", 0},
+		{state.LastRun{Status: "skipped", SkipReason: "on battery power"}, "skipped", "on battery power", "", 0},
+	}
+	for _, tt := range tests {
+		got := FromLastRun("backup", "dev-1", tt.run)
+		if got.Status != tt.status || got.Error != tt.err || got.ErrorKind != tt.errorKind || got.ErrorsCount != tt.errorCount {
+			t.Errorf("FromLastRun(%s) = status %q, error %q, kind %q, errors %d; want %q, %q, %q, %d",
+				tt.run.Status, got.Status, got.Error, got.ErrorKind, got.ErrorsCount, tt.status, tt.err, tt.errorKind, tt.errorCount)
+		}
+	}
+}
+
+func TestFromLastRunLegacyTimes(t *testing.T) {
+	// Recorded before LastRun had StartedAt/FinishedAt
+	run := state.LastRun{Status: "success", TimeUTC: "2026-03-01T02:05:00Z", DurationMS: 90000}
+	got := FromLastRun("backup", "dev-1", run)
+	if got.StartedAt != "2026-03-01T02:03:30Z" || got.FinishedAt != "2026-03-01T02:05:00Z" {
+		t.Errorf("FromLastRun times = %s - %s, want 2026-03-01T02:03:30Z - 2026-03-01T02:05:00Z", got.StartedAt, got.FinishedAt)
+	}
+}
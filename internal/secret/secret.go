@@ -0,0 +1,129 @@
+package secret
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Service is the keychain service name all agent secrets are stored under
+const Service = "xentz-agent"
+
+// ResticPasswordAccount is the keychain account holding the restic repository password
+const ResticPasswordAccount = "restic-password"
+
+// ErrNotFound is returned by Get when no secret is stored for the account
+var ErrNotFound = errors.New("secret not found")
+
+// Store is a backend that saves and loads named secrets
+type Store interface {
+	Set(account, secret string) error
+	Get(account string) (string, error)
+	Delete(account string) error
+}
+
+// Keychain returns the OS credential store: macOS Keychain, Windows Credential Manager,
+// or libsecret (via secret-tool) on Linux. It returns an error if none is available.
+func Keychain() (Store, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		if _, err := exec.LookPath("security"); err != nil {
+			return nil, fmt.Errorf("macOS keychain unavailable: security command not found")
+		}
+		return macKeychain{}, nil
+	case "windows":
+		return newWindowsCredentialStore()
+	case "linux":
+		if _, err := exec.LookPath("secret-tool"); err != nil {
+			return nil, fmt.Errorf("libsecret unavailable: secret-tool not found (install libsecret-tools)")
+		}
+		return libsecretStore{}, nil
+	default:
+		return nil, fmt.Errorf("keychain not supported on %s", runtime.GOOS)
+	}
+}
+
+// macKeychain stores secrets as generic passwords in the login keychain
+type macKeychain struct{}
+
+func (macKeychain) Set(account, secret string) error {
+	// Use interactive mode so the secret is passed on stdin, not visible in the process list
+	quote := func(s string) string {
+		s = strings.ReplaceAll(s, `\`, `\\`)
+		return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+	}
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n",
+		quote(Service), quote(account), quote(secret)))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("keychain store: %w\noutput: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func (macKeychain) Get(account string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("security", "find-generic-password", "-s", Service, "-a", account, "-w")
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		// security exits 44 when the item doesn't exist
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 44 {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("keychain lookup: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+func (macKeychain) Delete(account string) error {
+	cmd := exec.Command("security", "delete-generic-password", "-s", Service, "-a", account)
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 44 {
+			return nil
+		}
+		return fmt.Errorf("keychain delete: %w", err)
+	}
+	return nil
+}
+
+// libsecretStore stores secrets through the freedesktop Secret Service (GNOME Keyring, KWallet)
+type libsecretStore struct{}
+
+func (libsecretStore) Set(account, secret string) error {
+	// secret-tool reads the secret from stdin
+	cmd := exec.Command("secret-tool", "store", "--label=xentz-agent "+account, "service", Service, "account", account)
+	cmd.Stdin = strings.NewReader(secret)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("secret-tool store: %w\noutput: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func (libsecretStore) Get(account string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("secret-tool", "lookup", "service", Service, "account", account)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		// secret-tool exits 1 with no output when nothing matches
+		if len(out) == 0 && stderr.Len() == 0 {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("secret-tool lookup: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+func (libsecretStore) Delete(account string) error {
+	cmd := exec.Command("secret-tool", "clear", "service", Service, "account", account)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("secret-tool clear: %w\noutput: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
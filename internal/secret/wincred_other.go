@@ -0,0 +1,9 @@
+//go:build !windows
+
+package secret
+
+import "fmt"
+
+func newWindowsCredentialStore() (Store, error) {
+	return nil, fmt.Errorf("Windows Credential Manager is only available on Windows")
+}
@@ -0,0 +1,114 @@
+package secret
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+	errorNotFound           = syscall.Errno(1168)
+)
+
+var (
+	advapi32       = syscall.NewLazyDLL("advapi32.dll")
+	procCredWriteW = advapi32.NewProc("CredWriteW")
+	procCredReadW  = advapi32.NewProc("CredReadW")
+	procCredDelete = advapi32.NewProc("CredDeleteW")
+	procCredFree   = advapi32.NewProc("CredFree")
+)
+
+// credential mirrors the Win32 CREDENTIALW structure
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// windowsCredentialStore stores secrets as generic credentials in Windows Credential Manager
+type windowsCredentialStore struct{}
+
+func newWindowsCredentialStore() (Store, error) {
+	if err := procCredReadW.Find(); err != nil {
+		return nil, fmt.Errorf("Windows Credential Manager unavailable: %w", err)
+	}
+	return windowsCredentialStore{}, nil
+}
+
+func credentialTarget(account string) (*uint16, error) {
+	return syscall.UTF16PtrFromString(Service + ":" + account)
+}
+
+func (windowsCredentialStore) Set(account, secret string) error {
+	target, err := credentialTarget(account)
+	if err != nil {
+		return err
+	}
+	user, err := syscall.UTF16PtrFromString(account)
+	if err != nil {
+		return err
+	}
+	blob := []byte(secret)
+	cred := credential{
+		Type:               credTypeGeneric,
+		TargetName:         target,
+		CredentialBlobSize: uint32(len(blob)),
+		Persist:            credPersistLocalMachine,
+		UserName:           user,
+	}
+	if len(blob) > 0 {
+		cred.CredentialBlob = &blob[0]
+	}
+	if ret, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0); ret == 0 {
+		return fmt.Errorf("credential manager store: %w", err)
+	}
+	return nil
+}
+
+func (windowsCredentialStore) Get(account string) (string, error) {
+	target, err := credentialTarget(account)
+	if err != nil {
+		return "", err
+	}
+	var pcred *credential
+	ret, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&pcred)))
+	if ret == 0 {
+		if errors.Is(err, errorNotFound) {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("credential manager lookup: %w", err)
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(pcred)))
+
+	if pcred.CredentialBlobSize == 0 {
+		return "", nil
+	}
+	blob := unsafe.Slice(pcred.CredentialBlob, pcred.CredentialBlobSize)
+	return string(blob), nil
+}
+
+func (windowsCredentialStore) Delete(account string) error {
+	target, err := credentialTarget(account)
+	if err != nil {
+		return err
+	}
+	if ret, _, err := procCredDelete.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0); ret == 0 {
+		if errors.Is(err, errorNotFound) {
+			return nil
+		}
+		return fmt.Errorf("credential manager delete: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrLocked is returned by Lock when another agent run holds the run lock
+var ErrLocked = errors.New("another xentz-agent run is in progress")
+
+// staleRunLockAge is when a run lock is assumed to be left by a crashed run.
+// It exceeds the longest run timeout (backup: 6h).
+const staleRunLockAge = 8 * time.Hour
+
+func (s *Store) runLockPath() string {
+	return filepath.Join(s.dir, "run.lock")
+}
+
+// Lock takes the agent-wide run lock so backup and retention runs never overlap.
+// The returned function releases it. Returns ErrLocked if another run holds it.
+func (s *Store) Lock() (func(), error) {
+	path := s.runLockPath()
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			fmt.Fprintf(f, "%d %s\n", os.Getpid(), time.Now().UTC().Format(time.RFC3339))
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("create run lock: %w", err)
+		}
+		info, statErr := os.Stat(path)
+		if statErr != nil || time.Since(info.ModTime()) < staleRunLockAge {
+			return nil, ErrLocked
+		}
+		// Left by a run that crashed or was killed
+		os.Remove(path)
+	}
+	return nil, ErrLocked
+}
+
+// WaitLock is Lock, but waits up to timeout for another run to finish first
+func (s *Store) WaitLock(timeout time.Duration) (func(), error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		unlock, err := s.Lock()
+		if !errors.Is(err, ErrLocked) || time.Now().After(deadline) {
+			return unlock, err
+		}
+		time.Sleep(10 * time.Second)
+	}
+}
@@ -0,0 +1,78 @@
+package state
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"xentz-agent/internal/fsutil"
+)
+
+// MetricsPath is the default location of the Prometheus textfile written after each run
+func (s *Store) MetricsPath() string {
+	return filepath.Join(s.dir, "metrics.prom")
+}
+
+// WriteMetrics writes the last backup and retention results to path in the Prometheus
+// text exposition format, for node_exporter's textfile collector. The file is replaced
+// atomically so a scrape never sees a partial write.
+func (s *Store) WriteMetrics(path string) error {
+	var b strings.Builder
+
+	last, ok, err := s.LoadLastRun()
+	if err != nil {
+		return err
+	}
+	if ok {
+		writeGauge(&b, "xentz_backup_last_run_timestamp", "Unix time of the last backup run.", runTimestamp(last))
+		writeGauge(&b, "xentz_backup_last_status", "Status of the last backup run (1 = success or skipped, 0 = failure).", statusValue(last))
+		writeGauge(&b, "xentz_backup_duration_seconds", "Duration of the last backup run in seconds.", float64(last.DurationMS)/1000)
+		writeGauge(&b, "xentz_backup_bytes_added", "Bytes added to the repository by the last backup run.", float64(last.DataAddedBytes))
+		writeGauge(&b, "xentz_backup_files_total", "Files processed by the last backup run.", float64(last.FilesTotal))
+	}
+
+	success, ok, err := s.LoadLastSuccess()
+	if err != nil {
+		return err
+	}
+	if ok {
+		writeGauge(&b, "xentz_backup_last_success_timestamp", "Unix time of the last successful backup run.", runTimestamp(success))
+	}
+
+	retention, ok, err := s.LoadLastRetentionRun()
+	if err != nil {
+		return err
+	}
+	if ok {
+		writeGauge(&b, "xentz_retention_last_run_timestamp", "Unix time of the last retention run.", runTimestamp(retention))
+		writeGauge(&b, "xentz_retention_last_status", "Status of the last retention run (1 = success, 0 = failure).", statusValue(retention))
+		writeGauge(&b, "xentz_retention_duration_seconds", "Duration of the last retention run in seconds.", float64(retention.DurationMS)/1000)
+	}
+
+	if err := fsutil.WriteFileAtomic(path, []byte(b.String()), 0o644); err != nil {
+		return fmt.Errorf("write metrics: %w", err)
+	}
+	return nil
+}
+
+func writeGauge(b *strings.Builder, name, help string, value float64) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", name, help, name, name, strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+func runTimestamp(r LastRun) float64 {
+	t, err := time.Parse(time.RFC3339, r.TimeUTC)
+	if err != nil {
+		return 0
+	}
+	return float64(t.Unix())
+}
+
+// statusValue is 1 unless the run failed; a skipped backup (metered, on battery) is not an alert
+func statusValue(r LastRun) float64 {
+	if r.Status == "success" || r.Status == "skipped" {
+		return 1
+	}
+	return 0
+}
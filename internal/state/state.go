@@ -6,19 +6,29 @@ import (
 	"os"
 	"path/filepath"
 	"time"
+
+	"xentz-agent/internal/fsutil"
 )
 
 type LastRun struct {
-	Status        string `json:"status"` // success|error
-	TimeUTC       string `json:"time_utc"`
-	Duration      string `json:"duration"`
-	DurationMS    int64  `json:"duration_ms,omitempty"`    // Duration in milliseconds
-	BytesSent     int64  `json:"bytes_sent"`
-	FilesTotal    int64  `json:"files_total,omitempty"`    // Total files processed
-	BytesTotal    int64  `json:"bytes_total,omitempty"`    // Total bytes processed (logical size)
-	DataAddedBytes int64 `json:"data_added_bytes,omitempty"` // Data actually added/uploaded
-	SnapshotID    string `json:"snapshot_id,omitempty"`     // Restic snapshot ID
-	Error         string `json:"error,omitempty"`
+	Status         string   `json:"status"`                // success|degraded|error|skipped
+	TimeUTC        string   `json:"time_utc"`              // When the run finished (same as FinishedAt, kept for compatibility)
+	StartedAt      string   `json:"started_at,omitempty"`  // RFC3339 UTC
+	FinishedAt     string   `json:"finished_at,omitempty"` // RFC3339 UTC
+	Duration       string   `json:"duration"`
+	DurationMS     int64    `json:"duration_ms,omitempty"` // Duration in milliseconds
+	BytesSent      int64    `json:"bytes_sent"`
+	FilesTotal     int64    `json:"files_total,omitempty"`      // Total files processed
+	BytesTotal     int64    `json:"bytes_total,omitempty"`      // Total bytes processed (logical size)
+	DataAddedBytes int64    `json:"data_added_bytes,omitempty"` // Data actually added/uploaded
+	SnapshotID     string   `json:"snapshot_id,omitempty"`      // Restic snapshot ID
+	SkippedPaths   []string `json:"skipped_paths,omitempty"`    // Include paths that did not exist and were skipped
+	Attempts       int      `json:"attempts,omitempty"`         // restic backup invocations, including retries
+	ErrorsCount    int      `json:"errors_count,omitempty"`     // Files restic could not read (permission denied etc.)
+	ErrorSample    []string `json:"error_sample,omitempty"`     // The first few of those errors, truncated
+	SkipReason     string   `json:"skip_reason,omitempty"`      // Why a "skipped" run did not back up
+	Error          string   `json:"error,omitempty"`
+	ErrorKind      string   `json:"error_kind,omitempty"` // Why an "error" run failed (backup.ErrorKind)
 }
 
 type Store struct {
@@ -41,16 +51,36 @@ func (s *Store) lastRunPath() string {
 	return filepath.Join(s.dir, "last_run.json")
 }
 
+func (s *Store) lastSuccessPath() string {
+	return filepath.Join(s.dir, "last_success.json")
+}
+
+// SaveLastRun records r as the last backup run (and as the last success if it succeeded)
 func (s *Store) SaveLastRun(r LastRun) error {
 	b, err := json.MarshalIndent(r, "", "  ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(s.lastRunPath(), b, 0o600)
+	if r.Status == "success" {
+		if err := fsutil.WriteFileAtomic(s.lastSuccessPath(), b, 0o600); err != nil {
+			return err
+		}
+	}
+	return fsutil.WriteFileAtomic(s.lastRunPath(), b, 0o600)
 }
 
 func (s *Store) LoadLastRun() (LastRun, bool, error) {
-	b, err := os.ReadFile(s.lastRunPath())
+	return s.loadRun(s.lastRunPath())
+}
+
+// LoadLastSuccess returns the most recent successful backup run
+func (s *Store) LoadLastSuccess() (LastRun, bool, error) {
+	return s.loadRun(s.lastSuccessPath())
+}
+
+// loadRun reads a saved LastRun; ok is false if the file doesn't exist yet
+func (s *Store) loadRun(path string) (LastRun, bool, error) {
+	b, err := os.ReadFile(path)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			return LastRun{}, false, nil
@@ -64,39 +94,48 @@ func (s *Store) LoadLastRun() (LastRun, bool, error) {
 	return r, true, nil
 }
 
-func NewLastRunSuccess(d time.Duration, bytes int64) LastRun {
+// newLastRun returns a LastRun for a run that started at start and finished now
+func newLastRun(status string, start time.Time) LastRun {
+	finished := time.Now()
+	d := finished.Sub(start)
 	return LastRun{
-		Status:     "success",
-		TimeUTC:    time.Now().UTC().Format(time.RFC3339),
+		Status:     status,
+		TimeUTC:    finished.UTC().Format(time.RFC3339),
+		StartedAt:  start.UTC().Format(time.RFC3339),
+		FinishedAt: finished.UTC().Format(time.RFC3339),
 		Duration:   d.String(),
 		DurationMS: d.Milliseconds(),
-		BytesSent:  bytes,
 	}
 }
 
-func NewLastRunSuccessWithStats(d time.Duration, filesTotal, bytesTotal, dataAddedBytes int64, snapshotID string) LastRun {
-	return LastRun{
-		Status:         "success",
-		TimeUTC:        time.Now().UTC().Format(time.RFC3339),
-		Duration:       d.String(),
-		DurationMS:     d.Milliseconds(),
-		FilesTotal:     filesTotal,
-		BytesTotal:     bytesTotal,
-		DataAddedBytes: dataAddedBytes,
-		SnapshotID:     snapshotID,
-		BytesSent:      dataAddedBytes, // For backward compatibility
-	}
+func NewLastRunSuccess(start time.Time, bytes int64) LastRun {
+	r := newLastRun("success", start)
+	r.BytesSent = bytes
+	return r
 }
 
-func NewLastRunError(d time.Duration, bytes int64, msg string) LastRun {
-	return LastRun{
-		Status:    "error",
-		TimeUTC:   time.Now().UTC().Format(time.RFC3339),
-		Duration:  d.String(),
-		DurationMS: d.Milliseconds(),
-		BytesSent: bytes,
-		Error:     msg,
-	}
+func NewLastRunSuccessWithStats(start time.Time, filesTotal, bytesTotal, dataAddedBytes int64, snapshotID string) LastRun {
+	r := newLastRun("success", start)
+	r.FilesTotal = filesTotal
+	r.BytesTotal = bytesTotal
+	r.DataAddedBytes = dataAddedBytes
+	r.SnapshotID = snapshotID
+	r.BytesSent = dataAddedBytes // For backward compatibility
+	return r
+}
+
+func NewLastRunError(start time.Time, bytes int64, msg string) LastRun {
+	r := newLastRun("error", start)
+	r.BytesSent = bytes
+	r.Error = msg
+	return r
+}
+
+// NewLastRunSkipped returns the result of a backup that was not attempted, e.g. on a metered connection
+func NewLastRunSkipped(start time.Time, reason string) LastRun {
+	r := newLastRun("skipped", start)
+	r.SkipReason = reason
+	return r
 }
 
 func (s *Store) lastRetentionPath() string {
@@ -108,20 +147,25 @@ func (s *Store) SaveLastRetentionRun(r LastRun) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(s.lastRetentionPath(), b, 0o600)
+	return fsutil.WriteFileAtomic(s.lastRetentionPath(), b, 0o600)
 }
 
 func (s *Store) LoadLastRetentionRun() (LastRun, bool, error) {
-	b, err := os.ReadFile(s.lastRetentionPath())
+	return s.loadRun(s.lastRetentionPath())
+}
+func (s *Store) lastCheckPath() string {
+	return filepath.Join(s.dir, "last_check.json")
+}
+
+// SaveLastCheckRun records r as the last repository check (`xentz-agent run` with run_check)
+func (s *Store) SaveLastCheckRun(r LastRun) error {
+	b, err := json.MarshalIndent(r, "", "  ")
 	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return LastRun{}, false, nil
-		}
-		return LastRun{}, false, err
-	}
-	var r LastRun
-	if err := json.Unmarshal(b, &r); err != nil {
-		return LastRun{}, false, err
+		return err
 	}
-	return r, true, nil
-}
\ No newline at end of file
+	return fsutil.WriteFileAtomic(s.lastCheckPath(), b, 0o600)
+}
+
+func (s *Store) LoadLastCheckRun() (LastRun, bool, error) {
+	return s.loadRun(s.lastCheckPath())
+}
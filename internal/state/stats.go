@@ -0,0 +1,51 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"xentz-agent/internal/fsutil"
+)
+
+// RepoStats is the output of `restic stats --json` for one mode, with when it was taken
+type RepoStats struct {
+	Mode                  string  `json:"mode"`
+	TimeUTC               string  `json:"time_utc"`
+	TotalSize             int64   `json:"total_size"`
+	TotalFileCount        int64   `json:"total_file_count,omitempty"`
+	SnapshotsCount        int     `json:"snapshots_count"`
+	TotalUncompressedSize int64   `json:"total_uncompressed_size,omitempty"` // raw-data mode only
+	CompressionRatio      float64 `json:"compression_ratio,omitempty"`       // raw-data mode only
+	TotalBlobCount        int64   `json:"total_blob_count,omitempty"`        // raw-data mode only
+}
+
+func (s *Store) repoStatsPath(mode string) string {
+	return filepath.Join(s.dir, "repo_stats_"+mode+".json")
+}
+
+// SaveRepoStats caches r, one file per stats mode
+func (s *Store) SaveRepoStats(r RepoStats) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(s.repoStatsPath(r.Mode), b, 0o600)
+}
+
+// LoadRepoStats returns the cached stats for mode; ok is false if none were saved yet
+func (s *Store) LoadRepoStats(mode string) (RepoStats, bool, error) {
+	b, err := os.ReadFile(s.repoStatsPath(mode))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return RepoStats{}, false, nil
+		}
+		return RepoStats{}, false, err
+	}
+	var r RepoStats
+	if err := json.Unmarshal(b, &r); err != nil {
+		return RepoStats{}, false, err
+	}
+	return r, true, nil
+}
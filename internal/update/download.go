@@ -0,0 +1,122 @@
+package update
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Download retry policy: attempts in total, with the delay doubling after each failure
+const (
+	downloadAttempts = 4
+	downloadDelay    = 2 * time.Second
+)
+
+// downloadFile downloads url to dest. Data goes to dest+".part" and is renamed into place only
+// when complete; network errors are retried, resuming with a Range request when the server
+// supports it.
+func downloadFile(ctx context.Context, url, dest string) error {
+	partPath := dest + ".part"
+	defer os.Remove(partPath)
+
+	delay := downloadDelay
+	var err error
+	for attempt := 1; attempt <= downloadAttempts; attempt++ {
+		var retry bool
+		retry, err = downloadAttempt(ctx, url, partPath)
+		if err == nil {
+			return os.Rename(partPath, dest)
+		}
+		if !retry || attempt == downloadAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	return err
+}
+
+// downloadAttempt continues downloading url into partPath from its current size.
+// It reports whether a failure is worth retrying.
+func downloadAttempt(ctx context.Context, url, partPath string) (retry bool, err error) {
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		flags |= os.O_APPEND
+	case resp.StatusCode == http.StatusOK:
+		// Range not supported (or first attempt): start over
+		flags |= os.O_TRUNC
+		offset = 0
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// The partial file is unusable; drop it and start over on the next attempt
+		os.Remove(partPath)
+		return true, fmt.Errorf("status %d", resp.StatusCode)
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return true, fmt.Errorf("status %d", resp.StatusCode)
+	default:
+		return false, fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	out, err := os.OpenFile(partPath, flags, 0o600)
+	if err != nil {
+		return false, err
+	}
+	defer out.Close()
+
+	n, err := io.Copy(out, resp.Body)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return true, fmt.Errorf("incomplete download: got %d of %d bytes", offset+n, offset+resp.ContentLength)
+	}
+	return false, out.Close()
+}
+
+// fetchSmall downloads a small file (checksums, signatures) into memory; errNotFound on 404
+func fetchSmall(ctx context.Context, url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
@@ -0,0 +1,126 @@
+package update
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+const (
+	releasesAPI  = "https://api.github.com/repos/arope28/xentz-agent/releases/latest"
+	releasesBase = "https://github.com/arope28/xentz-agent/releases"
+)
+
+// LatestVersion returns the tag of the latest GitHub release (e.g. "v1.4.0")
+func LatestVersion(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, releasesAPI, nil)
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("check latest release: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("check latest release: status %d", resp.StatusCode)
+	}
+
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return "", fmt.Errorf("decode release: %w", err)
+	}
+	if release.TagName == "" {
+		return "", fmt.Errorf("latest release has no tag")
+	}
+	return release.TagName, nil
+}
+
+// AssetName returns the release binary name for the current platform, as built by build.sh
+func AssetName() string {
+	switch {
+	case runtime.GOOS == "windows":
+		return fmt.Sprintf("xentz-agent-windows-%s.exe", runtime.GOARCH)
+	case runtime.GOOS == "linux" && runtime.GOARCH == "arm":
+		return "xentz-agent-linux-armv7"
+	default:
+		return fmt.Sprintf("xentz-agent-%s-%s", runtime.GOOS, runtime.GOARCH)
+	}
+}
+
+// releaseFileURL returns the download URL of a file attached to the release tagged tag
+func releaseFileURL(tag, name string) string {
+	return fmt.Sprintf("%s/download/%s/%s", releasesBase, tag, name)
+}
+
+// Options control how Apply verifies the downloaded binary
+type Options struct {
+	// Skip the release signature check (checksums are still verified)
+	SkipSignature bool
+}
+
+// Apply downloads the release binary tagged tag, verifies it and replaces the executable at exePath
+func Apply(ctx context.Context, tag, exePath string, opts Options) error {
+	asset := AssetName()
+	dir := filepath.Dir(exePath)
+
+	// Download next to the executable so the final rename stays on one filesystem
+	tmp, err := os.CreateTemp(dir, ".xentz-agent-update-*")
+	if err != nil {
+		return fmt.Errorf("create temp file in %s: %w", dir, err)
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpPath)
+
+	if err := downloadFile(ctx, releaseFileURL(tag, asset), tmpPath); err != nil {
+		return fmt.Errorf("download %s: %w", asset, err)
+	}
+	if err := verifyRelease(ctx, tag, asset, tmpPath, !opts.SkipSignature); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, 0o755); err != nil {
+		return err
+	}
+	return replaceExecutable(exePath, tmpPath)
+}
+
+// replaceExecutable atomically moves newPath over exePath. Windows can't overwrite a running
+// executable but can rename it, so the old binary is moved aside first (and removed by
+// CleanupOld on a later run).
+func replaceExecutable(exePath, newPath string) error {
+	if runtime.GOOS == "windows" {
+		oldPath := exePath + ".old"
+		_ = os.Remove(oldPath)
+		if err := os.Rename(exePath, oldPath); err != nil {
+			return fmt.Errorf("move running binary aside: %w", err)
+		}
+		if err := os.Rename(newPath, exePath); err != nil {
+			// Put the old binary back so the agent keeps working
+			_ = os.Rename(oldPath, exePath)
+			return fmt.Errorf("install new binary: %w", err)
+		}
+		return nil
+	}
+	if err := os.Rename(newPath, exePath); err != nil {
+		return fmt.Errorf("install new binary: %w", err)
+	}
+	return nil
+}
+
+// CleanupOld removes a binary left behind by a previous Windows update, if any
+func CleanupOld(exePath string) {
+	_ = os.Remove(exePath + ".old")
+}
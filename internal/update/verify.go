@@ -0,0 +1,144 @@
+package update
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Release checksums (sha256sum format) and their minisign signature, as published by build.sh
+const (
+	checksumsFile = "SHA256SUMS"
+	signatureFile = checksumsFile + ".minisig"
+)
+
+// PublicKey is the minisign public key (base64, second line of minisign.pub) release checksums
+// must be signed with. Set at build time:
+//
+//	go build -ldflags="-X xentz-agent/internal/update.PublicKey=RWQ..." ./cmd/xentz-agent
+var PublicKey = ""
+
+var (
+	ErrSignatureMissing = errors.New("signature file missing")
+	ErrSignatureInvalid = errors.New("signature invalid")
+
+	errNotFound = errors.New("not found")
+)
+
+// verifyRelease checks the sha256 of path against the release's SHA256SUMS entry for asset,
+// after verifying the SHA256SUMS signature when checkSignature is set
+func verifyRelease(ctx context.Context, tag, asset, path string, checkSignature bool) error {
+	sums, err := fetchSmall(ctx, releaseFileURL(tag, checksumsFile))
+	if err != nil {
+		return fmt.Errorf("download %s: %w", checksumsFile, err)
+	}
+
+	if checkSignature {
+		sig, err := fetchSmall(ctx, releaseFileURL(tag, signatureFile))
+		if errors.Is(err, errNotFound) {
+			return fmt.Errorf("%s: %w", signatureFile, ErrSignatureMissing)
+		}
+		if err != nil {
+			return fmt.Errorf("download %s: %w", signatureFile, err)
+		}
+		if err := verifyMinisign(PublicKey, sums, sig); err != nil {
+			return fmt.Errorf("%s: %w", signatureFile, err)
+		}
+	}
+
+	expected, ok := lookupChecksum(string(sums), asset)
+	if !ok {
+		return fmt.Errorf("%s has no entry for %s", checksumsFile, asset)
+	}
+	actual, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+	if len(expected) != sha256.Size*2 || !strings.EqualFold(expected, actual) {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", asset, expected, actual)
+	}
+	return nil
+}
+
+// verifyMinisign checks a minisign signature of data. Only legacy (non-prehashed, "Ed")
+// signatures are supported, since prehashed ones need BLAKE2b from outside the standard library.
+// Problems with the signature itself wrap ErrSignatureInvalid.
+func verifyMinisign(publicKey string, data, sigFile []byte) error {
+	if publicKey == "" {
+		return fmt.Errorf("%w: this agent was built without a release public key", ErrSignatureInvalid)
+	}
+	pk, err := base64.StdEncoding.DecodeString(strings.TrimSpace(publicKey))
+	if err != nil || len(pk) != 2+8+ed25519.PublicKeySize || string(pk[:2]) != "Ed" {
+		return fmt.Errorf("malformed release public key")
+	}
+	keyID, key := pk[2:10], ed25519.PublicKey(pk[10:])
+
+	// untrusted comment, signature, trusted comment, global signature
+	lines := strings.Split(strings.ReplaceAll(string(sigFile), "\r\n", "\n"), "\n")
+	if len(lines) < 4 {
+		return fmt.Errorf("%w: malformed signature file", ErrSignatureInvalid)
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(sig) != 2+8+ed25519.SignatureSize {
+		return fmt.Errorf("%w: malformed signature", ErrSignatureInvalid)
+	}
+	switch string(sig[:2]) {
+	case "Ed":
+	case "ED":
+		return fmt.Errorf("%w: prehashed signatures are not supported (sign with minisign -l)", ErrSignatureInvalid)
+	default:
+		return fmt.Errorf("%w: unknown signature algorithm", ErrSignatureInvalid)
+	}
+	if !bytes.Equal(sig[2:10], keyID) {
+		return fmt.Errorf("%w: signed with a different key", ErrSignatureInvalid)
+	}
+	if !ed25519.Verify(key, data, sig[10:]) {
+		return ErrSignatureInvalid
+	}
+
+	trusted, ok := strings.CutPrefix(lines[2], "trusted comment: ")
+	if !ok {
+		return fmt.Errorf("%w: missing trusted comment", ErrSignatureInvalid)
+	}
+	globalSig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil || !ed25519.Verify(key, append(append([]byte{}, sig[10:]...), trusted...), globalSig) {
+		return fmt.Errorf("%w: trusted comment signature", ErrSignatureInvalid)
+	}
+	return nil
+}
+
+// lookupChecksum returns the hex digest for name from sha256sum output
+// ("<hex>  <name>", or "<hex> *<name>" for binary mode)
+func lookupChecksum(sums, name string) (string, bool) {
+	scanner := bufio.NewScanner(strings.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return fields[0], true
+		}
+	}
+	return "", false
+}
+
+// fileSHA256 returns the hex-encoded sha256 of the file at path
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
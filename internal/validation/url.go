@@ -1,15 +1,32 @@
 package validation
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/url"
+	"strings"
+	"time"
 )
 
+// Cloud instance metadata endpoints (AWS/GCP/Azure/OpenStack IPv4, AWS IPv6).
+// The IPv4 one is link-local and caught by checkIP anyway; listing both keeps the intent explicit.
+var metadataIPs = []net.IP{
+	net.ParseIP("169.254.169.254"),
+	net.ParseIP("fd00:ec2::254"),
+}
+
+// resolveTimeout bounds the DNS lookup done by ValidateResolvedServerURL
+const resolveTimeout = 5 * time.Second
+
+// lookupIP resolves hostnames for ValidateResolvedServerURL (replaced in tests)
+var lookupIP = net.DefaultResolver.LookupIP
+
 // ValidateServerURL validates server URL to prevent SSRF attacks.
 // It ensures:
 // - Only http/https schemes are allowed
-// - localhost is blocked (127.0.0.1, ::1, localhost)
+// - localhost is blocked (localhost, *.localhost and loopback IPs such as 127.0.0.1 and ::1)
+// - Link-local (169.254.0.0/16, fe80::/10), unspecified (0.0.0.0, ::) and cloud metadata IPs are blocked
 // - Private RFC1918 IPs are allowed (for legitimate internal control plane deployments)
 //
 // Rationale for allowing private IPs:
@@ -27,9 +44,68 @@ func ValidateServerURL(serverURL string) error {
 		return fmt.Errorf("only http/https schemes allowed")
 	}
 	// Block localhost to prevent SSRF (private IPs allowed for legitimate internal servers)
-	host := parsed.Hostname()
-	if host == "localhost" || host == "127.0.0.1" || host == "::1" {
+	host := strings.ToLower(strings.TrimSuffix(parsed.Hostname(), "."))
+	if host == "" {
+		return fmt.Errorf("missing host")
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("localhost not allowed (SSRF protection)")
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return checkIP(ip)
+	}
+	return nil
+}
+
+// checkIP rejects addresses that are never a legitimate control plane
+func checkIP(ip net.IP) error {
+	for _, metadataIP := range metadataIPs {
+		if ip.Equal(metadataIP) {
+			return fmt.Errorf("cloud metadata address not allowed (SSRF protection): %s", ip)
+		}
+	}
+	switch {
+	case ip.IsLoopback():
 		return fmt.Errorf("localhost not allowed (SSRF protection)")
+	case ip.IsUnspecified():
+		return fmt.Errorf("unspecified address not allowed (SSRF protection): %s", ip)
+	case ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast():
+		return fmt.Errorf("link-local address not allowed (SSRF protection): %s", ip)
+	}
+	return nil
+}
+
+// ValidateResolvedServerURL runs ValidateServerURL (or ValidateServerURLStrict when strict is set),
+// then resolves the hostname and applies the same IP checks to every address it resolves to.
+// This catches names pointing at loopback or metadata addresses, at the cost of a DNS lookup.
+func ValidateResolvedServerURL(serverURL string, strict bool) error {
+	validate := ValidateServerURL
+	if strict {
+		validate = ValidateServerURLStrict
+	}
+	if err := validate(serverURL); err != nil {
+		return err
+	}
+
+	parsed, _ := url.Parse(serverURL) // Already validated above
+	host := parsed.Hostname()
+	if net.ParseIP(host) != nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+	ips, err := lookupIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("resolve %s: %w", host, err)
+	}
+	for _, ip := range ips {
+		if err := checkIP(ip); err != nil {
+			return fmt.Errorf("%s resolves to %s: %w", host, ip, err)
+		}
+		if strict && ip.IsPrivate() {
+			return fmt.Errorf("%s resolves to private IP address %s (strict SSRF protection)", host, ip)
+		}
 	}
 	return nil
 }
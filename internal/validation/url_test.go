@@ -0,0 +1,96 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestValidateServerURL(t *testing.T) {
+	tests := []struct {
+		url    string
+		ok     bool
+		strict bool // Result of ValidateServerURLStrict
+	}{
+		{"https://control.example.com", true, true},
+		{"https://control.example.com.:8443/base", true, true},
+		{"http://10.0.0.5:8080", true, false},
+		{"http://192.168.1.20", true, false},
+		{"https://[2001:db8::1]:443", true, true},
+		{"https://93.184.216.34", true, true},
+
+		{"ftp://control.example.com", false, false},
+		{"file:///etc/passwd", false, false},
+		{"https://", false, false},
+		{"http://localhost:8080", false, false},
+		{"http://LOCALHOST.", false, false},
+		{"http://api.localhost", false, false},
+		{"http://127.0.0.1", false, false},
+		{"http://127.1.2.3", false, false},
+		{"http://[::1]", false, false},
+		{"http://[::ffff:127.0.0.1]", false, false},
+		{"http://0.0.0.0", false, false},
+		{"http://[::]", false, false},
+		{"http://169.254.169.254/latest/meta-data/", false, false},
+		{"http://169.254.1.1", false, false},
+		{"http://[fd00:ec2::254]", false, false},
+		{"http://[fe80::1]", false, false},
+	}
+	for _, tt := range tests {
+		if err := ValidateServerURL(tt.url); (err == nil) != tt.ok {
+			t.Errorf("ValidateServerURL(%q) = %v, want ok=%v", tt.url, err, tt.ok)
+		}
+		if err := ValidateServerURLStrict(tt.url); (err == nil) != tt.strict {
+			t.Errorf("ValidateServerURLStrict(%q) = %v, want ok=%v", tt.url, err, tt.strict)
+		}
+	}
+}
+
+func TestValidateResolvedServerURL(t *testing.T) {
+	hosts := map[string][]string{
+		"public.example.com":   {"93.184.216.34", "2606:2800:220:1:248:1893:25c8:1946"},
+		"internal.example.com": {"10.0.0.5"},
+		"loopback.example.com": {"93.184.216.34", "127.0.0.1"},
+		"mapped.example.com":   {"::ffff:127.0.0.1"},
+		"metadata.example.com": {"fd00:ec2::254"},
+		"any.example.com":      {"::"},
+	}
+	orig := lookupIP
+	t.Cleanup(func() { lookupIP = orig })
+	lookupIP = func(_ context.Context, _, host string) ([]net.IP, error) {
+		addrs, ok := hosts[host]
+		if !ok {
+			return nil, fmt.Errorf("lookup %s: no such host", host)
+		}
+		var ips []net.IP
+		for _, a := range addrs {
+			ips = append(ips, net.ParseIP(a))
+		}
+		return ips, nil
+	}
+
+	tests := []struct {
+		url        string
+		ok, strict bool
+	}{
+		{"https://public.example.com", true, true},
+		{"https://internal.example.com", true, false},
+		{"https://loopback.example.com", false, false},
+		{"https://mapped.example.com", false, false},
+		{"https://metadata.example.com", false, false},
+		{"https://any.example.com", false, false},
+		{"https://missing.example.com", false, false},
+		{"https://localhost", false, false}, // Rejected before resolving
+		{"https://10.0.0.5", true, false},   // IPs are not resolved
+		{"https://127.0.0.1", false, false},
+	}
+	for _, tt := range tests {
+		if err := ValidateResolvedServerURL(tt.url, false); (err == nil) != tt.ok {
+			t.Errorf("ValidateResolvedServerURL(%q, false) = %v, want ok=%v", tt.url, err, tt.ok)
+		}
+		if err := ValidateResolvedServerURL(tt.url, true); (err == nil) != tt.strict {
+			t.Errorf("ValidateResolvedServerURL(%q, true) = %v, want ok=%v", tt.url, err, tt.strict)
+		}
+	}
+}
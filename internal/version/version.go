@@ -0,0 +1,60 @@
+package version
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is the agent version, set at build time:
+//
+//	go build -ldflags="-X xentz-agent/internal/version.Version=1.2.3" ./cmd/xentz-agent
+var Version = "dev"
+
+// IsRelease reports whether v is a MAJOR.MINOR.PATCH release version (optionally "v"-prefixed)
+func IsRelease(v string) bool {
+	_, err := parse(v)
+	return err == nil
+}
+
+// Compare compares two release versions such as "1.2.3" or "v1.2.3", returning -1, 0 or +1.
+// Pre-release/build suffixes ("-rc1", "+abc") are ignored.
+func Compare(a, b string) (int, error) {
+	pa, err := parse(a)
+	if err != nil {
+		return 0, err
+	}
+	pb, err := parse(b)
+	if err != nil {
+		return 0, err
+	}
+	for i := range pa {
+		switch {
+		case pa[i] < pb[i]:
+			return -1, nil
+		case pa[i] > pb[i]:
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func parse(v string) ([3]int, error) {
+	var out [3]int
+	s := strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return out, fmt.Errorf("invalid version %q: expected MAJOR.MINOR.PATCH", v)
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return out, fmt.Errorf("invalid version %q: expected MAJOR.MINOR.PATCH", v)
+		}
+		out[i] = n
+	}
+	return out, nil
+}